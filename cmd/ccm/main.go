@@ -8,6 +8,7 @@ package main
 import (
 	"fmt"
 	"github.com/vmware/cloud-provider-for-cloud-director/pkg/ccm"
+	vcdconfig "github.com/vmware/cloud-provider-for-cloud-director/pkg/config"
 	"github.com/vmware/cloud-provider-for-cloud-director/version"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apiserver/pkg/server/healthz"
@@ -36,6 +37,10 @@ func main() {
 
 	rand.Seed(time.Now().UnixNano())
 
+	if len(os.Args) > 1 && os.Args[1] == validateConfigCommand {
+		os.Exit(runValidateConfig(os.Args[2:]))
+	}
+
 	opts, err := options.NewCloudControllerManagerOptions()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to construct options: %v\n", err)
@@ -43,12 +48,25 @@ func main() {
 	}
 	opts.KubeCloudShared.CloudProvider.Name = ccm.ProviderName
 	opts.Authentication.SkipInClusterLookup = true
+	// out of a cluster, the kube client is configured by the --kubeconfig flag or the KUBECONFIG environment variable
+	opts.Kubeconfig = os.Getenv("KUBECONFIG")
+
+	// fields of the cloud config can be overridden by flags, which take precedence over environment variables
+	// and the cloud config file
+	additionalFlags := flag.NamedFlagSets{}
+	vcdFlags := additionalFlags.FlagSet("vmware cloud director")
+	for _, overrideFlag := range vcdconfig.DefaultLoader.Flags() {
+		vcdFlags.Var(overrideFlag, overrideFlag.Name, overrideFlag.Usage)
+		if overrideFlag.IsBoolFlag() {
+			vcdFlags.Lookup(overrideFlag.Name).NoOptDefVal = "true"
+		}
+	}
 
 	command := app.NewCloudControllerManagerCommand(
 		opts,
 		vcdCCMInitializer,
 		app.DefaultInitFuncConstructors,
-		flag.NamedFlagSets{},
+		additionalFlags,
 		wait.NeverStop,
 	)
 
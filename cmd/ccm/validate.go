@@ -0,0 +1,115 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/ccm"
+	vcdconfig "github.com/vmware/cloud-provider-for-cloud-director/pkg/config"
+)
+
+const (
+	// validateConfigCommand is the subcommand that checks a cloud config before a rollout
+	validateConfigCommand = "validate-config"
+)
+
+// runValidateConfig runs the validate-config subcommand with args and returns the exit code
+func runValidateConfig(args []string) int {
+	flagSet := flag.NewFlagSet(validateConfigCommand, flag.ContinueOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), `Usage: %s %s --cloud-config <file> [--check-connectivity [--auth-dir <dir>]]
+
+Validate the cloud config and report all problems that are found. Environment variables such as VCLOUD_HOST and
+flags such as --vcloud-host override the cloud config file. With --check-connectivity the credentials are read
+from the authorization directory and the VCD objects used by the cloud provider are read to check connectivity
+and permissions.
+
+`, os.Args[0], validateConfigCommand)
+		flagSet.PrintDefaults()
+	}
+	cloudConfigPath := flagSet.String("cloud-config", "", "path to the cloud config file")
+	authDir := flagSet.String("auth-dir", vcdconfig.DefaultAuthorizationDir,
+		"directory holding the VCD credentials; only used with --check-connectivity")
+	checkConnectivity := flagSet.Bool("check-connectivity", false,
+		"connect to VCD and check that the configured objects can be read")
+	printConfig := flagSet.Bool("print-config", false,
+		"print the effective config, with secrets redacted, after environment variables and flags are applied")
+	for _, overrideFlag := range vcdconfig.DefaultLoader.Flags() {
+		flagSet.Var(overrideFlag, overrideFlag.Name, overrideFlag.Usage)
+	}
+	if err := flagSet.Parse(args); err != nil {
+		return 2
+	}
+	if *cloudConfigPath == "" {
+		fmt.Fprintf(os.Stderr, "--cloud-config is required\n")
+		flagSet.Usage()
+		return 2
+	}
+
+	if err := validateConfig(os.Stdout, *cloudConfigPath, *authDir, *checkConnectivity, *printConfig); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+func validateConfig(out io.Writer, cloudConfigPath string, authDir string, checkConnectivity bool,
+	printConfig bool) error {
+
+	configFile, err := os.Open(cloudConfigPath)
+	if err != nil {
+		return fmt.Errorf("unable to open cloud config file [%s]: [%v]", cloudConfigPath, err)
+	}
+	cloudConfig, err := vcdconfig.DefaultLoader.Load(configFile)
+	_ = configFile.Close()
+	if err != nil {
+		return fmt.Errorf("unable to load cloud config file [%s]: [%v]", cloudConfigPath, err)
+	}
+	if printConfig {
+		if err = vcdconfig.WriteEffectiveConfig(out, cloudConfig); err != nil {
+			return fmt.Errorf("unable to print effective config: [%v]", err)
+		}
+	}
+
+	fieldErrs := vcdconfig.ValidateCloudConfigFields(cloudConfig)
+	for _, fieldErr := range fieldErrs {
+		fmt.Fprintf(out, "invalid config: %v\n", fieldErr)
+	}
+	if len(fieldErrs) > 0 {
+		return fmt.Errorf("found [%d] problems in cloud config file [%s]", len(fieldErrs), cloudConfigPath)
+	}
+	fmt.Fprintf(out, "Cloud config file [%s] is valid\n", cloudConfigPath)
+
+	if !checkConnectivity {
+		return nil
+	}
+
+	if err = vcdconfig.SetAuthorizationFromDir(cloudConfig, authDir); err != nil {
+		return fmt.Errorf("unable to set authorization from [%s]: [%v]", authDir, err)
+	}
+	vcdClient, err := ccm.NewVCDClientFromConfig(cloudConfig)
+	if err != nil {
+		return fmt.Errorf("unable to connect to VCD [%s]: [%v]", cloudConfig.VCD.Host, err)
+	}
+	fmt.Fprintf(out, "Connected to VCD [%s] with api version [%s]\n", cloudConfig.VCD.Host, vcdClient.APIVersion())
+
+	accessErrs := vcdClient.CheckAccess(context.Background())
+	for _, accessErr := range accessErrs {
+		fmt.Fprintf(out, "access check failed: %v\n", accessErr)
+	}
+	if len(accessErrs) > 0 {
+		return fmt.Errorf("found [%d] problems accessing VCD [%s]", len(accessErrs), cloudConfig.VCD.Host)
+	}
+	fmt.Fprintf(out, "All objects used by the cloud provider can be read in VCD [%s]\n", cloudConfig.VCD.Host)
+
+	return nil
+}
@@ -3,8 +3,6 @@
    SPDX-License-Identifier: Apache-2.0
 */
 
-// +build !testing
-
 package ccm
 
 import (
@@ -12,10 +10,17 @@ import (
 	"github.com/vmware/cloud-provider-for-cloud-director/pkg/config"
 	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient"
 	"io"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
 	_ "k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 	cloudProvider "k8s.io/cloud-provider"
 	"k8s.io/klog"
+	"os"
+	"strings"
 	"time"
 )
 
@@ -26,9 +31,11 @@ const (
 
 // VCDCloudProvider - contains all of the interfaces for our cloud provider
 type VCDCloudProvider struct {
-	vcdClient *vcdclient.Client
-	lb        cloudProvider.LoadBalancer
-	instances cloudProvider.Instances
+	vcdClient      *vcdclient.Client
+	lb             cloudProvider.LoadBalancer
+	instances      *instances
+	vmInfoCache    *VmInfoCache
+	configReloader *configReloader
 }
 
 var _ cloudProvider.Interface = &VCDCloudProvider{}
@@ -37,13 +44,129 @@ func init() {
 	cloudProvider.RegisterCloudProvider(ProviderName, newVCDCloudProvider)
 }
 
+func newOneArm(oneArm *config.OneArm) *vcdclient.OneArm {
+	if oneArm == nil {
+		return nil
+	}
+	return &vcdclient.OneArm{
+		StartIPAddress: oneArm.StartIP,
+		EndIPAddress:   oneArm.EndIP,
+	}
+}
+
+// NewClientOptionsFromConfig : returns the options of the client for the VCD described by a validated
+// cloudConfig that carries credentials
+func NewClientOptionsFromConfig(cloudConfig *config.CloudConfig) (*vcdclient.ClientOptions, error) {
+	vAppSelectorTerms, err := cloudConfig.VCD.VAppName.Parse()
+	if err != nil {
+		return nil, fmt.Errorf("invalid vAppName [%v]: [%v]", cloudConfig.VCD.VAppName, err)
+	}
+
+	oneArm := newOneArm(cloudConfig.LB.OneArm)
+	lbTargets := []vcdclient.LBTarget{
+		{
+			Name:               vcdclient.DefaultLBTargetName,
+			NetworkName:        cloudConfig.VCD.VDCNetwork,
+			IPAMSubnet:         cloudConfig.VCD.VIPSubnet,
+			OneArm:             oneArm,
+			ServiceEngineGroup: cloudConfig.LB.ServiceEngineGroup,
+		},
+	}
+	for _, target := range cloudConfig.LB.Targets {
+		lbTargets = append(lbTargets, vcdclient.LBTarget{
+			Name:               target.Name,
+			NetworkName:        target.Network,
+			IPAMSubnet:         target.VIPSubnet,
+			OneArm:             newOneArm(target.OneArm),
+			ServiceEngineGroup: target.ServiceEngineGroup,
+		})
+	}
+
+	return &vcdclient.ClientOptions{
+		Host:         cloudConfig.VCD.Host,
+		OrgName:      cloudConfig.VCD.Org,
+		VDCName:      cloudConfig.VCD.VDC,
+		NetworkName:  cloudConfig.VCD.VDCNetwork,
+		IPAMSubnet:   cloudConfig.VCD.VIPSubnet,
+		UserOrg:      cloudConfig.VCD.UserOrg,
+		User:         cloudConfig.VCD.User,
+		Password:     cloudConfig.VCD.Secret,
+		RefreshToken: cloudConfig.VCD.RefreshToken,
+		VMSelector: vcdclient.VMSelector{
+			VAppNames:     vAppSelectorTerms.Names,
+			VAppGlobs:     vAppSelectorTerms.Globs,
+			VAppRegexps:   vAppSelectorTerms.Regexps,
+			MetadataKey:   vAppSelectorTerms.MetadataKey,
+			MetadataValue: vAppSelectorTerms.MetadataValue,
+		},
+		TLS: vcdclient.TLSConfig{
+			Insecure:           cloudConfig.VCD.Insecure,
+			CACertFile:         cloudConfig.VCD.CACertFile,
+			CACert:             cloudConfig.VCD.CACert,
+			PinnedCertificates: cloudConfig.VCD.PinnedCertificates,
+		},
+		Proxy: vcdclient.ProxyConfig{
+			URL:      cloudConfig.VCD.Proxy.URL,
+			NoProxy:  cloudConfig.VCD.Proxy.NoProxy,
+			Username: cloudConfig.VCD.Proxy.Username,
+			Password: cloudConfig.VCD.Proxy.Password,
+		},
+		APIVersion: vcdclient.APIVersionConfig{
+			Min: cloudConfig.VCD.APIVersion.Min,
+			Max: cloudConfig.VCD.APIVersion.Max,
+		},
+		ClusterID:        cloudConfig.ClusterID,
+		OneArm:           oneArm,
+		LBTargets:        lbTargets,
+		DefaultLBTarget:  cloudConfig.LB.DefaultTarget,
+		HTTPPort:         cloudConfig.LB.Ports.HTTP,
+		HTTPSPort:        cloudConfig.LB.Ports.HTTPS,
+		CertificateAlias: cloudConfig.LB.CertificateAlias,
+		TaskTimeouts: vcdclient.TaskTimeouts{
+			Create: cloudConfig.VCD.TaskTimeouts.Create,
+			Update: cloudConfig.VCD.TaskTimeouts.Update,
+			Delete: cloudConfig.VCD.TaskTimeouts.Delete,
+		},
+		Retry: vcdclient.RetryConfig{
+			MaxAttempts:    cloudConfig.VCD.Retry.MaxAttempts,
+			InitialBackoff: cloudConfig.VCD.Retry.InitialBackoff,
+			MaxBackoff:     cloudConfig.VCD.Retry.MaxBackoff,
+		},
+		TokenLifetime: cloudConfig.VCD.TokenLifetime,
+		GetVDCClient:  true,
+	}, nil
+}
+
+// NewVCDClientFromConfig : creates a client for the VCD described by a validated cloudConfig that carries
+// credentials
+func NewVCDClientFromConfig(cloudConfig *config.CloudConfig) (*vcdclient.Client, error) {
+	opts, err := NewClientOptionsFromConfig(cloudConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return vcdclient.NewClient(opts)
+}
+
 func newVCDCloudProvider(configReader io.Reader) (cloudProvider.Interface, error) {
 	var vcdClient *vcdclient.Client = nil
-	var oneArm *vcdclient.OneArm = nil
 	var cloudConfig *config.CloudConfig = nil
-	cloudConfig, err := config.ParseCloudConfig(configReader)
+	cloudConfig, err := config.DefaultLoader.Load(configReader)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse config: [%v]", err)
+		return nil, fmt.Errorf("unable to load config: [%v]", err)
+	}
+	parsedConfig := *cloudConfig
+	effectiveConfig := &strings.Builder{}
+	if err = config.WriteEffectiveConfig(effectiveConfig, cloudConfig); err != nil {
+		klog.Errorf("unable to print effective config: [%v]", err)
+	} else {
+		klog.Infof("Effective cloud config:\n%s", effectiveConfig.String())
+	}
+
+	// the cloud config is passed as the opened file, which tells us what to watch for changes
+	cloudConfigPath := ""
+	if configFile, ok := configReader.(*os.File); ok {
+		cloudConfigPath = configFile.Name()
 	}
 	for {
 		err = config.SetAuthorization(cloudConfig)
@@ -60,31 +183,7 @@ func newVCDCloudProvider(configReader io.Reader) (cloudProvider.Interface, error
 			continue
 		}
 
-		if cloudConfig.LB.OneArm != nil {
-			oneArm = &vcdclient.OneArm{
-				StartIPAddress: cloudConfig.LB.OneArm.StartIP,
-				EndIPAddress:   cloudConfig.LB.OneArm.EndIP,
-			}
-		}
-		vcdClient, err = vcdclient.NewVCDClientFromSecrets(
-			cloudConfig.VCD.Host,
-			cloudConfig.VCD.Org,
-			cloudConfig.VCD.VDC,
-			cloudConfig.VCD.VAppName,
-			cloudConfig.VCD.VDCNetwork,
-			cloudConfig.VCD.VIPSubnet,
-			cloudConfig.VCD.UserOrg,
-			cloudConfig.VCD.User,
-			cloudConfig.VCD.Secret,
-			cloudConfig.VCD.RefreshToken,
-			true,
-			cloudConfig.ClusterID,
-			oneArm,
-			cloudConfig.LB.Ports.HTTP,
-			cloudConfig.LB.Ports.HTTPS,
-			cloudConfig.LB.CertificateAlias,
-			true,
-		)
+		vcdClient, err = NewVCDClientFromConfig(cloudConfig)
 		if err == nil {
 			break
 		}
@@ -93,32 +192,90 @@ func newVCDCloudProvider(configReader io.Reader) (cloudProvider.Interface, error
 		time.Sleep(10 * time.Second)
 	}
 
-	// setup LB only if the gateway is not NSX-T
-	var lb cloudProvider.LoadBalancer = nil
-	if !vcdClient.IsNSXTBackedGateway() {
-		klog.Infof("Gateway of network [%s] not backed by NSX-T. Hence LB will not be initialized.",
-			cloudConfig.VCD.VDCNetwork)
-	} else {
-		lb = newLoadBalancer(vcdClient)
-	}
-
-	// cache for VM Info with an refresh of elements needed after 1 minute
-	vmInfoCache := newVmInfoCache(vcdClient, time.Minute)
+	// cache for VM Info, refreshed in the background. Entries are fetched again on demand once two refreshes
+	// have been missed.
+	vmInfoCache := newVmInfoCache(vcdClient.VMInventory(), 2*cloudConfig.VMCache.RefreshInterval+cloudConfig.VMCache.RefreshJitter,
+		cloudConfig.VMCache.RefreshInterval, cloudConfig.VMCache.RefreshJitter, cloudConfig.Node)
 
 	return &VCDCloudProvider{
-		vcdClient: vcdClient,
-		lb:        lb,
-		instances: newInstances(vmInfoCache),
+		vcdClient:   vcdClient,
+		instances:   newInstances(vmInfoCache, cloudConfig.Shutdown),
+		vmInfoCache: vmInfoCache,
+		configReloader: newConfigReloader(vcdClient, cloudConfigPath, config.DefaultAuthorizationDir,
+			parsedConfig, *cloudConfig),
 	}, nil
 }
 
-// Initialize - starts the cloud-provider controller
+// Initialize - starts the cloud-provider controller. The kube clients come from clientBuilder, which uses the
+// in-cluster config or the kubeconfig passed to the controller manager.
 func (vcdCP *VCDCloudProvider) Initialize(clientBuilder cloudProvider.ControllerClientBuilder, stop <-chan struct{}) {
 	clientSet := clientBuilder.ClientOrDie("do-shared-informers")
 	sharedInformer := informers.NewSharedInformerFactory(clientSet, 0)
+	nodeInformer := sharedInformer.Core().V1().Nodes()
+
+	// the systemUUID node lookup reads the system UUIDs that kubelets report from the node cache
+	vcdCP.vmInfoCache.setNodeLister(nodeInformer.Lister())
+
+	// explain with node events why nodes are or are not shut down
+	if err := nodeInformer.Informer().AddIndexers(cache.Indexers{
+		nodeProviderIDIndex: nodeProviderIDIndexFunc,
+	}); err != nil {
+		klog.Errorf("Unable to index nodes by provider ID; vm states will not be reported: [%v]", err)
+	} else {
+		eventBroadcaster := record.NewBroadcaster()
+		eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientSet.CoreV1().Events("")})
+		recorder := eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: ProviderName})
+		vcdCP.instances.statusReporter = newVMStatusReporter(recorder, nodeInformer.Informer().GetIndexer())
+	}
+
+	// setup LB only if the gateway is NSX-T. Pool members are computed from the node, service and endpoint slice
+	// caches, and pools are updated when nodes or endpoints change.
+	var lb *LBManager = nil
+	if !vcdCP.vcdClient.IsNSXTBackedGateway() {
+		klog.Infof("Gateway of the cluster network is not backed by NSX-T. Hence LB will not be initialized.")
+	} else {
+		serviceInformer := sharedInformer.Core().V1().Services()
+		endpointSliceInformer := sharedInformer.Discovery().V1().EndpointSlices()
+		lb = newLoadBalancer(vcdCP.vcdClient, vcdCP.vcdClient.RDEStore(), vcdCP.vcdClient.ClusterID,
+			vcdCP.vcdClient.CertificateAlias, nodeInformer.Lister(), serviceInformer.Lister(),
+			endpointSliceInformer.Lister())
+		lb.registerEventHandlers(nodeInformer.Informer(), endpointSliceInformer.Informer())
+		vcdCP.lb = lb
+	}
+
+	// apply VM metadata to node labels and taints only if a prefix is configured
+	var nodeMetadata *nodeMetadataSyncer = nil
+	nodeConfig := vcdCP.vmInfoCache.nodeConfig
+	if nodeConfig.LabelMetadataPrefix != "" || nodeConfig.TaintMetadataPrefix != "" {
+		nodeMetadata = newNodeMetadataSyncer(vcdCP.vcdClient.VMMetadata(), vcdCP.vmInfoCache, clientSet, nodeInformer.Lister(),
+			nodeConfig)
+	}
+
+	// write the identity of nodes to VM metadata only if a prefix is configured
+	var nodeIdentity *nodeIdentitySyncer = nil
+	if nodeConfig.IdentityMetadataPrefix != "" {
+		nodeIdentity = newNodeIdentitySyncer(vcdCP.vcdClient.VMMetadata(), vcdCP.vmInfoCache, nodeInformer.Lister(),
+			vcdCP.vcdClient.ClusterID, nodeConfig.IdentityMetadataDomain, nodeConfig.IdentityMetadataPrefix,
+			nodeConfig.MetadataSyncInterval)
+		nodeIdentity.registerEventHandlers(nodeInformer.Informer())
+	}
+
+	sharedInformer.Start(stop)
+	sharedInformer.WaitForCacheSync(stop)
+	if lb != nil {
+		go lb.runPoolSync(stop)
+	}
+	if nodeMetadata != nil {
+		go nodeMetadata.run(stop)
+	}
+	if nodeIdentity != nil {
+		go nodeIdentity.run(stop)
+	}
+
+	go vcdCP.vmInfoCache.run(stop)
 
-	sharedInformer.Start(nil)
-	sharedInformer.WaitForCacheSync(nil)
+	// pick up rotated credentials without a restart
+	go vcdCP.configReloader.run(stop)
 
 	return
 }
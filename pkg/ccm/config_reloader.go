@@ -0,0 +1,146 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package ccm
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/config"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient"
+	"k8s.io/klog"
+)
+
+const (
+	configReloadInterval = 30 * time.Second
+)
+
+// configReloader : applies credentials rotated in the mounted secret or in the cloud config file to the vcd
+// client without restarting the CCM. Other changes to the cloud config are validated and reported, but only
+// take effect after a restart since they are baked into the clients at startup.
+type configReloader struct {
+	vcdClient       *vcdclient.Client
+	cloudConfigPath string
+	authDir         string
+	watcher         *config.FileWatcher
+
+	// parsedConfig is the cloud config as loaded at startup, before credentials were added. It is the base
+	// for reloads when the path of the cloud config file is not known.
+	parsedConfig config.CloudConfig
+	// currentConfig is the config the client is currently running with
+	currentConfig config.CloudConfig
+}
+
+func newConfigReloader(vcdClient *vcdclient.Client, cloudConfigPath string, authDir string,
+	parsedConfig config.CloudConfig, currentConfig config.CloudConfig) *configReloader {
+
+	watchedFiles := config.AuthorizationFiles(authDir)
+	if cloudConfigPath != "" {
+		watchedFiles = append(watchedFiles, cloudConfigPath)
+	}
+
+	return &configReloader{
+		vcdClient:       vcdClient,
+		cloudConfigPath: cloudConfigPath,
+		authDir:         authDir,
+		watcher:         config.NewFileWatcher(watchedFiles, configReloadInterval),
+		parsedConfig:    parsedConfig,
+		currentConfig:   currentConfig,
+	}
+}
+
+func (reloader *configReloader) loadConfig() (*config.CloudConfig, error) {
+	var cloudConfig *config.CloudConfig
+	if reloader.cloudConfigPath == "" {
+		parsedConfig := reloader.parsedConfig
+		cloudConfig = &parsedConfig
+	} else {
+		configFile, err := os.Open(reloader.cloudConfigPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open cloud config file [%s]: [%v]", reloader.cloudConfigPath, err)
+		}
+		defer func() {
+			if err := configFile.Close(); err != nil {
+				klog.Errorf("unable to close cloud config file [%s]: [%v]", reloader.cloudConfigPath, err)
+			}
+		}()
+
+		if cloudConfig, err = config.DefaultLoader.Load(configFile); err != nil {
+			return nil, fmt.Errorf("unable to load cloud config file [%s]: [%v]", reloader.cloudConfigPath, err)
+		}
+	}
+
+	if err := config.SetAuthorizationFromDir(cloudConfig, reloader.authDir); err != nil {
+		return nil, fmt.Errorf("unable to set authorization in config: [%v]", err)
+	}
+	if err := config.ValidateCloudConfig(cloudConfig); err != nil {
+		return nil, fmt.Errorf("error validating config: [%v]", err)
+	}
+
+	return cloudConfig, nil
+}
+
+func withoutCredentials(cloudConfig config.CloudConfig) config.CloudConfig {
+	cloudConfig.VCD.UserOrg = ""
+	cloudConfig.VCD.User = ""
+	cloudConfig.VCD.Secret = ""
+	cloudConfig.VCD.RefreshToken = ""
+
+	return cloudConfig
+}
+
+// reload re-reads the config and switches the client to new credentials if they changed. It returns whether a
+// rotation was attempted.
+func (reloader *configReloader) reload() (bool, error) {
+	newConfig, err := reloader.loadConfig()
+	if err != nil {
+		return true, err
+	}
+
+	if !reflect.DeepEqual(withoutCredentials(reloader.currentConfig), withoutCredentials(*newConfig)) {
+		klog.Warningf("Changes to the cloud config other than credentials take effect after the CCM is restarted")
+	}
+
+	currentVCD, newVCD := reloader.currentConfig.VCD, newConfig.VCD
+	if currentVCD.UserOrg == newVCD.UserOrg && currentVCD.User == newVCD.User &&
+		currentVCD.Secret == newVCD.Secret && currentVCD.RefreshToken == newVCD.RefreshToken {
+		klog.Infof("Credentials are unchanged")
+		return false, nil
+	}
+
+	if err = reloader.vcdClient.UpdateCredentials(newVCD.UserOrg, newVCD.User, newVCD.Secret,
+		newVCD.RefreshToken); err != nil {
+		return true, err
+	}
+	reloader.currentConfig.VCD.UserOrg = newVCD.UserOrg
+	reloader.currentConfig.VCD.User = newVCD.User
+	reloader.currentConfig.VCD.Secret = newVCD.Secret
+	reloader.currentConfig.VCD.RefreshToken = newVCD.RefreshToken
+
+	return true, nil
+}
+
+func (reloader *configReloader) onChange() {
+	klog.Infof("Cloud config or credentials changed; reloading")
+	rotated, err := reloader.reload()
+	if err != nil {
+		credentialRotations.WithLabelValues(metricResultFailure).Inc()
+		klog.Errorf("Unable to rotate credentials; continuing with the current ones: [%v]", err)
+		return
+	}
+	if rotated {
+		credentialRotations.WithLabelValues(metricResultSuccess).Inc()
+		klog.Infof("Successfully rotated credentials to user [%s/%s]",
+			reloader.currentConfig.VCD.UserOrg, reloader.currentConfig.VCD.User)
+	}
+}
+
+// run watches the config and credential files until stopCh is closed
+func (reloader *configReloader) run(stopCh <-chan struct{}) {
+	reloader.watcher.Run(reloader.onChange, stopCh)
+}
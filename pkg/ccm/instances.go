@@ -7,8 +7,10 @@ package ccm
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"github.com/vmware/go-vcloud-director/v2/govcd"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/config"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	cloudProvider "k8s.io/cloud-provider"
@@ -18,11 +20,17 @@ import (
 )
 
 type instances struct {
-	vmInfoCache *VmInfoCache
+	vmInfoCache    *VmInfoCache
+	shutdownConfig config.ShutdownConfig
+	// statusReporter explains the shutdown state of nodes with events; it is set once the node informer is started
+	statusReporter *vmStatusReporter
 }
 
-func newInstances(vmInfoCache *VmInfoCache) cloudProvider.Instances {
-	return &instances{vmInfoCache}
+func newInstances(vmInfoCache *VmInfoCache, shutdownConfig config.ShutdownConfig) *instances {
+	return &instances{
+		vmInfoCache:    vmInfoCache,
+		shutdownConfig: shutdownConfig,
+	}
 }
 
 func getUUIDFromProviderID(providerID string) string {
@@ -35,9 +43,9 @@ func (i *instances) NodeAddresses(ctx context.Context, nodeName types.NodeName)
 	klog.Info("instances.NodeAddresses() called with ", string(nodeName))
 
 	vmName := string(nodeName)
-	vmInfo, err := i.vmInfoCache.GetByName(vmName)
+	vmInfo, err := i.vmInfoCache.GetByNodeName(vmName)
 	if err != nil {
-		if err == govcd.ErrorEntityNotFound {
+		if errors.Is(err, vcdclient.ErrNotFound) {
 			return nil, cloudProvider.InstanceNotFound
 		}
 
@@ -62,7 +70,7 @@ func (i *instances) NodeAddressesByProviderID(ctx context.Context, providerID st
 	vmUUID := getUUIDFromProviderID(providerID)
 	vmInfo, err := i.vmInfoCache.GetByUUID(vmUUID)
 	if err != nil {
-		if err == govcd.ErrorEntityNotFound {
+		if errors.Is(err, vcdclient.ErrNotFound) {
 			return nil, cloudProvider.InstanceNotFound
 		}
 
@@ -79,9 +87,9 @@ func (i *instances) InstanceID(ctx context.Context, nodeName types.NodeName) (st
 	klog.Infof("vcd.InstanceID() called with [%v]", nodeName)
 
 	vmName := string(nodeName)
-	vmInfo, err := i.vmInfoCache.GetByName(vmName)
+	vmInfo, err := i.vmInfoCache.GetByNodeName(vmName)
 	if err != nil {
-		if err == govcd.ErrorEntityNotFound {
+		if errors.Is(err, vcdclient.ErrNotFound) {
 			return "", cloudProvider.InstanceNotFound
 		}
 
@@ -96,9 +104,9 @@ func (i *instances) InstanceType(ctx context.Context, nodeName types.NodeName) (
 	klog.Infof("vcd.InstanceType() called with name [%v]", nodeName)
 
 	vmName := string(nodeName)
-	vmInfo, err := i.vmInfoCache.GetByName(vmName)
+	vmInfo, err := i.vmInfoCache.GetByNodeName(vmName)
 	if err != nil {
-		if err == govcd.ErrorEntityNotFound {
+		if errors.Is(err, vcdclient.ErrNotFound) {
 			return "", cloudProvider.InstanceNotFound
 		}
 
@@ -115,7 +123,7 @@ func (i *instances) InstanceTypeByProviderID(ctx context.Context, providerID str
 	vmUUID := getUUIDFromProviderID(providerID)
 	vmInfo, err := i.vmInfoCache.GetByUUID(vmUUID)
 	if err != nil {
-		if err == govcd.ErrorEntityNotFound {
+		if errors.Is(err, vcdclient.ErrNotFound) {
 			return "", cloudProvider.InstanceNotFound
 		}
 
@@ -148,7 +156,7 @@ func (i *instances) InstanceExistsByProviderID(ctx context.Context, providerID s
 	vmUUID := getUUIDFromProviderID(providerID)
 	_, err := i.vmInfoCache.GetByUUID(vmUUID)
 	if err != nil {
-		if err == govcd.ErrorEntityNotFound {
+		if errors.Is(err, vcdclient.ErrNotFound) {
 			klog.Infof("instances.InstanceExistsByProviderID() for provider ID [%s] is false", providerID)
 			return false, nil
 		}
@@ -162,37 +170,30 @@ func (i *instances) InstanceExistsByProviderID(ctx context.Context, providerID s
 	return true, nil
 }
 
-// InstanceShutdownByProviderID returns true if the instance is shutdown in cloudprovider
+// InstanceShutdownByProviderID returns true if the instance is shutdown in cloudprovider. Whether the VCD status
+// and maintenance mode of the VM mean that it is shut down is configured by the shutdown config.
 func (i *instances) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
 	klog.Infof("instances.InstanceShutdownByProviderID() called with providerID [%s]", providerID)
 
 	vmUUID := getUUIDFromProviderID(providerID)
 	vmInfo, err := i.vmInfoCache.GetByUUID(vmUUID)
 	if err != nil {
-		if err == govcd.ErrorEntityNotFound {
+		if errors.Is(err, vcdclient.ErrNotFound) {
 			return false, nil
 		}
 
 		return false, fmt.Errorf("unable to find instance type from vm uuid [%s]: [%v]", vmUUID, err)
 	}
 
-	if vmInfo.vm == nil {
-		return false, fmt.Errorf("vm struct in vmInfo nil for vm uuid [%s]: [%v]", vmUUID, err)
-	}
-
-	status, err := vmInfo.vm.GetStatus()
-	if err != nil {
-		if i.vmInfoCache.vcdClient.IsVmNotAvailable(err) {
-			return true, nil
-		}
-
-		return false, fmt.Errorf("unable to get status of vm uuid [%s], name [%s]: [%v]",
-			vmUUID, vmInfo.Name, err)
+	shutdown, state := isVMShutdown(vmInfo, &i.shutdownConfig)
+	if i.statusReporter != nil {
+		i.statusReporter.report(vmUUID, state, shutdown)
 	}
-	if status == "POWERED_ON" {
+	if !shutdown {
 		return false, nil
 	}
 
-	klog.Infof("instances.InstanceShutdownByProviderID() for provider ID [%s] is true", providerID)
+	klog.Infof("instances.InstanceShutdownByProviderID() for provider ID [%s] is true: vm is [%s]",
+		providerID, state)
 	return true, nil
 }
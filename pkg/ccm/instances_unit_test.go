@@ -0,0 +1,88 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package ccm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/config"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient/fakebackend"
+	v1 "k8s.io/api/core/v1"
+	cloudProvider "k8s.io/cloud-provider"
+)
+
+func TestInstanceExistsByProviderIDForbidden(t *testing.T) {
+	ctx := context.Background()
+	vms := fakebackend.NewVMs()
+	vmID := vms.AddVM("cluster", "worker-1", "10.0.0.5")
+	i := newInstances(newVmInfoCache(vms, time.Hour, time.Minute, 0, config.NodeConfig{}), config.ShutdownConfig{})
+	forbiddenErr := fmt.Errorf("unable to get vm: [%w]", vcdclient.ErrForbidden)
+
+	// a forbidden VM may still exist, and a node whose instance does not exist is deleted
+	vms.FailCalls("FindVMByUUID", 2, forbiddenErr)
+	exists, err := i.InstanceExistsByProviderID(ctx, ProviderName+"://"+vmID)
+	assert.Error(t, err, "Forbidden VM should be reported as an error")
+	assert.False(t, exists, "Existence of a forbidden VM should not be known")
+	_, err = i.InstanceShutdownByProviderID(ctx, ProviderName+"://"+vmID)
+	assert.Error(t, err, "Shutdown of a forbidden VM should be reported as an error")
+
+	exists, err = i.InstanceExistsByProviderID(ctx, ProviderName+"://"+vmID)
+	assert.NoError(t, err, "VM should be found once it may be viewed")
+	assert.True(t, exists, "VM should exist once it may be viewed")
+
+	vms.RemoveVM(vmID)
+	assert.NoError(t, i.vmInfoCache.refresh(), "VMs should be listed")
+	exists, err = i.InstanceExistsByProviderID(ctx, ProviderName+"://"+vmID)
+	assert.NoError(t, err, "VM that is gone should not be an error")
+	assert.False(t, exists, "VM that is gone should not exist")
+
+	return
+}
+
+func TestInstancesFakeBackend(t *testing.T) {
+	ctx := context.Background()
+	vms := fakebackend.NewVMs()
+	vmID := vms.AddVM("cluster", "worker-1", "10.0.0.5", "192.168.0.5")
+	i := newInstances(newVmInfoCache(vms, time.Hour, time.Minute, 0, config.NodeConfig{}), config.ShutdownConfig{})
+
+	expectedAddresses := []v1.NodeAddress{
+		{Type: v1.NodeInternalIP, Address: "10.0.0.5"},
+		{Type: v1.NodeExternalIP, Address: "10.0.0.5"},
+		{Type: v1.NodeHostName, Address: "worker-1"},
+		{Type: v1.NodeInternalIP, Address: "192.168.0.5"},
+		{Type: v1.NodeExternalIP, Address: "192.168.0.5"},
+	}
+	addresses, err := i.NodeAddresses(ctx, "worker-1")
+	assert.NoError(t, err, "Addresses of the VM should be found by node name")
+	assert.Equal(t, expectedAddresses, addresses, "All IPs of the VM should be addresses of the node")
+	addresses, err = i.NodeAddressesByProviderID(ctx, ProviderName+"://"+vmID)
+	assert.NoError(t, err, "Addresses of the VM should be found by provider id")
+	assert.Equal(t, expectedAddresses, addresses, "All IPs of the VM should be addresses of the node")
+
+	instanceID, err := i.InstanceID(ctx, "worker-1")
+	assert.NoError(t, err, "Instance id of the VM should be found")
+	assert.Equal(t, vmID, instanceID, "Instance id should be the id of the VM")
+	exists, err := i.InstanceExistsByProviderID(ctx, ProviderName+"://"+vmID)
+	assert.NoError(t, err, "Existence of the VM should be known")
+	assert.True(t, exists, "VM should exist")
+
+	_, err = i.NodeAddresses(ctx, "worker-2")
+	assert.Equal(t, cloudProvider.InstanceNotFound, err, "Addresses of a missing VM should not be found")
+	_, err = i.InstanceID(ctx, "worker-2")
+	assert.Equal(t, cloudProvider.InstanceNotFound, err, "Instance id of a missing VM should not be found")
+
+	vms.FailCalls("FindVMByName", 1, fmt.Errorf("unable to find vm: [%w]", vcdclient.ErrBusy))
+	_, err = i.NodeAddresses(ctx, "worker-3")
+	assert.Error(t, err, "Failed lookup should be reported as an error")
+	assert.NotEqual(t, cloudProvider.InstanceNotFound, err, "Failed lookup should not mean that the VM is missing")
+
+	return
+}
@@ -0,0 +1,192 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package ccm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+// isNodeReady returns true if the Ready condition of node is true
+func isNodeReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// getNodeInternalIP returns the first internal IP of node, or an empty string if it has none
+func getNodeInternalIP(node *v1.Node) string {
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == v1.NodeInternalIP {
+			return addr.Address
+		}
+	}
+
+	return ""
+}
+
+// nodePoolMembershipChanged returns true if the change from oldNode to newNode can change the pools it is in
+func nodePoolMembershipChanged(oldNode *v1.Node, newNode *v1.Node) bool {
+	_, oldExcluded := oldNode.Labels[v1.LabelNodeExcludeBalancers]
+	_, newExcluded := newNode.Labels[v1.LabelNodeExcludeBalancers]
+	return isNodeReady(oldNode) != isNodeReady(newNode) || oldExcluded != newExcluded ||
+		!reflect.DeepEqual(oldNode.Status.Addresses, newNode.Status.Addresses)
+}
+
+// hasLoadBalancer returns true if a load balancer has been created for service
+func hasLoadBalancer(service *v1.Service) bool {
+	return service.Spec.Type == v1.ServiceTypeLoadBalancer && len(service.Status.LoadBalancer.Ingress) > 0
+}
+
+// registerEventHandlers queues pool updates when nodes or the endpoints of services change
+func (lb *LBManager) registerEventHandlers(nodeInformer cache.SharedIndexInformer,
+	endpointSliceInformer cache.SharedIndexInformer) {
+
+	nodeInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			lb.enqueueAllServices()
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNode, oldOk := oldObj.(*v1.Node)
+			newNode, newOk := newObj.(*v1.Node)
+			if oldOk && newOk && nodePoolMembershipChanged(oldNode, newNode) {
+				klog.Infof("Addresses, readiness or exclusion of node [%s] changed; updating load balancer pools", newNode.Name)
+				lb.enqueueAllServices()
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			lb.enqueueAllServices()
+		},
+	})
+
+	// only the pools of services with the Local external traffic policy depend on their endpoints
+	endpointSliceHandler := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		endpointSlice, ok := obj.(*discoveryv1.EndpointSlice)
+		if !ok {
+			return
+		}
+		serviceName, ok := endpointSlice.Labels[discoveryv1.LabelServiceName]
+		if !ok {
+			return
+		}
+		service, err := lb.serviceLister.Services(endpointSlice.Namespace).Get(serviceName)
+		if err != nil {
+			return
+		}
+		if hasLoadBalancer(service) && service.Spec.ExternalTrafficPolicy == v1.ServiceExternalTrafficPolicyTypeLocal {
+			lb.enqueueService(service)
+		}
+	}
+	endpointSliceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: endpointSliceHandler,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			endpointSliceHandler(newObj)
+		},
+		DeleteFunc: endpointSliceHandler,
+	})
+
+	return
+}
+
+func (lb *LBManager) enqueueService(service *v1.Service) {
+	key, err := cache.MetaNamespaceKeyFunc(service)
+	if err != nil {
+		klog.Errorf("Unable to get key of service [%s/%s]: [%v]", service.Namespace, service.Name, err)
+		return
+	}
+	lb.poolQueue.Add(key)
+}
+
+func (lb *LBManager) enqueueAllServices() {
+	services, err := lb.serviceLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Unable to list services to update load balancer pools: [%v]", err)
+		return
+	}
+	for _, service := range services {
+		if hasLoadBalancer(service) {
+			lb.enqueueService(service)
+		}
+	}
+}
+
+// syncPools updates the pools of the service with key. Services that are gone or have no load balancer yet are
+// skipped; the service controller takes care of them.
+func (lb *LBManager) syncPools(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return fmt.Errorf("unable to split key [%s]: [%v]", key, err)
+	}
+	service, err := lb.serviceLister.Services(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to get service [%s]: [%v]", key, err)
+	}
+	if !hasLoadBalancer(service) {
+		return nil
+	}
+
+	// the pools are updated with the nodes that the service controller would pass
+	nodes, err := lb.listLBNodes()
+	if err != nil {
+		return err
+	}
+
+	unlock := lb.lockService(service)
+	defer unlock()
+
+	return lb.updatePools(ctx, service, nodes)
+}
+
+func (lb *LBManager) processNextPoolUpdate(ctx context.Context) bool {
+	item, shutdown := lb.poolQueue.Get()
+	if shutdown {
+		return false
+	}
+	defer lb.poolQueue.Done(item)
+
+	key := item.(string)
+	if err := lb.syncPools(ctx, key); err != nil {
+		klog.Errorf("Unable to update load balancer pools of service [%s]; retrying: [%v]", key, err)
+		lb.poolQueue.AddRateLimited(item)
+		return true
+	}
+	lb.poolQueue.Forget(item)
+
+	return true
+}
+
+// runPoolSync updates pools from the queue until stopCh is closed
+func (lb *LBManager) runPoolSync(stopCh <-chan struct{}) {
+	defer lb.poolQueue.ShutDown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go wait.Until(func() {
+		for lb.processNextPoolUpdate(ctx) {
+		}
+	}, 0, stopCh)
+
+	<-stopCh
+}
@@ -3,20 +3,23 @@
    SPDX-License-Identifier: Apache-2.0
 */
 
-// +build !testing
-
 package ccm
 
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/util"
 	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient"
 	v1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/util/workqueue"
 	cloudProvider "k8s.io/cloud-provider"
 	"k8s.io/klog"
 )
@@ -24,67 +27,208 @@ import (
 const (
 	sslPortsAnnotation = `service.beta.kubernetes.io/vcloud-avi-ssl-ports`
 	sslCertAliasAnnotation = `service.beta.kubernetes.io/vcloud-avi-ssl-cert-alias`
+	// lbTargetAnnotation selects the load balancer target of the cloud config on which the load balancer of the
+	// Service is created. A load balancer is not moved when it changes: ensuring it fails until the annotation is
+	// restored, while updates and deletes keep working on the target the load balancer was created on.
+	lbTargetAnnotation = `service.beta.kubernetes.io/vcloud-lb-target`
 )
 
 //LBManager -
 type LBManager struct {
-	vcdClient  *vcdclient.Client
-	kubeClient *kubernetes.Clientset
-	namespace  string
+	lbBackends vcdclient.LoadBalancerBackends
+	// rdeStore keeps the virtual IPs of the load balancers in the RDE of the cluster
+	rdeStore         vcdclient.RDEStore
+	clusterID        string
+	certificateAlias string
+	namespace        string
+
+	// listers read nodes, services and endpoint slices from the informer caches instead of the API server
+	nodeLister          corelisters.NodeLister
+	serviceLister       corelisters.ServiceLister
+	endpointSliceLister discoverylisters.EndpointSliceLister
+
+	// poolQueue holds the keys of services whose pools have to be updated after nodes or endpoints changed
+	poolQueue workqueue.RateLimitingInterface
+
+	// serviceLocks serializes create, update and delete of the same Service. Different Services are
+	// reconciled in parallel; the vcdclient serializes per gateway where needed.
+	serviceLocks util.KeyedMutex
 }
 
-func newLoadBalancer(vcdClient *vcdclient.Client) cloudProvider.LoadBalancer {
+var _ cloudProvider.LoadBalancer = &LBManager{}
+
+// newLoadBalancer : creates the load balancer of the cluster clusterID on lbBackends that computes pool members from
+// the informer caches of the listers. certificateAlias is used for SSL ports of Services that do not set one.
+func newLoadBalancer(lbBackends vcdclient.LoadBalancerBackends, rdeStore vcdclient.RDEStore, clusterID string,
+	certificateAlias string, nodeLister corelisters.NodeLister, serviceLister corelisters.ServiceLister,
+	endpointSliceLister discoverylisters.EndpointSliceLister) *LBManager {
 	return &LBManager{
-		vcdClient:  vcdClient,
-		kubeClient: GetK8SClient(),
-		namespace:  "default",
+		lbBackends:          lbBackends,
+		rdeStore:            rdeStore,
+		clusterID:           clusterID,
+		certificateAlias:    certificateAlias,
+		namespace:           "default",
+		nodeLister:          nodeLister,
+		serviceLister:       serviceLister,
+		endpointSliceLister: endpointSliceLister,
+		poolQueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(),
+			"vcd-lb-pools"),
+	}
+}
+
+// lockService acquires the lock for the service and returns the function that releases it.
+func (lb *LBManager) lockService(service *v1.Service) func() {
+	return lb.serviceLocks.Lock(fmt.Sprintf("%s/%s", service.Namespace, service.Name))
+}
+
+// lbBackendForService returns the name and backend of the load balancer target of the service. That is the target
+// selected by lbTargetAnnotation, unless the load balancer of the service only has virtual services on another
+// target: the virtual services record the target that the load balancer was created on, so that a changed
+// annotation does not leave the load balancer behind there.
+func (lb *LBManager) lbBackendForService(ctx context.Context, service *v1.Service) (string,
+	vcdclient.LoadBalancerBackend, error) {
+	targetName := service.Annotations[lbTargetAnnotation]
+	lbBackend, err := lb.lbBackends.LoadBalancerBackend(ctx, targetName)
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to get load balancer target [%s] of service [%s/%s]: [%v]",
+			targetName, service.Namespace, service.Name, err)
+	}
+	exists, err := lb.hasVirtualService(ctx, lbBackend, service)
+	if err != nil || exists {
+		return targetName, lbBackend, err
+	}
+
+	for _, otherTargetName := range lb.lbBackends.LBTargetNames() {
+		if otherTargetName == targetName {
+			continue
+		}
+		otherBackend, err := lb.lbBackends.LoadBalancerBackend(ctx, otherTargetName)
+		if err != nil {
+			return "", nil, fmt.Errorf("unable to get load balancer target [%s] to look for service [%s/%s]: [%v]",
+				otherTargetName, service.Namespace, service.Name, err)
+		}
+		exists, err = lb.hasVirtualService(ctx, otherBackend, service)
+		if err != nil {
+			return "", nil, err
+		}
+		if exists {
+			return otherTargetName, otherBackend, nil
+		}
+	}
+
+	return targetName, lbBackend, nil
+}
+
+// hasVirtualService returns whether lbBackend has a virtual service for any port of the service
+func (lb *LBManager) hasVirtualService(ctx context.Context, lbBackend vcdclient.LoadBalancerBackend,
+	service *v1.Service) (bool, error) {
+	virtualServiceNamePrefix := lb.getVirtualServicePrefix(ctx, service)
+	for _, port := range service.Spec.Ports {
+		virtualServiceName := fmt.Sprintf("%s-%s", virtualServiceNamePrefix, port.Name)
+		virtualIP, err := lbBackend.GetLoadBalancer(ctx, virtualServiceName)
+		if err != nil {
+			return false, fmt.Errorf("unable to get virtual service summary for [%s]: [%v]", virtualServiceName, err)
+		}
+		if virtualIP != "" {
+			return true, nil
+		}
 	}
+
+	return false, nil
 }
 
-func (lb *LBManager) getNodeIPs(ctx context.Context) ([]string, error) {
-	nodes, err := lb.kubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+// listLBNodes returns the nodes of the node cache that the service controller would pass for load balancers, which
+// are those that are not labelled to be excluded from them
+func (lb *LBManager) listLBNodes() ([]*v1.Node, error) {
+	nodes, err := lb.nodeLister.List(labels.Everything())
 	if err != nil {
-		return nil, fmt.Errorf("unable to get nodes of cluster: [%v]", err)
+		return nil, fmt.Errorf("unable to list nodes of cluster: [%v]", err)
 	}
 
-	nodeIPs := make([]string, len(nodes.Items))
-	for idx, node := range nodes.Items {
-		nodeIPs[idx] = node.Status.Addresses[0].Address
+	lbNodes := make([]*v1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if _, excluded := node.Labels[v1.LabelNodeExcludeBalancers]; excluded {
+			continue
+		}
+		lbNodes = append(lbNodes, node)
+	}
+
+	return lbNodes, nil
+}
+
+// getNodeIPs returns the internal IPs of the ready nodes among nodes that receive the traffic of service. With the
+// Local external traffic policy, only nodes that host a ready endpoint of the service are used.
+func (lb *LBManager) getNodeIPs(service *v1.Service, nodes []*v1.Node) ([]string, error) {
+	var endpointNodeNames map[string]bool = nil
+	if service.Spec.ExternalTrafficPolicy == v1.ServiceExternalTrafficPolicyTypeLocal {
+		var err error
+		if endpointNodeNames, err = lb.getEndpointNodeNames(service); err != nil {
+			return nil, err
+		}
+	}
+
+	nodeIPs := make([]string, 0)
+	for _, node := range nodes {
+		if !isNodeReady(node) {
+			continue
+		}
+		if endpointNodeNames != nil && !endpointNodeNames[node.Name] {
+			continue
+		}
+		nodeIP := getNodeInternalIP(node)
+		if nodeIP == "" {
+			klog.Warningf("Node [%s] has no internal IP; not adding it to load balancer pools", node.Name)
+			continue
+		}
+		nodeIPs = append(nodeIPs, nodeIP)
 	}
+	sort.Strings(nodeIPs)
 
 	return nodeIPs, nil
 }
 
+// getEndpointNodeNames returns the names of the nodes that host a ready endpoint of service
+func (lb *LBManager) getEndpointNodeNames(service *v1.Service) (map[string]bool, error) {
+	selector := labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: service.Name})
+	endpointSlices, err := lb.endpointSliceLister.EndpointSlices(service.Namespace).List(selector)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list endpoint slices of service [%s/%s]: [%v]",
+			service.Namespace, service.Name, err)
+	}
+
+	nodeNames := make(map[string]bool)
+	for _, endpointSlice := range endpointSlices {
+		for _, endpoint := range endpointSlice.Endpoints {
+			if endpoint.NodeName == nil {
+				continue
+			}
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+			nodeNames[*endpoint.NodeName] = true
+		}
+	}
+
+	return nodeNames, nil
+}
+
 // EnsureLoadBalancer creates a new load balancer 'name', or updates the existing one.
 // Returns the status of the balancer. Implementations must treat the *v1.Service and *v1.Node
-// parameters as read-only and not modify them.
+// parameters as read-only and not modify them. The pool members are the ready nodes of 'nodes'.
 // Parameter 'clusterName' is the name of the cluster as presented to kube-controller-manager
 func (lb *LBManager) EnsureLoadBalancer(ctx context.Context, clusterName string,
 	service *v1.Service, nodes []*v1.Node) (lbs *v1.LoadBalancerStatus, err error) {
 
-	if err = lb.vcdClient.RefreshBearerToken(); err != nil {
-		return nil, fmt.Errorf("error while obtaining access token: [%v]", err)
-	}
-	nodeIPs, err := lb.getNodeIPs(ctx)
+	unlock := lb.lockService(service)
+	defer unlock()
+
+	nodeIPs, err := lb.getNodeIPs(service, nodes)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get nodes in cluster: [%v]", err)
 	}
 	return lb.createLoadBalancer(ctx, service, nodeIPs)
 }
 
-func (lb *LBManager) getNodeInternalIps(nodes []*v1.Node) []string {
-	nodeIps := make([]string, len(nodes))
-	for i, node := range nodes {
-		for _, addr := range node.Status.Addresses {
-			if addr.Type == v1.NodeInternalIP {
-				nodeIps[i] = addr.Address
-				break
-			}
-		}
-	}
-	return nodeIps
-}
-
 func (lb *LBManager) getServicePortMap(service *v1.Service) (map[string]int32, map[string]int32) {
 	typeToInternalPort := make(map[string]int32)
 	typeToExternalPort := make(map[string]int32)
@@ -97,16 +241,28 @@ func (lb *LBManager) getServicePortMap(service *v1.Service) (map[string]int32, m
 
 // UpdateLoadBalancer updates hosts under the specified load balancer.
 // Implementations must treat the *v1.Service and *v1.Node
-// parameters as read-only and not modify them.
+// parameters as read-only and not modify them. The pool members are the ready nodes of 'nodes'.
 // Parameter 'clusterName' is the name of the cluster as presented to kube-controller-manager
 func (lb *LBManager) UpdateLoadBalancer(ctx context.Context, clusterName string,
 	service *v1.Service, nodes []*v1.Node) (err error) {
 
-	if err = lb.vcdClient.RefreshBearerToken(); err != nil {
-		return fmt.Errorf("error while obtaining access token: [%v]", err)
+	unlock := lb.lockService(service)
+	defer unlock()
+
+	return lb.updatePools(ctx, service, nodes)
+}
+
+// updatePools sets the members of the pools of service to the nodes among nodes that currently receive its traffic
+func (lb *LBManager) updatePools(ctx context.Context, service *v1.Service, nodes []*v1.Node) error {
+	_, lbBackend, err := lb.lbBackendForService(ctx, service)
+	if err != nil {
+		return err
 	}
 
-	nodeIps := lb.getNodeInternalIps(nodes)
+	nodeIps, err := lb.getNodeIPs(service, nodes)
+	if err != nil {
+		return fmt.Errorf("unable to get nodes in cluster: [%v]", err)
+	}
 	klog.Infof("UpdateLoadBalancer Node Ips: %v", nodeIps)
 
 	lbPoolNamePrefix := lb.getLBPoolNamePrefix(ctx, service)
@@ -117,7 +273,7 @@ func (lb *LBManager) UpdateLoadBalancer(ctx context.Context, clusterName string,
 		virtualServiceName := fmt.Sprintf("%s-%s", virtualServiceNamePrefix, portName)
 		externalPort := typeToExternalPort[portName]
 		klog.Infof("Updating pool [%s] with port [%s:%d]", lbPoolName, portName, internalPort)
-		if err := lb.vcdClient.UpdateLoadBalancer(ctx, lbPoolName, virtualServiceName, nodeIps, internalPort, externalPort); err != nil {
+		if err := lbBackend.UpdateLoadBalancer(ctx, lbPoolName, virtualServiceName, nodeIps, internalPort, externalPort); err != nil {
 			return fmt.Errorf("unable to update pool [%s] with port [%s:%d]: [%v]", lbPoolName, portName,
 				internalPort, err)
 		}
@@ -137,20 +293,25 @@ func (lb *LBManager) UpdateLoadBalancer(ctx context.Context, clusterName string,
 func (lb *LBManager) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string,
 	service *v1.Service) error {
 
-	if err := lb.vcdClient.RefreshBearerToken(); err != nil {
-		return fmt.Errorf("error while obtaining access token: [%v]", err)
-	}
+	unlock := lb.lockService(service)
+	defer unlock()
+
 	return lb.deleteLoadBalancer(ctx, service)
 }
 
 func (lb *LBManager) getLoadBalancer(ctx context.Context,
 	service *v1.Service) (status *v1.LoadBalancerStatus, exists bool, err error) {
 
+	_, lbBackend, err := lb.lbBackendForService(ctx, service)
+	if err != nil {
+		return nil, false, err
+	}
+
 	virtualServiceNamePrefix := lb.getLoadBalancerPrefix(ctx, service)
 	virtualIP := ""
 	for _, port := range service.Spec.Ports {
 		virtualServiceName := fmt.Sprintf("%s-%s", virtualServiceNamePrefix, port.Name)
-		virtualIP, err = lb.vcdClient.GetLoadBalancer(ctx, virtualServiceName)
+		virtualIP, err = lbBackend.GetLoadBalancer(ctx, virtualServiceName)
 		if err != nil {
 			return nil, false,
 				fmt.Errorf("unable to get virtual service summary for [%s]: [%v]",
@@ -183,16 +344,13 @@ func (lb *LBManager) getLoadBalancer(ctx context.Context,
 func (lb *LBManager) GetLoadBalancer(ctx context.Context, clusterName string,
 	service *v1.Service) (status *v1.LoadBalancerStatus, exists bool, err error) {
 
-	if err = lb.vcdClient.RefreshBearerToken(); err != nil {
-		return nil, false, fmt.Errorf("error while obtaining access token: [%v]", err)
-	}
 	return lb.getLoadBalancer(ctx, service)
 }
 
 // getTrimmedClusterID: this is a mitigation to not overflow VCD name length limits. There is a clearer
 // fix needed in the future. Cover all cluster prefixes.
 func (lb *LBManager) getTrimmedClusterID() string {
-	clusterID := lb.vcdClient.ClusterID
+	clusterID := lb.clusterID
 	for _, prefix := range []string{
 		"urn:vcloud:entity:vmware:",
 		"urn:vcloud:entity:cse:nativeCluster:",
@@ -222,6 +380,11 @@ func (lb *LBManager) GetLoadBalancerName(ctx context.Context, clusterName string
 
 func (lb *LBManager) deleteLoadBalancer(ctx context.Context, service *v1.Service) error {
 
+	_, lbBackend, err := lb.lbBackendForService(ctx, service)
+	if err != nil {
+		return err
+	}
+
 	virtualServiceName := lb.getVirtualServicePrefix(ctx, service)
 	lbPoolNamePrefix := lb.getLBPoolNamePrefix(ctx, service)
 	klog.Infof("Deleting virtual service [%s] and lb pool [%s]", virtualServiceName, lbPoolNamePrefix)
@@ -238,7 +401,7 @@ func (lb *LBManager) deleteLoadBalancer(ctx context.Context, service *v1.Service
 	}
 	klog.Infof("Deleting loadbalancer for ports [%#v]\n", portDetailsList)
 
-	err := lb.vcdClient.DeleteLoadBalancer(ctx, virtualServiceName, lbPoolNamePrefix, portDetailsList)
+	err = lbBackend.DeleteLoadBalancer(ctx, virtualServiceName, lbPoolNamePrefix, portDetailsList)
 	if err != nil {
 		return fmt.Errorf("Unable to delete load balancer for virtual-service [%s] and lb pool [%s]: [%v]",
 			virtualServiceName, lbPoolNamePrefix, err)
@@ -278,6 +441,16 @@ func getSSLCertAlias(service *v1.Service) string {
 func (lb *LBManager) createLoadBalancer(ctx context.Context, service *v1.Service,
 	nodeIPs []string) (*v1.LoadBalancerStatus, error) {
 
+	targetName, lbBackend, err := lb.lbBackendForService(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	if selectedTargetName := service.Annotations[lbTargetAnnotation]; targetName != selectedTargetName {
+		return nil, fmt.Errorf("load balancer of service [%s/%s] exists on load balancer target [%s] and cannot be "+
+			"moved to target [%s]; restore annotation [%s] or recreate the service", service.Namespace,
+			service.Name, targetName, selectedTargetName, lbTargetAnnotation)
+	}
+
 	lbPoolNamePrefix := lb.getLBPoolNamePrefix(ctx, service)
 	virtualServiceNamePrefix := lb.getVirtualServicePrefix(ctx, service)
 	lbStatus, lbExists, err := lb.getLoadBalancer(ctx, service)
@@ -292,11 +465,15 @@ func (lb *LBManager) createLoadBalancer(ctx context.Context, service *v1.Service
 			virtualServiceName := fmt.Sprintf("%s-%s", virtualServiceNamePrefix, portName)
 			externalPort := typeToExternalPortMap[portName]
 			klog.Infof("Updating pool [%s] with port [%s:%d:%d]", lbPoolName, portName, internalPort, externalPort)
-			if err := lb.vcdClient.UpdateLoadBalancer(ctx, lbPoolName, virtualServiceName, nodeIPs, internalPort, externalPort); err != nil {
+			if err := lbBackend.UpdateLoadBalancer(ctx, lbPoolName, virtualServiceName, nodeIPs, internalPort, externalPort); err != nil {
 				return nil, fmt.Errorf("unable to update pool [%s] with port [%s:%d:%d]: [%v]", lbPoolName, portName,
 					internalPort, externalPort, err)
 			}
 		}
+		// the virtual IP is missing from the RDE if recording it failed when the load balancer was created
+		if err := lb.rdeStore.AddVirtualIP(ctx, lbStatus.Ingress[0].IP); err != nil {
+			klog.Errorf("Unable to add virtual IP [%s] to RDE: [%v]", lbStatus.Ingress[0].IP, err)
+		}
 		return lbStatus, nil
 	}
 
@@ -313,7 +490,7 @@ func (lb *LBManager) createLoadBalancer(ctx context.Context, service *v1.Service
 
 	certAlias := getSSLCertAlias(service)
 	if certAlias == "" {
-		certAlias = lb.vcdClient.CertificateAlias
+		certAlias = lb.certificateAlias
 	}
 
 	// golang doesn't have the set data structure
@@ -342,7 +519,7 @@ func (lb *LBManager) createLoadBalancer(ctx context.Context, service *v1.Service
 	klog.Infof("Creating loadbalancer for ports [%#v]\n", portDetailsList)
 
 	// Create using VCD API
-	lbIP, err := lb.vcdClient.CreateLoadBalancer(ctx, virtualServiceNamePrefix, lbPoolNamePrefix, nodeIPs, portDetailsList)
+	lbIP, err := lbBackend.CreateLoadBalancer(ctx, virtualServiceNamePrefix, lbPoolNamePrefix, nodeIPs, portDetailsList)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create loadbalancer for ports [%#v]: [%v]", portDetailsList, err)
 	}
@@ -0,0 +1,247 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package ccm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient/fakebackend"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const testLBClusterID = "urn:vcloud:entity:vmware:capvcdCluster:abc"
+
+// newLBNode returns a node with the internal IP nodeIP whose Ready condition is ready
+func newLBNode(name string, nodeIP string, ready bool) *v1.Node {
+	readyStatus := v1.ConditionFalse
+	if ready {
+		readyStatus = v1.ConditionTrue
+	}
+
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: readyStatus}},
+			Addresses:  []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: nodeIP}},
+		},
+	}
+}
+
+// newLBService returns a Service of type LoadBalancer with an http and an https port
+func newLBService(name string) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: v1.ServiceSpec{
+			Type: v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{
+				{Name: "http", Protocol: v1.ProtocolTCP, Port: 80, NodePort: 31080},
+				{Name: "https", Protocol: v1.ProtocolTCP, Port: 443, NodePort: 31443},
+			},
+		},
+	}
+}
+
+// newTestLBManager returns a load balancer manager on lbs whose listers have the nodes, services and endpoint slices
+func newTestLBManager(t *testing.T, lbs *fakebackend.LoadBalancers, rdeStore *fakebackend.RDEStore,
+	nodes []*v1.Node, services []*v1.Service, endpointSlices []*discoveryv1.EndpointSlice) *LBManager {
+	serviceIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, service := range services {
+		assert.NoError(t, serviceIndexer.Add(service), "Service [%s] should be added to the lister", service.Name)
+	}
+	endpointSliceIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, endpointSlice := range endpointSlices {
+		assert.NoError(t, endpointSliceIndexer.Add(endpointSlice),
+			"Endpoint slice [%s] should be added to the lister", endpointSlice.Name)
+	}
+
+	return newLoadBalancer(lbs, rdeStore, testLBClusterID, "", newNodeLister(t, nodes...),
+		corelisters.NewServiceLister(serviceIndexer), discoverylisters.NewEndpointSliceLister(endpointSliceIndexer))
+}
+
+// poolMembers returns the members of the pools of target by pool name
+func poolMembers(lbs *fakebackend.LoadBalancers, target string) map[string][]string {
+	members := make(map[string][]string)
+	for _, pool := range lbs.Pools(target) {
+		members[pool.Name] = pool.Members
+	}
+
+	return members
+}
+
+func TestLBManagerFakeBackend(t *testing.T) {
+	ctx := context.Background()
+	rdeStore := fakebackend.NewRDEStore()
+	lbs := fakebackend.NewLoadBalancers(rdeStore)
+	lbs.AddTarget("default", "192.168.0.10", "192.168.0.11")
+
+	excludedNode := newLBNode("worker-3", "10.0.0.3", true)
+	excludedNode.Labels = map[string]string{v1.LabelNodeExcludeBalancers: ""}
+	nodes := []*v1.Node{
+		newLBNode("worker-1", "10.0.0.1", true),
+		newLBNode("worker-2", "10.0.0.2", false),
+		excludedNode,
+	}
+	service := newLBService("web")
+	service.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "192.168.0.10"}}
+	lb := newTestLBManager(t, lbs, rdeStore, nodes, []*v1.Service{service}, nil)
+
+	poolName := func(portName string) string {
+		return fmt.Sprintf("ingress-pool-web-capvcdCluster:abc-%s", portName)
+	}
+
+	// the service controller passes the nodes that are not excluded
+	status, err := lb.EnsureLoadBalancer(ctx, "cluster", service, nodes[:2])
+	assert.NoError(t, err, "Load balancer should be created")
+	assert.Equal(t, &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "192.168.0.10"}}}, status,
+		"Load balancer should get the first IP of the target")
+	virtualIPs, err := rdeStore.GetVirtualIPs(ctx)
+	assert.NoError(t, err, "Virtual IPs should be read from the RDE")
+	assert.Equal(t, []string{"192.168.0.10"}, virtualIPs, "Virtual IP of the load balancer should be in the RDE")
+	assert.Equal(t, map[string][]string{poolName("http"): {"10.0.0.1"}, poolName("https"): {"10.0.0.1"}},
+		poolMembers(lbs, "default"), "Only ready nodes should be pool members")
+	assert.Len(t, lbs.VirtualServices("default"), 2, "Every port should have a virtual service")
+
+	status, err = lb.EnsureLoadBalancer(ctx, "cluster", service, nodes[:2])
+	assert.NoError(t, err, "Existing load balancer should be ensured")
+	assert.Equal(t, "192.168.0.10", status.Ingress[0].IP, "Existing load balancer should keep its IP")
+
+	updatedNodes := []*v1.Node{newLBNode("worker-1", "10.0.0.1", true), newLBNode("worker-2", "10.0.0.2", true)}
+	assert.NoError(t, lb.UpdateLoadBalancer(ctx, "cluster", service, updatedNodes), "Pools should be updated")
+	assert.Equal(t, map[string][]string{
+		poolName("http"):  {"10.0.0.1", "10.0.0.2"},
+		poolName("https"): {"10.0.0.1", "10.0.0.2"},
+	}, poolMembers(lbs, "default"), "Node that became ready should be a pool member")
+
+	// the pool sync lists the nodes itself and must skip the excluded one like the service controller does
+	assert.NoError(t, lb.syncPools(ctx, "default/web"), "Pools should be synced")
+	assert.Equal(t, map[string][]string{poolName("http"): {"10.0.0.1"}, poolName("https"): {"10.0.0.1"}},
+		poolMembers(lbs, "default"), "Pool sync should only add ready nodes that are not excluded")
+	assert.NoError(t, lb.syncPools(ctx, "default/gone"), "Service that is gone should be skipped")
+
+	_, exists, err := lb.GetLoadBalancer(ctx, "cluster", service)
+	assert.NoError(t, err, "Load balancer should be looked up")
+	assert.True(t, exists, "Load balancer should exist")
+
+	assert.NoError(t, lb.EnsureLoadBalancerDeleted(ctx, "cluster", service), "Load balancer should be deleted")
+	assert.Empty(t, lbs.Pools("default"), "Pools of the load balancer should be deleted")
+	assert.Empty(t, lbs.VirtualServices("default"), "Virtual services of the load balancer should be deleted")
+	virtualIPs, err = rdeStore.GetVirtualIPs(ctx)
+	assert.NoError(t, err, "Virtual IPs should be read from the RDE")
+	assert.Empty(t, virtualIPs, "Virtual IP of the deleted load balancer should be removed from the RDE")
+	_, exists, err = lb.GetLoadBalancer(ctx, "cluster", service)
+	assert.NoError(t, err, "Deleted load balancer should be looked up")
+	assert.False(t, exists, "Deleted load balancer should not exist")
+	assert.NoError(t, lb.EnsureLoadBalancerDeleted(ctx, "cluster", service),
+		"Deleting a load balancer that is gone should succeed")
+
+	return
+}
+
+func TestLBManagerLocalTrafficPolicy(t *testing.T) {
+	ctx := context.Background()
+	rdeStore := fakebackend.NewRDEStore()
+	lbs := fakebackend.NewLoadBalancers(rdeStore)
+	lbs.AddTarget("default", "192.168.0.10")
+
+	nodes := []*v1.Node{
+		newLBNode("worker-1", "10.0.0.1", true),
+		newLBNode("worker-2", "10.0.0.2", true),
+		newLBNode("worker-3", "10.0.0.3", true),
+	}
+	service := newLBService("web")
+	service.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeLocal
+	nodeName := func(name string) *string {
+		return &name
+	}
+	notReady := false
+	endpointSlice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web-abcde",
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: "web"},
+		},
+		Endpoints: []discoveryv1.Endpoint{
+			{Addresses: []string{"172.16.0.1"}, NodeName: nodeName("worker-1")},
+			{Addresses: []string{"172.16.0.2"}, NodeName: nodeName("worker-2"),
+				Conditions: discoveryv1.EndpointConditions{Ready: &notReady}},
+		},
+	}
+	lb := newTestLBManager(t, lbs, rdeStore, nodes, []*v1.Service{service},
+		[]*discoveryv1.EndpointSlice{endpointSlice})
+
+	_, err := lb.EnsureLoadBalancer(ctx, "cluster", service, nodes)
+	assert.NoError(t, err, "Load balancer should be created")
+	for _, pool := range lbs.Pools("default") {
+		assert.Equal(t, []string{"10.0.0.1"}, pool.Members,
+			"Only nodes with a ready endpoint should be members of pool [%s]", pool.Name)
+	}
+
+	return
+}
+
+func TestLBManagerChangedTarget(t *testing.T) {
+	ctx := context.Background()
+	rdeStore := fakebackend.NewRDEStore()
+	lbs := fakebackend.NewLoadBalancers(rdeStore)
+	lbs.AddTarget("default", "192.168.0.10")
+	lbs.AddTarget("other", "192.168.1.10")
+
+	nodes := []*v1.Node{newLBNode("worker-1", "10.0.0.1", true), newLBNode("worker-2", "10.0.0.2", true)}
+	service := newLBService("web")
+	lb := newTestLBManager(t, lbs, rdeStore, nodes, []*v1.Service{service}, nil)
+
+	_, err := lb.EnsureLoadBalancer(ctx, "cluster", service, nodes[:1])
+	assert.NoError(t, err, "Load balancer should be created on the default target")
+
+	movedService := service.DeepCopy()
+	movedService.Annotations = map[string]string{lbTargetAnnotation: "other"}
+	_, err = lb.EnsureLoadBalancer(ctx, "cluster", movedService, nodes[:1])
+	assert.Error(t, err, "Load balancer should not be moved to another target")
+	assert.Empty(t, lbs.VirtualServices("other"), "No virtual services should be created on the new target")
+	assert.Empty(t, lbs.Pools("other"), "No pools should be created on the new target")
+
+	status, exists, err := lb.GetLoadBalancer(ctx, "cluster", movedService)
+	assert.NoError(t, err, "Load balancer should be looked up")
+	assert.True(t, exists, "Load balancer should be found on the target it was created on")
+	assert.Equal(t, "192.168.0.10", status.Ingress[0].IP, "Load balancer should keep its IP")
+
+	assert.NoError(t, lb.UpdateLoadBalancer(ctx, "cluster", movedService, nodes),
+		"Pools should be updated on the target the load balancer was created on")
+	for _, pool := range lbs.Pools("default") {
+		assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, pool.Members, "Members of pool [%s] should be updated",
+			pool.Name)
+	}
+
+	assert.NoError(t, lb.EnsureLoadBalancerDeleted(ctx, "cluster", movedService), "Load balancer should be deleted")
+	for _, target := range []string{"default", "other"} {
+		assert.Empty(t, lbs.Pools(target), "No pools should be left on target [%s]", target)
+		assert.Empty(t, lbs.VirtualServices(target), "No virtual services should be left on target [%s]", target)
+	}
+	virtualIPs, err := rdeStore.GetVirtualIPs(ctx)
+	assert.NoError(t, err, "Virtual IPs should be read from the RDE")
+	assert.Empty(t, virtualIPs, "Virtual IP of the deleted load balancer should be removed from the RDE")
+
+	// a load balancer created on a selected target is found after the annotation is removed
+	_, err = lb.EnsureLoadBalancer(ctx, "cluster", movedService, nodes)
+	assert.NoError(t, err, "Load balancer should be created on the selected target")
+	assert.Len(t, lbs.VirtualServices("other"), 2, "Load balancer should be created on the selected target")
+	assert.NoError(t, lb.EnsureLoadBalancerDeleted(ctx, "cluster", service),
+		"Load balancer should be deleted after its annotation was removed")
+	assert.Empty(t, lbs.Pools("other"), "No pools should be left on the selected target")
+	assert.Empty(t, lbs.VirtualServices("other"), "No virtual services should be left on the selected target")
+
+	return
+}
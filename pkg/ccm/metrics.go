@@ -0,0 +1,62 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package ccm
+
+import (
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const (
+	metricsNamespace = "cloudprovider"
+	metricsSubsystem = "vcd"
+
+	metricResultSuccess = "success"
+	metricResultFailure = "failure"
+	metricResultHit     = "hit"
+	metricResultMiss    = "miss"
+)
+
+var (
+	credentialRotations = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "credential_rotations_total",
+			Help:           "Number of attempts to switch to rotated VCD credentials, by result.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"result"},
+	)
+
+	vmCacheLookups = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "vm_cache_lookups_total",
+			Help:           "Number of lookups of VM details in the VM cache, by whether they were a hit or a miss.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"result"},
+	)
+
+	vmCacheRefreshes = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "vm_cache_refreshes_total",
+			Help:           "Number of listings of all VMs of the cluster vApp to refresh the VM cache, by result.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	legacyregistry.MustRegister(credentialRotations)
+	legacyregistry.MustRegister(vmCacheLookups)
+	legacyregistry.MustRegister(vmCacheRefreshes)
+}
@@ -0,0 +1,204 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package ccm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+)
+
+const (
+	// nodeRoleLabelPrefix starts the labels that give the roles of a node, such as
+	// node-role.kubernetes.io/control-plane
+	nodeRoleLabelPrefix = "node-role.kubernetes.io/"
+
+	// the keys of the identity metadata, after the configured prefix
+	identityNodeNameKey       = "nodeName"
+	identityClusterIDKey      = "clusterID"
+	identityRolesKey          = "roles"
+	identityKubeletVersionKey = "kubeletVersion"
+)
+
+// nodeIdentitySyncer writes the identity of nodes to the metadata of their VMs, so that VCD admins can tell which
+// VM is which node of which cluster
+type nodeIdentitySyncer struct {
+	vmMetadata  vcdclient.VMMetadata
+	vmInfoCache *VmInfoCache
+	nodeLister  corelisters.NodeLister
+
+	clusterID string
+	domain    string
+	prefix    string
+	interval  time.Duration
+
+	// queue holds the names of nodes whose identity has to be written
+	queue workqueue.RateLimitingInterface
+}
+
+func newNodeIdentitySyncer(vmMetadata vcdclient.VMMetadata, vmInfoCache *VmInfoCache,
+	nodeLister corelisters.NodeLister, clusterID string, domain string, prefix string,
+	interval time.Duration) *nodeIdentitySyncer {
+	return &nodeIdentitySyncer{
+		vmMetadata:  vmMetadata,
+		vmInfoCache: vmInfoCache,
+		nodeLister:  nodeLister,
+		clusterID:   clusterID,
+		domain:      domain,
+		prefix:      prefix,
+		interval:    interval,
+		queue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(),
+			"node-identity-metadata"),
+	}
+}
+
+// getNodeRoles returns the sorted roles of node from its node-role.kubernetes.io labels
+func getNodeRoles(node *v1.Node) []string {
+	roles := make([]string, 0)
+	for key := range node.Labels {
+		if role := strings.TrimPrefix(key, nodeRoleLabelPrefix); role != key && role != "" {
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles)
+
+	return roles
+}
+
+// identityMetadata returns the metadata entries that identify node in the cluster clusterID. Entries without a
+// value are left out, as VCD metadata cannot be empty.
+func (nis *nodeIdentitySyncer) identityMetadata(node *v1.Node) map[string]string {
+	values := map[string]string{
+		identityNodeNameKey:       node.Name,
+		identityClusterIDKey:      nis.clusterID,
+		identityRolesKey:          strings.Join(getNodeRoles(node), ","),
+		identityKubeletVersionKey: node.Status.NodeInfo.KubeletVersion,
+	}
+	entries := make(map[string]string)
+	for key, value := range values {
+		if value != "" {
+			entries[nis.prefix+key] = value
+		}
+	}
+
+	return entries
+}
+
+// nodeIdentityChanged returns true if the change from oldNode to newNode changes the metadata of its VM
+func nodeIdentityChanged(oldNode *v1.Node, newNode *v1.Node) bool {
+	return oldNode.Spec.ProviderID != newNode.Spec.ProviderID ||
+		oldNode.Status.NodeInfo.KubeletVersion != newNode.Status.NodeInfo.KubeletVersion ||
+		strings.Join(getNodeRoles(oldNode), ",") != strings.Join(getNodeRoles(newNode), ",")
+}
+
+// registerEventHandlers queues the identity of nodes to be written when they are added or their identity changes
+func (nis *nodeIdentitySyncer) registerEventHandlers(nodeInformer cache.SharedIndexInformer) {
+	nodeInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if node, ok := obj.(*v1.Node); ok {
+				nis.queue.Add(node.Name)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNode, oldOk := oldObj.(*v1.Node)
+			newNode, newOk := newObj.(*v1.Node)
+			if oldOk && newOk && nodeIdentityChanged(oldNode, newNode) {
+				nis.queue.Add(newNode.Name)
+			}
+		},
+	})
+
+	return
+}
+
+// enqueueAllNodes queues all nodes, so that metadata changed in VCD is written again
+func (nis *nodeIdentitySyncer) enqueueAllNodes() {
+	nodes, err := nis.nodeLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Unable to list nodes to write their identity to vm metadata: [%v]", err)
+		return
+	}
+	for _, node := range nodes {
+		nis.queue.Add(node.Name)
+	}
+}
+
+// syncNode writes the identity of the node nodeName to the metadata of its VM. Nodes that are gone or have not
+// been initialized with a provider ID are skipped.
+func (nis *nodeIdentitySyncer) syncNode(ctx context.Context, nodeName string) error {
+	node, err := nis.nodeLister.Get(nodeName)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to get node [%s]: [%v]", nodeName, err)
+	}
+	if node.Spec.ProviderID == "" {
+		return nil
+	}
+
+	vmUUID := getUUIDFromProviderID(node.Spec.ProviderID)
+	vmInfo, err := nis.vmInfoCache.GetByUUID(vmUUID)
+	if err != nil {
+		return fmt.Errorf("unable to find vm [%s]: [%v]", vmUUID, err)
+	}
+	changed, err := nis.vmMetadata.SetVMMetadata(ctx, vmInfo.HREF, nis.domain, nis.prefix,
+		nis.identityMetadata(node))
+	if err != nil {
+		return fmt.Errorf("unable to write identity of node [%s] to vm [%s]: [%v]", nodeName, vmInfo.Name, err)
+	}
+	if changed {
+		klog.Infof("Wrote identity of node [%s] to metadata of vm [%s]", nodeName, vmInfo.Name)
+	}
+
+	return nil
+}
+
+func (nis *nodeIdentitySyncer) processNextNode(ctx context.Context) bool {
+	item, shutdown := nis.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer nis.queue.Done(item)
+
+	nodeName := item.(string)
+	if err := nis.syncNode(ctx, nodeName); err != nil {
+		klog.Errorf("Unable to sync identity of node [%s] to vm metadata; retrying: [%v]", nodeName, err)
+		nis.queue.AddRateLimited(item)
+		return true
+	}
+	nis.queue.Forget(item)
+
+	return true
+}
+
+// run writes the identity of queued nodes, and queues all nodes every interval, until stopCh is closed
+func (nis *nodeIdentitySyncer) run(stopCh <-chan struct{}) {
+	defer nis.queue.ShutDown()
+
+	klog.Infof("Writing identity of nodes to vm metadata of domain [%s] with prefix [%s]", nis.domain, nis.prefix)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go wait.Until(func() {
+		for nis.processNextNode(ctx) {
+		}
+	}, 0, stopCh)
+	go wait.Until(nis.enqueueAllNodes, nis.interval, stopCh)
+
+	<-stopCh
+}
@@ -0,0 +1,61 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package ccm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/config"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient/fakebackend"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNodeIdentitySyncNode(t *testing.T) {
+	ctx := context.Background()
+	vms := fakebackend.NewVMs()
+	vmID := vms.AddVM("cluster", "worker-1", "10.0.0.5")
+	vms.SetMetadata(vmID, "k8s.node.nodeName", "set-by-admin")
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "worker-1",
+			Labels: map[string]string{
+				nodeRoleLabelPrefix + "worker": "",
+				nodeRoleLabelPrefix + "gpu":    "",
+			},
+		},
+		Spec: v1.NodeSpec{ProviderID: ProviderName + "://" + vmID},
+		Status: v1.NodeStatus{
+			NodeInfo: v1.NodeSystemInfo{KubeletVersion: "v1.21.2"},
+		},
+	}
+	vmic := newVmInfoCache(vms, time.Hour, time.Minute, 0, config.NodeConfig{})
+	nis := newNodeIdentitySyncer(vms, vmic, newNodeLister(t, node, newNodeWithSystemUUID("worker-2", "")),
+		"cluster-id", vcdclient.MetadataDomainSystem, "k8s.node.", time.Minute)
+
+	expectedMetadata := map[string]string{
+		"k8s.node.nodeName":       "worker-1",
+		"k8s.node.clusterID":      "cluster-id",
+		"k8s.node.roles":          "gpu,worker",
+		"k8s.node.kubeletVersion": "v1.21.2",
+	}
+	for attempt := 1; attempt <= 2; attempt++ {
+		assert.NoError(t, nis.syncNode(ctx, "worker-1"), "Identity of the node should be written [%d]", attempt)
+		assert.Equal(t, expectedMetadata, vms.SystemMetadata(vmID),
+			"Identity should be written to the configured domain [%d]", attempt)
+	}
+	assert.Equal(t, map[string]string{"k8s.node.nodeName": "set-by-admin"}, vms.Metadata(vmID),
+		"Metadata of the other domain should be left alone")
+
+	assert.NoError(t, nis.syncNode(ctx, "worker-2"), "Node without a provider id should be skipped")
+	assert.NoError(t, nis.syncNode(ctx, "worker-3"), "Node that is gone should be skipped")
+
+	return
+}
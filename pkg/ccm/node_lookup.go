@@ -0,0 +1,132 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package ccm
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/config"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog"
+)
+
+// setNodeLister makes the system UUIDs reported by kubelets available to the systemUUID node lookup
+func (vmic *VmInfoCache) setNodeLister(nodeLister corelisters.NodeLister) {
+	vmic.rwLock.Lock()
+	defer vmic.rwLock.Unlock()
+
+	vmic.nodeLister = nodeLister
+}
+
+// GetByNodeName : returns the VM of the Kubernetes node nodeName, which is found as configured by the node config
+func (vmic *VmInfoCache) GetByNodeName(nodeName string) (*VmInfo, error) {
+	if vmic.nodeConfig.VMLookup == "" || vmic.nodeConfig.VMLookup == config.NodeLookupVMName {
+		return vmic.GetByName(nodeName)
+	}
+
+	vmic.rwLock.RLock()
+	vmUUID, ok := vmic.nodeUUIDs[nodeName]
+	vmic.rwLock.RUnlock()
+	if ok {
+		vmInfo, err := vmic.GetByUUID(vmUUID)
+		if !errors.Is(err, vcdclient.ErrNotFound) {
+			return vmInfo, err
+		}
+		klog.Infof("Vm [%s] of node [%s] is gone; looking the node up again", vmUUID, nodeName)
+	}
+
+	vmInfo, err := vmic.findNodeVM(nodeName)
+	if err != nil {
+		if errors.Is(err, vcdclient.ErrNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("unable to find vm of node [%s] by [%s]: [%v]", nodeName,
+			vmic.nodeConfig.VMLookup, err)
+	}
+
+	vmic.rwLock.Lock()
+	vmic.nodeUUIDs[nodeName] = vmInfo.UUID
+	vmic.rwLock.Unlock()
+
+	return vmInfo, nil
+}
+
+// findNodeVM looks up the VM of nodeName in VCD, bypassing nodeUUIDs
+func (vmic *VmInfoCache) findNodeVM(nodeName string) (*VmInfo, error) {
+	switch vmic.nodeConfig.VMLookup {
+	case config.NodeLookupComputerName:
+		return vmic.fetch(func() (*vcdclient.VM, error) {
+			return vmic.vms.FindVMByComputerName(nodeName)
+		})
+
+	case config.NodeLookupMetadata:
+		return vmic.fetch(func() (*vcdclient.VM, error) {
+			return vmic.vms.FindVMByMetadata(vmic.nodeConfig.MetadataKey, nodeName)
+		})
+
+	case config.NodeLookupSystemUUID:
+		systemUUID, err := vmic.getSystemUUID(nodeName)
+		if err != nil {
+			return nil, err
+		}
+		vmInfo, err := vmic.GetByUUID(systemUUID)
+		if !errors.Is(err, vcdclient.ErrNotFound) {
+			return vmInfo, err
+		}
+		// older virtual hardware reports the first three fields of the BIOS UUID in little-endian order
+		swappedUUID, swapErr := swapUUIDByteOrder(systemUUID)
+		if swapErr != nil {
+			return nil, err
+		}
+		return vmic.GetByUUID(swappedUUID)
+	}
+
+	return nil, fmt.Errorf("unknown node lookup [%s]", vmic.nodeConfig.VMLookup)
+}
+
+// getSystemUUID returns the system UUID that the kubelet reported for nodeName
+func (vmic *VmInfoCache) getSystemUUID(nodeName string) (string, error) {
+	vmic.rwLock.RLock()
+	nodeLister := vmic.nodeLister
+	vmic.rwLock.RUnlock()
+	if nodeLister == nil {
+		return "", fmt.Errorf("nodes are not known yet")
+	}
+
+	node, err := nodeLister.Get(nodeName)
+	if err != nil {
+		return "", fmt.Errorf("unable to get node [%s]: [%v]", nodeName, err)
+	}
+	if node.Status.NodeInfo.SystemUUID == "" {
+		return "", fmt.Errorf("node [%s] has not reported its system UUID", nodeName)
+	}
+
+	return strings.ToLower(node.Status.NodeInfo.SystemUUID), nil
+}
+
+// swapUUIDByteOrder reverses the bytes of each of the first three fields of uuid
+func swapUUIDByteOrder(uuid string) (string, error) {
+	fields := strings.Split(uuid, "-")
+	if len(fields) != 5 {
+		return "", fmt.Errorf("invalid uuid [%s]", uuid)
+	}
+	for idx := 0; idx < 3; idx++ {
+		fieldBytes, err := hex.DecodeString(fields[idx])
+		if err != nil {
+			return "", fmt.Errorf("invalid uuid [%s]: [%v]", uuid, err)
+		}
+		for i, j := 0, len(fieldBytes)-1; i < j; i, j = i+1, j-1 {
+			fieldBytes[i], fieldBytes[j] = fieldBytes[j], fieldBytes[i]
+		}
+		fields[idx] = hex.EncodeToString(fieldBytes)
+	}
+
+	return strings.Join(fields, "-"), nil
+}
@@ -0,0 +1,205 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package ccm
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/config"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient/fakebackend"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// newNodeLister returns a lister of nodes
+func newNodeLister(t *testing.T, nodes ...*v1.Node) corelisters.NodeLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, node := range nodes {
+		assert.NoError(t, indexer.Add(node), "Node [%s] should be added to the lister", node.Name)
+	}
+
+	return corelisters.NewNodeLister(indexer)
+}
+
+func newNodeWithSystemUUID(name string, systemUUID string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{
+			NodeInfo: v1.NodeSystemInfo{SystemUUID: systemUUID},
+		},
+	}
+}
+
+func TestSwapUUIDByteOrder(t *testing.T) {
+
+	type TestCase struct {
+		UUID         string
+		SwappedUUID  string
+		ExpectError  bool
+		ErrorComment string
+	}
+
+	testCaseList := []TestCase{
+		{
+			UUID:         "00112233-4455-6677-8899-aabbccddeeff",
+			SwappedUUID:  "33221100-5544-7766-8899-aabbccddeeff",
+			ErrorComment: "First three fields should be reversed byte by byte",
+		},
+		{
+			UUID:         "33221100-5544-7766-8899-aabbccddeeff",
+			SwappedUUID:  "00112233-4455-6677-8899-aabbccddeeff",
+			ErrorComment: "Swapping twice should return the original uuid",
+		},
+		{
+			UUID:         "00112233-4455-6677-8899",
+			ExpectError:  true,
+			ErrorComment: "UUID with four fields should be rejected",
+		},
+		{
+			UUID:         "0011223g-4455-6677-8899-aabbccddeeff",
+			ExpectError:  true,
+			ErrorComment: "UUID with a field that is not hex should be rejected",
+		},
+	}
+
+	for _, testCase := range testCaseList {
+		swappedUUID, err := swapUUIDByteOrder(testCase.UUID)
+		if testCase.ExpectError {
+			assert.Error(t, err, testCase.ErrorComment)
+			continue
+		}
+		assert.NoError(t, err, testCase.ErrorComment)
+		assert.Equal(t, testCase.SwappedUUID, swappedUUID, testCase.ErrorComment)
+	}
+
+	return
+}
+
+func TestGetByNodeName(t *testing.T) {
+
+	type TestCase struct {
+		NodeConfig   config.NodeConfig
+		NodeName     string
+		ExpectedName string
+		ExpectedErr  error
+		ErrorComment string
+	}
+
+	vms := fakebackend.NewVMs()
+	workerID := vms.AddVM("cluster", "worker-vm-1", "10.0.0.5")
+	otherID := vms.AddVM("cluster", "worker-vm-2", "10.0.0.6")
+	vms.SetComputerName(workerID, "worker-1")
+	vms.SetMetadata(workerID, "node-name", "worker-1")
+	// the kubelet of the first VM reports its uuid in the byte order of older virtual hardware
+	swappedUUID, err := swapUUIDByteOrder(vmUUIDKey(workerID))
+	assert.NoError(t, err, "UUID of the VM should be swapped")
+	nodeLister := newNodeLister(t,
+		newNodeWithSystemUUID("worker-1", swappedUUID),
+		newNodeWithSystemUUID("worker-2", vmUUIDKey(otherID)),
+		newNodeWithSystemUUID("worker-3", ""))
+
+	testCaseList := []TestCase{
+		{
+			NodeConfig:   config.NodeConfig{VMLookup: config.NodeLookupVMName},
+			NodeName:     "worker-vm-1",
+			ExpectedName: "worker-vm-1",
+			ErrorComment: "VM should be found by its name",
+		},
+		{
+			NodeConfig:   config.NodeConfig{VMLookup: config.NodeLookupComputerName},
+			NodeName:     "worker-1",
+			ExpectedName: "worker-vm-1",
+			ErrorComment: "VM should be found by its computer name",
+		},
+		{
+			NodeConfig:   config.NodeConfig{VMLookup: config.NodeLookupMetadata, MetadataKey: "node-name"},
+			NodeName:     "worker-1",
+			ExpectedName: "worker-vm-1",
+			ErrorComment: "VM should be found by its metadata",
+		},
+		{
+			NodeConfig:   config.NodeConfig{VMLookup: config.NodeLookupSystemUUID},
+			NodeName:     "worker-2",
+			ExpectedName: "worker-vm-2",
+			ErrorComment: "VM should be found by the system uuid of its node",
+		},
+		{
+			NodeConfig:   config.NodeConfig{VMLookup: config.NodeLookupSystemUUID},
+			NodeName:     "worker-1",
+			ExpectedName: "worker-vm-1",
+			ErrorComment: "VM should be found by the swapped system uuid of its node",
+		},
+		{
+			NodeConfig:   config.NodeConfig{VMLookup: config.NodeLookupComputerName},
+			NodeName:     "worker-4",
+			ExpectedErr:  vcdclient.ErrNotFound,
+			ErrorComment: "Node without a VM should not be found",
+		},
+		{
+			NodeConfig:   config.NodeConfig{VMLookup: config.NodeLookupSystemUUID},
+			NodeName:     "worker-3",
+			ErrorComment: "Node without a system uuid should not be looked up",
+		},
+	}
+
+	for _, testCase := range testCaseList {
+		vmic := newVmInfoCache(vms, time.Hour, time.Minute, 0, testCase.NodeConfig)
+		vmic.setNodeLister(nodeLister)
+		vmInfo, err := vmic.GetByNodeName(testCase.NodeName)
+		if testCase.ExpectedName == "" {
+			if assert.Error(t, err, testCase.ErrorComment) && testCase.ExpectedErr != nil {
+				assert.True(t, errors.Is(err, testCase.ExpectedErr), testCase.ErrorComment)
+			}
+			continue
+		}
+		if assert.NoError(t, err, testCase.ErrorComment) {
+			assert.Equal(t, testCase.ExpectedName, vmInfo.Name, testCase.ErrorComment)
+		}
+	}
+
+	return
+}
+
+func TestGetByNodeNameVMGone(t *testing.T) {
+	vms := fakebackend.NewVMs()
+	oldID := vms.AddVM("cluster", "worker-vm-1", "10.0.0.5")
+	vms.SetComputerName(oldID, "worker-1")
+	vmic := newVmInfoCache(vms, time.Hour, time.Minute, 0,
+		config.NodeConfig{VMLookup: config.NodeLookupComputerName})
+
+	vmInfo, err := vmic.GetByNodeName("worker-1")
+	assert.NoError(t, err, "VM should be found by its computer name")
+	assert.Equal(t, oldID, vmInfo.UUID, "VM of the node should be found")
+
+	// a lookup by computer name would no longer find the VM
+	vms.SetComputerName(oldID, "renamed-worker-1")
+	vmInfo, err = vmic.GetByNodeName("worker-1")
+	assert.NoError(t, err, "VM of the node should be remembered")
+	assert.Equal(t, oldID, vmInfo.UUID, "Remembered VM should be returned without looking the node up")
+
+	// the VM is replaced by one with the same computer name, and the refresh drops the old VM
+	vms.RemoveVM(oldID)
+	newID := vms.AddVM("cluster", "worker-vm-2", "10.0.0.6")
+	vms.SetComputerName(newID, "worker-1")
+	assert.NoError(t, vmic.refresh(), "VMs should be listed")
+
+	vmInfo, err = vmic.GetByNodeName("worker-1")
+	assert.NoError(t, err, "Node should be looked up again once its VM is gone")
+	assert.Equal(t, newID, vmInfo.UUID, "New VM of the node should be found")
+
+	vms.RemoveVM(newID)
+	assert.NoError(t, vmic.refresh(), "VMs should be listed")
+	_, err = vmic.GetByNodeName("worker-1")
+	assert.True(t, errors.Is(err, vcdclient.ErrNotFound), "Node whose VM is gone should not be found")
+
+	return
+}
@@ -0,0 +1,171 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package ccm
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog"
+)
+
+const (
+	// metadataLabelsAnnotation lists the keys of the node labels that were applied from VM metadata. Labels that
+	// are not listed were set by someone else and are never changed.
+	metadataLabelsAnnotation = "vcloud.vmware.com/metadata-labels"
+	// metadataTaintsAnnotation lists the key:effect of the node taints that were applied from VM metadata
+	metadataTaintsAnnotation = "vcloud.vmware.com/metadata-taints"
+)
+
+// parseMetadata returns the labels and taints in the metadata of the VM vmName, which are the entries whose keys
+// start with labelPrefix and taintPrefix. Entries that are not valid labels or taints are logged and skipped.
+func parseMetadata(vmName string, metadata map[string]string, labelPrefix string,
+	taintPrefix string) (map[string]string, []v1.Taint) {
+	metadataLabels := make(map[string]string)
+	metadataTaints := make([]v1.Taint, 0)
+	for key, value := range metadata {
+		switch {
+		case labelPrefix != "" && strings.HasPrefix(key, labelPrefix):
+			labelKey := strings.TrimPrefix(key, labelPrefix)
+			errs := append(validation.IsQualifiedName(labelKey), validation.IsValidLabelValue(value)...)
+			if len(errs) > 0 {
+				klog.Errorf("Skipping metadata [%s] of vm [%s]: invalid label: [%s]", key, vmName,
+					strings.Join(errs, "; "))
+				continue
+			}
+			metadataLabels[labelKey] = value
+
+		case taintPrefix != "" && strings.HasPrefix(key, taintPrefix):
+			taint, err := parseTaint(strings.TrimPrefix(key, taintPrefix), value)
+			if err != nil {
+				klog.Errorf("Skipping metadata [%s] of vm [%s]: [%v]", key, vmName, err)
+				continue
+			}
+			metadataTaints = append(metadataTaints, *taint)
+		}
+	}
+
+	return metadataLabels, metadataTaints
+}
+
+// parseTaint returns the taint with key from a metadata value of the form [value:]effect
+func parseTaint(key string, metadataValue string) (*v1.Taint, error) {
+	if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid taint key [%s]: [%s]", key, strings.Join(errs, "; "))
+	}
+
+	taint := &v1.Taint{Key: key}
+	effect := metadataValue
+	if sep := strings.LastIndex(metadataValue, ":"); sep >= 0 {
+		taint.Value, effect = metadataValue[:sep], metadataValue[sep+1:]
+		if errs := validation.IsValidLabelValue(taint.Value); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid taint value [%s]: [%s]", taint.Value, strings.Join(errs, "; "))
+		}
+	}
+	switch v1.TaintEffect(effect) {
+	case v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+		taint.Effect = v1.TaintEffect(effect)
+	default:
+		return nil, fmt.Errorf("invalid taint effect [%s] for key [%s]", effect, key)
+	}
+
+	return taint, nil
+}
+
+// taintID identifies a taint by key and effect, as the API server does
+func taintID(taint *v1.Taint) string {
+	return fmt.Sprintf("%s:%s", taint.Key, taint.Effect)
+}
+
+// splitAnnotation returns the set of comma separated entries of the annotation key of node
+func splitAnnotation(node *v1.Node, key string) map[string]bool {
+	entries := make(map[string]bool)
+	for _, entry := range strings.Split(node.Annotations[key], ",") {
+		if entry != "" {
+			entries[entry] = true
+		}
+	}
+
+	return entries
+}
+
+// setAnnotation sets the annotation key of node to the sorted entries, or removes it if there are none
+func setAnnotation(node *v1.Node, key string, entries []string) {
+	if len(entries) == 0 {
+		delete(node.Annotations, key)
+		return
+	}
+	if node.Annotations == nil {
+		node.Annotations = make(map[string]string)
+	}
+	sort.Strings(entries)
+	node.Annotations[key] = strings.Join(entries, ",")
+}
+
+// applyMetadataToNode makes the labels and taints of node that were applied from metadata those in metadataLabels
+// and metadataTaints. Labels and taints that were set by someone else are left alone, even if the metadata has
+// them too. Returns true if node was changed.
+func applyMetadataToNode(node *v1.Node, metadataLabels map[string]string, metadataTaints []v1.Taint) bool {
+	original := node.DeepCopy()
+
+	appliedLabels := splitAnnotation(node, metadataLabelsAnnotation)
+	for key := range appliedLabels {
+		if _, ok := metadataLabels[key]; !ok {
+			delete(node.Labels, key)
+		}
+	}
+	labelKeys := make([]string, 0)
+	for key, value := range metadataLabels {
+		if _, ok := node.Labels[key]; ok && !appliedLabels[key] {
+			klog.Infof("Not applying vm metadata label [%s] to node [%s], which has the label already",
+				key, node.Name)
+			continue
+		}
+		if node.Labels == nil {
+			node.Labels = make(map[string]string)
+		}
+		node.Labels[key] = value
+		labelKeys = append(labelKeys, key)
+	}
+	setAnnotation(node, metadataLabelsAnnotation, labelKeys)
+
+	appliedTaints := splitAnnotation(node, metadataTaintsAnnotation)
+	wantedTaints := make(map[string]*v1.Taint)
+	for idx := range metadataTaints {
+		wantedTaints[taintID(&metadataTaints[idx])] = &metadataTaints[idx]
+	}
+	taints := make([]v1.Taint, 0)
+	for idx := range node.Spec.Taints {
+		id := taintID(&node.Spec.Taints[idx])
+		if !appliedTaints[id] {
+			if _, ok := wantedTaints[id]; ok {
+				klog.Infof("Not applying vm metadata taint [%s] to node [%s], which has the taint already",
+					id, node.Name)
+				delete(wantedTaints, id)
+			}
+			taints = append(taints, node.Spec.Taints[idx])
+		}
+	}
+	taintIDs := make([]string, 0)
+	for id := range wantedTaints {
+		taintIDs = append(taintIDs, id)
+	}
+	sort.Strings(taintIDs)
+	for _, id := range taintIDs {
+		taints = append(taints, *wantedTaints[id])
+	}
+	setAnnotation(node, metadataTaintsAnnotation, taintIDs)
+	if len(taints) == 0 {
+		taints = nil
+	}
+	node.Spec.Taints = taints
+
+	return !reflect.DeepEqual(original, node)
+}
@@ -0,0 +1,108 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package ccm
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/config"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog"
+)
+
+// nodeMetadataSyncer applies the VM metadata entries with the configured prefixes as labels and taints of the
+// nodes of the VMs
+type nodeMetadataSyncer struct {
+	vmMetadata  vcdclient.VMMetadata
+	vmInfoCache *VmInfoCache
+	kubeClient  kubernetes.Interface
+	nodeLister  corelisters.NodeLister
+
+	labelPrefix string
+	taintPrefix string
+	interval    time.Duration
+}
+
+func newNodeMetadataSyncer(vmMetadata vcdclient.VMMetadata, vmInfoCache *VmInfoCache, kubeClient kubernetes.Interface,
+	nodeLister corelisters.NodeLister, nodeConfig config.NodeConfig) *nodeMetadataSyncer {
+	return &nodeMetadataSyncer{
+		vmMetadata:  vmMetadata,
+		vmInfoCache: vmInfoCache,
+		kubeClient:  kubeClient,
+		nodeLister:  nodeLister,
+		labelPrefix: nodeConfig.LabelMetadataPrefix,
+		taintPrefix: nodeConfig.TaintMetadataPrefix,
+		interval:    nodeConfig.MetadataSyncInterval,
+	}
+}
+
+// run syncs the metadata of all nodes every interval until stopCh is closed
+func (nms *nodeMetadataSyncer) run(stopCh <-chan struct{}) {
+	klog.Infof("Syncing vm metadata with label prefix [%s] and taint prefix [%s] to nodes every [%v]",
+		nms.labelPrefix, nms.taintPrefix, nms.interval)
+	wait.Until(nms.syncAll, nms.interval, stopCh)
+}
+
+func (nms *nodeMetadataSyncer) syncAll() {
+	nodes, err := nms.nodeLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Unable to list nodes to sync vm metadata: [%v]", err)
+		return
+	}
+	for _, node := range nodes {
+		if err := nms.syncNode(node); err != nil {
+			klog.Errorf("Unable to sync vm metadata to node [%s]: [%v]", node.Name, err)
+		}
+	}
+}
+
+// syncNode applies the metadata of the VM of node, which must have been initialized with a provider ID
+func (nms *nodeMetadataSyncer) syncNode(node *v1.Node) error {
+	if node.Spec.ProviderID == "" {
+		return nil
+	}
+
+	vmUUID := getUUIDFromProviderID(node.Spec.ProviderID)
+	vmInfo, err := nms.vmInfoCache.GetByUUID(vmUUID)
+	if err != nil {
+		return fmt.Errorf("unable to find vm [%s]: [%v]", vmUUID, err)
+	}
+	metadata, err := nms.vmMetadata.GetVMMetadata(vmInfo.HREF)
+	if err != nil {
+		return fmt.Errorf("unable to get metadata of vm [%s]: [%v]", vmInfo.Name, err)
+	}
+	metadataLabels, metadataTaints := parseMetadata(vmInfo.Name, metadata, nms.labelPrefix, nms.taintPrefix)
+
+	// the cached node tells whether anything has to change; the update is made on the latest node
+	if !applyMetadataToNode(node.DeepCopy(), metadataLabels, metadataTaints) {
+		return nil
+	}
+	ctx := context.Background()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latestNode, err := nms.kubeClient.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if !applyMetadataToNode(latestNode, metadataLabels, metadataTaints) {
+			return nil
+		}
+		if _, err = nms.kubeClient.CoreV1().Nodes().Update(ctx, latestNode, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		klog.Infof("Applied metadata of vm [%s] to labels and taints of node [%s]", vmInfo.Name, node.Name)
+
+		return nil
+	})
+}
@@ -0,0 +1,188 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package ccm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseTaint(t *testing.T) {
+
+	type TestCase struct {
+		Key           string
+		MetadataValue string
+		ExpectedTaint *v1.Taint
+		ErrorComment  string
+	}
+
+	testCaseList := []TestCase{
+		{
+			Key:           "dedicated",
+			MetadataValue: "NoSchedule",
+			ExpectedTaint: &v1.Taint{Key: "dedicated", Effect: v1.TaintEffectNoSchedule},
+			ErrorComment:  "Taint without a value should be parsed",
+		},
+		{
+			Key:           "dedicated",
+			MetadataValue: "gpu:NoExecute",
+			ExpectedTaint: &v1.Taint{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoExecute},
+			ErrorComment:  "Taint with a value should be parsed",
+		},
+		{
+			Key:           "dedicated",
+			MetadataValue: "gpu:Sometimes",
+			ErrorComment:  "Taint with an unknown effect should be rejected",
+		},
+		{
+			Key:           "dedicated",
+			MetadataValue: "not a value:NoSchedule",
+			ErrorComment:  "Taint with an invalid value should be rejected",
+		},
+		{
+			Key:           "not a key",
+			MetadataValue: "NoSchedule",
+			ErrorComment:  "Taint with an invalid key should be rejected",
+		},
+	}
+
+	for _, testCase := range testCaseList {
+		taint, err := parseTaint(testCase.Key, testCase.MetadataValue)
+		if testCase.ExpectedTaint == nil {
+			assert.Error(t, err, testCase.ErrorComment)
+			continue
+		}
+		if assert.NoError(t, err, testCase.ErrorComment) {
+			assert.Equal(t, testCase.ExpectedTaint, taint, testCase.ErrorComment)
+		}
+	}
+
+	return
+}
+
+func TestParseMetadata(t *testing.T) {
+	metadataLabels, metadataTaints := parseMetadata("vm", map[string]string{
+		"k8s.label/zone":       "zone-a",
+		"k8s.label/not a key":  "value",
+		"k8s.taint/dedicated":  "gpu:NoSchedule",
+		"k8s.taint/invalid":    "Sometimes",
+		"k8s.identity/cluster": "cluster",
+	}, "k8s.label/", "k8s.taint/")
+
+	assert.Equal(t, map[string]string{"zone": "zone-a"}, metadataLabels,
+		"Only valid entries with the label prefix should be labels")
+	assert.Equal(t, []v1.Taint{{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}}, metadataTaints,
+		"Only valid entries with the taint prefix should be taints")
+
+	return
+}
+
+func TestApplyMetadataToNode(t *testing.T) {
+
+	type TestCase struct {
+		Labels          map[string]string
+		Annotations     map[string]string
+		Taints          []v1.Taint
+		MetadataLabels  map[string]string
+		MetadataTaints  []v1.Taint
+		ExpectedChanged bool
+		ExpectedLabels  map[string]string
+		ExpectedApplied map[string]string
+		ExpectedTaints  []v1.Taint
+		ErrorComment    string
+	}
+
+	noScheduleTaint := v1.Taint{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}
+	manualTaint := v1.Taint{Key: "dedicated", Value: "manual", Effect: v1.TaintEffectNoSchedule}
+
+	testCaseList := []TestCase{
+		{
+			Labels:          map[string]string{"role": "manual"},
+			MetadataLabels:  map[string]string{"role": "metadata", "zone": "zone-a"},
+			ExpectedChanged: true,
+			ExpectedLabels:  map[string]string{"role": "manual", "zone": "zone-a"},
+			ExpectedApplied: map[string]string{metadataLabelsAnnotation: "zone"},
+			ErrorComment:    "Manual label should be kept when the metadata has the same label",
+		},
+		{
+			Labels:          map[string]string{"role": "manual", "zone": "zone-a"},
+			Annotations:     map[string]string{metadataLabelsAnnotation: "zone"},
+			MetadataLabels:  map[string]string{},
+			ExpectedChanged: true,
+			ExpectedLabels:  map[string]string{"role": "manual"},
+			ExpectedApplied: map[string]string{},
+			ErrorComment:    "Label removed from the metadata should be removed from the node",
+		},
+		{
+			Labels:          map[string]string{"zone": "zone-a"},
+			Annotations:     map[string]string{metadataLabelsAnnotation: "zone"},
+			MetadataLabels:  map[string]string{"zone": "zone-b"},
+			ExpectedChanged: true,
+			ExpectedLabels:  map[string]string{"zone": "zone-b"},
+			ExpectedApplied: map[string]string{metadataLabelsAnnotation: "zone"},
+			ErrorComment:    "Label changed in the metadata should be changed on the node",
+		},
+		{
+			Taints:          []v1.Taint{manualTaint},
+			MetadataTaints:  []v1.Taint{noScheduleTaint},
+			ExpectedChanged: false,
+			ExpectedTaints:  []v1.Taint{manualTaint},
+			ExpectedApplied: map[string]string{},
+			ErrorComment:    "Manual taint should be kept when the metadata has a taint with the same key and effect",
+		},
+		{
+			MetadataTaints:  []v1.Taint{noScheduleTaint},
+			ExpectedChanged: true,
+			ExpectedTaints:  []v1.Taint{noScheduleTaint},
+			ExpectedApplied: map[string]string{metadataTaintsAnnotation: "dedicated:NoSchedule"},
+			ErrorComment:    "Taint in the metadata should be applied",
+		},
+		{
+			Annotations:     map[string]string{metadataTaintsAnnotation: "dedicated:NoSchedule"},
+			Taints:          []v1.Taint{noScheduleTaint},
+			ExpectedChanged: true,
+			ExpectedTaints:  nil,
+			ExpectedApplied: map[string]string{},
+			ErrorComment:    "Taint removed from the metadata should be removed from the node",
+		},
+		{
+			Labels:          map[string]string{"zone": "zone-a"},
+			Annotations:     map[string]string{metadataLabelsAnnotation: "zone"},
+			MetadataLabels:  map[string]string{"zone": "zone-a"},
+			ExpectedChanged: false,
+			ExpectedLabels:  map[string]string{"zone": "zone-a"},
+			ExpectedApplied: map[string]string{metadataLabelsAnnotation: "zone"},
+			ErrorComment:    "Node should not change when the metadata is already applied",
+		},
+	}
+
+	for _, testCase := range testCaseList {
+		node := &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "node",
+				Labels:      testCase.Labels,
+				Annotations: testCase.Annotations,
+			},
+			Spec: v1.NodeSpec{
+				Taints: testCase.Taints,
+			},
+		}
+		changed := applyMetadataToNode(node, testCase.MetadataLabels, testCase.MetadataTaints)
+		assert.Equal(t, testCase.ExpectedChanged, changed, testCase.ErrorComment)
+		if testCase.ExpectedLabels != nil {
+			assert.Equal(t, testCase.ExpectedLabels, node.Labels, testCase.ErrorComment)
+		}
+		assert.Equal(t, testCase.ExpectedTaints, node.Spec.Taints, testCase.ErrorComment)
+		for _, key := range []string{metadataLabelsAnnotation, metadataTaintsAnnotation} {
+			assert.Equal(t, testCase.ExpectedApplied[key], node.Annotations[key], testCase.ErrorComment)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,104 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package ccm
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/config"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+)
+
+const (
+	// nodeProviderIDIndex indexes nodes by the VM uuid in their provider ID
+	nodeProviderIDIndex = "providerID"
+
+	// the reasons of the node events that report the VCD status of the VM of a node
+	vmShutdownEventReason = "VMShutdown"
+	vmRunningEventReason  = "VMRunning"
+)
+
+// isVMShutdown returns true if the node of the VM of vmInfo is shut down according to shutdownConfig, along with
+// a description of the VCD state of the VM
+func isVMShutdown(vmInfo *VmInfo, shutdownConfig *config.ShutdownConfig) (bool, string) {
+	state := vmInfo.Status
+	if vmInfo.MaintenanceMode {
+		state = fmt.Sprintf("%s in maintenance mode", vmInfo.Status)
+		if shutdownConfig.MaintenanceMode {
+			return true, state
+		}
+	}
+	for _, status := range shutdownConfig.VMStatuses {
+		if vmInfo.Status == status {
+			return true, state
+		}
+	}
+
+	return false, state
+}
+
+// nodeProviderIDIndexFunc indexes a node by the VM uuid in its provider ID
+func nodeProviderIDIndexFunc(obj interface{}) ([]string, error) {
+	node, ok := obj.(*v1.Node)
+	if !ok || node.Spec.ProviderID == "" {
+		return []string{}, nil
+	}
+
+	return []string{getUUIDFromProviderID(node.Spec.ProviderID)}, nil
+}
+
+// vmStatusReporter records node events when the VCD state of the VM of a node changes, to explain why the node is
+// or is not considered shut down
+type vmStatusReporter struct {
+	recorder    record.EventRecorder
+	nodeIndexer cache.Indexer
+
+	lock sync.Mutex
+	// vmStates holds the last reported state by VM uuid
+	vmStates map[string]string
+}
+
+func newVMStatusReporter(recorder record.EventRecorder, nodeIndexer cache.Indexer) *vmStatusReporter {
+	return &vmStatusReporter{
+		recorder:    recorder,
+		nodeIndexer: nodeIndexer,
+		vmStates:    make(map[string]string),
+	}
+}
+
+// report records an event on the node of the VM vmUUID if state differs from the last reported state
+func (reporter *vmStatusReporter) report(vmUUID string, state string, shutdown bool) {
+	reporter.lock.Lock()
+	if reporter.vmStates[vmUUID] == state {
+		reporter.lock.Unlock()
+		return
+	}
+	reporter.vmStates[vmUUID] = state
+	reporter.lock.Unlock()
+
+	nodes, err := reporter.nodeIndexer.ByIndex(nodeProviderIDIndex, vmUUID)
+	if err != nil {
+		klog.Errorf("Unable to find node of vm [%s]: [%v]", vmUUID, err)
+		return
+	}
+	for _, obj := range nodes {
+		node, ok := obj.(*v1.Node)
+		if !ok {
+			continue
+		}
+		if shutdown {
+			reporter.recorder.Eventf(node, v1.EventTypeWarning, vmShutdownEventReason,
+				"VM [%s] is %s, so the node is shut down", vmUUID, state)
+		} else {
+			reporter.recorder.Eventf(node, v1.EventTypeNormal, vmRunningEventReason,
+				"VM [%s] is %s, so the node is not shut down", vmUUID, state)
+		}
+	}
+}
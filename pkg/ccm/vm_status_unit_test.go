@@ -0,0 +1,205 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package ccm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/config"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient/fakebackend"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestIsVMShutdown(t *testing.T) {
+
+	type TestCase struct {
+		Status          string
+		MaintenanceMode bool
+		ShutdownConfig  config.ShutdownConfig
+		Shutdown        bool
+		State           string
+		ErrorComment    string
+	}
+
+	shutdownConfig := config.ShutdownConfig{VMStatuses: []string{"POWERED_OFF", "SUSPENDED"}}
+	maintenanceShutdownConfig := config.ShutdownConfig{VMStatuses: []string{"POWERED_OFF"}, MaintenanceMode: true}
+
+	testCaseList := []TestCase{
+		{
+			Status:         "POWERED_ON",
+			ShutdownConfig: shutdownConfig,
+			Shutdown:       false,
+			State:          "POWERED_ON",
+			ErrorComment:   "Powered on VM should be running",
+		},
+		{
+			Status:         "POWERED_OFF",
+			ShutdownConfig: shutdownConfig,
+			Shutdown:       true,
+			State:          "POWERED_OFF",
+			ErrorComment:   "Powered off VM should be shut down",
+		},
+		{
+			Status:         "SUSPENDED",
+			ShutdownConfig: shutdownConfig,
+			Shutdown:       true,
+			State:          "SUSPENDED",
+			ErrorComment:   "VM with a configured status should be shut down",
+		},
+		{
+			Status:         "SUSPENDED",
+			ShutdownConfig: maintenanceShutdownConfig,
+			Shutdown:       false,
+			State:          "SUSPENDED",
+			ErrorComment:   "VM with a status that is not configured should be running",
+		},
+		{
+			Status:          "POWERED_ON",
+			MaintenanceMode: true,
+			ShutdownConfig:  shutdownConfig,
+			Shutdown:        false,
+			State:           "POWERED_ON in maintenance mode",
+			ErrorComment:    "VM in maintenance mode should be running unless configured otherwise",
+		},
+		{
+			Status:          "POWERED_ON",
+			MaintenanceMode: true,
+			ShutdownConfig:  maintenanceShutdownConfig,
+			Shutdown:        true,
+			State:           "POWERED_ON in maintenance mode",
+			ErrorComment:    "VM in maintenance mode should be shut down if configured",
+		},
+		{
+			Status:         "POWERED_ON",
+			ShutdownConfig: maintenanceShutdownConfig,
+			Shutdown:       false,
+			State:          "POWERED_ON",
+			ErrorComment:   "VM out of maintenance mode should be running",
+		},
+	}
+
+	for _, testCase := range testCaseList {
+		shutdown, state := isVMShutdown(&VmInfo{
+			Status:          testCase.Status,
+			MaintenanceMode: testCase.MaintenanceMode,
+		}, &testCase.ShutdownConfig)
+		assert.Equal(t, testCase.Shutdown, shutdown, testCase.ErrorComment)
+		assert.Equal(t, testCase.State, state, testCase.ErrorComment)
+	}
+
+	return
+}
+
+// newNodeIndexer returns an indexer of nodes by the VM uuid in their provider ID
+func newNodeIndexer(t *testing.T, nodes ...*v1.Node) cache.Indexer {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{nodeProviderIDIndex: nodeProviderIDIndexFunc})
+	for _, node := range nodes {
+		assert.NoError(t, indexer.Add(node), "Node [%s] should be indexed", node.Name)
+	}
+
+	return indexer
+}
+
+func newNodeWithProviderID(name string, vmID string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       v1.NodeSpec{ProviderID: ProviderName + "://" + vmID},
+	}
+}
+
+func TestVMStatusReporterReport(t *testing.T) {
+
+	type TestCase struct {
+		VMUUID        string
+		State         string
+		Shutdown      bool
+		ExpectedEvent string
+		ErrorComment  string
+	}
+
+	vmUUID := "00000001-0000-4000-8000-000000000001"
+	recorder := record.NewFakeRecorder(10)
+	reporter := newVMStatusReporter(recorder, newNodeIndexer(t,
+		newNodeWithProviderID("worker-1", vmUUID),
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-2"}}))
+
+	testCaseList := []TestCase{
+		{
+			VMUUID:        vmUUID,
+			State:         "POWERED_ON",
+			ExpectedEvent: "Normal VMRunning VM [" + vmUUID + "] is POWERED_ON, so the node is not shut down",
+			ErrorComment:  "First state of the VM should be reported",
+		},
+		{
+			VMUUID:       vmUUID,
+			State:        "POWERED_ON",
+			ErrorComment: "Same state should not be reported again",
+		},
+		{
+			VMUUID:        vmUUID,
+			State:         "POWERED_ON in maintenance mode",
+			Shutdown:      true,
+			ExpectedEvent: "Warning VMShutdown VM [" + vmUUID + "] is POWERED_ON in maintenance mode, so the node is shut down",
+			ErrorComment:  "Change of the maintenance mode should be reported",
+		},
+		{
+			VMUUID:        vmUUID,
+			State:         "POWERED_OFF",
+			Shutdown:      true,
+			ExpectedEvent: "Warning VMShutdown VM [" + vmUUID + "] is POWERED_OFF, so the node is shut down",
+			ErrorComment:  "Change of the status should be reported",
+		},
+		{
+			VMUUID:       "00000002-0000-4000-8000-000000000002",
+			State:        "POWERED_OFF",
+			Shutdown:     true,
+			ErrorComment: "VM without a node should not be reported",
+		},
+	}
+
+	for _, testCase := range testCaseList {
+		reporter.report(testCase.VMUUID, testCase.State, testCase.Shutdown)
+		select {
+		case event := <-recorder.Events:
+			assert.Equal(t, testCase.ExpectedEvent, event, testCase.ErrorComment)
+		default:
+			assert.Empty(t, testCase.ExpectedEvent, testCase.ErrorComment)
+		}
+	}
+
+	return
+}
+
+func TestInstanceShutdownByProviderIDMaintenanceMode(t *testing.T) {
+	ctx := context.Background()
+	vms := fakebackend.NewVMs()
+	vmID := vms.AddVM("cluster", "worker-1", "10.0.0.5")
+	vms.SetVMStatus(vmID, "POWERED_ON", true)
+	vmic := newVmInfoCache(vms, time.Hour, time.Minute, 0, config.NodeConfig{})
+	i := newInstances(vmic, config.ShutdownConfig{VMStatuses: []string{"POWERED_OFF"}, MaintenanceMode: true})
+	recorder := record.NewFakeRecorder(10)
+	i.statusReporter = newVMStatusReporter(recorder, newNodeIndexer(t, newNodeWithProviderID("worker-1", vmID)))
+
+	// VCD only reports the maintenance mode of listed VMs
+	shutdown, err := i.InstanceShutdownByProviderID(ctx, ProviderName+"://"+vmID)
+	assert.NoError(t, err, "Shutdown of the found VM should be known")
+	assert.False(t, shutdown, "Found VM should not be known to be in maintenance mode")
+
+	assert.NoError(t, vmic.refresh(), "VMs should be listed")
+	shutdown, err = i.InstanceShutdownByProviderID(ctx, ProviderName+"://"+vmID)
+	assert.NoError(t, err, "Shutdown of the listed VM should be known")
+	assert.True(t, shutdown, "Listed VM in maintenance mode should be shut down")
+	assert.Len(t, recorder.Events, 2, "Both states of the VM should be reported")
+
+	return
+}
@@ -6,167 +6,269 @@
 package ccm
 
 import (
+	"errors"
 	"fmt"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/config"
 	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient"
 	"k8s.io/klog"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/vmware/go-vcloud-director/v2/govcd"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	v1helper "k8s.io/cloud-provider/node/helpers"
 )
 
 type VmInfo struct {
-	vm        *govcd.VM
 	UUID      string
+	HREF      string
 	Name      string
 	Type      string
+	Status    string
 	Addresses []v1.NodeAddress
 	TimeStamp time.Time
+	// MaintenanceMode is only known for VMs listed by the query API
+	MaintenanceMode bool
 }
 
 // VmInfoCache caches VM details. Ideally we need a LRU cache with ttl-based expiry. But since we have ~10k nodes
 // per cluster, we can ignore limits and expiry.
+// All VMs of the cluster vApp are listed in the background every refreshInterval, delayed by up to
+// refreshJitter, so that the periodic node syncs are served from the cache. Misses and entries older than
+// expiry are fetched on demand.
 type VmInfoCache struct {
-	rwLock    sync.RWMutex
-	expiry    time.Duration
-	nameMap   map[string]*VmInfo
-	uuidMap   map[string]*VmInfo
-	vcdClient *vcdclient.Client
+	rwLock  sync.RWMutex
+	expiry  time.Duration
+	nameMap map[string]*VmInfo
+	uuidMap map[string]*VmInfo
+	vms     vcdclient.VMInventory
+
+	refreshInterval time.Duration
+	refreshJitter   time.Duration
+
+	// nodeConfig tells how the VM of a node is found. For lookups other than by VM name, nodeUUIDs maps node
+	// names to the uuids of their VMs. It survives refreshes, as finding a VM can take a request per VM.
+	nodeConfig config.NodeConfig
+	nodeUUIDs  map[string]string
+	// nodeLister gets the system UUIDs that kubelets report; it is set once the node informer is started
+	nodeLister corelisters.NodeLister
 }
 
-func newVmInfoCache(client *vcdclient.Client, expiry time.Duration) *VmInfoCache {
+func newVmInfoCache(vms vcdclient.VMInventory, expiry time.Duration, refreshInterval time.Duration,
+	refreshJitter time.Duration, nodeConfig config.NodeConfig) *VmInfoCache {
 	return &VmInfoCache{
-		expiry:    expiry,
-		nameMap:   make(map[string]*VmInfo),
-		uuidMap:   make(map[string]*VmInfo),
-		vcdClient: client,
+		expiry:          expiry,
+		nameMap:         make(map[string]*VmInfo),
+		uuidMap:         make(map[string]*VmInfo),
+		vms:             vms,
+		refreshInterval: refreshInterval,
+		refreshJitter:   refreshJitter,
+		nodeConfig:      nodeConfig,
+		nodeUUIDs:       make(map[string]string),
 	}
 }
 
-func (vmic *VmInfoCache) vmToVMInfo(vm *govcd.VM, captureTime time.Time) (*VmInfo, error) {
+// vmUUIDKey returns the key of the uuid map for vmUUID, which may or may not have the VCD prefix
+func vmUUIDKey(vmUUID string) string {
+	return strings.ToLower(strings.TrimPrefix(vmUUID, vcdclient.VCDVMIDPrefix))
+}
 
-	if vm == nil {
-		return nil, fmt.Errorf("vm parameter should not be nil")
-	}
-	if vm.VM == nil {
-		return nil, fmt.Errorf("vm.VM struct should not be nil")
+// getNodeAddresses returns the addresses of a VM with the IPs of its network connections
+func getNodeAddresses(vmName string, ipAddresses []string) []v1.NodeAddress {
+	vmAddresses := make([]v1.NodeAddress, 0)
+	for _, ipAddress := range ipAddresses {
+		v1helper.AddToNodeAddresses(&vmAddresses,
+			v1.NodeAddress{
+				Type:    v1.NodeInternalIP,
+				Address: ipAddress,
+			},
+			v1.NodeAddress{
+				Type:    v1.NodeExternalIP,
+				Address: ipAddress,
+			},
+			v1.NodeAddress{
+				Type:    v1.NodeHostName,
+				Address: vmName,
+			})
 	}
 
+	return vmAddresses
+}
+
+// vmToVMInfo converts a VM of the inventory, which only has the maintenance mode and the IP of the primary
+// network connection of the VM if it was listed
+func (vmic *VmInfoCache) vmToVMInfo(vm *vcdclient.VM, captureTime time.Time) *VmInfo {
 	vmInfo := &VmInfo{
-		vm:        vm,
-		UUID:      vm.VM.ID,
-		Name:      vm.VM.Name,
-		Type:      "",
-		TimeStamp: captureTime,
-	}
-
-	if vm.VM.NetworkConnectionSection != nil {
-		vmAddresses := make([]v1.NodeAddress, 0)
-		for _, netConn := range vm.VM.NetworkConnectionSection.NetworkConnection {
-			v1helper.AddToNodeAddresses(&vmAddresses,
-				v1.NodeAddress{
-					Type:    v1.NodeInternalIP,
-					Address: netConn.IPAddress,
-				},
-				v1.NodeAddress{
-					Type:    v1.NodeExternalIP,
-					Address: netConn.IPAddress,
-				},
-				v1.NodeAddress{
-					Type:    v1.NodeHostName,
-					Address: vm.VM.Name,
-				})
-		}
-		vmInfo.Addresses = vmAddresses
+		UUID:            vm.ID,
+		HREF:            vm.HREF,
+		Name:            vm.Name,
+		Type:            "",
+		Status:          vm.Status,
+		MaintenanceMode: vm.MaintenanceMode,
+		TimeStamp:       captureTime,
+	}
+	if len(vm.IPAddresses) > 0 {
+		vmInfo.Addresses = getNodeAddresses(vm.Name, vm.IPAddresses)
 	}
 
-	return vmInfo, nil
+	return vmInfo
 }
 
-func (vmic *VmInfoCache) GetByName(vmName string) (*VmInfo, error) {
-	vmic.rwLock.Lock()
-	defer vmic.rwLock.Unlock()
+// vmInfoKey selects the map of the cache in which get looks up a key
+type vmInfoKey int
 
-	now := time.Now()
-	if vmInfo, ok := vmic.nameMap[vmName]; ok {
-		if now.Sub(vmInfo.TimeStamp) < vmic.expiry {
-			klog.Infof("now is [%v], info captured at [%v], hence reusing cached value", now, vmInfo.TimeStamp)
-			return vmInfo, nil
-		}
+const (
+	vmInfoKeyName vmInfoKey = iota
+	vmInfoKeyUUID
+)
 
-		// don't use old values
-		delete(vmic.nameMap, vmName)
+// get returns the entry of key in the map selected by keyType if it has not expired. The maps are read under the
+// lock, as refresh replaces them.
+func (vmic *VmInfoCache) get(keyType vmInfoKey, key string) (*VmInfo, bool) {
+	vmic.rwLock.RLock()
+	defer vmic.rwLock.RUnlock()
+
+	vmInfoMap := vmic.nameMap
+	if keyType == vmInfoKeyUUID {
+		vmInfoMap = vmic.uuidMap
+	}
+	vmInfo, ok := vmInfoMap[key]
+	if !ok || time.Since(vmInfo.TimeStamp) >= vmic.expiry {
+		vmCacheLookups.WithLabelValues(metricResultMiss).Inc()
+		return nil, false
 	}
+	vmCacheLookups.WithLabelValues(metricResultHit).Inc()
 
+	return vmInfo, true
+}
+
+func (vmic *VmInfoCache) add(vmInfo *VmInfo) {
+	vmic.rwLock.Lock()
+	defer vmic.rwLock.Unlock()
+
+	vmic.nameMap[vmInfo.Name] = vmInfo
+	vmic.uuidMap[vmUUIDKey(vmInfo.UUID)] = vmInfo
+}
+
+// fetch gets a VM from the inventory with find and adds it to the cache
+func (vmic *VmInfoCache) fetch(find func() (*vcdclient.VM, error)) (*VmInfo, error) {
 	captureTime := time.Now()
-	if err := vmic.vcdClient.RefreshBearerToken(); err != nil {
-		return nil, fmt.Errorf("error while obtaining access token: [%v]", err)
-	}
-	vm, err := vmic.vcdClient.FindVMByName(vmName)
+	vm, err := find()
 	if err != nil {
-		if err == govcd.ErrorEntityNotFound {
-			return nil, govcd.ErrorEntityNotFound
-		}
+		return nil, err
+	}
 
-		if vmic.vcdClient.IsVmNotAvailable(err) {
-			return nil, govcd.ErrorEntityNotFound
-		}
+	vmInfo := vmic.vmToVMInfo(vm, captureTime)
+	vmic.add(vmInfo)
 
-		return nil, fmt.Errorf("unable to find vm with name [%s]: [%v]", vmName, err)
+	return vmInfo, nil
+}
+
+func (vmic *VmInfoCache) GetByName(vmName string) (*VmInfo, error) {
+	if vmInfo, ok := vmic.get(vmInfoKeyName, vmName); ok {
+		return vmInfo, nil
 	}
 
-	vmInfo, err := vmic.vmToVMInfo(vm, captureTime)
+	vmInfo, err := vmic.fetch(func() (*vcdclient.VM, error) {
+		return vmic.vms.FindVMByName(vmName)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("unable to convert vm struct [%v] to vmInfo: [%v]", vm, err)
+		if errors.Is(err, vcdclient.ErrNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("unable to find vm with name [%s]: [%v]", vmName, err)
 	}
 
-	vmic.nameMap[vmName] = vmInfo
-	vmic.uuidMap[vm.VM.ID] = vmInfo
-
 	return vmInfo, nil
 }
 
 func (vmic *VmInfoCache) GetByUUID(vmUUID string) (*VmInfo, error) {
-	vmic.rwLock.Lock()
-	defer vmic.rwLock.Unlock()
+	if vmInfo, ok := vmic.get(vmInfoKeyUUID, vmUUIDKey(vmUUID)); ok {
+		return vmInfo, nil
+	}
 
-	now := time.Now()
-	if vmInfo, ok := vmic.uuidMap[vmUUID]; ok {
-		if now.Sub(vmInfo.TimeStamp) < vmic.expiry {
-			klog.Infof("now is [%v], info captured at [%v], hence reusing cached value", now, vmInfo.TimeStamp)
-			return vmInfo, nil
+	vmInfo, err := vmic.fetch(func() (*vcdclient.VM, error) {
+		return vmic.vms.FindVMByUUID(vmUUID)
+	})
+	if err != nil {
+		if errors.Is(err, vcdclient.ErrNotFound) {
+			return nil, err
 		}
+		return nil, fmt.Errorf("unable to find vm with uuid [%s]: [%v]", vmUUID, err)
+	}
 
-		// don't use old values
-		delete(vmic.nameMap, vmUUID)
+	return vmInfo, nil
+}
+
+// includesAddresses returns true if addresses has every address of otherAddresses
+func includesAddresses(addresses []v1.NodeAddress, otherAddresses []v1.NodeAddress) bool {
+	addressSet := make(map[v1.NodeAddress]bool)
+	for _, address := range addresses {
+		addressSet[address] = true
+	}
+	for _, address := range otherAddresses {
+		if !addressSet[address] {
+			return false
+		}
 	}
 
+	return true
+}
+
+// refresh replaces the cache with all VMs of the cluster vApp, so that VMs that are gone are dropped as well.
+// Listed VMs only have the IP of their primary network connection, so that the addresses of a VM that was found
+// with all of its IPs are kept as long as they include the listed IP.
+func (vmic *VmInfoCache) refresh() error {
 	captureTime := time.Now()
-	if err := vmic.vcdClient.RefreshBearerToken(); err != nil {
-		return nil, fmt.Errorf("error while obtaining access token: [%v]", err)
-	}
-	vm, err := vmic.vcdClient.FindVMByUUID(vmUUID)
+	vms, err := vmic.vms.ListVMs()
 	if err != nil {
-		if err == govcd.ErrorEntityNotFound {
-			return nil, govcd.ErrorEntityNotFound
-		}
+		return fmt.Errorf("unable to list vms: [%v]", err)
+	}
 
-		if vmic.vcdClient.IsVmNotAvailable(err) {
-			return nil, govcd.ErrorEntityNotFound
+	nameMap := make(map[string]*VmInfo)
+	uuidMap := make(map[string]*VmInfo)
+	// names used by several VMs are left out of the name map, so that lookups by name report them
+	duplicateNames := make(map[string]bool)
+	for _, vm := range vms {
+		vmInfo := vmic.vmToVMInfo(vm, captureTime)
+		uuidMap[vmUUIDKey(vmInfo.UUID)] = vmInfo
+		if _, ok := nameMap[vmInfo.Name]; ok {
+			duplicateNames[vmInfo.Name] = true
 		}
-
-		return nil, fmt.Errorf("unable to find vm with uuid [%s]: [%v]", vmUUID, err)
+		nameMap[vmInfo.Name] = vmInfo
+	}
+	for name := range duplicateNames {
+		klog.Errorf("Vm name [%s] is used by several vms of the cluster", name)
+		delete(nameMap, name)
 	}
 
-	vmInfo, err := vmic.vmToVMInfo(vm, captureTime)
-	if err != nil {
-		return nil, fmt.Errorf("unable to convert vm struct [%v] to vmInfo: [%v]", vm, err)
+	vmic.rwLock.Lock()
+	defer vmic.rwLock.Unlock()
+	for key, vmInfo := range uuidMap {
+		cachedVMInfo, ok := vmic.uuidMap[key]
+		if ok && len(cachedVMInfo.Addresses) > len(vmInfo.Addresses) &&
+			includesAddresses(cachedVMInfo.Addresses, vmInfo.Addresses) {
+			vmInfo.Addresses = cachedVMInfo.Addresses
+		}
 	}
+	vmic.nameMap = nameMap
+	vmic.uuidMap = uuidMap
 
-	vmic.uuidMap[vmUUID] = vmInfo
-	vmic.nameMap[vm.VM.Name] = vmInfo
+	return nil
+}
 
-	return vmInfo, nil
+// run refreshes the cache in the background until stopCh is closed. A failed refresh keeps the cached VMs,
+// which are then fetched on demand once they expire.
+func (vmic *VmInfoCache) run(stopCh <-chan struct{}) {
+	jitterFactor := float64(vmic.refreshJitter) / float64(vmic.refreshInterval)
+	wait.JitterUntil(func() {
+		if err := vmic.refresh(); err != nil {
+			vmCacheRefreshes.WithLabelValues(metricResultFailure).Inc()
+			klog.Errorf("Unable to refresh vm cache: [%v]", err)
+			return
+		}
+		vmCacheRefreshes.WithLabelValues(metricResultSuccess).Inc()
+	}, vmic.refreshInterval, jitterFactor, true, stopCh)
 }
@@ -0,0 +1,199 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package ccm
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/config"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient/fakebackend"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient/fakevcd"
+	swaggerClient "github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdswaggerclient"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestVmInfoCacheRefreshKeepsAddresses(t *testing.T) {
+	vms := fakebackend.NewVMs()
+	vms.AddVM("cluster", "worker-1", "10.0.0.5", "10.1.0.5")
+	vms.AddVM("cluster", "worker-2", "10.0.0.6", "10.1.0.6")
+	vmic := newVmInfoCache(vms, time.Hour, time.Minute, 0, config.NodeConfig{})
+
+	vmInfo, err := vmic.GetByName("worker-1")
+	assert.NoError(t, err, "VM should be found")
+	foundAddresses := vmInfo.Addresses
+	assert.Equal(t, getNodeAddresses("worker-1", []string{"10.0.0.5", "10.1.0.5"}), foundAddresses,
+		"Found VM should have the addresses of all of its IPs")
+
+	for refresh := 1; refresh <= 2; refresh++ {
+		assert.NoError(t, vmic.refresh(), "Refresh [%d] should list the VMs", refresh)
+		vmInfo, err = vmic.GetByName("worker-1")
+		assert.NoError(t, err, "VM should be cached after refresh [%d]", refresh)
+		assert.Equal(t, foundAddresses, vmInfo.Addresses,
+			"Addresses of the found VM should be kept by refresh [%d]", refresh)
+	}
+
+	vmInfo, err = vmic.GetByName("worker-2")
+	assert.NoError(t, err, "Listed VM should be cached")
+	assert.Equal(t, getNodeAddresses("worker-2", []string{"10.0.0.6"}), vmInfo.Addresses,
+		"Listed VM should only have the address of its primary IP")
+
+	return
+}
+
+func TestIncludesAddresses(t *testing.T) {
+
+	type TestCase struct {
+		Addresses      []v1.NodeAddress
+		OtherAddresses []v1.NodeAddress
+		Included       bool
+		ErrorComment   string
+	}
+
+	testCaseList := []TestCase{
+		{
+			Addresses:      getNodeAddresses("vm", []string{"10.0.0.5", "10.1.0.5"}),
+			OtherAddresses: getNodeAddresses("vm", []string{"10.0.0.5"}),
+			Included:       true,
+			ErrorComment:   "Primary IP should be included in all IPs",
+		},
+		{
+			Addresses:      getNodeAddresses("vm", []string{"10.0.0.5", "10.1.0.5"}),
+			OtherAddresses: getNodeAddresses("vm", []string{"10.0.0.7"}),
+			Included:       false,
+			ErrorComment:   "Changed primary IP should not be included",
+		},
+		{
+			Addresses:      getNodeAddresses("vm", []string{"10.0.0.5", "10.1.0.5"}),
+			OtherAddresses: getNodeAddresses("renamed-vm", []string{"10.0.0.5"}),
+			Included:       false,
+			ErrorComment:   "Changed host name should not be included",
+		},
+	}
+
+	for _, testCase := range testCaseList {
+		assert.Equal(t, testCase.Included, includesAddresses(testCase.Addresses, testCase.OtherAddresses),
+			testCase.ErrorComment)
+	}
+
+	return
+}
+
+func TestVmInfoCacheConcurrentRefresh(t *testing.T) {
+	vms := fakebackend.NewVMs()
+	vmID := vms.AddVM("cluster", "worker-1", "10.0.0.5")
+	vmic := newVmInfoCache(vms, time.Hour, time.Minute, 0, config.NodeConfig{})
+
+	// lookups read the maps that refresh replaces; the race detector reports unguarded reads
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_, err := vmic.GetByName("worker-1")
+				assert.NoError(t, err, "VM should be found by name")
+				_, err = vmic.GetByUUID(vmID)
+				assert.NoError(t, err, "VM should be found by uuid")
+			}
+		}()
+	}
+	for j := 0; j < 50; j++ {
+		assert.NoError(t, vmic.refresh(), "VMs should be listed")
+	}
+	wg.Wait()
+
+	return
+}
+
+// newFakeVCDClient starts a fake VCD with the org, VDC and network of a cluster whose VMs are in the vApp
+// "cluster", and returns it with the id of its VDC and a client logged in to it. The server must be closed.
+func newFakeVCDClient(t *testing.T) (*fakevcd.Server, string, *vcdclient.Client) {
+	server := fakevcd.NewServer()
+	server.AddOrg("tenant")
+	server.AddUser("tenant", "user", "password")
+	vdcID := server.AddVDC("tenant", "vdc")
+	gatewayID := server.AddEdgeGateway(vdcID, "gateway", []swaggerClient.EdgeGatewaySubnet{
+		{
+			Gateway:      "192.168.0.1",
+			PrefixLength: 24,
+		},
+	})
+	server.AddNetwork(vdcID, "network", gatewayID)
+
+	client, err := vcdclient.NewClient(&vcdclient.ClientOptions{
+		Host:        server.URL,
+		OrgName:     "tenant",
+		VDCName:     "vdc",
+		NetworkName: "network",
+		IPAMSubnet:  "192.168.0.1/24",
+		UserOrg:     "tenant",
+		User:        "user",
+		Password:    "password",
+		VMSelector: vcdclient.VMSelector{
+			VAppNames: []string{"cluster"},
+		},
+		GetVDCClient: true,
+	})
+	assert.NoError(t, err, "Client should log in to the fake VCD")
+
+	return server, vdcID, client
+}
+
+func TestVmInfoCacheFakeVCD(t *testing.T) {
+	server, vdcID, client := newFakeVCDClient(t)
+	defer server.Close()
+	if client == nil {
+		return
+	}
+
+	server.AddVM(vdcID, "cluster", "worker-1", "10.0.0.5")
+	otherID := server.AddVM(vdcID, "cluster", "worker-2", "10.0.0.6")
+	server.AddVM(vdcID, "other", "worker-3", "10.0.0.7")
+	vmic := newVmInfoCache(client.VMInventory(), time.Hour, time.Minute, 0, config.NodeConfig{})
+
+	requests := server.Requests("", "/api/")
+	vmInfo, err := vmic.GetByName("worker-1")
+	assert.NoError(t, err, "VM should be found on a miss")
+	if assert.NotNil(t, vmInfo, "VM should be found on a miss") {
+		assert.Equal(t, getNodeAddresses("worker-1", []string{"10.0.0.5"}), vmInfo.Addresses,
+			"Found VM should have the addresses of its IPs")
+	}
+	assert.Greater(t, server.Requests("", "/api/"), requests, "Miss should be fetched from VCD")
+
+	requests = server.Requests("", "/api/")
+	_, err = vmic.GetByName("worker-1")
+	assert.NoError(t, err, "Found VM should be cached")
+	assert.Equal(t, requests, server.Requests("", "/api/"), "Hit should not be fetched from VCD")
+
+	assert.NoError(t, vmic.refresh(), "VMs of the cluster should be listed")
+	requests = server.Requests("", "/api/")
+	vmInfo, err = vmic.GetByUUID(otherID)
+	assert.NoError(t, err, "Listed VM should be cached by uuid")
+	if assert.NotNil(t, vmInfo, "Listed VM should be cached by uuid") {
+		assert.Equal(t, "worker-2", vmInfo.Name, "Listed VM should have its name")
+		assert.Equal(t, "POWERED_ON", vmInfo.Status, "Listed VM should have its status")
+	}
+	_, err = vmic.GetByName("worker-2")
+	assert.NoError(t, err, "Listed VM should be cached by name")
+	assert.Equal(t, requests, server.Requests("", "/api/"), "Listed VMs should not be fetched from VCD")
+
+	_, err = vmic.GetByName("worker-3")
+	assert.True(t, errors.Is(err, vcdclient.ErrNotFound), "VM of another vApp should not be found")
+
+	server.RemoveVM(otherID)
+	assert.NoError(t, vmic.refresh(), "VMs of the cluster should be listed again")
+	_, err = vmic.GetByUUID(otherID)
+	assert.True(t, errors.Is(err, vcdclient.ErrNotFound), "Removed VM should not be found")
+	_, err = vmic.GetByName("worker-2")
+	assert.True(t, errors.Is(err, vcdclient.ErrNotFound), "Removed VM should not be found by name")
+
+	return
+}
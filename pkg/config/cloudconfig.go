@@ -11,7 +11,25 @@ import (
 	"io"
 	"io/ioutil"
 	"k8s.io/klog"
+	"path/filepath"
 	"strings"
+	"time"
+)
+
+const (
+	// DefaultAuthorizationDir is where the secret with the VCD credentials is mounted
+	DefaultAuthorizationDir = "/etc/kubernetes/vcloud/basic-auth"
+
+	// NodeLookupVMName and the other node lookups are the ways in which the VM of a Kubernetes node is found
+	NodeLookupVMName       = "vmName"
+	NodeLookupComputerName = "computerName"
+	NodeLookupMetadata     = "metadata"
+	NodeLookupSystemUUID   = "systemUUID"
+
+	// MetadataDomainGeneral and MetadataDomainSystem are the VCD metadata domains to which the identity of nodes
+	// can be written. Only system administrators can write to the SYSTEM domain.
+	MetadataDomainGeneral = "GENERAL"
+	MetadataDomainSystem  = "SYSTEM"
 )
 
 // VCDConfig :
@@ -35,7 +53,59 @@ type VCDConfig struct {
 
 	VDCNetwork string `yaml:"network"`
 	VIPSubnet  string `yaml:"vipSubnet"`
-	VAppName  string  `yaml:"vAppName"`
+	VAppName  VAppSelector `yaml:"vAppName"`
+
+	// The certificate of VCD is verified against the system CAs and the CAs in CACertFile or CACert, which
+	// hold PEM encoded certificates. Insecure skips this verification. PinnedCertificates are SHA-256
+	// fingerprints of which one must match a certificate presented by VCD, even if Insecure is set.
+	Insecure           bool     `yaml:"insecure"`
+	CACertFile         string   `yaml:"caCertFile"`
+	CACert             string   `yaml:"caCert"`
+	PinnedCertificates []string `yaml:"pinnedCertificates"`
+
+	Proxy ProxyConfig `yaml:"proxy"`
+
+	APIVersion APIVersionConfig `yaml:"apiVersion"`
+
+	TaskTimeouts TaskTimeouts `yaml:"taskTimeouts"`
+	Retry        RetryConfig  `yaml:"retry"`
+
+	// TokenLifetime is how long a bearer token is used before it is refreshed, unless VCD reports an
+	// earlier expiry. Unset uses the default of the client.
+	TokenLifetime time.Duration `yaml:"tokenLifetime"`
+}
+
+// TaskTimeouts : maximum time to wait for VCD tasks, such as creating a virtual service, to complete. Values
+// are durations such as "5m". Unset values use the defaults of the client.
+type TaskTimeouts struct {
+	Create time.Duration `yaml:"create"`
+	Update time.Duration `yaml:"update"`
+	Delete time.Duration `yaml:"delete"`
+}
+
+// RetryConfig : budget for retrying transient VCD failures, such as a busy gateway or HTTP 429/5xx responses,
+// within a single reconcile. Unset values use the defaults of the client.
+type RetryConfig struct {
+	MaxAttempts    int           `yaml:"maxAttempts"`
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`
+}
+
+// ProxyConfig : HTTP proxy through which VCD is reached. If the url is not set, the HTTP_PROXY, HTTPS_PROXY
+// and NO_PROXY environment variables are used. noProxy is a comma separated list of hosts, domains and CIDRs
+// that are reached directly.
+type ProxyConfig struct {
+	URL      string `yaml:"url"`
+	NoProxy  string `yaml:"noProxy"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// APIVersionConfig : window of VCD API versions, such as "36.0", from which the highest version supported by
+// both VCD and the provider is picked. Unset bounds use the range supported by the provider.
+type APIVersionConfig struct {
+	Min string `yaml:"min"`
+	Max string `yaml:"max"`
 }
 
 // Ports :
@@ -50,18 +120,81 @@ type OneArm struct {
 	EndIP   string `yaml:"endIP"`
 }
 
+// LBTargetConfig : a network, in addition to the network of the cluster, on whose edge gateway load balancers
+// are created for the Services that select the target by name
+type LBTargetConfig struct {
+	Name               string  `yaml:"name"`
+	Network            string  `yaml:"network"`
+	VIPSubnet          string  `yaml:"vipSubnet"`
+	OneArm             *OneArm `yaml:"oneArm,omitempty"`
+	ServiceEngineGroup string  `yaml:"serviceEngineGroup"`
+}
+
 // LBConfig :
 type LBConfig struct {
 	OneArm           *OneArm `yaml:"oneArm,omitempty"`
 	Ports            Ports   `yaml:"ports"`
 	CertificateAlias string  `yaml:"certAlias"`
+
+	// ServiceEngineGroup is used for the target named "default", which is formed by the network, vipSubnet
+	// and oneArm of the cluster. If empty, any service engine group of the gateway with capacity is used.
+	ServiceEngineGroup string           `yaml:"serviceEngineGroup"`
+	Targets            []LBTargetConfig `yaml:"targets"`
+	// DefaultTarget is the target of Services that do not select one; it defaults to "default"
+	DefaultTarget string `yaml:"defaultTarget"`
+}
+
+// VMCacheConfig : the VMs of the cluster vApp are listed every refreshInterval to refresh the cache of node
+// details. Each refresh is delayed by a random duration of up to refreshJitter.
+type VMCacheConfig struct {
+	RefreshInterval time.Duration `yaml:"refreshInterval" default:"1m"`
+	RefreshJitter   time.Duration `yaml:"refreshJitter" default:"10s"`
+}
+
+// NodeConfig : how the VM of a Kubernetes node is found. With the vmName lookup the node name is the name of
+// the VM, with computerName it is the computer name set by guest customization, and with metadata it is the
+// value of the VM metadata metadataKey. With systemUUID the VM is the one whose id is the system UUID that the
+// kubelet reports for the node.
+// VM metadata entries whose keys start with LabelMetadataPrefix are applied as node labels, with the prefix
+// removed from the key. Entries whose keys start with TaintMetadataPrefix are applied as taints, with values of
+// the form [value:]effect. If IdentityMetadataPrefix is set, the node name, cluster id, node roles and kubelet
+// version of each node are written to the metadata of its VM, under keys with that prefix, in the metadata domain
+// IdentityMetadataDomain. Both are synced every MetadataSyncInterval.
+type NodeConfig struct {
+	VMLookup               string        `yaml:"vmLookup" default:"vmName"`
+	MetadataKey            string        `yaml:"metadataKey"`
+	LabelMetadataPrefix    string        `yaml:"labelMetadataPrefix"`
+	TaintMetadataPrefix    string        `yaml:"taintMetadataPrefix"`
+	IdentityMetadataPrefix string        `yaml:"identityMetadataPrefix"`
+	IdentityMetadataDomain string        `yaml:"identityMetadataDomain" default:"GENERAL"`
+	MetadataSyncInterval   time.Duration `yaml:"metadataSyncInterval" default:"5m"`
+}
+
+// ShutdownVMStatuses are the VCD statuses of a VM that can be configured to mean that its node is shut down
+var ShutdownVMStatuses = []string{
+	"POWERED_OFF", "SUSPENDED", "PARTIALLY_POWERED_OFF", "PARTIALLY_SUSPENDED", "WAITING_FOR_INPUT",
+	"UNRESOLVED", "UNKNOWN", "INCONSISTENT_STATE", "FAILED_CREATION",
+}
+
+// ShutdownConfig : when the VM of a node is reported as shut down, so that the node lifecycle controller taints
+// the node with node.cloudprovider.kubernetes.io/shutdown. A node is shut down if the status of its VM is one of
+// VMStatuses, or if the VM is in maintenance mode and MaintenanceMode is set. VMs with other statuses are
+// reported as running. VCD only reports the maintenance mode of VMs that are listed, so that it is unknown for a VM
+// fetched on demand, such as a new VM or one whose cache entry expired, until the next listing of the VM cache, up
+// to vmCache.refreshInterval later.
+type ShutdownConfig struct {
+	VMStatuses      []string `yaml:"vmStatuses" default:"POWERED_OFF,SUSPENDED,PARTIALLY_POWERED_OFF,PARTIALLY_SUSPENDED"`
+	MaintenanceMode bool     `yaml:"maintenanceMode"`
 }
 
 // CloudConfig contains the config that will be read from the secret
 type CloudConfig struct {
-	VCD       VCDConfig `yaml:"vcd"`
-	LB        LBConfig  `yaml:"loadbalancer"`
-	ClusterID string    `yaml:"clusterid"`
+	VCD       VCDConfig      `yaml:"vcd"`
+	LB        LBConfig       `yaml:"loadbalancer"`
+	VMCache   VMCacheConfig  `yaml:"vmCache"`
+	Node      NodeConfig     `yaml:"node"`
+	Shutdown  ShutdownConfig `yaml:"shutdown"`
+	ClusterID string         `yaml:"clusterid"`
 }
 
 func getUserAndOrg(fullUserName string, clusterOrg string) (userOrg string, userName string, err error) {
@@ -87,30 +220,45 @@ func getUserAndOrg(fullUserName string, clusterOrg string) (userOrg string, user
 	return userOrg, userName, nil
 }
 
-// ParseCloudConfig : parses config and env to fill in the CloudConfig struct
+// ParseCloudConfig : parses config on top of the defaults to fill in the CloudConfig struct. Environment
+// variables and flags are applied by Loader.Load.
 func ParseCloudConfig(configReader io.Reader) (*CloudConfig, error) {
 	var err error
-	config := &CloudConfig{}
+	config := NewDefaultCloudConfig()
 
 	decoder := yaml.NewDecoder(configReader)
 	decoder.SetStrict(true)
 
-	if err = decoder.Decode(&config); err != nil {
+	if err = decoder.Decode(config); err != nil {
 		return nil, fmt.Errorf("unable to decode yaml file: [%v]", err)
 	}
 
 	return config, nil
 }
 
+// AuthorizationFiles : paths of the files in authDir from which SetAuthorizationFromDir reads credentials
+func AuthorizationFiles(authDir string) []string {
+	return []string{
+		filepath.Join(authDir, "username"),
+		filepath.Join(authDir, "password"),
+		filepath.Join(authDir, "refreshToken"),
+	}
+}
+
 func SetAuthorization(config *CloudConfig) error {
-	refreshToken, err := ioutil.ReadFile("/etc/kubernetes/vcloud/basic-auth/refreshToken")
+	return SetAuthorizationFromDir(config, DefaultAuthorizationDir)
+}
+
+// SetAuthorizationFromDir : fills in the credentials in config from the files of a secret mounted at authDir
+func SetAuthorizationFromDir(config *CloudConfig, authDir string) error {
+	refreshToken, err := ioutil.ReadFile(filepath.Join(authDir, "refreshToken"))
 	if err != nil {
 		klog.Infof("Unable to get refresh token: [%v]", err)
 	} else {
 		config.VCD.RefreshToken = strings.TrimSuffix(string(refreshToken), "\n")
 	}
 
-	username, err := ioutil.ReadFile("/etc/kubernetes/vcloud/basic-auth/username")
+	username, err := ioutil.ReadFile(filepath.Join(authDir, "username"))
 	if err != nil {
 		klog.Infof("Unable to get username: [%v]", err)
 	} else {
@@ -126,7 +274,7 @@ func SetAuthorization(config *CloudConfig) error {
 		config.VCD.UserOrg = strings.TrimSuffix(config.VCD.Org, "\n")
 	}
 
-	secret, err := ioutil.ReadFile("/etc/kubernetes/vcloud/basic-auth/password")
+	secret, err := ioutil.ReadFile(filepath.Join(authDir, "password"))
 	if err != nil {
 		klog.Infof("Unable to get password: [%v]", err)
 	} else {
@@ -145,21 +293,11 @@ func SetAuthorization(config *CloudConfig) error {
 	return fmt.Errorf("unable to get valid set of credentials from secrets")
 }
 
+// ValidateCloudConfig : returns an aggregate of all problems found in config, or nil if there are none
 func ValidateCloudConfig(config *CloudConfig) error {
-	// TODO: needs more validation
 	if config == nil {
 		return fmt.Errorf("nil config passed")
 	}
 
-	if config.VCD.Host == "" {
-		return fmt.Errorf("need a valid vCloud Host")
-	}
-	if config.VCD.VDCNetwork == "" {
-		return fmt.Errorf("need a valid ovdc network name")
-	}
-	if config.VCD.VAppName == "" {
-		return fmt.Errorf("need a valid vApp name")
-	}
-
-	return nil
+	return ValidateCloudConfigFields(config).ToAggregate()
 }
@@ -7,9 +7,11 @@ package config
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -36,6 +38,36 @@ func TestCloudConfig(t *testing.T) {
 		assert.NoError(t, err, "Error closing config file [%s], testConfigFilePath")
 	}()
 
-	_, err = ParseCloudConfig(configReader)
+	config, err := ParseCloudConfig(configReader)
 	assert.NoError(t, err, "Unable to parse config file")
+	assert.Equal(t, 10*time.Minute, config.VCD.TaskTimeouts.Create, "Unexpected create task timeout")
+	assert.Equal(t, 5*time.Minute, config.VCD.TaskTimeouts.Update, "Unexpected update task timeout")
+	assert.Equal(t, 4, config.VCD.Retry.MaxAttempts, "Unexpected retry attempts")
+	assert.Equal(t, 20*time.Second, config.VCD.Retry.MaxBackoff, "Unexpected retry max backoff")
+	assert.Equal(t, 20*time.Minute, config.VCD.TokenLifetime, "Unexpected token lifetime")
+}
+
+func TestSetAuthorizationFromDir(t *testing.T) {
+	authDir, err := ioutil.TempDir("", "basic-auth")
+	assert.NoError(t, err, "Unable to create directory for credentials")
+	defer func() {
+		err = os.RemoveAll(authDir)
+		assert.NoError(t, err, "Unable to remove directory [%s]", authDir)
+	}()
+
+	config := &CloudConfig{}
+	config.VCD.Org = "cluster-org"
+	err = SetAuthorizationFromDir(config, authDir)
+	assert.Error(t, err, "Error should be obtained when no credentials are present")
+
+	err = ioutil.WriteFile(filepath.Join(authDir, "username"), []byte("user-org/user\n"), 0600)
+	assert.NoError(t, err, "Unable to write username")
+	err = ioutil.WriteFile(filepath.Join(authDir, "password"), []byte("password\n"), 0600)
+	assert.NoError(t, err, "Unable to write password")
+
+	err = SetAuthorizationFromDir(config, authDir)
+	assert.NoError(t, err, "Credentials should be read from [%s]", authDir)
+	assert.Equal(t, "user-org", config.VCD.UserOrg, "Unexpected user org")
+	assert.Equal(t, "user", config.VCD.User, "Unexpected user")
+	assert.Equal(t, "password", config.VCD.Secret, "Unexpected password")
 }
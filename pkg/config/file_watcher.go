@@ -0,0 +1,75 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog"
+)
+
+// FileWatcher : polls a set of files and reports when the content of any of them changes. Secrets and
+// config maps are updated by swapping a symlink in the mounted directory, so contents are compared rather
+// than modification times.
+type FileWatcher struct {
+	paths      []string
+	interval   time.Duration
+	lastDigest string
+}
+
+// NewFileWatcher : creates a watcher for paths, taking their current content as the baseline
+func NewFileWatcher(paths []string, interval time.Duration) *FileWatcher {
+	fw := &FileWatcher{
+		paths:    paths,
+		interval: interval,
+	}
+	fw.lastDigest = fw.digest()
+
+	return fw
+}
+
+// digest hashes the content of all files. Files that cannot be read contribute only their path, so that a
+// file appearing or disappearing also counts as a change.
+func (fw *FileWatcher) digest() string {
+	hash := sha256.New()
+	for _, path := range fw.paths {
+		hash.Write([]byte(path))
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			hash.Write([]byte{0})
+			continue
+		}
+		hash.Write([]byte{1})
+		hash.Write(content)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Changed : returns true if the content of the files differs from when it was last checked
+func (fw *FileWatcher) Changed() bool {
+	currentDigest := fw.digest()
+	if currentDigest == fw.lastDigest {
+		return false
+	}
+	fw.lastDigest = currentDigest
+
+	return true
+}
+
+// Run : calls onChange every time the content of the files changes, until stopCh is closed
+func (fw *FileWatcher) Run(onChange func(), stopCh <-chan struct{}) {
+	klog.Infof("Watching files [%v] for changes every [%v]", fw.paths, fw.interval)
+	wait.Until(func() {
+		if fw.Changed() {
+			onChange()
+		}
+	}, fw.interval, stopCh)
+}
@@ -0,0 +1,46 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileWatcher(t *testing.T) {
+	watchDir, err := ioutil.TempDir("", "file-watcher")
+	assert.NoError(t, err, "Unable to create directory for watched files")
+	defer func() {
+		err = os.RemoveAll(watchDir)
+		assert.NoError(t, err, "Unable to remove directory [%s]", watchDir)
+	}()
+
+	existingFile := filepath.Join(watchDir, "password")
+	missingFile := filepath.Join(watchDir, "refreshToken")
+	err = ioutil.WriteFile(existingFile, []byte("old"), 0600)
+	assert.NoError(t, err, "Unable to write [%s]", existingFile)
+
+	fw := NewFileWatcher([]string{existingFile, missingFile}, time.Second)
+	assert.False(t, fw.Changed(), "Files should be unchanged right after creating the watcher")
+
+	err = ioutil.WriteFile(existingFile, []byte("new"), 0600)
+	assert.NoError(t, err, "Unable to write [%s]", existingFile)
+	assert.True(t, fw.Changed(), "Modified content should be detected")
+	assert.False(t, fw.Changed(), "A change should be reported only once")
+
+	err = ioutil.WriteFile(missingFile, []byte("token"), 0600)
+	assert.NoError(t, err, "Unable to write [%s]", missingFile)
+	assert.True(t, fw.Changed(), "A file that appears should be detected")
+
+	err = os.Remove(existingFile)
+	assert.NoError(t, err, "Unable to remove [%s]", existingFile)
+	assert.True(t, fw.Changed(), "A file that disappears should be detected")
+}
@@ -0,0 +1,361 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// envPrefix is the prefix of environment variables that override the cloud config
+	envPrefix = "VCLOUD_"
+	// flagPrefix is the prefix of flags that override the cloud config
+	flagPrefix = "vcloud-"
+
+	redactedValue = "<redacted>"
+)
+
+// override : a field of the cloud config that can be set through an environment variable and a flag
+type override struct {
+	// name is used for the environment variable in upper snake case and for the flag in lower kebab case,
+	// after the respective prefix
+	name  string
+	usage string
+	// field returns a pointer to the overridden field, allocating optional parents as needed
+	field func(config *CloudConfig) interface{}
+}
+
+func oneArm(config *CloudConfig) *OneArm {
+	if config.LB.OneArm == nil {
+		config.LB.OneArm = &OneArm{}
+	}
+	return config.LB.OneArm
+}
+
+var overrides = []override{
+	{"host", "url of VCD, such as https://vcd.example.com",
+		func(config *CloudConfig) interface{} { return &config.VCD.Host }},
+	{"org", "org of the cluster",
+		func(config *CloudConfig) interface{} { return &config.VCD.Org }},
+	{"vdc", "org VDC of the cluster",
+		func(config *CloudConfig) interface{} { return &config.VCD.VDC }},
+	{"network", "org VDC network of the cluster",
+		func(config *CloudConfig) interface{} { return &config.VCD.VDCNetwork }},
+	{"vip subnet", "CIDR from which virtual IPs are picked",
+		func(config *CloudConfig) interface{} { return &config.VCD.VIPSubnet }},
+	{"vapp name", "comma separated names, globs or /regexps/ of the vApps holding the cluster VMs, or metadata:key=value",
+		func(config *CloudConfig) interface{} { return &config.VCD.VAppName }},
+	{"insecure", "skip verification of the VCD certificate",
+		func(config *CloudConfig) interface{} { return &config.VCD.Insecure }},
+	{"ca cert file", "file with PEM encoded CA certificates for VCD",
+		func(config *CloudConfig) interface{} { return &config.VCD.CACertFile }},
+	{"pinned certificates", "comma separated SHA-256 fingerprints of accepted VCD certificates",
+		func(config *CloudConfig) interface{} { return &config.VCD.PinnedCertificates }},
+	{"proxy url", "url of the HTTP proxy through which VCD is reached",
+		func(config *CloudConfig) interface{} { return &config.VCD.Proxy.URL }},
+	{"no proxy", "comma separated hosts, domains and CIDRs reached without the proxy",
+		func(config *CloudConfig) interface{} { return &config.VCD.Proxy.NoProxy }},
+	{"api version min", "lowest VCD api version that may be negotiated",
+		func(config *CloudConfig) interface{} { return &config.VCD.APIVersion.Min }},
+	{"api version max", "highest VCD api version that may be negotiated",
+		func(config *CloudConfig) interface{} { return &config.VCD.APIVersion.Max }},
+	{"task timeout create", "maximum time to wait for VCD create tasks",
+		func(config *CloudConfig) interface{} { return &config.VCD.TaskTimeouts.Create }},
+	{"task timeout update", "maximum time to wait for VCD update tasks",
+		func(config *CloudConfig) interface{} { return &config.VCD.TaskTimeouts.Update }},
+	{"task timeout delete", "maximum time to wait for VCD delete tasks",
+		func(config *CloudConfig) interface{} { return &config.VCD.TaskTimeouts.Delete }},
+	{"retry max attempts", "maximum attempts for transient VCD failures",
+		func(config *CloudConfig) interface{} { return &config.VCD.Retry.MaxAttempts }},
+	{"retry initial backoff", "backoff before the first retry of a transient VCD failure",
+		func(config *CloudConfig) interface{} { return &config.VCD.Retry.InitialBackoff }},
+	{"retry max backoff", "maximum backoff between retries of transient VCD failures",
+		func(config *CloudConfig) interface{} { return &config.VCD.Retry.MaxBackoff }},
+	{"token lifetime", "time after which the VCD bearer token is refreshed",
+		func(config *CloudConfig) interface{} { return &config.VCD.TokenLifetime }},
+	{"lb one arm start ip", "first internal IP of the one-arm load balancer range",
+		func(config *CloudConfig) interface{} { return &oneArm(config).StartIP }},
+	{"lb one arm end ip", "last internal IP of the one-arm load balancer range",
+		func(config *CloudConfig) interface{} { return &oneArm(config).EndIP }},
+	{"lb http port", "external port of the HTTP listener of load balancers",
+		func(config *CloudConfig) interface{} { return &config.LB.Ports.HTTP }},
+	{"lb https port", "external port of the HTTPS listener of load balancers",
+		func(config *CloudConfig) interface{} { return &config.LB.Ports.HTTPS }},
+	{"lb cert alias", "alias of the certificate in VCD used for HTTPS",
+		func(config *CloudConfig) interface{} { return &config.LB.CertificateAlias }},
+	{"lb service engine group", "service engine group of the default load balancer target",
+		func(config *CloudConfig) interface{} { return &config.LB.ServiceEngineGroup }},
+	{"lb default target", "load balancer target of Services that do not select one",
+		func(config *CloudConfig) interface{} { return &config.LB.DefaultTarget }},
+	{"vm cache refresh interval", "interval at which the VMs of the cluster vApp are listed",
+		func(config *CloudConfig) interface{} { return &config.VMCache.RefreshInterval }},
+	{"vm cache refresh jitter", "maximum random delay added to each listing of the VMs of the cluster vApp",
+		func(config *CloudConfig) interface{} { return &config.VMCache.RefreshJitter }},
+	{"node vm lookup", "how the VM of a node is found: vmName, computerName, metadata or systemUUID",
+		func(config *CloudConfig) interface{} { return &config.Node.VMLookup }},
+	{"node metadata key", "VM metadata key whose value is the node name, for the metadata lookup",
+		func(config *CloudConfig) interface{} { return &config.Node.MetadataKey }},
+	{"node label metadata prefix", "prefix of the VM metadata keys that are applied as node labels",
+		func(config *CloudConfig) interface{} { return &config.Node.LabelMetadataPrefix }},
+	{"node taint metadata prefix", "prefix of the VM metadata keys that are applied as node taints",
+		func(config *CloudConfig) interface{} { return &config.Node.TaintMetadataPrefix }},
+	{"node identity metadata prefix", "prefix of the VM metadata keys to which the identity of the node is written",
+		func(config *CloudConfig) interface{} { return &config.Node.IdentityMetadataPrefix }},
+	{"node identity metadata domain", "VCD metadata domain, GENERAL or SYSTEM, of the identity of the node",
+		func(config *CloudConfig) interface{} { return &config.Node.IdentityMetadataDomain }},
+	{"node metadata sync interval", "interval at which VM metadata is applied to node labels and taints",
+		func(config *CloudConfig) interface{} { return &config.Node.MetadataSyncInterval }},
+	{"shutdown vm statuses", "VCD statuses of a VM that mean that its node is shut down",
+		func(config *CloudConfig) interface{} { return &config.Shutdown.VMStatuses }},
+	{"shutdown maintenance mode", "whether nodes whose VM is in maintenance mode are shut down",
+		func(config *CloudConfig) interface{} { return &config.Shutdown.MaintenanceMode }},
+	{"cluster id", "id of the RDE of the cluster",
+		func(config *CloudConfig) interface{} { return &config.ClusterID }},
+}
+
+func (o *override) envVar() string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(o.name, " ", "_"))
+}
+
+func (o *override) flagName() string {
+	return flagPrefix + strings.ReplaceAll(o.name, " ", "-")
+}
+
+// apply sets the overridden field of config from value
+func (o *override) apply(config *CloudConfig, value string) error {
+	return setFromString(reflect.ValueOf(o.field(config)).Elem(), value)
+}
+
+// typeName describes the type of the overridden field for usage messages
+func (o *override) typeName() string {
+	fieldType := reflect.TypeOf(o.field(&CloudConfig{LB: LBConfig{OneArm: &OneArm{}}})).Elem()
+	switch {
+	case fieldType == reflect.TypeOf(time.Duration(0)):
+		return "duration"
+	case fieldType.Kind() == reflect.Slice:
+		return "strings"
+	default:
+		return fieldType.Kind().String()
+	}
+}
+
+// setFromString parses value into field, which is a string, bool, integer, duration or string slice
+func setFromString(field reflect.Value, value string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("unable to parse duration [%s]: [%v]", value, err)
+		}
+		field.SetInt(int64(duration))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("unable to parse bool [%s]: [%v]", value, err)
+		}
+		field.SetBool(boolValue)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		intValue, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("unable to parse integer [%s]: [%v]", value, err)
+		}
+		field.SetInt(intValue)
+	case reflect.Slice:
+		values := make([]string, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+		field.Set(reflect.ValueOf(values).Convert(field.Type()))
+	default:
+		return fmt.Errorf("unsupported field type [%v]", field.Type())
+	}
+
+	return nil
+}
+
+// applyDefaults sets every field of the struct value that is zero and has a default tag to that default,
+// descending into nested structs
+func applyDefaults(value reflect.Value) error {
+	for i := 0; i < value.NumField(); i++ {
+		field, structField := value.Field(i), value.Type().Field(i)
+		if field.Kind() == reflect.Struct && field.Type() != reflect.TypeOf(time.Duration(0)) {
+			if err := applyDefaults(field); err != nil {
+				return err
+			}
+			continue
+		}
+		defaultValue, ok := structField.Tag.Lookup("default")
+		if !ok || !field.IsZero() {
+			continue
+		}
+		if err := setFromString(field, defaultValue); err != nil {
+			return fmt.Errorf("invalid default of field [%s]: [%v]", structField.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// NewDefaultCloudConfig : returns a CloudConfig with the defaults declared by the default tags of its fields
+func NewDefaultCloudConfig() *CloudConfig {
+	config := &CloudConfig{}
+	if err := applyDefaults(reflect.ValueOf(config).Elem()); err != nil {
+		// the defaults are constant, so this is caught during dev
+		panic(err)
+	}
+
+	return config
+}
+
+// OverrideFlag : a flag that overrides a field of the cloud config. It implements the Value interfaces of both
+// the flag and the pflag packages.
+type OverrideFlag struct {
+	Name  string
+	Usage string
+
+	override *override
+	value    string
+	set      bool
+}
+
+// String : returns the value the flag was set to
+func (overrideFlag *OverrideFlag) String() string {
+	if overrideFlag == nil {
+		return ""
+	}
+	return overrideFlag.value
+}
+
+// Set : checks that value can be parsed for the overridden field and keeps it
+func (overrideFlag *OverrideFlag) Set(value string) error {
+	if err := overrideFlag.override.apply(&CloudConfig{}, value); err != nil {
+		return err
+	}
+	overrideFlag.value = value
+	overrideFlag.set = true
+
+	return nil
+}
+
+// Type : returns the type of the overridden field
+func (overrideFlag *OverrideFlag) Type() string {
+	return overrideFlag.override.typeName()
+}
+
+// IsBoolFlag : returns true if the flag may be passed without a value
+func (overrideFlag *OverrideFlag) IsBoolFlag() bool {
+	return overrideFlag.Type() == "bool"
+}
+
+// Loader : builds the effective cloud config from, in increasing order of precedence, the defaults, the cloud
+// config file, environment variables such as VCLOUD_HOST and flags such as --vcloud-host
+type Loader struct {
+	lookupEnv func(key string) (string, bool)
+	flags     []*OverrideFlag
+}
+
+// NewLoader : creates a loader that reads environment variables through lookupEnv
+func NewLoader(lookupEnv func(key string) (string, bool)) *Loader {
+	loader := &Loader{
+		lookupEnv: lookupEnv,
+		flags:     make([]*OverrideFlag, 0, len(overrides)),
+	}
+	for i := range overrides {
+		loader.flags = append(loader.flags, &OverrideFlag{
+			Name:     overrides[i].flagName(),
+			Usage:    fmt.Sprintf("%s; overrides %s and the cloud config file", overrides[i].usage, overrides[i].envVar()),
+			override: &overrides[i],
+		})
+	}
+
+	return loader
+}
+
+// DefaultLoader : loader that reads the environment of the process and whose flags are registered by the commands
+var DefaultLoader = NewLoader(os.LookupEnv)
+
+// Flags : returns the flags of the loader, which need to be registered with the flag set of a command
+func (loader *Loader) Flags() []*OverrideFlag {
+	return loader.flags
+}
+
+// Load : parses the cloud config from configReader and applies the environment variables and flags to it
+func (loader *Loader) Load(configReader io.Reader) (*CloudConfig, error) {
+	config, err := ParseCloudConfig(configReader)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, overrideFlag := range loader.flags {
+		value, ok := loader.lookupEnv(overrideFlag.override.envVar())
+		if !ok {
+			continue
+		}
+		if err = overrideFlag.override.apply(config, value); err != nil {
+			return nil, fmt.Errorf("invalid value of environment variable [%s]: [%v]",
+				overrideFlag.override.envVar(), err)
+		}
+	}
+	for _, overrideFlag := range loader.flags {
+		if !overrideFlag.set {
+			continue
+		}
+		if err = overrideFlag.override.apply(config, overrideFlag.value); err != nil {
+			return nil, fmt.Errorf("invalid value of flag [--%s]: [%v]", overrideFlag.Name, err)
+		}
+	}
+
+	return config, nil
+}
+
+// Redacted : returns a copy of config in which secrets are replaced, so that it can be printed
+func Redacted(config *CloudConfig) CloudConfig {
+	redactedConfig := *config
+	if redactedConfig.VCD.Secret != "" {
+		redactedConfig.VCD.Secret = redactedValue
+	}
+	if redactedConfig.VCD.RefreshToken != "" {
+		redactedConfig.VCD.RefreshToken = redactedValue
+	}
+	if redactedConfig.VCD.Proxy.Password != "" {
+		redactedConfig.VCD.Proxy.Password = redactedValue
+	}
+	if proxyURL, err := url.Parse(redactedConfig.VCD.Proxy.URL); err == nil && proxyURL.User != nil {
+		redactedConfig.VCD.Proxy.URL = proxyURL.Redacted()
+	}
+
+	return redactedConfig
+}
+
+// WriteEffectiveConfig : writes config as YAML to w with secrets redacted
+func WriteEffectiveConfig(w io.Writer, config *CloudConfig) error {
+	redactedConfig := Redacted(config)
+	out, err := yaml.Marshal(&redactedConfig)
+	if err != nil {
+		return fmt.Errorf("unable to marshal cloud config: [%v]", err)
+	}
+	if _, err = w.Write(out); err != nil {
+		return fmt.Errorf("unable to write cloud config: [%v]", err)
+	}
+
+	return nil
+}
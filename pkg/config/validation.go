@@ -0,0 +1,365 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package config
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// clusterIDNoRDEPrefix marks cluster IDs that are generated for clusters without an RDE
+	clusterIDNoRDEPrefix = "NO_RDE_"
+	// defaultLBTargetName is the name of the load balancer target formed by the network of the cluster
+	defaultLBTargetName = "default"
+)
+
+var (
+	clusterIDRegexp  = regexp.MustCompile(`^urn:vcloud:entity:[A-Za-z0-9_.-]+:[A-Za-z0-9_.-]+:[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	apiVersionRegexp = regexp.MustCompile(`^[0-9]+\.[0-9]+$`)
+)
+
+func validateHost(host string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if host == "" {
+		return append(allErrs, field.Required(fldPath, "need a valid vCloud Host"))
+	}
+
+	hostURL, err := url.Parse(host)
+	if err != nil {
+		return append(allErrs, field.Invalid(fldPath, host, err.Error()))
+	}
+	if hostURL.Scheme != "https" && hostURL.Scheme != "http" {
+		return append(allErrs, field.Invalid(fldPath, host, "must be an http or https url"))
+	}
+	if hostURL.Host == "" {
+		allErrs = append(allErrs, field.Invalid(fldPath, host, "must contain a host name"))
+	}
+	if hostURL.Path != "" && hostURL.Path != "/" {
+		allErrs = append(allErrs, field.Invalid(fldPath, host, "must not contain a path such as /api"))
+	}
+
+	return allErrs
+}
+
+func validateNonNegativeDuration(duration time.Duration, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if duration < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath, duration.String(), "must not be negative"))
+	}
+
+	return allErrs
+}
+
+func validateTLS(vcdConfig *VCDConfig, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if vcdConfig.CACert != "" && vcdConfig.CACertFile != "" {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("caCert"),
+			"caCert and caCertFile are mutually exclusive"))
+	}
+	if vcdConfig.Insecure && (vcdConfig.CACert != "" || vcdConfig.CACertFile != "") {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("insecure"),
+			"insecure skips verification against caCert or caCertFile; set only one of them"))
+	}
+	for idx, pinnedCertificate := range vcdConfig.PinnedCertificates {
+		fingerprint, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(pinnedCertificate), ":", ""))
+		if err != nil || len(fingerprint) != 32 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("pinnedCertificates").Index(idx),
+				pinnedCertificate, "must be a SHA-256 fingerprint in hex"))
+		}
+	}
+
+	return allErrs
+}
+
+func validateProxy(proxyConfig *ProxyConfig, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if proxyConfig.URL == "" {
+		if proxyConfig.Username != "" || proxyConfig.Password != "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("url"),
+				"needed when proxy credentials are set"))
+		}
+		return allErrs
+	}
+
+	rawURL := proxyConfig.URL
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	if proxyURL, err := url.Parse(rawURL); err != nil || proxyURL.Host == "" {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("url"), proxyConfig.URL, "must be a url with a host"))
+	}
+	if proxyConfig.Password != "" && proxyConfig.Username == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("username"), "needed when a password is set"))
+	}
+
+	return allErrs
+}
+
+func validateAPIVersion(apiVersionConfig *APIVersionConfig, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if apiVersionConfig.Min != "" && !apiVersionRegexp.MatchString(apiVersionConfig.Min) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("min"), apiVersionConfig.Min,
+			"must be of the form major.minor"))
+	}
+	if apiVersionConfig.Max != "" && !apiVersionRegexp.MatchString(apiVersionConfig.Max) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("max"), apiVersionConfig.Max,
+			"must be of the form major.minor"))
+	}
+
+	return allErrs
+}
+
+func validateVCD(vcdConfig *VCDConfig, fldPath *field.Path) field.ErrorList {
+	allErrs := validateHost(vcdConfig.Host, fldPath.Child("host"))
+	if vcdConfig.Org == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("org"), "need a valid organization name"))
+	}
+	if vcdConfig.VDC == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("vdc"), "need a valid ovdc name"))
+	}
+	if vcdConfig.VDCNetwork == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("network"), "need a valid ovdc network name"))
+	}
+	if len(vcdConfig.VAppName) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("vAppName"), "need a valid vApp name"))
+	} else if _, err := vcdConfig.VAppName.Parse(); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("vAppName"), []string(vcdConfig.VAppName),
+			err.Error()))
+	}
+	allErrs = append(allErrs, validateVIPSubnet(vcdConfig.VIPSubnet, fldPath.Child("vipSubnet"))...)
+
+	allErrs = append(allErrs, validateTLS(vcdConfig, fldPath)...)
+	allErrs = append(allErrs, validateProxy(&vcdConfig.Proxy, fldPath.Child("proxy"))...)
+	allErrs = append(allErrs, validateAPIVersion(&vcdConfig.APIVersion, fldPath.Child("apiVersion"))...)
+
+	taskTimeoutsPath := fldPath.Child("taskTimeouts")
+	allErrs = append(allErrs, validateNonNegativeDuration(vcdConfig.TaskTimeouts.Create, taskTimeoutsPath.Child("create"))...)
+	allErrs = append(allErrs, validateNonNegativeDuration(vcdConfig.TaskTimeouts.Update, taskTimeoutsPath.Child("update"))...)
+	allErrs = append(allErrs, validateNonNegativeDuration(vcdConfig.TaskTimeouts.Delete, taskTimeoutsPath.Child("delete"))...)
+
+	retryPath := fldPath.Child("retry")
+	if vcdConfig.Retry.MaxAttempts < 0 {
+		allErrs = append(allErrs, field.Invalid(retryPath.Child("maxAttempts"), vcdConfig.Retry.MaxAttempts,
+			"must not be negative"))
+	}
+	allErrs = append(allErrs, validateNonNegativeDuration(vcdConfig.Retry.InitialBackoff, retryPath.Child("initialBackoff"))...)
+	allErrs = append(allErrs, validateNonNegativeDuration(vcdConfig.Retry.MaxBackoff, retryPath.Child("maxBackoff"))...)
+	if vcdConfig.Retry.MaxBackoff > 0 && vcdConfig.Retry.InitialBackoff > vcdConfig.Retry.MaxBackoff {
+		allErrs = append(allErrs, field.Invalid(retryPath.Child("initialBackoff"),
+			vcdConfig.Retry.InitialBackoff.String(), "must not be greater than maxBackoff"))
+	}
+	allErrs = append(allErrs, validateNonNegativeDuration(vcdConfig.TokenLifetime, fldPath.Child("tokenLifetime"))...)
+
+	return allErrs
+}
+
+func validatePort(port int32, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	// a port set to 0 is allowed and leaves the corresponding listener out
+	if port < 0 || port > 65535 {
+		allErrs = append(allErrs, field.Invalid(fldPath, port, "must be between 1 and 65535"))
+	}
+
+	return allErrs
+}
+
+func validateOneArm(oneArm *OneArm, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	startIP := net.ParseIP(oneArm.StartIP)
+	if startIP == nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("startIP"), oneArm.StartIP,
+			"must be an IP address"))
+	}
+	endIP := net.ParseIP(oneArm.EndIP)
+	if endIP == nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("endIP"), oneArm.EndIP,
+			"must be an IP address"))
+	}
+	if startIP != nil && endIP != nil {
+		if (startIP.To4() == nil) != (endIP.To4() == nil) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("endIP"), oneArm.EndIP,
+				"must be of the same IP family as startIP"))
+		} else if bytes.Compare(startIP.To16(), endIP.To16()) > 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("endIP"), oneArm.EndIP,
+				"must not be lower than startIP"))
+		}
+	}
+
+	return allErrs
+}
+
+func validateVIPSubnet(vipSubnet string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if vipSubnet == "" {
+		return allErrs
+	}
+	if _, _, err := net.ParseCIDR(vipSubnet); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath, vipSubnet, "must be a CIDR such as 10.0.0.0/24"))
+	}
+
+	return allErrs
+}
+
+func validateLBTargets(lbConfig *LBConfig, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	targetNames := map[string]bool{
+		defaultLBTargetName: true,
+	}
+	for idx, target := range lbConfig.Targets {
+		targetPath := fldPath.Child("targets").Index(idx)
+		switch {
+		case target.Name == "":
+			allErrs = append(allErrs, field.Required(targetPath.Child("name"), "need a name for the target"))
+		case target.Name == defaultLBTargetName:
+			allErrs = append(allErrs, field.Invalid(targetPath.Child("name"), target.Name,
+				"is reserved for the target formed by the network of the cluster"))
+		case targetNames[target.Name]:
+			allErrs = append(allErrs, field.Duplicate(targetPath.Child("name"), target.Name))
+		}
+		targetNames[target.Name] = true
+
+		if target.Network == "" {
+			allErrs = append(allErrs, field.Required(targetPath.Child("network"), "need a valid ovdc network name"))
+		}
+		allErrs = append(allErrs, validateVIPSubnet(target.VIPSubnet, targetPath.Child("vipSubnet"))...)
+		if target.OneArm != nil {
+			allErrs = append(allErrs, validateOneArm(target.OneArm, targetPath.Child("oneArm"))...)
+		}
+	}
+	if lbConfig.DefaultTarget != "" && !targetNames[lbConfig.DefaultTarget] {
+		allErrs = append(allErrs, field.NotFound(fldPath.Child("defaultTarget"), lbConfig.DefaultTarget))
+	}
+
+	return allErrs
+}
+
+func validateLB(lbConfig *LBConfig, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if lbConfig.OneArm != nil {
+		allErrs = append(allErrs, validateOneArm(lbConfig.OneArm, fldPath.Child("oneArm"))...)
+	}
+
+	portsPath := fldPath.Child("ports")
+	allErrs = append(allErrs, validatePort(lbConfig.Ports.HTTP, portsPath.Child("http"))...)
+	allErrs = append(allErrs, validatePort(lbConfig.Ports.HTTPS, portsPath.Child("https"))...)
+	if lbConfig.Ports.HTTP != 0 && lbConfig.Ports.HTTP == lbConfig.Ports.HTTPS {
+		allErrs = append(allErrs, field.Duplicate(portsPath.Child("https"), lbConfig.Ports.HTTPS))
+	}
+	allErrs = append(allErrs, validateLBTargets(lbConfig, fldPath)...)
+
+	return allErrs
+}
+
+func validateVMCache(vmCacheConfig *VMCacheConfig, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if vmCacheConfig.RefreshInterval <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("refreshInterval"),
+			vmCacheConfig.RefreshInterval.String(), "must be positive"))
+	}
+	allErrs = append(allErrs, validateNonNegativeDuration(vmCacheConfig.RefreshJitter,
+		fldPath.Child("refreshJitter"))...)
+
+	return allErrs
+}
+
+// metadataPrefixesOverlap returns true if both prefixes are set and some metadata key could start with both
+func metadataPrefixesOverlap(prefix string, otherPrefix string) bool {
+	return prefix != "" && otherPrefix != "" &&
+		(strings.HasPrefix(prefix, otherPrefix) || strings.HasPrefix(otherPrefix, prefix))
+}
+
+func validateNode(nodeConfig *NodeConfig, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	switch nodeConfig.VMLookup {
+	case NodeLookupVMName, NodeLookupComputerName, NodeLookupSystemUUID:
+		if nodeConfig.MetadataKey != "" {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("metadataKey"),
+				fmt.Sprintf("only used with vmLookup [%s]", NodeLookupMetadata)))
+		}
+	case NodeLookupMetadata:
+		if nodeConfig.MetadataKey == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("metadataKey"),
+				fmt.Sprintf("needed with vmLookup [%s]", NodeLookupMetadata)))
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("vmLookup"), nodeConfig.VMLookup,
+			[]string{NodeLookupVMName, NodeLookupComputerName, NodeLookupMetadata, NodeLookupSystemUUID}))
+	}
+	if metadataPrefixesOverlap(nodeConfig.LabelMetadataPrefix, nodeConfig.TaintMetadataPrefix) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("taintMetadataPrefix"),
+			nodeConfig.TaintMetadataPrefix, "must not overlap with labelMetadataPrefix"))
+	}
+	// the identity written to VM metadata must not be read back as labels or taints
+	for _, prefix := range []string{nodeConfig.LabelMetadataPrefix, nodeConfig.TaintMetadataPrefix} {
+		if metadataPrefixesOverlap(prefix, nodeConfig.IdentityMetadataPrefix) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("identityMetadataPrefix"),
+				nodeConfig.IdentityMetadataPrefix, "must not overlap with labelMetadataPrefix or taintMetadataPrefix"))
+			break
+		}
+	}
+	switch nodeConfig.IdentityMetadataDomain {
+	case MetadataDomainGeneral, MetadataDomainSystem:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("identityMetadataDomain"),
+			nodeConfig.IdentityMetadataDomain, []string{MetadataDomainGeneral, MetadataDomainSystem}))
+	}
+	if nodeConfig.MetadataSyncInterval <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("metadataSyncInterval"),
+			nodeConfig.MetadataSyncInterval.String(), "must be positive"))
+	}
+
+	return allErrs
+}
+
+func validateShutdown(shutdownConfig *ShutdownConfig, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	knownStatuses := make(map[string]bool)
+	for _, status := range ShutdownVMStatuses {
+		knownStatuses[status] = true
+	}
+	for idx, status := range shutdownConfig.VMStatuses {
+		if !knownStatuses[status] {
+			allErrs = append(allErrs, field.NotSupported(fldPath.Child("vmStatuses").Index(idx), status,
+				ShutdownVMStatuses))
+		}
+	}
+
+	return allErrs
+}
+
+func validateClusterID(clusterID string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if clusterID == "" || strings.HasPrefix(clusterID, clusterIDNoRDEPrefix) {
+		return allErrs
+	}
+	if !clusterIDRegexp.MatchString(clusterID) {
+		allErrs = append(allErrs, field.Invalid(fldPath, clusterID,
+			"must be an RDE URN such as urn:vcloud:entity:vmware:capvcdCluster:<uuid>"))
+	}
+
+	return allErrs
+}
+
+// ValidateCloudConfigFields : checks all fields of config and returns every problem that is found
+func ValidateCloudConfigFields(config *CloudConfig) field.ErrorList {
+	allErrs := validateVCD(&config.VCD, field.NewPath("vcd"))
+	allErrs = append(allErrs, validateLB(&config.LB, field.NewPath("loadbalancer"))...)
+	allErrs = append(allErrs, validateVMCache(&config.VMCache, field.NewPath("vmCache"))...)
+	allErrs = append(allErrs, validateNode(&config.Node, field.NewPath("node"))...)
+	allErrs = append(allErrs, validateShutdown(&config.Shutdown, field.NewPath("shutdown"))...)
+	allErrs = append(allErrs, validateClusterID(config.ClusterID, field.NewPath("clusterid"))...)
+
+	return allErrs
+}
@@ -0,0 +1,188 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func validCloudConfig() *CloudConfig {
+	return &CloudConfig{
+		VCD: VCDConfig{
+			Host:       "https://vcd.example.com",
+			Org:        "org",
+			VDC:        "vdc",
+			VDCNetwork: "network",
+			VAppName:   VAppSelector{"vapp"},
+			VIPSubnet:  "10.1.0.0/24",
+		},
+		LB: LBConfig{
+			OneArm: &OneArm{
+				StartIP: "192.168.8.2",
+				EndIP:   "192.168.8.100",
+			},
+			Ports: Ports{
+				HTTP:  80,
+				HTTPS: 443,
+			},
+		},
+		VMCache: VMCacheConfig{
+			RefreshInterval: time.Minute,
+			RefreshJitter:   10 * time.Second,
+		},
+		Node: NodeConfig{
+			VMLookup:               NodeLookupVMName,
+			IdentityMetadataDomain: MetadataDomainGeneral,
+			MetadataSyncInterval:   5 * time.Minute,
+		},
+		Shutdown: ShutdownConfig{
+			VMStatuses: []string{"POWERED_OFF", "SUSPENDED"},
+		},
+		ClusterID: "urn:vcloud:entity:vmware:capvcdCluster:2b0e2e72-6d9c-4d0e-a1b5-4e77bd4b5c11",
+	}
+}
+
+func TestValidateCloudConfig(t *testing.T) {
+
+	type TestCase struct {
+		Name        string
+		Modify      func(config *CloudConfig)
+		ErrorFields []string
+	}
+
+	testCaseList := []TestCase{
+		{"valid", func(config *CloudConfig) {}, nil},
+		{"generated cluster id", func(config *CloudConfig) { config.ClusterID = "NO_RDE_abc" }, nil},
+		{"no one arm", func(config *CloudConfig) { config.LB.OneArm = nil }, nil},
+		{"host with api path", func(config *CloudConfig) { config.VCD.Host = "https://vcd.example.com/api" },
+			[]string{"vcd.host"}},
+		{"host without scheme", func(config *CloudConfig) { config.VCD.Host = "vcd.example.com" },
+			[]string{"vcd.host"}},
+		{"missing names", func(config *CloudConfig) {
+			config.VCD.Org = ""
+			config.VCD.VDC = ""
+			config.VCD.VDCNetwork = ""
+			config.VCD.VAppName = nil
+		}, []string{"vcd.org", "vcd.vdc", "vcd.network", "vcd.vAppName"}},
+		{"invalid vip subnet", func(config *CloudConfig) { config.VCD.VIPSubnet = "10.1.0.0" },
+			[]string{"vcd.vipSubnet"}},
+		{"one arm range reversed", func(config *CloudConfig) { config.LB.OneArm.EndIP = "192.168.8.1" },
+			[]string{"loadbalancer.oneArm.endIP"}},
+		{"one arm invalid ips", func(config *CloudConfig) {
+			config.LB.OneArm.StartIP = "192.168.8"
+			config.LB.OneArm.EndIP = ""
+		}, []string{"loadbalancer.oneArm.startIP", "loadbalancer.oneArm.endIP"}},
+		{"one arm mixed families", func(config *CloudConfig) { config.LB.OneArm.EndIP = "fd00::1" },
+			[]string{"loadbalancer.oneArm.endIP"}},
+		{"port out of range", func(config *CloudConfig) { config.LB.Ports.HTTPS = 65536 },
+			[]string{"loadbalancer.ports.https"}},
+		{"same ports", func(config *CloudConfig) { config.LB.Ports.HTTPS = 80 },
+			[]string{"loadbalancer.ports.https"}},
+		{"vApp selector with pattern and metadata", func(config *CloudConfig) {
+			config.VCD.VAppName = VAppSelector{"cluster-*", "metadata:cluster-id=abc"}
+		}, []string{"vcd.vAppName"}},
+		{"vm cache without refresh", func(config *CloudConfig) { config.VMCache.RefreshInterval = 0 },
+			[]string{"vmCache.refreshInterval"}},
+		{"negative vm cache jitter", func(config *CloudConfig) { config.VMCache.RefreshJitter = -time.Second },
+			[]string{"vmCache.refreshJitter"}},
+		{"metadata node lookup", func(config *CloudConfig) {
+			config.Node.VMLookup, config.Node.MetadataKey = NodeLookupMetadata, "node-name"
+		}, nil},
+		{"metadata node lookup without key", func(config *CloudConfig) { config.Node.VMLookup = NodeLookupMetadata },
+			[]string{"node.metadataKey"}},
+		{"metadata key without metadata node lookup", func(config *CloudConfig) { config.Node.MetadataKey = "node-name" },
+			[]string{"node.metadataKey"}},
+		{"unknown node lookup", func(config *CloudConfig) { config.Node.VMLookup = "hostname" },
+			[]string{"node.vmLookup"}},
+		{"label and taint metadata prefixes", func(config *CloudConfig) {
+			config.Node.LabelMetadataPrefix, config.Node.TaintMetadataPrefix = "k8s.label.", "k8s.taint."
+		}, nil},
+		{"overlapping metadata prefixes", func(config *CloudConfig) {
+			config.Node.LabelMetadataPrefix, config.Node.TaintMetadataPrefix = "k8s.", "k8s.taint."
+		}, []string{"node.taintMetadataPrefix"}},
+		{"identity metadata prefix", func(config *CloudConfig) {
+			config.Node.LabelMetadataPrefix, config.Node.IdentityMetadataPrefix = "k8s.label.", "k8s.node."
+		}, nil},
+		{"identity metadata prefix overlapping taint prefix", func(config *CloudConfig) {
+			config.Node.TaintMetadataPrefix, config.Node.IdentityMetadataPrefix = "k8s.", "k8s.node."
+		}, []string{"node.identityMetadataPrefix"}},
+		{"system identity metadata domain", func(config *CloudConfig) {
+			config.Node.IdentityMetadataDomain = MetadataDomainSystem
+		}, nil},
+		{"unknown identity metadata domain", func(config *CloudConfig) { config.Node.IdentityMetadataDomain = "general" },
+			[]string{"node.identityMetadataDomain"}},
+		{"zero node metadata sync interval", func(config *CloudConfig) { config.Node.MetadataSyncInterval = 0 },
+			[]string{"node.metadataSyncInterval"}},
+		{"shutdown on maintenance mode", func(config *CloudConfig) {
+			config.Shutdown.VMStatuses = append(config.Shutdown.VMStatuses, "WAITING_FOR_INPUT")
+			config.Shutdown.MaintenanceMode = true
+		}, nil},
+		{"powered on vm shutdown status", func(config *CloudConfig) {
+			config.Shutdown.VMStatuses = []string{"POWERED_OFF", "POWERED_ON"}
+		}, []string{"shutdown.vmStatuses[1]"}},
+		{"invalid cluster id", func(config *CloudConfig) { config.ClusterID = "urn:vcloud:entity:vmware:capvcdCluster" },
+			[]string{"clusterid"}},
+		{"ca cert and ca cert file", func(config *CloudConfig) {
+			config.VCD.CACert = "cert"
+			config.VCD.CACertFile = "/etc/ssl/vcd.pem"
+		}, []string{"vcd.caCert"}},
+		{"insecure with ca cert", func(config *CloudConfig) {
+			config.VCD.Insecure = true
+			config.VCD.CACert = "cert"
+		}, []string{"vcd.insecure"}},
+		{"invalid pinned certificate", func(config *CloudConfig) {
+			config.VCD.PinnedCertificates = []string{"ab:cd"}
+		}, []string{"vcd.pinnedCertificates[0]"}},
+		{"proxy credentials without url", func(config *CloudConfig) { config.VCD.Proxy.Username = "user" },
+			[]string{"vcd.proxy.url"}},
+		{"invalid api version", func(config *CloudConfig) { config.VCD.APIVersion.Min = "36" },
+			[]string{"vcd.apiVersion.min"}},
+		{"lb targets", func(config *CloudConfig) {
+			config.LB.Targets = []LBTargetConfig{
+				{Name: "dmz", Network: "dmz-network", VIPSubnet: "10.2.0.0/24",
+					OneArm: &OneArm{StartIP: "192.168.9.2", EndIP: "192.168.9.100"}},
+				{Name: "internal", Network: "internal-network", ServiceEngineGroup: "internal-seg"},
+			}
+			config.LB.DefaultTarget = "internal"
+		}, nil},
+		{"invalid lb targets", func(config *CloudConfig) {
+			config.LB.Targets = []LBTargetConfig{
+				{Name: "default", Network: "network"},
+				{Name: "dmz", VIPSubnet: "10.2.0.0"},
+				{Name: "dmz", Network: "network", OneArm: &OneArm{StartIP: "192.168.9.2"}},
+			}
+			config.LB.DefaultTarget = "internal"
+		}, []string{"loadbalancer.targets[0].name", "loadbalancer.targets[1].network",
+			"loadbalancer.targets[1].vipSubnet", "loadbalancer.targets[2].name",
+			"loadbalancer.targets[2].oneArm.endIP", "loadbalancer.defaultTarget"}},
+		{"negative durations", func(config *CloudConfig) {
+			config.VCD.TaskTimeouts.Create = -time.Second
+			config.VCD.TokenLifetime = -time.Minute
+		}, []string{"vcd.taskTimeouts.create", "vcd.tokenLifetime"}},
+	}
+
+	for _, tc := range testCaseList {
+		config := validCloudConfig()
+		tc.Modify(config)
+		errList := ValidateCloudConfigFields(config)
+		errorFields := make([]string, 0)
+		for _, fieldErr := range errList {
+			errorFields = append(errorFields, fieldErr.Field)
+		}
+		if tc.ErrorFields == nil {
+			assert.Empty(t, errorFields, "Unexpected errors for case [%s]: [%v]", tc.Name, errList)
+			assert.NoError(t, ValidateCloudConfig(config), "Config of case [%s] should be valid", tc.Name)
+			continue
+		}
+		assert.Equal(t, tc.ErrorFields, errorFields, "Unexpected errors for case [%s]: [%v]", tc.Name, errList)
+		assert.Error(t, ValidateCloudConfig(config), "Config of case [%s] should be invalid", tc.Name)
+	}
+
+	return
+}
@@ -0,0 +1,112 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	// vAppSelectorMetadataPrefix starts an entry that selects VMs by metadata, such as metadata:cluster-id=<id>
+	vAppSelectorMetadataPrefix = "metadata:"
+	// vAppSelectorRegexpDelimiter encloses an entry that is a regular expression, such as /^cluster-.*$/
+	vAppSelectorRegexpDelimiter = "/"
+)
+
+// VAppSelector : selects the VMs of the cluster in the VDC. In the cloud config it is a single entry or a list of
+// entries. An entry is a vApp name, a glob such as "cluster-*", a regular expression enclosed in slashes such as
+// "/^cluster-(gpu|infra)$/", or a VM metadata selector such as "metadata:cluster-id=<id>". VMs in any vApp that
+// matches a name, glob or regular expression are selected. A metadata selector selects the VMs with that
+// metadata in any vApp of the VDC, and cannot be combined with other entries.
+type VAppSelector []string
+
+// UnmarshalYAML : accepts a single entry as well as a list of entries
+func (selector *VAppSelector) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	entry := ""
+	if err := unmarshal(&entry); err == nil {
+		*selector = VAppSelector{entry}
+		if entry == "" {
+			*selector = nil
+		}
+		return nil
+	}
+
+	entries := make([]string, 0)
+	if err := unmarshal(&entries); err != nil {
+		return fmt.Errorf("vApp selector should be a string or a list of strings: [%v]", err)
+	}
+	*selector = entries
+
+	return nil
+}
+
+// MarshalYAML : writes a single entry as a string, so that configs with one vApp name look as they were written
+func (selector VAppSelector) MarshalYAML() (interface{}, error) {
+	if len(selector) == 1 {
+		return selector[0], nil
+	}
+
+	return []string(selector), nil
+}
+
+// VAppSelectorTerms : the entries of a VAppSelector by kind
+type VAppSelectorTerms struct {
+	Names         []string
+	Globs         []string
+	Regexps       []*regexp.Regexp
+	MetadataKey   string
+	MetadataValue string
+}
+
+// Parse : sorts the entries of the selector by kind, and returns an error for entries that cannot be used
+func (selector VAppSelector) Parse() (*VAppSelectorTerms, error) {
+	terms := &VAppSelectorTerms{
+		Names:   make([]string, 0),
+		Globs:   make([]string, 0),
+		Regexps: make([]*regexp.Regexp, 0),
+	}
+	for _, entry := range selector {
+		switch {
+		case entry == "":
+			return nil, fmt.Errorf("entries should not be empty")
+
+		case strings.HasPrefix(entry, vAppSelectorMetadataPrefix):
+			if len(selector) > 1 {
+				return nil, fmt.Errorf("metadata selector [%s] cannot be combined with other entries", entry)
+			}
+			keyValue := strings.SplitN(strings.TrimPrefix(entry, vAppSelectorMetadataPrefix), "=", 2)
+			if len(keyValue) != 2 || keyValue[0] == "" || keyValue[1] == "" {
+				return nil, fmt.Errorf("metadata selector [%s] should be of the form %skey=value",
+					entry, vAppSelectorMetadataPrefix)
+			}
+			terms.MetadataKey, terms.MetadataValue = keyValue[0], keyValue[1]
+
+		case len(entry) > 2 && strings.HasPrefix(entry, vAppSelectorRegexpDelimiter) &&
+			strings.HasSuffix(entry, vAppSelectorRegexpDelimiter):
+			expression := strings.TrimSuffix(strings.TrimPrefix(entry, vAppSelectorRegexpDelimiter),
+				vAppSelectorRegexpDelimiter)
+			compiled, err := regexp.Compile(expression)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression [%s]: [%v]", expression, err)
+			}
+			terms.Regexps = append(terms.Regexps, compiled)
+
+		case strings.ContainsAny(entry, "*?["):
+			if _, err := path.Match(entry, ""); err != nil {
+				return nil, fmt.Errorf("invalid glob [%s]: [%v]", entry, err)
+			}
+			terms.Globs = append(terms.Globs, entry)
+
+		default:
+			terms.Names = append(terms.Names, entry)
+		}
+	}
+
+	return terms, nil
+}
@@ -0,0 +1,85 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestVAppSelectorYAML(t *testing.T) {
+
+	type TestCase struct {
+		YAML     string
+		Selector VAppSelector
+	}
+
+	testCaseList := []TestCase{
+		{`vAppName: cluster`, VAppSelector{"cluster"}},
+		{`vAppName: [cluster, cluster-gpu]`, VAppSelector{"cluster", "cluster-gpu"}},
+		{"vAppName:\n- cluster-*\n- /^infra-[0-9]+$/", VAppSelector{"cluster-*", "/^infra-[0-9]+$/"}},
+		{`vAppName: ""`, nil},
+	}
+
+	for _, tc := range testCaseList {
+		vcdConfig := VCDConfig{}
+		err := yaml.NewDecoder(strings.NewReader(tc.YAML)).Decode(&vcdConfig)
+		assert.NoError(t, err, "Unable to decode [%s]", tc.YAML)
+		assert.Equal(t, tc.Selector, vcdConfig.VAppName, "Unexpected selector for [%s]", tc.YAML)
+	}
+
+	out, err := yaml.Marshal(VCDConfig{VAppName: VAppSelector{"cluster"}})
+	assert.NoError(t, err, "Unable to marshal selector")
+	assert.Contains(t, string(out), "vAppName: cluster\n", "Single entry should be written as a string")
+
+	return
+}
+
+func TestVAppSelectorParse(t *testing.T) {
+
+	type TestCase struct {
+		Selector      VAppSelector
+		Names         []string
+		Globs         []string
+		Regexps       int
+		MetadataKey   string
+		MetadataValue string
+		ExpectError   bool
+	}
+
+	testCaseList := []TestCase{
+		{VAppSelector{"cluster"}, []string{"cluster"}, []string{}, 0, "", "", false},
+		{VAppSelector{"cluster", "gpu-*", "/^infra-[0-9]+$/"}, []string{"cluster"}, []string{"gpu-*"}, 1, "", "",
+			false},
+		{VAppSelector{"metadata:cluster-id=urn:vcloud:entity:1"}, []string{}, []string{}, 0, "cluster-id",
+			"urn:vcloud:entity:1", false},
+		{VAppSelector{"metadata:cluster-id=abc", "cluster"}, nil, nil, 0, "", "", true},
+		{VAppSelector{"metadata:cluster-id"}, nil, nil, 0, "", "", true},
+		{VAppSelector{"/[/"}, nil, nil, 0, "", "", true},
+		{VAppSelector{"gpu-["}, nil, nil, 0, "", "", true},
+		{VAppSelector{""}, nil, nil, 0, "", "", true},
+	}
+
+	for _, tc := range testCaseList {
+		terms, err := tc.Selector.Parse()
+		if tc.ExpectError {
+			assert.Error(t, err, "Expected error for selector [%v]", tc.Selector)
+			continue
+		}
+		assert.NoError(t, err, "Unexpected error for selector [%v]", tc.Selector)
+		assert.Equal(t, tc.Names, terms.Names, "Unexpected names for selector [%v]", tc.Selector)
+		assert.Equal(t, tc.Globs, terms.Globs, "Unexpected globs for selector [%v]", tc.Selector)
+		assert.Equal(t, tc.Regexps, len(terms.Regexps), "Unexpected regexps for selector [%v]", tc.Selector)
+		assert.Equal(t, tc.MetadataKey, terms.MetadataKey, "Unexpected metadata key for selector [%v]", tc.Selector)
+		assert.Equal(t, tc.MetadataValue, terms.MetadataValue, "Unexpected metadata value for selector [%v]",
+			tc.Selector)
+	}
+
+	return
+}
@@ -0,0 +1,51 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package util
+
+import (
+	"sync"
+)
+
+type refCountedMutex struct {
+	sync.Mutex
+	refCount int
+}
+
+// KeyedMutex hands out one mutex per key so that operations on unrelated keys can proceed in parallel.
+// Entries are reference counted and dropped once no caller holds or waits on them, so the map only
+// grows with the number of concurrently active keys.
+type KeyedMutex struct {
+	mapLock sync.Mutex
+	locks   map[string]*refCountedMutex
+}
+
+// Lock blocks until the mutex for key is acquired and returns the function that releases it.
+func (km *KeyedMutex) Lock(key string) func() {
+	km.mapLock.Lock()
+	if km.locks == nil {
+		km.locks = make(map[string]*refCountedMutex)
+	}
+	lock, ok := km.locks[key]
+	if !ok {
+		lock = &refCountedMutex{}
+		km.locks[key] = lock
+	}
+	lock.refCount++
+	km.mapLock.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		km.mapLock.Lock()
+		lock.refCount--
+		if lock.refCount == 0 {
+			delete(km.locks, key)
+		}
+		km.mapLock.Unlock()
+	}
+}
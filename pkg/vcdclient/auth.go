@@ -6,7 +6,6 @@
 package vcdclient
 
 import (
-	"crypto/tls"
 	"fmt"
 	swaggerClient "github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdswaggerclient"
 	"github.com/vmware/go-vcloud-director/v2/govcd"
@@ -16,6 +15,7 @@ import (
 )
 
 const (
+	// VCloudApiVersion is the api version the swagger client is generated for
 	VCloudApiVersion = "36.0"
 )
 
@@ -28,9 +28,35 @@ type VCDAuthConfig struct {
 	Host         string `json:"host"`
 	CloudAPIHref string `json:"cloudapihref"`
 	VDC          string `json:"vdc"`
-	Insecure     bool   `json:"insecure"`
 	Token        string `json:"token"`
 	IsSysAdmin   bool   // will be set by GetBearerToken()
+	TLSConfig
+	Proxy      ProxyConfig      `json:"proxy"`
+	APIVersion APIVersionConfig `json:"apiVersion"`
+}
+
+// newGovcdClient creates an unauthenticated govcd client that verifies the VCD endpoint as per the TLS config
+// and connects through the configured proxy. All other clients share its transport.
+func (config *VCDAuthConfig) newGovcdClient(u url.URL) (*govcd.VCDClient, error) {
+	tlsClientConfig, err := config.TLSConfig.clientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS config for [%s]: [%v]", config.Host, err)
+	}
+
+	vcdClient := govcd.NewVCDClient(u, config.Insecure)
+	transport, ok := vcdClient.Client.Http.Transport.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("unexpected transport of type [%T] in govcd client", vcdClient.Client.Http.Transport)
+	}
+	transport.TLSClientConfig = tlsClientConfig
+
+	proxyFunc, err := config.Proxy.proxyFunc()
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy config for [%s]: [%v]", config.Host, err)
+	}
+	transport.Proxy = proxyFunc
+
+	return vcdClient, nil
 }
 
 func (config *VCDAuthConfig) GetBearerToken() (*govcd.VCDClient, *http.Response, error) {
@@ -40,8 +66,13 @@ func (config *VCDAuthConfig) GetBearerToken() (*govcd.VCDClient, *http.Response,
 		return nil, nil, fmt.Errorf("unable to parse url [%s]: %s", href, err)
 	}
 
-	vcdClient := govcd.NewVCDClient(*u, config.Insecure)
-	vcdClient.Client.APIVersion = VCloudApiVersion
+	vcdClient, err := config.newGovcdClient(*u)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create client for url [%s]: [%v]", href, err)
+	}
+	if err = config.negotiateAPIVersion(vcdClient); err != nil {
+		return nil, nil, fmt.Errorf("unable to use url [%s]: [%v]", href, err)
+	}
 	klog.Infof("Using VCD OpenAPI version [%s]", vcdClient.Client.APIVersion)
 
 	var resp *http.Response
@@ -72,18 +103,21 @@ func (config *VCDAuthConfig) GetSwaggerClientFromSecrets() (*govcd.VCDClient, *s
 	if err != nil {
 		return nil, nil, fmt.Errorf("unable to get bearer token from secrets: [%v]", err)
 	}
+
+	return vcdClient, config.newSwaggerClient(vcdClient), nil
+}
+
+// newSwaggerClient creates a swagger client that shares the transport and api version of vcdClient. Since
+// the transport is captured here, anything that wraps it must be installed before.
+func (config *VCDAuthConfig) newSwaggerClient(vcdClient *govcd.VCDClient) *swaggerClient.APIClient {
 	authHeader := fmt.Sprintf("Bearer %s", vcdClient.Client.VCDToken)
 
 	swaggerConfig := swaggerClient.NewConfiguration()
 	swaggerConfig.BasePath = fmt.Sprintf("%s/cloudapi", config.Host)
 	swaggerConfig.AddDefaultHeader("Authorization", authHeader)
-	swaggerConfig.HTTPClient = &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: config.Insecure},
-		},
-	}
+	swaggerConfig.HTTPClient = newSwaggerHTTPClient(vcdClient)
 
-	return vcdClient, swaggerClient.NewAPIClient(swaggerConfig), nil
+	return swaggerClient.NewAPIClient(swaggerConfig)
 }
 
 func (config *VCDAuthConfig) GetPlainClientFromSecrets() (*govcd.VCDClient, error) {
@@ -94,8 +128,13 @@ func (config *VCDAuthConfig) GetPlainClientFromSecrets() (*govcd.VCDClient, erro
 		return nil, fmt.Errorf("unable to parse url: [%s]: [%v]", href, err)
 	}
 
-	vcdClient := govcd.NewVCDClient(*u, config.Insecure)
-	vcdClient.Client.APIVersion = VCloudApiVersion
+	vcdClient, err := config.newGovcdClient(*u)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create client for url [%s]: [%v]", href, err)
+	}
+	if err = config.negotiateAPIVersion(vcdClient); err != nil {
+		return nil, fmt.Errorf("unable to use url [%s]: [%v]", href, err)
+	}
 	klog.Infof("Using VCD XML API version [%s]", vcdClient.Client.APIVersion)
 	if err = vcdClient.Authenticate(config.User, config.Password, config.UserOrg); err != nil {
 		return nil, fmt.Errorf("cannot authenticate with vcd: [%v]", err)
@@ -105,13 +144,16 @@ func (config *VCDAuthConfig) GetPlainClientFromSecrets() (*govcd.VCDClient, erro
 }
 
 func NewVCDAuthConfigFromSecrets(host string, user string, secret string,
-	refreshToken string, userOrg string, insecure bool) *VCDAuthConfig {
+	refreshToken string, userOrg string, tlsConfig TLSConfig, proxyConfig ProxyConfig,
+	apiVersionConfig APIVersionConfig) *VCDAuthConfig {
 	return &VCDAuthConfig{
 		Host:         host,
 		User:         user,
 		Password:     secret,
 		RefreshToken: refreshToken,
 		UserOrg:      userOrg,
-		Insecure:     insecure,
+		TLSConfig:    tlsConfig,
+		Proxy:        proxyConfig,
+		APIVersion:   apiVersionConfig,
 	}
 }
@@ -0,0 +1,192 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+var (
+	_ LoadBalancerBackend  = &Client{}
+	_ LoadBalancerBackends = &Client{}
+	_ VMInventory          = &vcdVMs{}
+	_ VMMetadata           = &vcdVMs{}
+	_ RDEStore             = &vcdRDEStore{}
+)
+
+// LoadBalancerBackend : returns the client scoped to the named load balancer target, after making sure that its
+// bearer token is valid
+func (client *Client) LoadBalancerBackend(ctx context.Context, name string) (LoadBalancerBackend, error) {
+	if err := client.RefreshBearerTokenIfNeeded(); err != nil {
+		return nil, fmt.Errorf("error while obtaining access token: [%v]", err)
+	}
+
+	return client.ForLBTarget(ctx, name)
+}
+
+// vcdVMs finds the VMs selected by the VM selector of the client, and reads and writes their metadata. The bearer
+// token of the client is refreshed as needed before each call.
+type vcdVMs struct {
+	client *Client
+}
+
+// VMInventory : returns the VMs selected by the VM selector of the client
+func (client *Client) VMInventory() VMInventory {
+	return &vcdVMs{client: client}
+}
+
+// VMMetadata : returns the metadata of the VMs of the client
+func (client *Client) VMMetadata() VMMetadata {
+	return &vcdVMs{client: client}
+}
+
+// vmFromGovcd converts a VM read from VCD with all of its network connections
+func vmFromGovcd(vm *govcd.VM) (*VM, error) {
+	if vm == nil || vm.VM == nil {
+		return nil, fmt.Errorf("vm struct should not be nil")
+	}
+
+	vcdVM := &VM{
+		ID:          vm.VM.ID,
+		HREF:        vm.VM.HREF,
+		Name:        vm.VM.Name,
+		Status:      types.VAppStatuses[vm.VM.Status],
+		IPAddresses: make([]string, 0),
+	}
+	if vm.VM.NetworkConnectionSection != nil {
+		for _, netConn := range vm.VM.NetworkConnectionSection.NetworkConnection {
+			vcdVM.IPAddresses = append(vcdVM.IPAddresses, netConn.IPAddress)
+		}
+	}
+
+	return vcdVM, nil
+}
+
+// vmFromRecord converts a VM listed by the query API, which only has the IP of the primary network connection
+func vmFromRecord(vmRecord *types.QueryResultVMRecordType) *VM {
+	vcdVM := &VM{
+		ID:              vmRecord.ID,
+		HREF:            vmRecord.HREF,
+		Name:            vmRecord.Name,
+		Status:          vmRecord.Status,
+		MaintenanceMode: vmRecord.MaintenanceMode,
+		IPAddresses:     make([]string, 0),
+	}
+	if vmRecord.IpAddress != "" {
+		vcdVM.IPAddresses = append(vcdVM.IPAddresses, vmRecord.IpAddress)
+	}
+
+	return vcdVM
+}
+
+// find gets a VM with find and converts it. VMs that are gone yield ErrNotFound.
+func (vms *vcdVMs) find(find func() (*govcd.VM, error)) (*VM, error) {
+	if err := vms.client.RefreshBearerTokenIfNeeded(); err != nil {
+		return nil, fmt.Errorf("error while obtaining access token: [%v]", err)
+	}
+	vm, err := find()
+	if err != nil {
+		// VMs that are gone can also be reported as forbidden; other forbidden errors are returned as they are
+		if vms.client.IsVmNotAvailable(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return vmFromGovcd(vm)
+}
+
+func (vms *vcdVMs) FindVMByName(name string) (*VM, error) {
+	return vms.find(func() (*govcd.VM, error) {
+		return vms.client.FindVMByName(name)
+	})
+}
+
+func (vms *vcdVMs) FindVMByUUID(uuid string) (*VM, error) {
+	return vms.find(func() (*govcd.VM, error) {
+		return vms.client.FindVMByUUID(uuid)
+	})
+}
+
+func (vms *vcdVMs) FindVMByComputerName(computerName string) (*VM, error) {
+	return vms.find(func() (*govcd.VM, error) {
+		return vms.client.FindVMByComputerName(computerName)
+	})
+}
+
+func (vms *vcdVMs) FindVMByMetadata(key string, value string) (*VM, error) {
+	return vms.find(func() (*govcd.VM, error) {
+		return vms.client.FindVMByMetadata(key, value)
+	})
+}
+
+func (vms *vcdVMs) ListVMs() ([]*VM, error) {
+	if err := vms.client.RefreshBearerTokenIfNeeded(); err != nil {
+		return nil, fmt.Errorf("error while obtaining access token: [%v]", err)
+	}
+	vmRecords, err := vms.client.ListClusterVMs()
+	if err != nil {
+		return nil, err
+	}
+
+	vmList := make([]*VM, len(vmRecords))
+	for idx, vmRecord := range vmRecords {
+		vmList[idx] = vmFromRecord(vmRecord)
+	}
+
+	return vmList, nil
+}
+
+func (vms *vcdVMs) GetVMMetadata(vmHREF string) (map[string]string, error) {
+	if err := vms.client.RefreshBearerTokenIfNeeded(); err != nil {
+		return nil, fmt.Errorf("error while obtaining access token: [%v]", err)
+	}
+
+	return vms.client.GetVMMetadata(vmHREF)
+}
+
+func (vms *vcdVMs) SetVMMetadata(ctx context.Context, vmHREF string, domain string, prefix string,
+	entries map[string]string) (bool, error) {
+	if err := vms.client.RefreshBearerTokenIfNeeded(); err != nil {
+		return false, fmt.Errorf("error while obtaining access token: [%v]", err)
+	}
+
+	return vms.client.SetVMMetadata(ctx, vmHREF, domain, prefix, entries)
+}
+
+// vcdRDEStore keeps the virtual IPs in the RDE of the cluster of the client
+type vcdRDEStore struct {
+	client *Client
+}
+
+// RDEStore : returns the store of virtual IPs in the RDE of the cluster of the client
+func (client *Client) RDEStore() RDEStore {
+	return &vcdRDEStore{client: client}
+}
+
+func (store *vcdRDEStore) GetVirtualIPs(ctx context.Context) ([]string, error) {
+	virtualIPs, _, _, err := store.client.GetRDEVirtualIps(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if virtualIPs == nil {
+		virtualIPs = make([]string, 0)
+	}
+
+	return virtualIPs, nil
+}
+
+func (store *vcdRDEStore) AddVirtualIP(ctx context.Context, ip string) error {
+	return store.client.addVirtualIpToRDE(ctx, ip)
+}
+
+func (store *vcdRDEStore) RemoveVirtualIP(ctx context.Context, ip string) error {
+	return store.client.removeVirtualIpFromRDE(ctx, ip)
+}
@@ -7,21 +7,15 @@ package vcdclient
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"k8s.io/klog"
-	"net/http"
-	"sync"
+	"time"
 
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/util"
 	swaggerClient "github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdswaggerclient"
 	"github.com/vmware/go-vcloud-director/v2/govcd"
 )
 
-var (
-	clientCreatorLock sync.Mutex
-	clientSingleton   *Client = nil
-)
-
 // OneArm : internal struct representing OneArm config details
 type OneArm struct {
 	StartIPAddress string
@@ -30,9 +24,9 @@ type OneArm struct {
 
 // Client :
 type Client struct {
-	VCDAuthConfig  *VCDAuthConfig
 	ClusterOrgName string
 	ClusterOVDCName    string
+	// ClusterVAppName describes the vApps of the cluster VMs, which are selected by vmSelector
 	ClusterVAppName string
 	VCDClient *govcd.VCDClient
 	VDC         *govcd.Vdc
@@ -46,130 +40,179 @@ type Client struct {
 	HTTPPort           int32
 	HTTPSPort          int32
 	CertificateAlias string
-	RWLock           sync.RWMutex
+	TaskTimeouts     TaskTimeouts
+	RetryConfig      RetryConfig
+	tokens           *tokenManager
+
+	// Operations on different Services run in parallel. gatewayLocks is held only where the gateway itself
+	// must be serialized, such as IP allocation and NAT rule changes. Both are shared with the copies of the
+	// client that are scoped to a load balancer target.
+	gatewayLocks   *util.KeyedMutex
+	ipReservations *ipReservations
+
+	// lbTargets are the networks on which load balancers can be created. A client returned by ForLBTarget
+	// works on the network, gateway, vip subnet and one-arm range of lbTargetName.
+	lbTargets          *lbTargets
+	lbTargetName       string
+	serviceEngineGroup string
+
+	vmSelector VMSelector
 }
 
-func (client *Client) RefreshBearerToken() error {
-	klog.Infof("Refreshing vcd client")
+// RefreshBearerTokenIfNeeded : makes sure that the bearer token is valid for the next requests. VCD is
+// contacted only if the token is about to expire; requests that are rejected with 401 refresh it as well.
+func (client *Client) RefreshBearerTokenIfNeeded() error {
+	if client.tokens == nil {
+		return fmt.Errorf("vcd client is not authenticated")
+	}
+	if _, err := client.tokens.get(); err != nil {
+		return fmt.Errorf("unable to get valid bearer token: [%v]", err)
+	}
 
-	href := fmt.Sprintf("%s/api", client.VCDAuthConfig.Host)
-	client.VCDClient.Client.APIVersion = VCloudApiVersion
+	return nil
+}
 
-	klog.Infof("Is user sysadmin: [%v]", client.VCDClient.Client.IsSysAdmin)
-	if client.VCDAuthConfig.RefreshToken != "" {
-		// Refresh vcd client using refresh token
-		err := client.VCDClient.SetToken(client.VCDAuthConfig.UserOrg,
-			govcd.ApiTokenHeader, client.VCDAuthConfig.RefreshToken)
-		if err != nil {
-			return fmt.Errorf("failed to refresh VCD client with the refresh token: [%v]", err)
-		}
-	} else if client.VCDAuthConfig.User != "" && client.VCDAuthConfig.Password != "" {
-		// Refresh vcd client using username and password
-		resp, err := client.VCDClient.GetAuthResponse(client.VCDAuthConfig.User, client.VCDAuthConfig.Password,
-			client.VCDAuthConfig.UserOrg)
-		if err != nil {
-			return fmt.Errorf("unable to authenticate [%s/%s] for url [%s]: [%+v] : [%v]",
-				client.VCDAuthConfig.UserOrg, client.VCDAuthConfig.User, href, resp, err)
-		}
-	} else {
-		return fmt.Errorf(
-			"unable to find refresh token or secret to refresh vcd client for user [%s/%s] and url [%s]",
-			client.VCDAuthConfig.UserOrg, client.VCDAuthConfig.User, href)
+// RefreshBearerToken : obtains a new bearer token regardless of the validity of the current one.
+func (client *Client) RefreshBearerToken() error {
+	if client.tokens == nil {
+		return fmt.Errorf("vcd client is not authenticated")
 	}
-
-	// reset legacy client
-	org, err := client.VCDClient.GetOrgByNameOrId(client.ClusterOrgName)
-	if err != nil {
-		return fmt.Errorf("unable to get vcd organization [%s]: [%v]",
-			client.ClusterOrgName, err)
+	if _, err := client.tokens.refresh(client.tokens.current()); err != nil {
+		return fmt.Errorf("failed to refresh VCD client: [%v]", err)
 	}
 
-	vdc, err := org.GetVDCByName(client.ClusterOVDCName, true)
-	if err != nil {
-		return fmt.Errorf("unable to get VDC from org [%s], VDC [%s]: [%v]",
-			client.ClusterOrgName, client.VCDAuthConfig.VDC, err)
+	return nil
+}
+
+// UpdateCredentials : switches the client to a new user, password or refresh token, for example after the
+// secret holding them is rotated. The new credentials are used only if they can be used to authenticate;
+// otherwise the client keeps working with the current ones.
+func (client *Client) UpdateCredentials(userOrg string, user string, password string, refreshToken string) error {
+	if client.tokens == nil {
+		return fmt.Errorf("vcd client is not authenticated")
 	}
-	client.VDC = vdc
-
-	// reset swagger client
-	swaggerConfig := swaggerClient.NewConfiguration()
-	swaggerConfig.BasePath = fmt.Sprintf("%s/cloudapi", client.VCDAuthConfig.Host)
-	swaggerConfig.AddDefaultHeader("Authorization", fmt.Sprintf("Bearer %s", client.VCDClient.Client.VCDToken))
-	swaggerConfig.HTTPClient = &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: client.VCDAuthConfig.Insecure},
-		},
+
+	client.tokens.credentialsLock.Lock()
+	defer client.tokens.credentialsLock.Unlock()
+
+	currentAuthConfig := client.tokens.getAuthConfig()
+	vcdAuthConfig := NewVCDAuthConfigFromSecrets(currentAuthConfig.Host, user, password, refreshToken, userOrg,
+		currentAuthConfig.TLSConfig, currentAuthConfig.Proxy, currentAuthConfig.APIVersion)
+	if err := client.tokens.setCredentials(vcdAuthConfig); err != nil {
+		return fmt.Errorf("unable to update credentials of user [%s/%s]: [%v]", userOrg, user, err)
 	}
-	client.APIClient = swaggerClient.NewAPIClient(swaggerConfig)
 
-	klog.Info("successfully refreshed all clients")
 	return nil
 }
 
-// NewVCDClientFromSecrets :
-func NewVCDClientFromSecrets(host string, orgName string, vdcName string, vAppName string,
-	networkName string, ipamSubnet string, userOrg string, user string, password string,
-	refreshToken string, insecure bool, clusterID string, oneArm *OneArm,
-	httpPort int32, httpsPort int32, certAlias string, getVdcClient bool) (*Client, error) {
-
-	// TODO: validation of parameters
-
-	clientCreatorLock.Lock()
-	defer clientCreatorLock.Unlock()
-
-	// Return old client if everything matches. Else create new one and cache it.
-	// This is suboptimal but is not a common case.
-	if clientSingleton != nil {
-		if clientSingleton.VCDAuthConfig.Host == host &&
-			clientSingleton.ClusterOrgName == orgName &&
-			clientSingleton.ClusterOVDCName == vdcName &&
-			clientSingleton.ClusterVAppName == vAppName &&
-			clientSingleton.networkName == networkName &&
-			clientSingleton.VCDAuthConfig.UserOrg == userOrg &&
-			clientSingleton.VCDAuthConfig.User == user &&
-			clientSingleton.VCDAuthConfig.Password == password &&
-			clientSingleton.VCDAuthConfig.RefreshToken == refreshToken &&
-			clientSingleton.VCDAuthConfig.Insecure == insecure {
-			return clientSingleton, nil
+// ClientOptions : settings of a client created by NewClient. Unset timeouts, retry settings and token lifetime
+// use the defaults of the client.
+type ClientOptions struct {
+	Host         string
+	OrgName      string
+	VDCName      string
+	NetworkName  string
+	IPAMSubnet   string
+	UserOrg      string
+	User         string
+	Password     string
+	RefreshToken string
+
+	// VMSelector selects the VMs of the cluster in the VDC
+	VMSelector VMSelector
+
+	TLS        TLSConfig
+	Proxy      ProxyConfig
+	APIVersion APIVersionConfig
+
+	ClusterID string
+	OneArm    *OneArm
+	// LBTargets are the networks on which load balancers can be created. If empty, the target named
+	// DefaultLBTargetName is formed by NetworkName, IPAMSubnet and OneArm.
+	LBTargets        []LBTarget
+	DefaultLBTarget  string
+	HTTPPort         int32
+	HTTPSPort        int32
+	CertificateAlias string
+
+	TaskTimeouts  TaskTimeouts
+	Retry         RetryConfig
+	TokenLifetime time.Duration
+
+	// GetVDCClient loads the VDC of the cluster, which is needed to work with the VMs of the cluster
+	GetVDCClient bool
+}
+
+// NewClient : creates a client that is authenticated against VCD and has cached the gateway of the network of
+// the cluster. Every call creates an independent client; ClientCache shares clients between callers.
+func NewClient(opts *ClientOptions) (*Client, error) {
+	if opts == nil {
+		return nil, fmt.Errorf("client options should not be nil")
+	}
+
+	// without explicit targets, load balancers are created on the network of the cluster
+	lbTargets := opts.LBTargets
+	if len(lbTargets) == 0 {
+		lbTargets = []LBTarget{
+			{
+				Name:        DefaultLBTargetName,
+				NetworkName: opts.NetworkName,
+				IPAMSubnet:  opts.IPAMSubnet,
+				OneArm:      opts.OneArm,
+			},
 		}
 	}
+	lbTargetMap, err := newLBTargets(lbTargets, opts.DefaultLBTarget)
+	if err != nil {
+		return nil, fmt.Errorf("invalid load balancer targets: [%v]", err)
+	}
 
-	vcdAuthConfig := NewVCDAuthConfigFromSecrets(host, user, password, refreshToken, userOrg, insecure)
+	vcdAuthConfig := NewVCDAuthConfigFromSecrets(opts.Host, opts.User, opts.Password, opts.RefreshToken,
+		opts.UserOrg, opts.TLS, opts.Proxy, opts.APIVersion)
 
-	vcdClient, apiClient, err := vcdAuthConfig.GetSwaggerClientFromSecrets()
+	vcdClient, _, err := vcdAuthConfig.GetBearerToken()
 	if err != nil {
-		return nil, fmt.Errorf("unable to get swagger client from secrets: [%v]", err)
+		return nil, fmt.Errorf("unable to get bearer token from secrets: [%v]", err)
 	}
+	// the token manager wraps the transport of vcdClient, so it is created before the swagger client
+	tokens := newTokenManager(vcdAuthConfig, vcdClient, opts.TokenLifetime)
+	apiClient := vcdAuthConfig.newSwaggerClient(vcdClient)
 
 	client := &Client{
-		VCDAuthConfig:    vcdAuthConfig,
-		ClusterOrgName:   orgName,
-		ClusterOVDCName:  vdcName,
-		ClusterVAppName:  vAppName,
+		ClusterOrgName:   opts.OrgName,
+		ClusterOVDCName:  opts.VDCName,
+		ClusterVAppName:  opts.VMSelector.String(),
 		VCDClient:        vcdClient,
 		APIClient:        apiClient,
-		networkName:      networkName,
-		IPAMSubnet:       ipamSubnet,
+		networkName:      opts.NetworkName,
+		IPAMSubnet:       opts.IPAMSubnet,
 		gatewayRef:       nil,
-		ClusterID:        clusterID,
-		OneArm:           oneArm,
-		HTTPPort:         httpPort,
-		HTTPSPort:        httpsPort,
-		CertificateAlias: certAlias,
+		ClusterID:        opts.ClusterID,
+		OneArm:           opts.OneArm,
+		HTTPPort:         opts.HTTPPort,
+		HTTPSPort:        opts.HTTPSPort,
+		CertificateAlias: opts.CertificateAlias,
+		TaskTimeouts:     opts.TaskTimeouts,
+		RetryConfig:      opts.Retry,
+		tokens:           tokens,
+		gatewayLocks:     &util.KeyedMutex{},
+		ipReservations:   &ipReservations{},
+		lbTargets:        lbTargetMap,
+		vmSelector:       opts.VMSelector,
 	}
+	client.logFeatures()
 
-	if getVdcClient {
-		org, err := vcdClient.GetOrgByName(orgName)
+	if opts.GetVDCClient {
+		org, err := vcdClient.GetOrgByName(opts.OrgName)
 		if err != nil {
-			return nil, fmt.Errorf("unable to get org from name [%s]: [%v]", orgName, err)
+			return nil, fmt.Errorf("unable to get org from name [%s]: [%v]", opts.OrgName, err)
 		}
 
-		client.VDC, err = org.GetVDCByName(vdcName, true)
+		client.VDC, err = org.GetVDCByName(opts.VDCName, true)
 		if err != nil {
-			return nil, fmt.Errorf("unable to get VDC [%s] from org [%s]: [%v]", vdcName, orgName, err)
+			return nil, fmt.Errorf("unable to get VDC [%s] from org [%s]: [%v]", opts.VDCName, opts.OrgName, err)
 		}
 	}
-	client.VCDClient = vcdClient
 	// We will specifically cache the gateway ID that corresponds to the
 	// network name since it is used frequently in the loadbalancer context.
 	ctx := context.Background()
@@ -177,8 +220,12 @@ func NewVCDClientFromSecrets(host string, orgName string, vdcName string, vAppNa
 		return nil, fmt.Errorf("unable to get gateway edge from network name [%s]: [%v]",
 			client.networkName, err)
 	}
-	clientSingleton = client
+	// targets whose gateway cannot be found yet are retried when a Service selects them
+	if err = client.RefreshLBTargets(ctx); err != nil {
+		klog.Errorf("Unable to cache gateways of all load balancer targets: [%v]", err)
+	}
 
-	klog.Infof("Client singleton is sysadmin: [%v]", clientSingleton.VCDClient.Client.IsSysAdmin)
-	return clientSingleton, nil
+	klog.Infof("Client for user [%s/%s] is sysadmin: [%v]", opts.UserOrg, opts.User,
+		client.VCDClient.Client.IsSysAdmin)
+	return client, nil
 }
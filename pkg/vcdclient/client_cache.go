@@ -0,0 +1,100 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/util"
+)
+
+// ClientCache : shares clients between callers that ask for the same options. Clients are keyed by all of their
+// options, so a change in any option, such as the cluster ID or the one-arm range, yields a new client.
+type ClientCache struct {
+	rwLock  sync.RWMutex
+	clients map[string]*Client
+
+	// creationLocks makes concurrent callers with the same options wait for a single client to be created
+	creationLocks util.KeyedMutex
+	// newClient creates clients; it can be replaced in tests
+	newClient func(opts *ClientOptions) (*Client, error)
+}
+
+// NewClientCache : creates an empty cache that creates clients with NewClient
+func NewClientCache() *ClientCache {
+	return &ClientCache{
+		clients:   make(map[string]*Client),
+		newClient: NewClient,
+	}
+}
+
+// clientCacheKey hashes opts so that credentials are not kept in the keys of the cache
+func clientCacheKey(opts *ClientOptions) (string, error) {
+	optsBytes, err := json.Marshal(opts)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal client options: [%v]", err)
+	}
+	hash := sha256.Sum256(optsBytes)
+
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// Get : returns the cached client for opts, creating it if there is none
+func (cache *ClientCache) Get(opts *ClientOptions) (*Client, error) {
+	if opts == nil {
+		return nil, fmt.Errorf("client options should not be nil")
+	}
+	key, err := clientCacheKey(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := cache.creationLocks.Lock(key)
+	defer unlock()
+
+	cache.rwLock.RLock()
+	client, ok := cache.clients[key]
+	cache.rwLock.RUnlock()
+	if ok {
+		return client, nil
+	}
+
+	client, err = cache.newClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	cache.rwLock.Lock()
+	cache.clients[key] = client
+	cache.rwLock.Unlock()
+
+	return client, nil
+}
+
+// Delete : drops the client for opts from the cache, so that the next Get creates a new one
+func (cache *ClientCache) Delete(opts *ClientOptions) error {
+	key, err := clientCacheKey(opts)
+	if err != nil {
+		return err
+	}
+
+	cache.rwLock.Lock()
+	defer cache.rwLock.Unlock()
+	delete(cache.clients, key)
+
+	return nil
+}
+
+// Len : returns the number of cached clients
+func (cache *ClientCache) Len() int {
+	cache.rwLock.RLock()
+	defer cache.rwLock.RUnlock()
+
+	return len(cache.clients)
+}
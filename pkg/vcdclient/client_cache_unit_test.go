@@ -0,0 +1,90 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientCache(t *testing.T) {
+	cache := NewClientCache()
+	created := 0
+	cache.newClient = func(opts *ClientOptions) (*Client, error) {
+		if opts.Host == "" {
+			return nil, fmt.Errorf("host should not be empty")
+		}
+		created++
+		return &Client{ClusterID: opts.ClusterID}, nil
+	}
+
+	opts := &ClientOptions{Host: "https://vcd.example.com", OrgName: "org", ClusterID: "cluster-1"}
+	client, err := cache.Get(opts)
+	assert.NoError(t, err, "Unable to get client")
+	assert.Equal(t, "cluster-1", client.ClusterID, "Unexpected client")
+
+	sameOpts := *opts
+	sameClient, err := cache.Get(&sameOpts)
+	assert.NoError(t, err, "Unable to get client for the same options")
+	assert.True(t, client == sameClient, "Same options should share a client")
+	assert.Equal(t, 1, created, "Same options should create a single client")
+
+	otherOpts := *opts
+	otherOpts.ClusterID = "cluster-2"
+	otherClient, err := cache.Get(&otherOpts)
+	assert.NoError(t, err, "Unable to get client for other options")
+	assert.Equal(t, "cluster-2", otherClient.ClusterID, "Other options should get their own client")
+	assert.Equal(t, 2, cache.Len(), "Unexpected number of cached clients")
+
+	_, err = cache.Get(&ClientOptions{})
+	assert.Error(t, err, "Client creation errors should be returned")
+	assert.Equal(t, 2, cache.Len(), "Failed clients should not be cached")
+
+	_, err = cache.Get(nil)
+	assert.Error(t, err, "Nil options should be rejected")
+
+	assert.NoError(t, cache.Delete(opts), "Unable to delete client")
+	assert.Equal(t, 1, cache.Len(), "Unexpected number of cached clients after delete")
+	newClient, err := cache.Get(opts)
+	assert.NoError(t, err, "Unable to get client after delete")
+	assert.False(t, client == newClient, "Deleted client should be created again")
+
+	return
+}
+
+func TestClientCacheConcurrentGet(t *testing.T) {
+	cache := NewClientCache()
+	createdLock := sync.Mutex{}
+	created := 0
+	cache.newClient = func(opts *ClientOptions) (*Client, error) {
+		createdLock.Lock()
+		defer createdLock.Unlock()
+		created++
+		return &Client{}, nil
+	}
+
+	opts := &ClientOptions{Host: "https://vcd.example.com", ClusterID: "cluster-1"}
+	clients := make([]*Client, 10)
+	wg := sync.WaitGroup{}
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clients[i], _ = cache.Get(opts)
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, created, "Concurrent callers should create a single client")
+	for _, client := range clients {
+		assert.True(t, client == clients[0], "Concurrent callers should share a client")
+	}
+
+	return
+}
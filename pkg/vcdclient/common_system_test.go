@@ -114,23 +114,38 @@ func getTestVCDClient(inputMap map[string]interface{}) (*Client, error) {
 		}
 	}
 
-	return NewVCDClientFromSecrets(
-		cloudConfig.VCD.Host,
-		cloudConfig.VCD.Org,
-		cloudConfig.VCD.VDC,
-		cloudConfig.VCD.VAppName,
-		cloudConfig.VCD.VDCNetwork,
-		cloudConfig.VCD.VIPSubnet,
-		cloudConfig.VCD.UserOrg,
-		cloudConfig.VCD.User,
-		cloudConfig.VCD.Secret,
-		cloudConfig.VCD.RefreshToken,
-		insecure,
-		cloudConfig.ClusterID,
-		oneArm,
-		cloudConfig.LB.Ports.HTTP,
-		cloudConfig.LB.Ports.HTTPS,
-		cloudConfig.LB.CertificateAlias,
-		getVdcClient,
-	)
+	return NewClient(&ClientOptions{
+		Host:    cloudConfig.VCD.Host,
+		OrgName: cloudConfig.VCD.Org,
+		VDCName: cloudConfig.VCD.VDC,
+		VMSelector: VMSelector{
+			VAppNames: cloudConfig.VCD.VAppName,
+		},
+		NetworkName:  cloudConfig.VCD.VDCNetwork,
+		IPAMSubnet:   cloudConfig.VCD.VIPSubnet,
+		UserOrg:      cloudConfig.VCD.UserOrg,
+		User:         cloudConfig.VCD.User,
+		Password:     cloudConfig.VCD.Secret,
+		RefreshToken: cloudConfig.VCD.RefreshToken,
+		TLS: TLSConfig{
+			Insecure: insecure,
+		},
+		ClusterID:        cloudConfig.ClusterID,
+		OneArm:           oneArm,
+		HTTPPort:         cloudConfig.LB.Ports.HTTP,
+		HTTPSPort:        cloudConfig.LB.Ports.HTTPS,
+		CertificateAlias: cloudConfig.LB.CertificateAlias,
+		TaskTimeouts: TaskTimeouts{
+			Create: cloudConfig.VCD.TaskTimeouts.Create,
+			Update: cloudConfig.VCD.TaskTimeouts.Update,
+			Delete: cloudConfig.VCD.TaskTimeouts.Delete,
+		},
+		Retry: RetryConfig{
+			MaxAttempts:    cloudConfig.VCD.Retry.MaxAttempts,
+			InitialBackoff: cloudConfig.VCD.Retry.InitialBackoff,
+			MaxBackoff:     cloudConfig.VCD.Retry.MaxBackoff,
+		},
+		TokenLifetime: cloudConfig.VCD.TokenLifetime,
+		GetVDCClient:  getVdcClient,
+	})
 }
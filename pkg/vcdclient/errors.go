@@ -3,6 +3,8 @@ package vcdclient
 import (
     "fmt"
     "runtime/debug"
+
+    "github.com/vmware/go-vcloud-director/v2/types/v56"
 )
 
 type VirtualServicePendingError struct {
@@ -21,6 +23,11 @@ type GatewayBusyError struct {
 	GatewayName string
 }
 
+type DuplicateVMNameError struct {
+	VMName    string
+	VAppNames []string
+}
+
 func (vsError *VirtualServicePendingError) Error() string {
 	return fmt.Sprintf("virtual service [%s] is in Pending state", vsError.VirtualServiceName)
 }
@@ -35,6 +42,11 @@ func (vsError *VirtualServiceBusyError) Error() string {
 	return fmt.Sprintf("virtual service [%s] is busy", vsError.VirtualServiceName)
 }
 
+// Unwrap makes errors.Is(err, ErrBusy) hold
+func (vsError *VirtualServiceBusyError) Unwrap() error {
+	return ErrBusy
+}
+
 func NewVirtualServiceBusyError(virtualServiceName string) *VirtualServiceBusyError {
 	return &VirtualServiceBusyError{
 		VirtualServiceName: virtualServiceName,
@@ -45,6 +57,11 @@ func (lbPoolError *LoadBalancerPoolBusyError) Error() string {
 	return fmt.Sprintf("load balancer pool [%s] is busy", lbPoolError.LBPoolName)
 }
 
+// Unwrap makes errors.Is(err, ErrBusy) hold
+func (lbPoolError *LoadBalancerPoolBusyError) Unwrap() error {
+	return ErrBusy
+}
+
 func NewLBPoolBusyError(lbPoolName string) *LoadBalancerPoolBusyError {
 	return &LoadBalancerPoolBusyError{
 		LBPoolName: lbPoolName,
@@ -55,12 +72,65 @@ func (gatewayBusyError *GatewayBusyError) Error() string {
 	return fmt.Sprintf("gateway [%s] is busy", gatewayBusyError.GatewayName)
 }
 
+// Unwrap makes errors.Is(err, ErrBusy) hold
+func (gatewayBusyError *GatewayBusyError) Unwrap() error {
+	return ErrBusy
+}
+
+func (duplicateVMNameError *DuplicateVMNameError) Error() string {
+	return fmt.Sprintf("vm name [%s] is used by several selected vms, in vApps [%v]",
+		duplicateVMNameError.VMName, duplicateVMNameError.VAppNames)
+}
+
+func NewDuplicateVMNameError(vmName string, vAppNames []string) *DuplicateVMNameError {
+	return &DuplicateVMNameError{
+		VMName:    vmName,
+		VAppNames: vAppNames,
+	}
+}
+
 func NewGatewayBusyError(gatewayName string) *GatewayBusyError {
 	return &GatewayBusyError{
 		GatewayName: gatewayName,
 	}
 }
 
+// TaskFailedError is returned when a VCD task ends in an error, aborted or canceled state
+type TaskFailedError struct {
+	TaskURL        string
+	Operation      string
+	Status         string
+	MajorErrorCode int
+	MinorErrorCode string
+	Message        string
+}
+
+func (taskError *TaskFailedError) Error() string {
+	return fmt.Sprintf("task [%s] for operation [%s] ended in status [%s]: [%d:%s] - [%s]",
+		taskError.TaskURL, taskError.Operation, taskError.Status, taskError.MajorErrorCode,
+		taskError.MinorErrorCode, taskError.Message)
+}
+
+// Unwrap returns the kind of the VCD error of the task, so that errors.Is works with ErrBusy and the other kinds
+func (taskError *TaskFailedError) Unwrap() error {
+	return vcdErrorKind(taskError.MajorErrorCode, taskError.MinorErrorCode, taskError.Message)
+}
+
+func NewTaskFailedError(taskURL string, task *types.Task) *TaskFailedError {
+	taskError := &TaskFailedError{
+		TaskURL:   taskURL,
+		Operation: task.Operation,
+		Status:    task.Status,
+	}
+	if task.Error != nil {
+		taskError.MajorErrorCode = task.Error.MajorErrorCode
+		taskError.MinorErrorCode = task.Error.MinorErrorCode
+		taskError.Message = task.Error.Message
+	}
+
+	return taskError
+}
+
 // NoRDEError is an error used when the InfraID value in the VCDCluster object does not point to a valid RDE in VCD
 type NoRDEError struct {
 	msg string
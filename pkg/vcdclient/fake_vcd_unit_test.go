@@ -0,0 +1,645 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/util"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient/fakevcd"
+	swaggerClient "github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdswaggerclient"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+)
+
+// fakeVCD is a fake VCD with the org, VDC, network, gateway and cluster RDE that the tests log in to. The gateway
+// hands out external IPs from 192.168.0.10-20, of which the first is used.
+type fakeVCD struct {
+	server    *fakevcd.Server
+	vdcID     string
+	gatewayID string
+	clusterID string
+}
+
+func newFakeVCD() *fakeVCD {
+	server := fakevcd.NewServer()
+	server.AddOrg("tenant")
+	server.AddUser("tenant", "user", "password")
+	server.AddRefreshToken("tenant", "api-token")
+	vdcID := server.AddVDC("tenant", "vdc")
+	gatewayID := server.AddEdgeGateway(vdcID, "gateway", []swaggerClient.EdgeGatewaySubnet{
+		{
+			Gateway:      "192.168.0.1",
+			PrefixLength: 24,
+			IpRanges: &swaggerClient.IpRanges{
+				Values: []swaggerClient.IpRange{
+					{
+						StartAddress: "192.168.0.10",
+						EndAddress:   "192.168.0.20",
+					},
+				},
+			},
+		},
+	})
+	server.AddUsedIPs(gatewayID, "192.168.0.10")
+	server.AddNetwork(vdcID, "network", gatewayID)
+	server.AddServiceEngineGroup(gatewayID, "seg", 4)
+	clusterID := server.AddDefinedEntity(swaggerClient.DefinedEntity{
+		EntityType: util.CAPVCDEntityTypeID,
+		Name:       "cluster",
+		Entity: map[string]interface{}{
+			"status": map[string]interface{}{
+				"virtualIPs": []interface{}{},
+			},
+		},
+	})
+
+	return &fakeVCD{
+		server:    server,
+		vdcID:     vdcID,
+		gatewayID: gatewayID,
+		clusterID: clusterID,
+	}
+}
+
+// newClient logs in to the fake VCD with a password, or with an API token if refreshToken is set
+func (fake *fakeVCD) newClient(oneArm *OneArm, refreshToken string) (*Client, error) {
+	password := "password"
+	if refreshToken != "" {
+		password = ""
+	}
+	return NewClient(&ClientOptions{
+		Host:         fake.server.URL,
+		OrgName:      "tenant",
+		VDCName:      "vdc",
+		NetworkName:  "network",
+		IPAMSubnet:   "192.168.0.1/24",
+		UserOrg:      "tenant",
+		User:         "user",
+		Password:     password,
+		RefreshToken: refreshToken,
+		VMSelector: VMSelector{
+			VAppNames: []string{"cluster"},
+		},
+		ClusterID: fake.clusterID,
+		OneArm:    oneArm,
+		TaskTimeouts: TaskTimeouts{
+			Create: 10 * time.Second,
+			Update: 10 * time.Second,
+			Delete: 10 * time.Second,
+		},
+		Retry: RetryConfig{
+			MaxAttempts:    5,
+			InitialBackoff: 10 * time.Millisecond,
+			MaxBackoff:     50 * time.Millisecond,
+		},
+		GetVDCClient: true,
+	})
+}
+
+func (fake *fakeVCD) virtualIPs(t *testing.T) []string {
+	entity, ok := fake.server.DefinedEntity(fake.clusterID)
+	assert.True(t, ok, "Cluster RDE should exist")
+	virtualIPs, err := util.GetVirtualIPsFromRDE(&entity)
+	assert.NoError(t, err, "Virtual IPs should be read from the cluster RDE")
+
+	return virtualIPs
+}
+
+var fakeVCDPortDetails = []PortDetails{
+	{
+		Protocol:     "TCP",
+		PortSuffix:   "tcp",
+		ExternalPort: 80,
+		InternalPort: 30080,
+	},
+	{
+		Protocol:     "TCP",
+		PortSuffix:   "unused",
+		ExternalPort: 8080,
+		InternalPort: 0,
+	},
+}
+
+func TestFakeVCDLoadBalancer(t *testing.T) {
+	fake := newFakeVCD()
+	defer fake.server.Close()
+
+	client, err := fake.newClient(nil, "")
+	assert.NoError(t, err, "Client should log in to the fake VCD")
+	ctx := context.Background()
+
+	externalIP, err := client.CreateLoadBalancer(ctx, "ingress", "pool", []string{"10.0.0.5", "10.0.0.6"},
+		fakeVCDPortDetails)
+	assert.NoError(t, err, "Load balancer should be created")
+	assert.Equal(t, "192.168.0.11", externalIP, "First unused IP of the gateway should be used")
+
+	pools := fake.server.LoadBalancerPools(fake.gatewayID)
+	if assert.Len(t, pools, 1, "One pool should be created for the port with an internal port") {
+		assert.Equal(t, "pool-tcp", pools[0].Name, "Pool should be named after the port")
+		assert.Len(t, pools[0].Members, 2, "Pool should have a member per IP")
+	}
+	virtualServices := fake.server.VirtualServices(fake.gatewayID)
+	if assert.Len(t, virtualServices, 1, "One virtual service should be created") {
+		assert.Equal(t, "ingress-tcp", virtualServices[0].Name, "Virtual service should be named after the port")
+		assert.Equal(t, externalIP, virtualServices[0].VirtualIpAddress, "Virtual service should use the IP")
+	}
+	assert.Empty(t, fake.server.NATRules(fake.gatewayID), "No NAT rule should be created without one-arm")
+	assert.Equal(t, []string{externalIP}, fake.virtualIPs(t), "IP should be added to the cluster RDE")
+
+	ip, err := client.GetLoadBalancer(ctx, "ingress-tcp")
+	assert.NoError(t, err, "Load balancer should be found")
+	assert.Equal(t, externalIP, ip, "Load balancer should report its IP")
+
+	_, err = client.CreateLoadBalancer(ctx, "ingress", "pool", []string{"10.0.0.5", "10.0.0.6"},
+		fakeVCDPortDetails)
+	assert.NoError(t, err, "Existing load balancer should be created again without error")
+	assert.Len(t, fake.server.VirtualServices(fake.gatewayID), 1, "Existing virtual service should be reused")
+	assert.Len(t, fake.server.LoadBalancerPools(fake.gatewayID), 1, "Existing pool should be reused")
+
+	err = client.DeleteLoadBalancer(ctx, "ingress", "pool", fakeVCDPortDetails)
+	assert.NoError(t, err, "Load balancer should be deleted")
+	assert.Empty(t, fake.server.VirtualServices(fake.gatewayID), "Virtual service should be deleted")
+	assert.Empty(t, fake.server.LoadBalancerPools(fake.gatewayID), "Pool should be deleted")
+	assert.Empty(t, fake.virtualIPs(t), "IP should be removed from the cluster RDE")
+
+	err = client.DeleteLoadBalancer(ctx, "ingress", "pool", fakeVCDPortDetails)
+	assert.NoError(t, err, "Deleted load balancer should be deleted again without error")
+	ip, err = client.GetLoadBalancer(ctx, "ingress-tcp")
+	assert.NoError(t, err, "Deleted load balancer should not be an error")
+	assert.Empty(t, ip, "Deleted load balancer should have no IP")
+
+	return
+}
+
+func TestFakeVCDOneArmLoadBalancer(t *testing.T) {
+	fake := newFakeVCD()
+	defer fake.server.Close()
+
+	client, err := fake.newClient(&OneArm{
+		StartIPAddress: "192.168.8.2",
+		EndIPAddress:   "192.168.8.100",
+	}, "")
+	assert.NoError(t, err, "Client should log in to the fake VCD")
+	ctx := context.Background()
+
+	externalIP, err := client.CreateLoadBalancer(ctx, "ingress", "pool", []string{"10.0.0.5"}, fakeVCDPortDetails)
+	assert.NoError(t, err, "One-arm load balancer should be created")
+	assert.Equal(t, "192.168.0.11", externalIP, "First unused IP of the gateway should be used")
+
+	virtualServices := fake.server.VirtualServices(fake.gatewayID)
+	if assert.Len(t, virtualServices, 1, "One virtual service should be created") {
+		assert.Equal(t, "192.168.8.2", virtualServices[0].VirtualIpAddress,
+			"Virtual service should use the first one-arm IP")
+	}
+	natRules := fake.server.NATRules(fake.gatewayID)
+	if assert.Len(t, natRules, 1, "One DNAT rule should be created") {
+		assert.Equal(t, "dnat-ingress-tcp", natRules[0].Name, "DNAT rule should be named after the service")
+		assert.Equal(t, externalIP, natRules[0].ExternalAddresses, "DNAT rule should translate the external IP")
+		assert.Equal(t, "192.168.8.2", natRules[0].InternalAddresses, "DNAT rule should translate to one-arm IP")
+		assert.Equal(t, "DNAT", natRules[0].Type_, "Rule type should be set from api version 36.0")
+	}
+	appPortProfiles := fake.server.AppPortProfiles()
+	if assert.Len(t, appPortProfiles, 1, "One application port profile should be created") {
+		assert.Equal(t, "appPort_dnat-ingress-tcp", appPortProfiles[0].Name,
+			"Application port profile should be named after the DNAT rule")
+		assert.Equal(t, fake.vdcID, appPortProfiles[0].ContextEntityId,
+			"Application port profile should be created in the VDC")
+	}
+	assert.Equal(t, []string{externalIP}, fake.virtualIPs(t), "External IP should be added to the cluster RDE")
+
+	ip, err := client.GetLoadBalancer(ctx, "ingress-tcp")
+	assert.NoError(t, err, "One-arm load balancer should be found")
+	assert.Equal(t, externalIP, ip, "One-arm load balancer should report its external IP")
+
+	_, err = client.CreateLoadBalancer(ctx, "other", "other-pool", []string{"10.0.0.5"}, fakeVCDPortDetails)
+	assert.NoError(t, err, "Second one-arm load balancer should be created")
+	for _, virtualService := range fake.server.VirtualServices(fake.gatewayID) {
+		if virtualService.Name == "other-tcp" {
+			assert.Equal(t, "192.168.8.3", virtualService.VirtualIpAddress,
+				"Second virtual service should use the next one-arm IP")
+		}
+	}
+
+	err = client.DeleteLoadBalancer(ctx, "ingress", "pool", fakeVCDPortDetails)
+	assert.NoError(t, err, "One-arm load balancer should be deleted")
+	err = client.DeleteLoadBalancer(ctx, "other", "other-pool", fakeVCDPortDetails)
+	assert.NoError(t, err, "Second one-arm load balancer should be deleted")
+	assert.Empty(t, fake.server.VirtualServices(fake.gatewayID), "Virtual services should be deleted")
+	assert.Empty(t, fake.server.LoadBalancerPools(fake.gatewayID), "Pools should be deleted")
+	assert.Empty(t, fake.server.NATRules(fake.gatewayID), "DNAT rules should be deleted")
+	assert.Empty(t, fake.server.AppPortProfiles(), "Application port profiles should be deleted")
+	assert.Empty(t, fake.virtualIPs(t), "External IPs should be removed from the cluster RDE")
+
+	return
+}
+
+func TestFakeVCDLoadBalancerTasks(t *testing.T) {
+	fake := newFakeVCD()
+	defer fake.server.Close()
+
+	client, err := fake.newClient(nil, "")
+	assert.NoError(t, err, "Client should log in to the fake VCD")
+	ctx := context.Background()
+
+	fake.server.FailTasks(http.MethodPost, "/cloudapi/1.0.0/loadBalancer/virtualServices", 1, "no capacity")
+	_, err = client.CreateLoadBalancer(ctx, "ingress", "pool", []string{"10.0.0.5"}, fakeVCDPortDetails)
+	assert.Error(t, err, "Failed virtual service task should fail the creation")
+	assert.Empty(t, fake.server.VirtualServices(fake.gatewayID), "Failed virtual service should be rolled back")
+	assert.Len(t, fake.server.LoadBalancerPools(fake.gatewayID), 1, "Pool should remain for the next attempt")
+
+	fake.server.SetTaskDelay(300 * time.Millisecond)
+	taskPolls := fake.server.Requests(http.MethodGet, "/api/task/")
+	externalIP, err := client.CreateLoadBalancer(ctx, "ingress", "pool", []string{"10.0.0.5"}, fakeVCDPortDetails)
+	assert.NoError(t, err, "Creation should complete once the slow task does")
+	assert.Equal(t, "192.168.0.11", externalIP, "IP of the failed attempt should be reused")
+	assert.Greater(t, fake.server.Requests(http.MethodGet, "/api/task/")-taskPolls, 1,
+		"Slow task should be polled until it completes")
+	assert.Len(t, fake.server.LoadBalancerPools(fake.gatewayID), 1, "Existing pool should be reused")
+
+	err = client.DeleteLoadBalancer(ctx, "ingress", "pool", fakeVCDPortDetails)
+	assert.NoError(t, err, "Deletion should complete once the slow tasks do")
+	assert.Empty(t, fake.server.VirtualServices(fake.gatewayID), "Virtual service should be deleted")
+	assert.Empty(t, fake.server.LoadBalancerPools(fake.gatewayID), "Pool should be deleted")
+
+	return
+}
+
+func TestFakeVCDLoadBalancerRetries(t *testing.T) {
+	fake := newFakeVCD()
+	defer fake.server.Close()
+
+	client, err := fake.newClient(nil, "")
+	assert.NoError(t, err, "Client should log in to the fake VCD")
+	ctx := context.Background()
+
+	// VCD may have created the object before failing with a server error, so that creation is not retried
+	fake.server.FailRequests(http.MethodPost, "/cloudapi/1.0.0/loadBalancer/pools", 1,
+		http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE")
+	_, err = client.CreateLoadBalancer(ctx, "ingress", "pool", []string{"10.0.0.5"}, fakeVCDPortDetails)
+	assert.Error(t, err, "Creation should fail on an unavailable error")
+	assert.Equal(t, 1, fake.server.Requests(http.MethodPost, "/cloudapi/1.0.0/loadBalancer/pools"),
+		"Unavailable pool creation should not be retried")
+
+	fake.server.FailRequests(http.MethodPost, "/cloudapi/1.0.0/loadBalancer/pools", 2, http.StatusBadRequest,
+		"BUSY_ENTITY")
+	fake.server.FailRequests(http.MethodPost, "/cloudapi/1.0.0/loadBalancer/virtualServices", 1,
+		http.StatusTooManyRequests, "TOO_MANY_REQUESTS")
+	fake.server.RejectFilterProperties("name")
+	_, err = client.CreateLoadBalancer(ctx, "ingress", "pool", []string{"10.0.0.5"}, fakeVCDPortDetails)
+	assert.NoError(t, err, "Creation should be retried past busy and throttling errors")
+	assert.Equal(t, 4, fake.server.Requests(http.MethodPost, "/cloudapi/1.0.0/loadBalancer/pools"),
+		"Busy pool creation should be retried")
+	assert.Equal(t, 2, fake.server.Requests(http.MethodPost, "/cloudapi/1.0.0/loadBalancer/virtualServices"),
+		"Throttled virtual service creation should be retried")
+	assert.Len(t, fake.server.VirtualServices(fake.gatewayID), 1, "Virtual service should be found without filters")
+
+	// a gateway under a concurrent change turns deletes down as busy, too
+	fake.server.FailRequests(http.MethodDelete, "/cloudapi/1.0.0/loadBalancer/virtualServices/", 1,
+		http.StatusBadRequest, "BUSY_ENTITY")
+	fake.server.FailRequests(http.MethodDelete, "/cloudapi/1.0.0/loadBalancer/pools/", 1,
+		http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE")
+	err = client.DeleteLoadBalancer(ctx, "ingress", "pool", fakeVCDPortDetails)
+	assert.NoError(t, err, "Deletion should be retried past busy and unavailable errors")
+	assert.Equal(t, 2, fake.server.Requests(http.MethodDelete, "/cloudapi/1.0.0/loadBalancer/virtualServices/"),
+		"Busy virtual service deletion should be retried")
+	assert.Equal(t, 2, fake.server.Requests(http.MethodDelete, "/cloudapi/1.0.0/loadBalancer/pools/"),
+		"Unavailable pool deletion should be retried")
+	assert.Empty(t, fake.server.LoadBalancerPools(fake.gatewayID), "Pool should be deleted")
+
+	return
+}
+
+func TestFakeVCDLoadBalancerBusyUpdates(t *testing.T) {
+	fake := newFakeVCD()
+	defer fake.server.Close()
+
+	// updates also change the DNAT rule, which only one-arm load balancers have
+	client, err := fake.newClient(&OneArm{
+		StartIPAddress: "192.168.8.2",
+		EndIPAddress:   "192.168.8.100",
+	}, "")
+	assert.NoError(t, err, "Client should log in to the fake VCD")
+	ctx := context.Background()
+
+	_, err = client.CreateLoadBalancer(ctx, "ingress", "pool", []string{"10.0.0.5"}, fakeVCDPortDetails)
+	assert.NoError(t, err, "Load balancer should be created")
+
+	// a gateway under a concurrent change turns updates down as busy, just like creates
+	natRulesPath := "/cloudapi/1.0.0/edgeGateways/" + fake.gatewayID + "/nat/rules/"
+	fake.server.FailRequests(http.MethodPut, "/cloudapi/1.0.0/loadBalancer/pools/", 1, http.StatusBadRequest,
+		"BUSY_ENTITY")
+	fake.server.FailRequests(http.MethodPut, "/cloudapi/1.0.0/loadBalancer/virtualServices/", 1,
+		http.StatusBadRequest, "BUSY_ENTITY")
+	fake.server.FailRequests(http.MethodPut, natRulesPath, 1, http.StatusBadRequest, "BUSY_ENTITY")
+	err = client.UpdateLoadBalancer(ctx, "pool-tcp", "ingress-tcp", []string{"10.0.0.6"}, 30080, 8081)
+	assert.NoError(t, err, "Update should be retried past busy errors")
+	assert.Equal(t, 2, fake.server.Requests(http.MethodPut, "/cloudapi/1.0.0/loadBalancer/pools/"),
+		"Busy pool update should be retried")
+	assert.Equal(t, 2, fake.server.Requests(http.MethodPut, "/cloudapi/1.0.0/loadBalancer/virtualServices/"),
+		"Busy virtual service update should be retried")
+	assert.Equal(t, 2, fake.server.Requests(http.MethodPut, natRulesPath), "Busy DNAT rule update should be retried")
+	pools := fake.server.LoadBalancerPools(fake.gatewayID)
+	if assert.Len(t, pools, 1, "Pool should remain") {
+		assert.Len(t, pools[0].Members, 1, "Pool should have the updated member")
+		assert.Equal(t, "10.0.0.6", pools[0].Members[0].IpAddress, "Pool should have the updated member")
+	}
+
+	return
+}
+
+func TestFakeVCDRDEVirtualIPs(t *testing.T) {
+	fake := newFakeVCD()
+	defer fake.server.Close()
+
+	client, err := fake.newClient(nil, "")
+	assert.NoError(t, err, "Client should log in to the fake VCD")
+	ctx := context.Background()
+
+	virtualIPs, etag, entity, err := client.GetRDEVirtualIps(ctx)
+	assert.NoError(t, err, "Virtual IPs should be read from the cluster RDE")
+	assert.Empty(t, virtualIPs, "Cluster RDE should have no virtual IPs")
+
+	fake.server.ModifyDefinedEntity(fake.clusterID, func(entity *swaggerClient.DefinedEntity) {
+		entity.Entity["status"].(map[string]interface{})["virtualIPs"] = []interface{}{"192.168.0.15"}
+	})
+	resp, err := client.updateRDEVirtualIps(ctx, []string{"192.168.0.12"}, etag, entity)
+	assert.Error(t, err, "Update with a stale ETag should fail")
+	if assert.NotNil(t, resp, "Failed update should have a response") {
+		assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode, "Stale ETag should fail the precondition")
+	}
+
+	assert.NoError(t, client.addVirtualIpToRDE(ctx, "192.168.0.12"), "Virtual IP should be added")
+	assert.Equal(t, []string{"192.168.0.15", "192.168.0.12"}, fake.virtualIPs(t),
+		"Virtual IP should be added to the IPs of the concurrent update")
+	assert.NoError(t, client.removeVirtualIpFromRDE(ctx, "192.168.0.15"), "Virtual IP should be removed")
+	assert.Equal(t, []string{"192.168.0.12"}, fake.virtualIPs(t), "Only the removed virtual IP should be gone")
+
+	return
+}
+
+func TestFakeVCDTokenLogin(t *testing.T) {
+	fake := newFakeVCD()
+	defer fake.server.Close()
+
+	client, err := fake.newClient(nil, "api-token")
+	assert.NoError(t, err, "Client should log in to the fake VCD with an API token")
+	assert.Equal(t, 0, fake.server.Requests(http.MethodPost, "/cloudapi/1.0.0/sessions"),
+		"API token login should not log in with a password")
+	tokenRequests := fake.server.Requests(http.MethodPost, "/oauth/tenant/tenant/token")
+	assert.Greater(t, tokenRequests, 0, "API token should be exchanged for an access token")
+
+	fake.server.ExpireTokens()
+	_, err = client.GetLoadBalancer(context.Background(), "ingress-tcp")
+	assert.NoError(t, err, "Expired access token should be refreshed")
+	assert.Greater(t, fake.server.Requests(http.MethodPost, "/oauth/tenant/tenant/token"), tokenRequests,
+		"API token should be exchanged again once the access token expires")
+
+	_, err = fake.newClient(nil, "unknown-token")
+	assert.Error(t, err, "Unknown API token should not log in")
+
+	return
+}
+
+func TestFakeVCDUpdateCredentials(t *testing.T) {
+	fake := newFakeVCD()
+	defer fake.server.Close()
+	fake.server.AddUser("tenant", "rotated-user", "rotated-password")
+
+	client, err := fake.newClient(nil, "")
+	assert.NoError(t, err, "Client should log in to the fake VCD")
+	ctx := context.Background()
+	lbClient, err := client.ForLBTarget(ctx, "")
+	assert.NoError(t, err, "Client should be scoped to the default target")
+
+	// copies of the client refresh with whatever credentials are current while they are switched
+	wg := sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, lbClient.RefreshBearerToken(), "Token should be refreshed during the switch")
+		}()
+	}
+	err = client.UpdateCredentials("tenant", "rotated-user", "rotated-password", "")
+	wg.Wait()
+	assert.NoError(t, err, "Valid credentials should be switched to")
+	assert.Equal(t, "rotated-user", lbClient.tokens.getAuthConfig().User,
+		"Copies of the client should use the switched credentials")
+
+	err = client.UpdateCredentials("tenant", "rotated-user", "wrong-password", "")
+	assert.Error(t, err, "Invalid credentials should not be switched to")
+	assert.Equal(t, "rotated-password", client.tokens.getAuthConfig().Password,
+		"Current credentials should be kept")
+	assert.NoError(t, lbClient.RefreshBearerToken(), "Current credentials should still log in")
+
+	return
+}
+
+func TestFakeVCDClusterVMs(t *testing.T) {
+	fake := newFakeVCD()
+	defer fake.server.Close()
+
+	workerID := fake.server.AddVM(fake.vdcID, "cluster", "worker-1", "10.0.0.5")
+	fake.server.AddVM(fake.vdcID, "cluster", "worker-2", "10.0.0.6")
+	fake.server.AddVM(fake.vdcID, "other", "worker-1", "10.0.1.5")
+	fake.server.SetVMStatus(workerID, 8, true)
+	fake.server.SetVMMetadata(workerID, "node", "worker-1.cluster")
+
+	client, err := fake.newClient(nil, "")
+	assert.NoError(t, err, "Client should log in to the fake VCD")
+
+	vmRecords, err := client.ListClusterVMs()
+	assert.NoError(t, err, "VMs of the cluster should be listed")
+	if assert.Len(t, vmRecords, 2, "Only the VMs of the cluster vApp should be listed") {
+		assert.Equal(t, workerID, vmRecords[0].ID, "Id of the VM should be set from its href")
+		assert.Equal(t, "POWERED_OFF", vmRecords[0].Status, "Status of the VM should be listed")
+		assert.True(t, vmRecords[0].MaintenanceMode, "Maintenance mode of the VM should be listed")
+		assert.Equal(t, "10.0.0.6", vmRecords[1].IpAddress, "IP of the VM should be listed")
+	}
+
+	vm, err := client.FindVMByName("worker-1")
+	assert.NoError(t, err, "VM of the cluster should be found by name despite its namesake in another vApp")
+	if assert.NotNil(t, vm, "VM should be found by name") {
+		assert.Equal(t, workerID, vm.VM.ID, "VM of the cluster vApp should be found")
+		assert.Equal(t, "10.0.0.5", vm.VM.NetworkConnectionSection.NetworkConnection[0].IPAddress,
+			"Network connections of the VM should be read")
+	}
+
+	vm, err = client.FindVMByUUID(strings.ToUpper(strings.TrimPrefix(workerID, VCDVMIDPrefix)))
+	assert.NoError(t, err, "VM should be found by UUID")
+	if assert.NotNil(t, vm, "VM should be found by UUID") {
+		assert.Equal(t, "worker-1", vm.VM.Name, "VM with the UUID should be found")
+	}
+
+	vm, err = client.FindVMByMetadata("node", "worker-1.cluster")
+	assert.NoError(t, err, "VM should be found by metadata")
+	if assert.NotNil(t, vm, "VM should be found by metadata") {
+		assert.Equal(t, workerID, vm.VM.ID, "VM with the metadata should be found")
+	}
+
+	_, err = client.FindVMByName("worker-3")
+	assert.Equal(t, govcd.ErrorEntityNotFound, err, "Unknown VM should not be found")
+
+	fake.server.RemoveVM(workerID)
+	_, err = client.FindVMByUUID(workerID)
+	assert.Equal(t, govcd.ErrorEntityNotFound, err, "Removed VM should not be found")
+	_, err = client.VCDClient.Client.GetVMByHref(vmRecords[0].HREF)
+	assert.True(t, client.IsVmNotAvailable(NewVCDErrorFromGovcd(err)), "Removed VM should not be available")
+
+	return
+}
+
+func TestFakeVCDVMInventory(t *testing.T) {
+	fake := newFakeVCD()
+	defer fake.server.Close()
+
+	workerID := fake.server.AddVM(fake.vdcID, "cluster", "worker-1", "10.0.0.5")
+	fake.server.SetVMStatus(workerID, 8, true)
+	fake.server.SetVMMetadata(workerID, "node", "worker-1.cluster")
+
+	client, err := fake.newClient(nil, "")
+	assert.NoError(t, err, "Client should log in to the fake VCD")
+	vms := client.VMInventory()
+
+	vmList, err := vms.ListVMs()
+	assert.NoError(t, err, "VMs of the cluster should be listed")
+	if assert.Len(t, vmList, 1, "VM of the cluster should be listed") {
+		assert.Equal(t, &VM{
+			ID:              workerID,
+			HREF:            vmList[0].HREF,
+			Name:            "worker-1",
+			Status:          "POWERED_OFF",
+			MaintenanceMode: true,
+			IPAddresses:     []string{"10.0.0.5"},
+		}, vmList[0], "Listed VM should be converted")
+	}
+
+	vm, err := vms.FindVMByMetadata("node", "worker-1.cluster")
+	assert.NoError(t, err, "VM should be found by metadata")
+	if assert.NotNil(t, vm, "VM should be found by metadata") {
+		assert.Equal(t, workerID, vm.ID, "VM with the metadata should be found")
+		assert.Equal(t, "POWERED_OFF", vm.Status, "Status of the found VM should be named")
+		assert.Equal(t, []string{"10.0.0.5"}, vm.IPAddresses, "IPs of the found VM should be read")
+	}
+
+	// the user lacks rights to view the VM, which still exists
+	fake.server.FailRequests(http.MethodGet, "/api/vApp/vm-"+strings.TrimPrefix(workerID, VCDVMIDPrefix), 1,
+		http.StatusForbidden, "ACCESS_TO_RESOURCE_IS_FORBIDDEN")
+	_, err = vms.FindVMByUUID(workerID)
+	assert.True(t, errors.Is(err, ErrForbidden), "Forbidden VM should be reported as forbidden")
+	assert.False(t, errors.Is(err, ErrNotFound), "Forbidden VM should not be taken for a VM that is gone")
+
+	fake.server.RemoveVM(workerID)
+	_, err = vms.FindVMByUUID(workerID)
+	assert.True(t, errors.Is(err, ErrNotFound), "Removed VM should not be found")
+
+	rdeStore := client.RDEStore()
+	assert.NoError(t, rdeStore.AddVirtualIP(context.Background(), "192.168.0.12"), "Virtual IP should be added")
+	virtualIPs, err := rdeStore.GetVirtualIPs(context.Background())
+	assert.NoError(t, err, "Virtual IPs should be read")
+	assert.Equal(t, []string{"192.168.0.12"}, virtualIPs, "Added virtual IP should be read")
+
+	return
+}
+
+func TestFakeVCDVMMetadata(t *testing.T) {
+	fake := newFakeVCD()
+	defer fake.server.Close()
+	ctx := context.Background()
+
+	workerID := fake.server.AddVM(fake.vdcID, "cluster", "worker-1", "10.0.0.5")
+	fake.server.SetVMMetadata(workerID, "node", "worker-1.cluster")
+	fake.server.SetVMMetadata(workerID, "k8s.stale", "value")
+	vmPath := "/api/vApp/vm-" + strings.TrimPrefix(workerID, VCDVMIDPrefix)
+	metadataWrites := func() int {
+		return fake.server.Requests(http.MethodPut, vmPath) + fake.server.Requests(http.MethodDelete, vmPath)
+	}
+
+	client, err := fake.newClient(nil, "")
+	assert.NoError(t, err, "Client should log in to the fake VCD")
+	vmList, err := client.VMInventory().ListVMs()
+	assert.NoError(t, err, "VMs of the cluster should be listed")
+	if !assert.Len(t, vmList, 1, "VM of the cluster should be listed") {
+		return
+	}
+	vms := client.VMMetadata()
+	entries := map[string]string{"k8s.node": "worker-1", "k8s.cluster": "cluster"}
+
+	changed, err := vms.SetVMMetadata(ctx, vmList[0].HREF, "", "k8s.", entries)
+	assert.NoError(t, err, "Metadata should be set")
+	assert.True(t, changed, "New metadata should change the VM")
+	assert.Equal(t, map[string]string{"node": "worker-1.cluster", "k8s.node": "worker-1", "k8s.cluster": "cluster"},
+		fake.server.VMMetadata(workerID, MetadataDomainGeneral),
+		"Entries with the prefix should be replaced and other entries kept")
+
+	writes := metadataWrites()
+	changed, err = vms.SetVMMetadata(ctx, vmList[0].HREF, MetadataDomainGeneral, "k8s.", entries)
+	assert.NoError(t, err, "Same metadata should be set again")
+	assert.False(t, changed, "Same metadata should not change the VM")
+	assert.Equal(t, writes, metadataWrites(), "Unchanged metadata should not be written")
+
+	entries["k8s.node"] = "worker-2"
+	changed, err = vms.SetVMMetadata(ctx, vmList[0].HREF, MetadataDomainGeneral, "k8s.", entries)
+	assert.NoError(t, err, "Changed metadata should be set")
+	assert.True(t, changed, "Changed metadata should change the VM")
+	assert.Equal(t, writes+1, metadataWrites(), "Only the changed entry should be written")
+
+	_, err = vms.SetVMMetadata(ctx, vmList[0].HREF, MetadataDomainSystem, "k8s.", entries)
+	assert.True(t, errors.Is(err, ErrForbidden), "Users of the org should not write system metadata")
+	_, err = vms.SetVMMetadata(ctx, vmList[0].HREF, "system", "k8s.", entries)
+	assert.Error(t, err, "Unknown metadata domain should be rejected")
+
+	// a stuck metadata task must not block the caller beyond its context
+	fake.server.SetTaskDelay(time.Minute)
+	entries["k8s.node"] = "worker-3"
+	timeoutCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	start := time.Now()
+	_, err = vms.SetVMMetadata(timeoutCtx, vmList[0].HREF, MetadataDomainGeneral, "k8s.", entries)
+	cancel()
+	assert.Error(t, err, "Waiting for a stuck metadata task should stop when the context is done")
+	assert.Less(t, int64(time.Since(start)), int64(5*time.Second), "Stuck metadata task should not be waited for")
+	fake.server.SetTaskDelay(0)
+
+	fake.server.FailTasks(http.MethodPut, vmPath+"/metadata/", 1, "metadata is locked")
+	entries["k8s.node"] = "worker-4"
+	_, err = vms.SetVMMetadata(ctx, vmList[0].HREF, MetadataDomainGeneral, "k8s.", entries)
+	var taskFailedErr *TaskFailedError
+	assert.True(t, errors.As(err, &taskFailedErr), "Failed metadata task should be reported as a failed task")
+
+	fake.server.AddUser(fakevcd.SystemOrg, "admin", "password")
+	adminClient, err := NewClient(&ClientOptions{
+		Host:        fake.server.URL,
+		OrgName:     "tenant",
+		VDCName:     "vdc",
+		NetworkName: "network",
+		IPAMSubnet:  "192.168.0.1/24",
+		UserOrg:     fakevcd.SystemOrg,
+		User:        "admin",
+		Password:    "password",
+		VMSelector:  VMSelector{VAppNames: []string{"cluster"}},
+		ClusterID:   fake.clusterID,
+	})
+	if !assert.NoError(t, err, "System administrator should log in to the fake VCD") {
+		return
+	}
+	changed, err = adminClient.VMMetadata().SetVMMetadata(ctx, vmList[0].HREF, MetadataDomainSystem, "k8s.", entries)
+	assert.NoError(t, err, "System administrator should write system metadata")
+	assert.True(t, changed, "New system metadata should change the VM")
+	assert.Equal(t, entries, fake.server.VMMetadata(workerID, MetadataDomainSystem),
+		"Metadata should be written to the system domain")
+	changed, err = adminClient.VMMetadata().SetVMMetadata(ctx, vmList[0].HREF, MetadataDomainSystem, "k8s.", entries)
+	assert.NoError(t, err, "Same system metadata should be set again")
+	assert.False(t, changed, "Entries of the general domain should not be taken for system metadata")
+
+	return
+}
@@ -0,0 +1,45 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package fakebackend keeps load balancers, VMs and the virtual IPs of the cluster RDE in memory. Its types
+// implement the interfaces of the vcdclient that the cloud provider consumes, so that the cloud provider can be
+// exercised without a VCD, or a fake of its API, in unit tests.
+//
+// Calls of every type can be made to fail to exercise the error paths. A failed call changes nothing.
+package fakebackend
+
+// callFailure fails the next count calls of method
+type callFailure struct {
+	method string
+	count  int
+	err    error
+}
+
+// failures are the calls that are to fail. It is guarded by the lock of its owner.
+type failures []*callFailure
+
+func (f *failures) add(method string, count int, err error) {
+	*f = append(*f, &callFailure{
+		method: method,
+		count:  count,
+		err:    err,
+	})
+}
+
+// next returns the error of the next failure of method, or nil if the call is not to fail
+func (f *failures) next(method string) error {
+	for idx, failure := range *f {
+		if failure.method != method {
+			continue
+		}
+		failure.count--
+		if failure.count <= 0 {
+			*f = append((*f)[:idx], (*f)[idx+1:]...)
+		}
+		return failure.err
+	}
+
+	return nil
+}
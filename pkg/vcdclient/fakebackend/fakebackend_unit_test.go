@@ -0,0 +1,205 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package fakebackend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient"
+)
+
+func TestFakeLoadBalancers(t *testing.T) {
+	ctx := context.Background()
+	rdeStore := NewRDEStore()
+	lbs := NewLoadBalancers(rdeStore)
+	lbs.AddTarget("default", "192.168.0.10", "192.168.0.11")
+	lbs.AddTarget("other", "10.0.0.10")
+
+	lbBackend, err := lbs.LoadBalancerBackend(ctx, "")
+	assert.NoError(t, err, "Default target should be returned for an empty name")
+	portDetailsList := []vcdclient.PortDetails{
+		{PortSuffix: "http", ExternalPort: 80, InternalPort: 31080, Protocol: "HTTP"},
+		{PortSuffix: "https", ExternalPort: 443, InternalPort: 31443, Protocol: "HTTPS", UseSSL: true},
+	}
+	externalIP, err := lbBackend.CreateLoadBalancer(ctx, "vs", "pool", []string{"10.1.0.1"}, portDetailsList)
+	assert.NoError(t, err, "Load balancer should be created")
+	assert.Equal(t, "192.168.0.10", externalIP, "First IP of the range should be used")
+	assert.Len(t, lbs.VirtualServices("default"), 2, "Every port should have a virtual service")
+	assert.Empty(t, lbs.VirtualServices("other"), "Other targets should not be changed")
+
+	externalIP, err = lbBackend.CreateLoadBalancer(ctx, "vs", "pool", []string{"10.1.0.1"}, portDetailsList)
+	assert.NoError(t, err, "Existing load balancer should be created again")
+	assert.Equal(t, "192.168.0.10", externalIP, "Existing load balancer should keep its IP")
+
+	virtualIPs, err := rdeStore.GetVirtualIPs(ctx)
+	assert.NoError(t, err, "Virtual IPs should be read")
+	assert.Equal(t, []string{"192.168.0.10"}, virtualIPs, "External IP should be recorded once in the RDE")
+
+	assert.NoError(t, lbBackend.UpdateLoadBalancer(ctx, "pool-http", "vs-http", []string{"10.1.0.2"}, 32080, 8080),
+		"Load balancer should be updated")
+	pools := lbs.Pools("default")
+	if assert.Len(t, pools, 2, "Every port should have a pool") {
+		assert.Equal(t, Pool{Name: "pool-http", Members: []string{"10.1.0.2"}, Port: 32080}, pools[0],
+			"Pool should be updated")
+	}
+	externalIP, err = lbBackend.GetLoadBalancer(ctx, "vs-http")
+	assert.NoError(t, err, "Load balancer should be read")
+	assert.Equal(t, "192.168.0.10", externalIP, "IP of the virtual service should be returned")
+
+	assert.NoError(t, lbBackend.DeleteLoadBalancer(ctx, "vs", "pool", portDetailsList),
+		"Load balancer should be deleted")
+	assert.Empty(t, lbs.Pools("default"), "Pools should be deleted")
+	externalIP, err = lbBackend.GetLoadBalancer(ctx, "vs-http")
+	assert.NoError(t, err, "Deleted load balancer should be read")
+	assert.Empty(t, externalIP, "Deleted load balancer should have no IP")
+	virtualIPs, err = rdeStore.GetVirtualIPs(ctx)
+	assert.NoError(t, err, "Virtual IPs should be read")
+	assert.Empty(t, virtualIPs, "External IP should be removed from the RDE")
+
+	_, err = lbs.LoadBalancerBackend(ctx, "unknown")
+	assert.Error(t, err, "Unknown target should not be returned")
+
+	return
+}
+
+func TestFakeCallFailures(t *testing.T) {
+	ctx := context.Background()
+	injectedErr := fmt.Errorf("injected")
+	rdeStore := NewRDEStore()
+	lbs := NewLoadBalancers(rdeStore)
+	lbs.AddTarget("default", "192.168.0.10")
+	lbBackend, err := lbs.LoadBalancerBackend(ctx, "default")
+	assert.NoError(t, err, "Target should be returned")
+	portDetailsList := []vcdclient.PortDetails{{PortSuffix: "http", ExternalPort: 80, InternalPort: 31080}}
+
+	rdeStore.FailCalls("AddVirtualIP", 1, injectedErr)
+	_, err = lbBackend.CreateLoadBalancer(ctx, "vs", "pool", nil, portDetailsList)
+	assert.Error(t, err, "Failure of the RDE should fail the creation")
+	assert.Empty(t, lbs.VirtualServices("default"), "Failed creation should change nothing")
+
+	lbs.FailCalls("GetLoadBalancer", 2, injectedErr)
+	for attempt := 1; attempt <= 2; attempt++ {
+		_, err = lbBackend.GetLoadBalancer(ctx, "vs-http")
+		assert.Equal(t, injectedErr, err, "Call [%d] should fail", attempt)
+	}
+	_, err = lbBackend.GetLoadBalancer(ctx, "vs-http")
+	assert.NoError(t, err, "Calls after the failures should succeed")
+
+	return
+}
+
+func TestFakeVMs(t *testing.T) {
+
+	type TestCase struct {
+		Find         func(vms *VMs) (*vcdclient.VM, error)
+		ExpectedName string
+		ExpectedErr  error
+		ErrorComment string
+	}
+
+	vms := NewVMs()
+	workerID := vms.AddVM("cluster", "worker-1", "10.0.0.5", "10.1.0.5")
+	vms.AddVM("cluster", "worker-2", "10.0.0.6")
+	vms.AddVM("other", "worker-2", "10.0.1.6")
+	vms.SetComputerName(workerID, "worker-1.cluster")
+	vms.SetMetadata(workerID, "node", "worker-1.cluster")
+	vms.SetVMStatus(workerID, "POWERED_OFF", true)
+
+	testCaseList := []TestCase{
+		{
+			Find: func(vms *VMs) (*vcdclient.VM, error) {
+				return vms.FindVMByName("worker-1")
+			},
+			ExpectedName: "worker-1",
+			ErrorComment: "VM should be found by name",
+		},
+		{
+			Find: func(vms *VMs) (*vcdclient.VM, error) {
+				return vms.FindVMByUUID("00000001-0000-4000-8000-000000000001")
+			},
+			ExpectedName: "worker-1",
+			ErrorComment: "VM should be found by UUID without the prefix",
+		},
+		{
+			Find: func(vms *VMs) (*vcdclient.VM, error) {
+				return vms.FindVMByComputerName("WORKER-1.cluster")
+			},
+			ExpectedName: "worker-1",
+			ErrorComment: "VM should be found by computer name regardless of case",
+		},
+		{
+			Find: func(vms *VMs) (*vcdclient.VM, error) {
+				return vms.FindVMByMetadata("node", "worker-1.cluster")
+			},
+			ExpectedName: "worker-1",
+			ErrorComment: "VM should be found by metadata",
+		},
+		{
+			Find: func(vms *VMs) (*vcdclient.VM, error) {
+				return vms.FindVMByName("worker-3")
+			},
+			ExpectedErr:  vcdclient.ErrNotFound,
+			ErrorComment: "Unknown VM should not be found",
+		},
+	}
+
+	for _, testCase := range testCaseList {
+		vm, err := testCase.Find(vms)
+		if testCase.ExpectedErr != nil {
+			assert.True(t, errors.Is(err, testCase.ExpectedErr), testCase.ErrorComment)
+			continue
+		}
+		if assert.NoError(t, err, testCase.ErrorComment) {
+			assert.Equal(t, testCase.ExpectedName, vm.Name, testCase.ErrorComment)
+			assert.Equal(t, []string{"10.0.0.5", "10.1.0.5"}, vm.IPAddresses,
+				"Found VM should have all of its IPs")
+			assert.False(t, vm.MaintenanceMode, "Found VM should not know its maintenance mode")
+		}
+	}
+
+	_, err := vms.FindVMByName("worker-2")
+	var duplicateErr *vcdclient.DuplicateVMNameError
+	assert.True(t, errors.As(err, &duplicateErr), "Name of several VMs should be reported")
+
+	vmList, err := vms.ListVMs()
+	assert.NoError(t, err, "VMs should be listed")
+	if assert.Len(t, vmList, 3, "All VMs should be listed") {
+		assert.Equal(t, []string{"10.0.0.5"}, vmList[0].IPAddresses, "Listed VM should only have its first IP")
+		assert.Equal(t, "POWERED_OFF", vmList[0].Status, "Listed VM should have its status")
+		assert.True(t, vmList[0].MaintenanceMode, "Listed VM should have its maintenance mode")
+	}
+
+	ctx := context.Background()
+	changed, err := vms.SetVMMetadata(ctx, vmList[0].HREF, "", "k8s.", map[string]string{"k8s.node": "worker-1"})
+	assert.NoError(t, err, "Metadata should be set")
+	assert.True(t, changed, "New metadata should change the VM")
+	changed, err = vms.SetVMMetadata(ctx, vmList[0].HREF, vcdclient.MetadataDomainGeneral, "k8s.",
+		map[string]string{"k8s.node": "worker-1"})
+	assert.NoError(t, err, "Metadata should be set again")
+	assert.False(t, changed, "Same metadata should not change the VM")
+	metadata, err := vms.GetVMMetadata(vmList[0].HREF)
+	assert.NoError(t, err, "Metadata should be read")
+	assert.Equal(t, map[string]string{"node": "worker-1.cluster", "k8s.node": "worker-1"}, metadata,
+		"Metadata without the prefix should be kept")
+	changed, err = vms.SetVMMetadata(ctx, vmList[0].HREF, vcdclient.MetadataDomainSystem, "k8s.",
+		map[string]string{"k8s.cluster": "cluster"})
+	assert.NoError(t, err, "System metadata should be set")
+	assert.True(t, changed, "New system metadata should change the VM")
+	assert.Equal(t, map[string]string{"k8s.cluster": "cluster"}, vms.SystemMetadata(workerID),
+		"Metadata should be set in the system domain")
+	assert.Equal(t, "worker-1", vms.Metadata(workerID)["k8s.node"],
+		"Metadata of the general domain should be kept")
+
+	vms.RemoveVM(workerID)
+	_, err = vms.FindVMByUUID(workerID)
+	assert.True(t, errors.Is(err, vcdclient.ErrNotFound), "Removed VM should not be found")
+
+	return
+}
@@ -0,0 +1,306 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package fakebackend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient"
+)
+
+// Pool is a load balancer pool
+type Pool struct {
+	Name    string
+	Members []string
+	Port    int32
+}
+
+// VirtualService is a virtual service that sends the traffic to its external IP and port to its pool
+type VirtualService struct {
+	Name      string
+	PoolName  string
+	IP        string
+	Port      int32
+	Protocol  string
+	CertAlias string
+}
+
+// lbTarget is a load balancer target, which hands out the external IPs of its range
+type lbTarget struct {
+	lbs             *LoadBalancers
+	name            string
+	ipRange         []string
+	pools           map[string]*Pool
+	virtualServices map[string]*VirtualService
+}
+
+// LoadBalancers keeps the load balancers of load balancer targets in memory. All ports of a load balancer share an
+// external IP, which is recorded in the RDE store.
+type LoadBalancers struct {
+	lock          sync.Mutex
+	rdeStore      vcdclient.RDEStore
+	targets       map[string]*lbTarget
+	defaultTarget string
+	failures      failures
+}
+
+var (
+	_ vcdclient.LoadBalancerBackends = &LoadBalancers{}
+	_ vcdclient.LoadBalancerBackend  = &lbTarget{}
+)
+
+// NewLoadBalancers returns load balancers without targets that record their external IPs in rdeStore
+func NewLoadBalancers(rdeStore vcdclient.RDEStore) *LoadBalancers {
+	return &LoadBalancers{
+		rdeStore: rdeStore,
+		targets:  make(map[string]*lbTarget),
+	}
+}
+
+// AddTarget adds a target that hands out the external IPs ipRange in order. The first target added is the default.
+func (lbs *LoadBalancers) AddTarget(name string, ipRange ...string) {
+	lbs.lock.Lock()
+	defer lbs.lock.Unlock()
+
+	if _, ok := lbs.targets[name]; ok {
+		panic(fmt.Sprintf("load balancer target [%s] already exists", name))
+	}
+	lbs.targets[name] = &lbTarget{
+		lbs:             lbs,
+		name:            name,
+		ipRange:         append([]string{}, ipRange...),
+		pools:           make(map[string]*Pool),
+		virtualServices: make(map[string]*VirtualService),
+	}
+	if lbs.defaultTarget == "" {
+		lbs.defaultTarget = name
+	}
+}
+
+// FailCalls fails the next count calls of method, such as CreateLoadBalancer, on any target with err
+func (lbs *LoadBalancers) FailCalls(method string, count int, err error) {
+	lbs.lock.Lock()
+	defer lbs.lock.Unlock()
+
+	lbs.failures.add(method, count, err)
+}
+
+// Pools returns the pools of target, sorted by name
+func (lbs *LoadBalancers) Pools(target string) []Pool {
+	lbs.lock.Lock()
+	defer lbs.lock.Unlock()
+
+	pools := make([]Pool, 0)
+	if t, ok := lbs.targets[target]; ok {
+		for _, pool := range t.pools {
+			poolCopy := *pool
+			poolCopy.Members = append([]string{}, pool.Members...)
+			pools = append(pools, poolCopy)
+		}
+	}
+	sort.Slice(pools, func(i, j int) bool {
+		return pools[i].Name < pools[j].Name
+	})
+
+	return pools
+}
+
+// VirtualServices returns the virtual services of target, sorted by name
+func (lbs *LoadBalancers) VirtualServices(target string) []VirtualService {
+	lbs.lock.Lock()
+	defer lbs.lock.Unlock()
+
+	virtualServices := make([]VirtualService, 0)
+	if t, ok := lbs.targets[target]; ok {
+		for _, virtualService := range t.virtualServices {
+			virtualServices = append(virtualServices, *virtualService)
+		}
+	}
+	sort.Slice(virtualServices, func(i, j int) bool {
+		return virtualServices[i].Name < virtualServices[j].Name
+	})
+
+	return virtualServices
+}
+
+// LBTargetNames returns the names of the targets, sorted
+func (lbs *LoadBalancers) LBTargetNames() []string {
+	lbs.lock.Lock()
+	defer lbs.lock.Unlock()
+
+	names := make([]string, 0, len(lbs.targets))
+	for name := range lbs.targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (lbs *LoadBalancers) LoadBalancerBackend(ctx context.Context, name string) (vcdclient.LoadBalancerBackend,
+	error) {
+	lbs.lock.Lock()
+	defer lbs.lock.Unlock()
+
+	if err := lbs.failures.next("LoadBalancerBackend"); err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = lbs.defaultTarget
+	}
+	t, ok := lbs.targets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown load balancer target [%s]", name)
+	}
+
+	return t, nil
+}
+
+// allocateIP returns the first IP of the range of the target that no virtual service uses
+func (t *lbTarget) allocateIP() (string, error) {
+	usedIPs := make(map[string]bool)
+	for _, virtualService := range t.virtualServices {
+		usedIPs[virtualService.IP] = true
+	}
+	for _, ip := range t.ipRange {
+		if !usedIPs[ip] {
+			return ip, nil
+		}
+	}
+
+	return "", fmt.Errorf("no unused external IP in range [%v] of load balancer target [%s]", t.ipRange, t.name)
+}
+
+// isIPUsed returns true if a virtual service uses ip
+func (t *lbTarget) isIPUsed(ip string) bool {
+	for _, virtualService := range t.virtualServices {
+		if virtualService.IP == ip {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *lbTarget) CreateLoadBalancer(ctx context.Context, virtualServiceNamePrefix string,
+	lbPoolNamePrefix string, ips []string, portDetailsList []vcdclient.PortDetails) (string, error) {
+	t.lbs.lock.Lock()
+	defer t.lbs.lock.Unlock()
+
+	if err := t.lbs.failures.next("CreateLoadBalancer"); err != nil {
+		return "", err
+	}
+	if len(portDetailsList) == 0 {
+		return "", fmt.Errorf("nothing to do since http and https ports are not specified")
+	}
+
+	// ports that already have a virtual service keep its IP
+	externalIP := ""
+	for _, portDetails := range portDetailsList {
+		name := fmt.Sprintf("%s-%s", virtualServiceNamePrefix, portDetails.PortSuffix)
+		if virtualService, ok := t.virtualServices[name]; ok {
+			externalIP = virtualService.IP
+			break
+		}
+	}
+	if externalIP == "" {
+		ip, err := t.allocateIP()
+		if err != nil {
+			return "", err
+		}
+		externalIP = ip
+	}
+	if err := t.lbs.rdeStore.AddVirtualIP(ctx, externalIP); err != nil {
+		return "", fmt.Errorf("error when adding virtual ip [%s] to RDE: [%v]", externalIP, err)
+	}
+
+	for _, portDetails := range portDetailsList {
+		lbPoolName := fmt.Sprintf("%s-%s", lbPoolNamePrefix, portDetails.PortSuffix)
+		if _, ok := t.pools[lbPoolName]; !ok {
+			t.pools[lbPoolName] = &Pool{
+				Name:    lbPoolName,
+				Members: append([]string{}, ips...),
+				Port:    portDetails.InternalPort,
+			}
+		}
+		virtualServiceName := fmt.Sprintf("%s-%s", virtualServiceNamePrefix, portDetails.PortSuffix)
+		if _, ok := t.virtualServices[virtualServiceName]; !ok {
+			t.virtualServices[virtualServiceName] = &VirtualService{
+				Name:      virtualServiceName,
+				PoolName:  lbPoolName,
+				IP:        externalIP,
+				Port:      portDetails.ExternalPort,
+				Protocol:  portDetails.Protocol,
+				CertAlias: portDetails.CertAlias,
+			}
+		}
+	}
+
+	return externalIP, nil
+}
+
+func (t *lbTarget) UpdateLoadBalancer(ctx context.Context, lbPoolName string, virtualServiceName string,
+	ips []string, internalPort int32, externalPort int32) error {
+	t.lbs.lock.Lock()
+	defer t.lbs.lock.Unlock()
+
+	if err := t.lbs.failures.next("UpdateLoadBalancer"); err != nil {
+		return err
+	}
+	pool, ok := t.pools[lbPoolName]
+	if !ok {
+		return fmt.Errorf("unable to update load balancer pool [%s]: [%w]", lbPoolName, vcdclient.ErrNotFound)
+	}
+	pool.Members = append([]string{}, ips...)
+	pool.Port = internalPort
+	if virtualService, ok := t.virtualServices[virtualServiceName]; ok {
+		virtualService.Port = externalPort
+	}
+
+	return nil
+}
+
+func (t *lbTarget) DeleteLoadBalancer(ctx context.Context, virtualServiceNamePrefix string,
+	lbPoolNamePrefix string, portDetailsList []vcdclient.PortDetails) error {
+	t.lbs.lock.Lock()
+	defer t.lbs.lock.Unlock()
+
+	if err := t.lbs.failures.next("DeleteLoadBalancer"); err != nil {
+		return err
+	}
+	for _, portDetails := range portDetailsList {
+		virtualServiceName := fmt.Sprintf("%s-%s", virtualServiceNamePrefix, portDetails.PortSuffix)
+		if virtualService, ok := t.virtualServices[virtualServiceName]; ok {
+			delete(t.virtualServices, virtualServiceName)
+			if !t.isIPUsed(virtualService.IP) {
+				if err := t.lbs.rdeStore.RemoveVirtualIP(ctx, virtualService.IP); err != nil {
+					return fmt.Errorf("error when removing vip from RDE: [%v]", err)
+				}
+			}
+		}
+		delete(t.pools, fmt.Sprintf("%s-%s", lbPoolNamePrefix, portDetails.PortSuffix))
+	}
+
+	return nil
+}
+
+func (t *lbTarget) GetLoadBalancer(ctx context.Context, virtualServiceName string) (string, error) {
+	t.lbs.lock.Lock()
+	defer t.lbs.lock.Unlock()
+
+	if err := t.lbs.failures.next("GetLoadBalancer"); err != nil {
+		return "", err
+	}
+	virtualService, ok := t.virtualServices[virtualServiceName]
+	if !ok {
+		return "", nil
+	}
+
+	return virtualService.IP, nil
+}
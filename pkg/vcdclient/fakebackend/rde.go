@@ -0,0 +1,85 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package fakebackend
+
+import (
+	"context"
+	"sync"
+
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient"
+)
+
+// RDEStore keeps the virtual IPs of a cluster RDE in memory
+type RDEStore struct {
+	lock       sync.Mutex
+	virtualIPs []string
+	failures   failures
+}
+
+var _ vcdclient.RDEStore = &RDEStore{}
+
+// NewRDEStore returns a store whose RDE has virtualIPs
+func NewRDEStore(virtualIPs ...string) *RDEStore {
+	return &RDEStore{
+		virtualIPs: append([]string{}, virtualIPs...),
+	}
+}
+
+// FailCalls fails the next count calls of method, such as AddVirtualIP, with err
+func (store *RDEStore) FailCalls(method string, count int, err error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.failures.add(method, count, err)
+}
+
+func (store *RDEStore) GetVirtualIPs(ctx context.Context) ([]string, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if err := store.failures.next("GetVirtualIPs"); err != nil {
+		return nil, err
+	}
+
+	return append([]string{}, store.virtualIPs...), nil
+}
+
+func (store *RDEStore) AddVirtualIP(ctx context.Context, ip string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if err := store.failures.next("AddVirtualIP"); err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+	for _, virtualIP := range store.virtualIPs {
+		if virtualIP == ip {
+			return nil
+		}
+	}
+	store.virtualIPs = append(store.virtualIPs, ip)
+
+	return nil
+}
+
+func (store *RDEStore) RemoveVirtualIP(ctx context.Context, ip string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if err := store.failures.next("RemoveVirtualIP"); err != nil {
+		return err
+	}
+	for idx, virtualIP := range store.virtualIPs {
+		if virtualIP == ip {
+			store.virtualIPs = append(store.virtualIPs[:idx], store.virtualIPs[idx+1:]...)
+			return nil
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,311 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package fakebackend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdclient"
+)
+
+const (
+	// vmHREFPrefix starts the hrefs of the VMs, which end in vm-<uuid> like those of VCD
+	vmHREFPrefix = "https://vcd.fake/api/vApp/vm-"
+)
+
+type fakeVM struct {
+	vm           vcdclient.VM
+	vAppName     string
+	computerName string
+	metadata     map[string]string
+	// systemMetadata holds the metadata of the SYSTEM domain
+	systemMetadata map[string]string
+}
+
+// VMs keeps the VMs of a cluster and their metadata in memory. Like VCD, found VMs have the IPs of all of their
+// network connections and listed VMs only the first, along with their maintenance mode.
+type VMs struct {
+	lock     sync.Mutex
+	vms      []*fakeVM
+	nextID   int
+	failures failures
+}
+
+var (
+	_ vcdclient.VMInventory = &VMs{}
+	_ vcdclient.VMMetadata  = &VMs{}
+)
+
+// NewVMs returns an inventory without VMs
+func NewVMs() *VMs {
+	return &VMs{}
+}
+
+// AddVM adds a powered on VM named name to vAppName, whose computer name is its name, and returns its id
+func (vms *VMs) AddVM(vAppName string, name string, ipAddresses ...string) string {
+	vms.lock.Lock()
+	defer vms.lock.Unlock()
+
+	vms.nextID++
+	uuid := fmt.Sprintf("%08x-0000-4000-8000-%012x", vms.nextID, vms.nextID)
+	vms.vms = append(vms.vms, &fakeVM{
+		vm: vcdclient.VM{
+			ID:          vcdclient.VCDVMIDPrefix + uuid,
+			HREF:        vmHREFPrefix + uuid,
+			Name:        name,
+			Status:      "POWERED_ON",
+			IPAddresses: append([]string{}, ipAddresses...),
+		},
+		vAppName:       vAppName,
+		computerName:   name,
+		metadata:       make(map[string]string),
+		systemMetadata: make(map[string]string),
+	})
+
+	return vcdclient.VCDVMIDPrefix + uuid
+}
+
+// SetVMStatus sets the status, such as POWERED_OFF, and the maintenance mode of the VM with id
+func (vms *VMs) SetVMStatus(id string, status string, maintenanceMode bool) {
+	vms.lock.Lock()
+	defer vms.lock.Unlock()
+
+	vm := vms.mustFindByID(id)
+	vm.vm.Status = status
+	vm.vm.MaintenanceMode = maintenanceMode
+}
+
+// SetComputerName sets the computer name that guest customization gives the VM with id
+func (vms *VMs) SetComputerName(id string, computerName string) {
+	vms.lock.Lock()
+	defer vms.lock.Unlock()
+
+	vms.mustFindByID(id).computerName = computerName
+}
+
+// SetMetadata sets the metadata entry key of the VM with id to value
+func (vms *VMs) SetMetadata(id string, key string, value string) {
+	vms.lock.Lock()
+	defer vms.lock.Unlock()
+
+	vms.mustFindByID(id).metadata[key] = value
+}
+
+// Metadata returns the metadata entries of the GENERAL domain of the VM with id by key
+func (vms *VMs) Metadata(id string) map[string]string {
+	vms.lock.Lock()
+	defer vms.lock.Unlock()
+
+	return copyMetadata(vms.mustFindByID(id).metadata)
+}
+
+// SystemMetadata returns the metadata entries of the SYSTEM domain of the VM with id by key
+func (vms *VMs) SystemMetadata(id string) map[string]string {
+	vms.lock.Lock()
+	defer vms.lock.Unlock()
+
+	return copyMetadata(vms.mustFindByID(id).systemMetadata)
+}
+
+func copyMetadata(metadata map[string]string) map[string]string {
+	metadataCopy := make(map[string]string)
+	for key, value := range metadata {
+		metadataCopy[key] = value
+	}
+
+	return metadataCopy
+}
+
+// RemoveVM removes the VM with id
+func (vms *VMs) RemoveVM(id string) {
+	vms.lock.Lock()
+	defer vms.lock.Unlock()
+
+	for idx, vm := range vms.vms {
+		if vm.vm.ID == id {
+			vms.vms = append(vms.vms[:idx], vms.vms[idx+1:]...)
+			return
+		}
+	}
+	panic(fmt.Sprintf("unable to remove unknown vm [%s]", id))
+}
+
+// FailCalls fails the next count calls of method, such as FindVMByName, with err
+func (vms *VMs) FailCalls(method string, count int, err error) {
+	vms.lock.Lock()
+	defer vms.lock.Unlock()
+
+	vms.failures.add(method, count, err)
+}
+
+func (vms *VMs) mustFindByID(id string) *fakeVM {
+	for _, vm := range vms.vms {
+		if vm.vm.ID == id {
+			return vm
+		}
+	}
+	panic(fmt.Sprintf("unknown vm [%s]", id))
+}
+
+// found returns a copy of the VM as it is found, without its maintenance mode
+func found(vm *fakeVM) *vcdclient.VM {
+	vmCopy := vm.vm
+	vmCopy.MaintenanceMode = false
+	vmCopy.IPAddresses = append([]string{}, vm.vm.IPAddresses...)
+
+	return &vmCopy
+}
+
+// findSingle returns the only VM that matches, with name as the name of a DuplicateVMNameError
+func (vms *VMs) findSingle(method string, name string, matches func(vm *fakeVM) bool) (*vcdclient.VM, error) {
+	vms.lock.Lock()
+	defer vms.lock.Unlock()
+
+	if err := vms.failures.next(method); err != nil {
+		return nil, err
+	}
+	var matchingVM *fakeVM = nil
+	matchingVAppNames := make([]string, 0)
+	for _, vm := range vms.vms {
+		if matches(vm) {
+			matchingVM = vm
+			matchingVAppNames = append(matchingVAppNames, vm.vAppName)
+		}
+	}
+	if len(matchingVAppNames) > 1 {
+		return nil, vcdclient.NewDuplicateVMNameError(name, matchingVAppNames)
+	}
+	if matchingVM == nil {
+		return nil, vcdclient.ErrNotFound
+	}
+
+	return found(matchingVM), nil
+}
+
+func (vms *VMs) FindVMByName(name string) (*vcdclient.VM, error) {
+	return vms.findSingle("FindVMByName", name, func(vm *fakeVM) bool {
+		return vm.vm.Name == name
+	})
+}
+
+func (vms *VMs) FindVMByUUID(uuid string) (*vcdclient.VM, error) {
+	id := vcdclient.VCDVMIDPrefix + strings.ToLower(strings.TrimPrefix(uuid, vcdclient.VCDVMIDPrefix))
+	return vms.findSingle("FindVMByUUID", uuid, func(vm *fakeVM) bool {
+		return vm.vm.ID == id
+	})
+}
+
+func (vms *VMs) FindVMByComputerName(computerName string) (*vcdclient.VM, error) {
+	return vms.findSingle("FindVMByComputerName", computerName, func(vm *fakeVM) bool {
+		return strings.EqualFold(vm.computerName, computerName)
+	})
+}
+
+func (vms *VMs) FindVMByMetadata(key string, value string) (*vcdclient.VM, error) {
+	return vms.findSingle("FindVMByMetadata", value, func(vm *fakeVM) bool {
+		metadataValue, ok := vm.metadata[key]
+		return ok && metadataValue == value
+	})
+}
+
+func (vms *VMs) ListVMs() ([]*vcdclient.VM, error) {
+	vms.lock.Lock()
+	defer vms.lock.Unlock()
+
+	if err := vms.failures.next("ListVMs"); err != nil {
+		return nil, err
+	}
+	vmList := make([]*vcdclient.VM, len(vms.vms))
+	for idx, vm := range vms.vms {
+		vmCopy := vm.vm
+		vmCopy.IPAddresses = make([]string, 0)
+		if len(vm.vm.IPAddresses) > 0 {
+			vmCopy.IPAddresses = append(vmCopy.IPAddresses, vm.vm.IPAddresses[0])
+		}
+		vmList[idx] = &vmCopy
+	}
+
+	return vmList, nil
+}
+
+func (vms *VMs) findByHREF(vmHREF string) (*fakeVM, error) {
+	for _, vm := range vms.vms {
+		if vm.vm.HREF == vmHREF {
+			return vm, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unable to get vm [%s]: [%w]", vmHREF, vcdclient.ErrNotFound)
+}
+
+func (vms *VMs) GetVMMetadata(vmHREF string) (map[string]string, error) {
+	vms.lock.Lock()
+	defer vms.lock.Unlock()
+
+	if err := vms.failures.next("GetVMMetadata"); err != nil {
+		return nil, err
+	}
+	vm, err := vms.findByHREF(vmHREF)
+	if err != nil {
+		return nil, err
+	}
+	// like VCD, the entries of both domains are returned
+	metadata := copyMetadata(vm.metadata)
+	for key, value := range vm.systemMetadata {
+		metadata[key] = value
+	}
+
+	return metadata, nil
+}
+
+func (vms *VMs) SetVMMetadata(ctx context.Context, vmHREF string, domain string, prefix string,
+	entries map[string]string) (bool, error) {
+	vms.lock.Lock()
+	defer vms.lock.Unlock()
+
+	if err := vms.failures.next("SetVMMetadata"); err != nil {
+		return false, err
+	}
+	if vmHREF == "" || prefix == "" {
+		return false, fmt.Errorf("vmHREF and prefix mandatory for SetVMMetadata")
+	}
+	for key := range entries {
+		if !strings.HasPrefix(key, prefix) {
+			return false, fmt.Errorf("metadata key [%s] does not have prefix [%s]", key, prefix)
+		}
+	}
+	vm, err := vms.findByHREF(vmHREF)
+	if err != nil {
+		return false, err
+	}
+	metadata := vm.metadata
+	switch domain {
+	case "", vcdclient.MetadataDomainGeneral:
+	case vcdclient.MetadataDomainSystem:
+		metadata = vm.systemMetadata
+	default:
+		return false, fmt.Errorf("unknown metadata domain [%s]", domain)
+	}
+
+	changed := false
+	for key, value := range entries {
+		if currentValue, ok := metadata[key]; !ok || currentValue != value {
+			metadata[key] = value
+			changed = true
+		}
+	}
+	for key := range metadata {
+		if _, ok := entries[key]; !ok && strings.HasPrefix(key, prefix) {
+			delete(metadata, key)
+			changed = true
+		}
+	}
+
+	return changed, nil
+}
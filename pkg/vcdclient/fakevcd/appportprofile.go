@@ -0,0 +1,263 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package fakevcd
+
+import (
+	"fmt"
+	"net/http"
+
+	swaggerClient "github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdswaggerclient"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+// appPortProfiles is a page of application port profiles, in the envelope that govcd pages through
+type appPortProfiles struct {
+	ResultTotal int32                      `json:"resultTotal"`
+	PageCount   int32                      `json:"pageCount"`
+	Page        int32                      `json:"page"`
+	PageSize    int32                      `json:"pageSize"`
+	Values      []types.NsxtAppPortProfile `json:"values"`
+}
+
+type fakeCertificate struct {
+	orgID string
+	item  swaggerClient.CertificateLibraryItem
+}
+
+// AddCertificate adds a certificate with alias to the certificate library of org, and returns its id
+func (server *Server) AddCertificate(org string, alias string) string {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	certificateOrg := server.findOrg(org)
+	if certificateOrg == nil {
+		panic(fmt.Sprintf("unable to add certificate [%s] to unknown org [%s]", alias, org))
+	}
+	certificate := &fakeCertificate{
+		orgID: certificateOrg.ID,
+		item: swaggerClient.CertificateLibraryItem{
+			Id:          server.newURN("certificateLibraryItem"),
+			Alias:       alias,
+			Certificate: "-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----\n",
+		},
+	}
+	server.certificates = append(server.certificates, certificate)
+
+	return certificate.item.Id
+}
+
+// AppPortProfiles returns the application port profiles of every org
+func (server *Server) AppPortProfiles() []types.NsxtAppPortProfile {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	profiles := make([]types.NsxtAppPortProfile, 0)
+	for _, profile := range server.appPortProfiles {
+		profiles = append(profiles, *profile)
+	}
+
+	return profiles
+}
+
+func (server *Server) findAppPortProfile(id string) (int, *types.NsxtAppPortProfile) {
+	for idx, profile := range server.appPortProfiles {
+		if profile.ID == id {
+			return idx, profile
+		}
+	}
+
+	return -1, nil
+}
+
+// checkAppPortProfileRef writes a bad request and returns false if ref is set but refers to no profile
+func (server *Server) checkAppPortProfileRef(w http.ResponseWriter, r *http.Request,
+	ref *swaggerClient.EntityReference) bool {
+	if ref == nil {
+		return true
+	}
+	if _, profile := server.findAppPortProfile(ref.Id); profile == nil {
+		writeError(w, r, http.StatusBadRequest, "BAD_REQUEST",
+			fmt.Sprintf("application port profile [%s] does not exist", ref.Id))
+		return false
+	}
+
+	return true
+}
+
+// checkAppPortProfile writes a bad request and returns false if profile cannot be created or changed to as it is.
+// Names are unique within the scope and context of a profile.
+func (server *Server) checkAppPortProfile(w http.ResponseWriter, r *http.Request,
+	profile *types.NsxtAppPortProfile) bool {
+	for _, other := range server.appPortProfiles {
+		if other.ID != profile.ID && other.Name == profile.Name && other.Scope == profile.Scope &&
+			other.ContextEntityId == profile.ContextEntityId {
+			writeError(w, r, http.StatusBadRequest, "DUPLICATE_NAME",
+				fmt.Sprintf("an application port profile named [%s] already exists", profile.Name))
+			return false
+		}
+	}
+
+	return true
+}
+
+// serveAppPortProfiles serves the application port profiles, which govcd rather than the swagger client manages
+func (server *Server) serveAppPortProfiles(w http.ResponseWriter, r *http.Request, segments []string) {
+	if len(segments) == 0 || segments[0] == "" {
+		switch r.Method {
+		case http.MethodGet:
+			server.listAppPortProfiles(w, r)
+		case http.MethodPost:
+			server.createAppPortProfile(w, r)
+		default:
+			writeMethodNotAllowed(w, r)
+		}
+		return
+	}
+
+	id := segments[0]
+	_, profile := server.findAppPortProfile(id)
+	if profile == nil {
+		writeNotFound(w, r, "application port profile", id)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, profile)
+	case http.MethodPut:
+		update := types.NsxtAppPortProfile{}
+		if !readJSON(w, r, &update) {
+			return
+		}
+		update.ID = id
+		if server.isBusy(id) {
+			writeBusy(w, r, id)
+			return
+		}
+		if !server.checkAppPortProfile(w, r, &update) {
+			return
+		}
+		server.startTask(w, r, "Updating application port profile", id, []string{id},
+			func() {
+				*profile = update
+			}, nil)
+	case http.MethodDelete:
+		if server.isBusy(id) {
+			writeBusy(w, r, id)
+			return
+		}
+		for _, rule := range server.natRules {
+			if rule.rule.ApplicationPortProfile != nil && rule.rule.ApplicationPortProfile.Id == id {
+				writeError(w, r, http.StatusBadRequest, "BAD_REQUEST",
+					fmt.Sprintf("application port profile [%s] is in use by NAT rule [%s]", profile.Name,
+						rule.rule.Name))
+				return
+			}
+		}
+		server.startTask(w, r, "Deleting application port profile", id, []string{id},
+			func() {
+				if idx, _ := server.findAppPortProfile(id); idx >= 0 {
+					server.appPortProfiles = append(server.appPortProfiles[:idx], server.appPortProfiles[idx+1:]...)
+				}
+			}, nil)
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
+
+func (server *Server) listAppPortProfiles(w http.ResponseWriter, r *http.Request) {
+	f, ok := server.cloudAPIFilter(w, r)
+	if !ok {
+		return
+	}
+	profiles := make([]types.NsxtAppPortProfile, 0)
+	for _, profile := range server.appPortProfiles {
+		orgID := ""
+		if profile.OrgRef != nil {
+			orgID = profile.OrgRef.ID
+		}
+		if f.matches(map[string]string{
+			"id":              profile.ID,
+			"name":            profile.Name,
+			"scope":           profile.Scope,
+			"contextEntityId": profile.ContextEntityId,
+			"orgRef.id":       orgID,
+		}) {
+			profiles = append(profiles, *profile)
+		}
+	}
+	page, pageSize := pageParams(r.URL.Query())
+	start, end := pageBounds(len(profiles), page, pageSize)
+
+	writeJSON(w, http.StatusOK, &appPortProfiles{
+		ResultTotal: int32(len(profiles)),
+		PageCount:   pageCount(len(profiles), pageSize),
+		Page:        int32(page),
+		PageSize:    int32(pageSize),
+		Values:      profiles[start:end],
+	})
+}
+
+// createAppPortProfile creates a profile, which is listed as soon as it is accepted and removed if its task fails
+func (server *Server) createAppPortProfile(w http.ResponseWriter, r *http.Request) {
+	profile := &types.NsxtAppPortProfile{}
+	if !readJSON(w, r, profile) || !server.checkAppPortProfile(w, r, profile) {
+		return
+	}
+	profile.ID = server.newURN("applicationPortProfile")
+	server.appPortProfiles = append(server.appPortProfiles, profile)
+
+	server.startTask(w, r, "Creating application port profile", profile.ID, []string{profile.ID}, nil,
+		func() {
+			if idx, _ := server.findAppPortProfile(profile.ID); idx >= 0 {
+				server.appPortProfiles = append(server.appPortProfiles[:idx], server.appPortProfiles[idx+1:]...)
+			}
+		})
+}
+
+// serveCertificates lists the certificate library of the org in the tenant context of the request, or of the org
+// that is logged in
+func (server *Server) serveCertificates(w http.ResponseWriter, r *http.Request, org string, segments []string) {
+	if len(segments) != 1 || segments[0] != "certificateLibrary" {
+		writeError(w, r, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("no resource at [%s]", r.URL.Path))
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	f, ok := server.cloudAPIFilter(w, r)
+	if !ok {
+		return
+	}
+	tenantOrgID := r.Header.Get("X-VMWARE-VCLOUD-TENANT-CONTEXT")
+	if tenantOrgID == "" && !isSysAdmin(org) {
+		if tenantOrg := server.findOrg(org); tenantOrg != nil {
+			tenantOrgID = tenantOrg.ID
+		}
+	}
+	items := make([]swaggerClient.CertificateLibraryItem, 0)
+	for _, certificate := range server.certificates {
+		if tenantOrgID != "" && certificate.orgID != tenantOrgID {
+			continue
+		}
+		if f.matches(map[string]string{
+			"id":    certificate.item.Id,
+			"alias": certificate.item.Alias,
+		}) {
+			items = append(items, certificate.item)
+		}
+	}
+	page, pageSize := pageParams(r.URL.Query())
+	start, end := pageBounds(len(items), page, pageSize)
+
+	writeJSON(w, http.StatusOK, &swaggerClient.CertificateLibraryItems{
+		ResultTotal: int32(len(items)),
+		PageCount:   pageCount(len(items), pageSize),
+		Page:        int32(page),
+		PageSize:    int32(pageSize),
+		Values:      items[start:end],
+	})
+}
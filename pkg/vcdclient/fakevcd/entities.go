@@ -0,0 +1,117 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package fakevcd
+
+import (
+	"fmt"
+	"net/http"
+
+	swaggerClient "github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdswaggerclient"
+)
+
+// fakeEntity is a defined entity whose ETag is its version
+type fakeEntity struct {
+	entity  swaggerClient.DefinedEntity
+	version int
+}
+
+func (entity *fakeEntity) etag() string {
+	return fmt.Sprintf(`"%d"`, entity.version)
+}
+
+// AddDefinedEntity adds entity, with a new id unless it has one, and returns its id
+func (server *Server) AddDefinedEntity(entity swaggerClient.DefinedEntity) string {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	if entity.Id == "" {
+		entity.Id = server.newURN("entity")
+	}
+	server.entities = append(server.entities, &fakeEntity{
+		entity:  entity,
+		version: 1,
+	})
+
+	return entity.Id
+}
+
+// DefinedEntity returns the defined entity with id, and false if there is none
+func (server *Server) DefinedEntity(id string) (swaggerClient.DefinedEntity, bool) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	entity := server.findEntity(id)
+	if entity == nil {
+		return swaggerClient.DefinedEntity{}, false
+	}
+
+	return entity.entity, true
+}
+
+// ModifyDefinedEntity changes the defined entity with id through modify, as another client would, so that updates
+// made with its previous ETag fail
+func (server *Server) ModifyDefinedEntity(id string, modify func(entity *swaggerClient.DefinedEntity)) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	entity := server.findEntity(id)
+	if entity == nil {
+		panic(fmt.Sprintf("unable to modify unknown defined entity [%s]", id))
+	}
+	modify(&entity.entity)
+	entity.version++
+}
+
+func (server *Server) findEntity(id string) *fakeEntity {
+	for _, entity := range server.entities {
+		if entity.entity.Id == id {
+			return entity
+		}
+	}
+
+	return nil
+}
+
+// serveDefinedEntities serves defined entities. An update must carry the ETag of the entity in If-Match.
+func (server *Server) serveDefinedEntities(w http.ResponseWriter, r *http.Request, segments []string) {
+	if len(segments) != 1 {
+		writeError(w, r, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("no resource at [%s]", r.URL.Path))
+		return
+	}
+	entity := server.findEntity(segments[0])
+	if entity == nil {
+		writeNotFound(w, r, "defined entity", segments[0])
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Etag", entity.etag())
+		writeJSON(w, http.StatusOK, &entity.entity)
+	case http.MethodPut:
+		if r.Header.Get("If-Match") != entity.etag() {
+			writeError(w, r, http.StatusPreconditionFailed, "PRECONDITION_FAILED",
+				fmt.Sprintf("ETag [%s] of defined entity [%s] is stale", r.Header.Get("If-Match"), entity.entity.Id))
+			return
+		}
+		update := swaggerClient.DefinedEntity{}
+		if !readJSON(w, r, &update) {
+			return
+		}
+		if update.EntityType != entity.entity.EntityType {
+			writeError(w, r, http.StatusBadRequest, "BAD_REQUEST",
+				fmt.Sprintf("entity type of defined entity [%s] cannot change", entity.entity.Id))
+			return
+		}
+		update.Id = entity.entity.Id
+		entity.entity = update
+		entity.version++
+		w.Header().Set("Etag", entity.etag())
+		writeJSON(w, http.StatusOK, &entity.entity)
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
@@ -0,0 +1,236 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package fakevcd
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// filter is a parsed FIQL filter. It matches objects by the string values of their properties; a property that an
+// object does not have compares as empty.
+type filter interface {
+	matches(properties map[string]string) bool
+}
+
+type comparison struct {
+	property string
+	value    string
+}
+
+func (c comparison) matches(properties map[string]string) bool {
+	return properties[c.property] == c.value
+}
+
+type conjunction []filter
+
+func (c conjunction) matches(properties map[string]string) bool {
+	for _, f := range c {
+		if !f.matches(properties) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type disjunction []filter
+
+func (d disjunction) matches(properties map[string]string) bool {
+	for _, f := range d {
+		if f.matches(properties) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchAll is the filter of a request without one
+type matchAll struct{}
+
+func (matchAll) matches(map[string]string) bool {
+	return true
+}
+
+// filterParser parses the FIQL subset that VCD clients use: == comparisons joined by ';' (and) and ',' (or), with
+// parentheses. As in FIQL, ';' binds tighter than ','.
+type filterParser struct {
+	expression string
+	pos        int
+	// unescape is set for the legacy API, whose filter values are query escaped within the filter
+	unescape   bool
+	properties []string
+}
+
+// parseFilter parses expression, and returns the properties that it compares along with it
+func parseFilter(expression string, unescape bool) (filter, []string, error) {
+	if expression == "" {
+		return matchAll{}, nil, nil
+	}
+	parser := &filterParser{
+		expression: expression,
+		unescape:   unescape,
+	}
+	f, err := parser.parseOr()
+	if err != nil {
+		return nil, nil, err
+	}
+	if parser.pos != len(expression) {
+		return nil, nil, fmt.Errorf("unexpected [%c] at [%d] in filter [%s]", expression[parser.pos], parser.pos,
+			expression)
+	}
+
+	return f, parser.properties, nil
+}
+
+func (parser *filterParser) parseOr() (filter, error) {
+	operands := disjunction{}
+	for {
+		operand, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+		if !parser.consume(',') {
+			break
+		}
+	}
+	if len(operands) == 1 {
+		return operands[0], nil
+	}
+
+	return operands, nil
+}
+
+func (parser *filterParser) parseAnd() (filter, error) {
+	operands := conjunction{}
+	for {
+		operand, err := parser.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+		if !parser.consume(';') {
+			break
+		}
+	}
+	if len(operands) == 1 {
+		return operands[0], nil
+	}
+
+	return operands, nil
+}
+
+func (parser *filterParser) parsePrimary() (filter, error) {
+	if parser.consume('(') {
+		f, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !parser.consume(')') {
+			return nil, fmt.Errorf("missing ')' at [%d] in filter [%s]", parser.pos, parser.expression)
+		}
+		return f, nil
+	}
+
+	rest := parser.expression[parser.pos:]
+	operator := strings.Index(rest, "==")
+	if operator <= 0 || strings.ContainsAny(rest[:operator], ";,()") {
+		return nil, fmt.Errorf("expected a comparison at [%d] in filter [%s]", parser.pos, parser.expression)
+	}
+	property := rest[:operator]
+	value := rest[operator+len("=="):]
+	if end := strings.IndexAny(value, ";,)"); end >= 0 {
+		value = value[:end]
+	}
+	parser.pos += operator + len("==") + len(value)
+	if parser.unescape {
+		unescaped, err := url.QueryUnescape(value)
+		if err != nil {
+			return nil, fmt.Errorf("unable to unescape [%s] in filter [%s]: [%v]", value, parser.expression, err)
+		}
+		value = unescaped
+	}
+	parser.properties = append(parser.properties, property)
+
+	return comparison{
+		property: property,
+		value:    value,
+	}, nil
+}
+
+func (parser *filterParser) consume(c byte) bool {
+	if parser.pos < len(parser.expression) && parser.expression[parser.pos] == c {
+		parser.pos++
+		return true
+	}
+
+	return false
+}
+
+// cloudAPIFilter returns the filter of a cloudapi request. It writes a bad request and returns false if the filter
+// cannot be parsed or compares a property that the server rejects.
+func (server *Server) cloudAPIFilter(w http.ResponseWriter, r *http.Request) (filter, bool) {
+	return server.checkFilter(w, r, r.URL.Query().Get("filter"), false)
+}
+
+func (server *Server) checkFilter(w http.ResponseWriter, r *http.Request, expression string,
+	unescape bool) (filter, bool) {
+	f, properties, err := parseFilter(expression, unescape)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return nil, false
+	}
+	for _, property := range properties {
+		if server.rejectedFilterProperties[property] {
+			writeError(w, r, http.StatusBadRequest, "BAD_REQUEST",
+				fmt.Sprintf("[%s] is not a supported filter property", property))
+			return nil, false
+		}
+	}
+
+	return f, true
+}
+
+// pageParams returns the page and page size of a request, defaulting and capping them as VCD does
+func pageParams(params url.Values) (int, int) {
+	page, err := strconv.Atoi(params.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(params.Get("pageSize"))
+	if err != nil || pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	return page, pageSize
+}
+
+// pageBounds returns the range of the items of page within total items
+func pageBounds(total int, page int, pageSize int) (int, int) {
+	start := (page - 1) * pageSize
+	if start > total {
+		start = total
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+
+	return start, end
+}
+
+// pageCount returns the number of pages of pageSize that hold total items
+func pageCount(total int, pageSize int) int32 {
+	return int32((total + pageSize - 1) / pageSize)
+}
@@ -0,0 +1,62 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package fakevcd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeFilterMatches(t *testing.T) {
+
+	type TestCase struct {
+		Filter       string
+		Unescape     bool
+		Expected     bool
+		ErrorComment string
+	}
+
+	properties := map[string]string{
+		"name":             "lb-1",
+		"virtualIpAddress": "10.0.0.2",
+		"vdc":              "https://vcd/api/vdc/1",
+	}
+	testCaseList := []TestCase{
+		{"", false, true, "Empty filter should match everything"},
+		{"name==lb-1", false, true, "Equal value should match"},
+		{"name==lb-2", false, false, "Different value should not match"},
+		{"owner==x", false, false, "Missing property should compare as empty"},
+		{"name==lb-1;virtualIpAddress==10.0.0.3", false, false, "All operands of and should match"},
+		{"virtualIpAddress==10.0.0.3,virtualIpAddress==10.0.0.2", false, true, "One operand of or should match"},
+		{"name==lb-2;virtualIpAddress==10.0.0.3,name==lb-1", false, true, "And should bind tighter than or"},
+		{"name==lb-1;(virtualIpAddress==10.0.0.3,virtualIpAddress==10.0.0.2)", false, true,
+			"Parentheses should group or within and"},
+		{"vdc==https%3A%2F%2Fvcd%2Fapi%2Fvdc%2F1;name==lb-1", true, true, "Legacy values should be unescaped"},
+	}
+
+	for _, testCase := range testCaseList {
+		f, _, err := parseFilter(testCase.Filter, testCase.Unescape)
+		assert.NoError(t, err, "Filter [%s] should parse", testCase.Filter)
+		assert.Equal(t, testCase.Expected, f.matches(properties), testCase.ErrorComment)
+	}
+
+	return
+}
+
+func TestFakeFilterErrors(t *testing.T) {
+	for _, filter := range []string{"name", "name!=lb-1", "(name==lb-1", "name==lb-1)", "name==lb-1;"} {
+		_, _, err := parseFilter(filter, false)
+		assert.Error(t, err, "Filter [%s] should not parse", filter)
+	}
+
+	_, properties, err := parseFilter("name==lb-1;(virtualIpAddress==1,gatewayRef.id==2)", false)
+	assert.NoError(t, err, "Filter should parse")
+	assert.Equal(t, []string{"name", "virtualIpAddress", "gatewayRef.id"}, properties,
+		"Compared properties should be returned")
+
+	return
+}
@@ -0,0 +1,428 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package fakevcd
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	swaggerClient "github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdswaggerclient"
+)
+
+type fakeGateway struct {
+	gateway swaggerClient.EdgeGateway
+	// staticUsedIPs are used by objects that the server does not model, such as the SNAT rules of the tenant
+	staticUsedIPs []string
+}
+
+type fakeNATRule struct {
+	gatewayID string
+	rule      swaggerClient.EdgeNatRule
+}
+
+// AddEdgeGateway adds an edge gateway named name to the VDC with vdcID, with one uplink of subnets, and returns its
+// id
+func (server *Server) AddEdgeGateway(vdcID string, name string, subnets []swaggerClient.EdgeGatewaySubnet) string {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	vdc := server.findVDC(vdcID)
+	if vdc == nil {
+		panic(fmt.Sprintf("unable to add edge gateway [%s] to unknown VDC [%s]", name, vdcID))
+	}
+	gateway := &fakeGateway{
+		gateway: swaggerClient.EdgeGateway{
+			Id:   server.newURN("gateway"),
+			Name: name,
+			EdgeGatewayUplinks: []swaggerClient.EdgeGatewayUplink{
+				{
+					UplinkId:   server.newURN("network"),
+					UplinkName: "uplink",
+					Subnets: &swaggerClient.EdgeGatewaySubnets{
+						Values: subnets,
+					},
+					Connected: true,
+				},
+			},
+			OrgVdc: &swaggerClient.EntityReference{
+				Name: vdc.vdc.Name,
+				Id:   vdc.vdc.ID,
+			},
+			OwnerRef: &swaggerClient.EntityReference{
+				Name: vdc.vdc.Name,
+				Id:   vdc.vdc.ID,
+			},
+		},
+	}
+	server.gateways = append(server.gateways, gateway)
+
+	return gateway.gateway.Id
+}
+
+// AddUsedIPs marks ips of the gateway with gatewayID as used
+func (server *Server) AddUsedIPs(gatewayID string, ips ...string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	gateway := server.findGateway(gatewayID)
+	if gateway == nil {
+		panic(fmt.Sprintf("unable to add used IPs to unknown edge gateway [%s]", gatewayID))
+	}
+	gateway.staticUsedIPs = append(gateway.staticUsedIPs, ips...)
+}
+
+// AddNetwork adds a network named name, owned by the VDC with vdcID and routed through the gateway with gatewayID,
+// and returns its id
+func (server *Server) AddNetwork(vdcID string, name string, gatewayID string) string {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	vdc := server.findVDC(vdcID)
+	gateway := server.findGateway(gatewayID)
+	if vdc == nil || gateway == nil {
+		panic(fmt.Sprintf("unable to add network [%s] to unknown VDC [%s] or gateway [%s]", name, vdcID, gatewayID))
+	}
+	backingNetworkType := swaggerClient.NSXT_FLEXIBLE_SEGMENT_BackingNetworkType
+	network := &swaggerClient.VdcNetwork{
+		Id:                 server.newURN("network"),
+		Name:               name,
+		BackingNetworkType: &backingNetworkType,
+		OrgVdc: &swaggerClient.EntityReference{
+			Name: vdc.vdc.Name,
+			Id:   vdc.vdc.ID,
+		},
+		OwnerRef: &swaggerClient.EntityReference{
+			Name: vdc.vdc.Name,
+			Id:   vdc.vdc.ID,
+		},
+		OrgVdcIsNsxTBacked: true,
+		Connection: &swaggerClient.RouterConnection{
+			RouterRef: &swaggerClient.EntityReference{
+				Name: gateway.gateway.Name,
+				Id:   gateway.gateway.Id,
+			},
+			Connected: true,
+		},
+	}
+	server.networks = append(server.networks, network)
+
+	return network.Id
+}
+
+// AddServiceEngineGroup assigns a service engine group named name, which can host maxVirtualServices, to the
+// gateway with gatewayID, and returns the id of the group
+func (server *Server) AddServiceEngineGroup(gatewayID string, name string, maxVirtualServices int32) string {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	gateway := server.findGateway(gatewayID)
+	if gateway == nil {
+		panic(fmt.Sprintf("unable to assign service engine group [%s] to unknown edge gateway [%s]", name,
+			gatewayID))
+	}
+	assignment := &swaggerClient.LoadBalancerServiceEngineGroupAssignment{
+		Id:                 server.newURN("serviceEngineGroupAssignment"),
+		MaxVirtualServices: maxVirtualServices,
+		ServiceEngineGroupRef: &swaggerClient.EntityReference{
+			Name: name,
+			Id:   server.newURN("serviceEngineGroup"),
+		},
+		GatewayRef: &swaggerClient.EntityReference{
+			Name: gateway.gateway.Name,
+			Id:   gateway.gateway.Id,
+		},
+	}
+	server.segAssignments = append(server.segAssignments, assignment)
+
+	return assignment.ServiceEngineGroupRef.Id
+}
+
+// NATRules returns the NAT rules of the gateway with gatewayID
+func (server *Server) NATRules(gatewayID string) []swaggerClient.EdgeNatRule {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	rules := make([]swaggerClient.EdgeNatRule, 0)
+	for _, rule := range server.natRules {
+		if rule.gatewayID == gatewayID {
+			rules = append(rules, rule.rule)
+		}
+	}
+
+	return rules
+}
+
+func (server *Server) findGateway(id string) *fakeGateway {
+	for _, gateway := range server.gateways {
+		if gateway.gateway.Id == id {
+			return gateway
+		}
+	}
+
+	return nil
+}
+
+func (server *Server) findNATRule(gatewayID string, id string) (int, *fakeNATRule) {
+	for idx, rule := range server.natRules {
+		if rule.gatewayID == gatewayID && rule.rule.Id == id {
+			return idx, rule
+		}
+	}
+
+	return -1, nil
+}
+
+// usedIPs returns the IPs of the gateway with gatewayID that are in use by NAT rules, virtual services or objects
+// that the server does not model
+func (server *Server) usedIPs(gatewayID string) []string {
+	ips := make([]string, 0)
+	if gateway := server.findGateway(gatewayID); gateway != nil {
+		ips = append(ips, gateway.staticUsedIPs...)
+	}
+	for _, rule := range server.natRules {
+		if rule.gatewayID == gatewayID {
+			ips = append(ips, rule.rule.ExternalAddresses)
+		}
+	}
+	for _, virtualService := range server.virtualServices {
+		if virtualService.GatewayRef.Id == gatewayID {
+			ips = append(ips, virtualService.VirtualIpAddress)
+		}
+	}
+
+	return ips
+}
+
+func (server *Server) serveNetworks(w http.ResponseWriter, r *http.Request, segments []string) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	if len(segments) == 1 && segments[0] != "" {
+		for _, network := range server.networks {
+			if network.Id == segments[0] {
+				writeJSON(w, http.StatusOK, network)
+				return
+			}
+		}
+		writeNotFound(w, r, "network", segments[0])
+		return
+	}
+
+	f, ok := server.cloudAPIFilter(w, r)
+	if !ok {
+		return
+	}
+	networks := make([]swaggerClient.VdcNetwork, 0)
+	for _, network := range server.networks {
+		if f.matches(map[string]string{
+			"id":          network.Id,
+			"name":        network.Name,
+			"orgVdc.id":   network.OrgVdc.Id,
+			"ownerRef.id": network.OwnerRef.Id,
+		}) {
+			networks = append(networks, *network)
+		}
+	}
+	page, pageSize := pageParams(r.URL.Query())
+	start, end := pageBounds(len(networks), page, pageSize)
+
+	writeJSON(w, http.StatusOK, &swaggerClient.VdcNetworks{
+		ResultTotal: int32(len(networks)),
+		PageCount:   pageCount(len(networks), pageSize),
+		Page:        int32(page),
+		PageSize:    int32(pageSize),
+		Values:      networks[start:end],
+	})
+}
+
+func (server *Server) serveEdgeGateways(w http.ResponseWriter, r *http.Request, segments []string) {
+	gateway := server.findGateway(segments[0])
+	if gateway == nil {
+		writeNotFound(w, r, "edge gateway", segments[0])
+		return
+	}
+
+	switch {
+	case len(segments) == 1:
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, r)
+			return
+		}
+		response := gateway.gateway
+		response.Status = server.statusOf(gateway.gateway.Id)
+		writeJSON(w, http.StatusOK, &response)
+	case len(segments) == 2 && segments[1] == "usedIpAddresses":
+		server.serveUsedIPs(w, r, gateway)
+	case len(segments) == 3 && segments[1] == "nat" && segments[2] == "rules":
+		server.serveNATRules(w, r, gateway)
+	case len(segments) == 4 && segments[1] == "nat" && segments[2] == "rules":
+		server.serveNATRule(w, r, gateway, segments[3])
+	case len(segments) == 3 && segments[1] == "loadBalancer" && segments[2] == "poolSummaries":
+		server.servePoolSummaries(w, r, gateway)
+	case len(segments) == 3 && segments[1] == "loadBalancer" && segments[2] == "virtualServiceSummaries":
+		server.serveVirtualServiceSummaries(w, r, gateway)
+	default:
+		writeError(w, r, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("no resource at [%s]", r.URL.Path))
+	}
+}
+
+func (server *Server) serveUsedIPs(w http.ResponseWriter, r *http.Request, gateway *fakeGateway) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	usedIPs := make([]swaggerClient.GatewayUsedIpAddress, 0)
+	for _, ip := range server.usedIPs(gateway.gateway.Id) {
+		usedIPs = append(usedIPs, swaggerClient.GatewayUsedIpAddress{
+			IpAddress: ip,
+		})
+	}
+	page, pageSize := pageParams(r.URL.Query())
+	start, end := pageBounds(len(usedIPs), page, pageSize)
+
+	writeJSON(w, http.StatusOK, &swaggerClient.GatewayUsedIpAddresses{
+		ResultTotal: int32(len(usedIPs)),
+		PageCount:   pageCount(len(usedIPs), pageSize),
+		Page:        int32(page),
+		PageSize:    int32(pageSize),
+		Values:      usedIPs[start:end],
+	})
+}
+
+// serveNATRules lists the NAT rules of gateway a cursor at a time, or creates one. VCD cannot filter NAT rules.
+func (server *Server) serveNATRules(w http.ResponseWriter, r *http.Request, gateway *fakeGateway) {
+	switch r.Method {
+	case http.MethodGet:
+		rules := make([]swaggerClient.EdgeNatRule, 0)
+		for _, rule := range server.natRules {
+			if rule.gatewayID == gateway.gateway.Id {
+				rules = append(rules, rule.rule)
+			}
+		}
+		_, pageSize := pageParams(r.URL.Query())
+		start, err := strconv.Atoi(r.URL.Query().Get("cursor"))
+		if err != nil || start < 0 {
+			start = 0
+		}
+		start, end := pageBounds(len(rules), start/pageSize+1, pageSize)
+		if end < len(rules) {
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?cursor=%d&pageSize=%d>;rel="nextPage"`, server.URL,
+				r.URL.Path, end, pageSize))
+		}
+		writeJSON(w, http.StatusOK, &swaggerClient.EdgeNatRules{
+			Status: server.statusOf(gateway.gateway.Id),
+			Values: rules[start:end],
+		})
+	case http.MethodPost:
+		rule := swaggerClient.EdgeNatRule{}
+		if !readJSON(w, r, &rule) {
+			return
+		}
+		if server.isBusy(gateway.gateway.Id) {
+			writeBusy(w, r, gateway.gateway.Id)
+			return
+		}
+		if !server.checkAppPortProfileRef(w, r, rule.ApplicationPortProfile) {
+			return
+		}
+		rule.Id = server.newUUID()
+		natRule := &fakeNATRule{
+			gatewayID: gateway.gateway.Id,
+			rule:      rule,
+		}
+		server.startTask(w, r, "Creating NAT rule", rule.Id, []string{gateway.gateway.Id},
+			func() {
+				server.natRules = append(server.natRules, natRule)
+			}, nil)
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
+
+func (server *Server) serveNATRule(w http.ResponseWriter, r *http.Request, gateway *fakeGateway, id string) {
+	_, natRule := server.findNATRule(gateway.gateway.Id, id)
+	if natRule == nil {
+		writeNotFound(w, r, "NAT rule", id)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, &natRule.rule)
+	case http.MethodPut:
+		rule := swaggerClient.EdgeNatRule{}
+		if !readJSON(w, r, &rule) {
+			return
+		}
+		if server.isBusy(gateway.gateway.Id) {
+			writeBusy(w, r, gateway.gateway.Id)
+			return
+		}
+		if !server.checkAppPortProfileRef(w, r, rule.ApplicationPortProfile) {
+			return
+		}
+		rule.Id = id
+		server.startTask(w, r, "Updating NAT rule", id, []string{gateway.gateway.Id},
+			func() {
+				natRule.rule = rule
+			}, nil)
+	case http.MethodDelete:
+		if server.isBusy(gateway.gateway.Id) {
+			writeBusy(w, r, gateway.gateway.Id)
+			return
+		}
+		server.startTask(w, r, "Deleting NAT rule", id, []string{gateway.gateway.Id},
+			func() {
+				if idx, _ := server.findNATRule(gateway.gateway.Id, id); idx >= 0 {
+					server.natRules = append(server.natRules[:idx], server.natRules[idx+1:]...)
+				}
+			}, nil)
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
+
+func (server *Server) serveServiceEngineGroupAssignments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	f, ok := server.cloudAPIFilter(w, r)
+	if !ok {
+		return
+	}
+	assignments := make([]swaggerClient.LoadBalancerServiceEngineGroupAssignment, 0)
+	for _, assignment := range server.segAssignments {
+		if !f.matches(map[string]string{
+			"gatewayRef.id":              assignment.GatewayRef.Id,
+			"serviceEngineGroupRef.id":   assignment.ServiceEngineGroupRef.Id,
+			"serviceEngineGroupRef.name": assignment.ServiceEngineGroupRef.Name,
+		}) {
+			continue
+		}
+		response := *assignment
+		response.NumDeployedVirtualServices = 0
+		for _, virtualService := range server.virtualServices {
+			if virtualService.GatewayRef.Id == assignment.GatewayRef.Id &&
+				virtualService.ServiceEngineGroupRef.Id == assignment.ServiceEngineGroupRef.Id {
+				response.NumDeployedVirtualServices++
+			}
+		}
+		assignments = append(assignments, response)
+	}
+	page, pageSize := pageParams(r.URL.Query())
+	start, end := pageBounds(len(assignments), page, pageSize)
+
+	writeJSON(w, http.StatusOK, &swaggerClient.LoadBalancerServiceEngineGroupAssignments{
+		ResultTotal: int32(len(assignments)),
+		PageCount:   pageCount(len(assignments), pageSize),
+		Page:        int32(page),
+		PageSize:    int32(pageSize),
+		Values:      assignments[start:end],
+	})
+}
@@ -0,0 +1,653 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package fakevcd
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+// defaultAPIVersions are offered unless SetAPIVersions is called. 36.1 is the first version with API tokens.
+var defaultAPIVersions = []string{"35.0", "36.0", "36.1"}
+
+// versionInfo and supportedVersions are the response of /api/versions
+type versionInfo struct {
+	Version  string `xml:"Version"`
+	LoginUrl string `xml:"LoginUrl"`
+}
+
+type supportedVersions struct {
+	XMLName      xml.Name      `xml:"SupportedVersions"`
+	VersionInfos []versionInfo `xml:"VersionInfo"`
+}
+
+const (
+	// vmStatusPoweredOn is the status of a powered on VM in types.VAppStatuses
+	vmStatusPoweredOn = 4
+
+	// metadataDomainGeneral and metadataDomainSystem are the domains of metadata entries
+	metadataDomainGeneral = "GENERAL"
+	metadataDomainSystem  = "SYSTEM"
+)
+
+type fakeVDC struct {
+	vdc     types.Vdc
+	orgName string
+}
+
+type fakeVM struct {
+	vm       types.Vm
+	vdcHREF  string
+	vAppName string
+	// ipAddress is the address of the VM on its primary network
+	ipAddress         string
+	inMaintenanceMode bool
+	// metadata holds the string metadata of the GENERAL domain of the VM, which VM queries can filter by
+	metadata map[string]string
+	// systemMetadata holds the string metadata of the SYSTEM domain of the VM
+	systemMetadata map[string]string
+}
+
+// SetAPIVersions sets the api versions that the server offers
+func (server *Server) SetAPIVersions(versions ...string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	server.apiVersions = versions
+}
+
+// AddOrg adds an org named name and returns its id
+func (server *Server) AddOrg(name string) string {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	uuid := server.newUUID()
+	org := &types.Org{
+		HREF:     fmt.Sprintf("%s/api/org/%s", server.URL, uuid),
+		Type:     "application/vnd.vmware.vcloud.org+xml",
+		ID:       fmt.Sprintf("urn:vcloud:org:%s", uuid),
+		Name:     name,
+		FullName: name,
+	}
+	server.orgs = append(server.orgs, org)
+
+	return org.ID
+}
+
+// AddUser adds a user of org that logs in with password
+func (server *Server) AddUser(org string, user string, password string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	server.users[strings.ToLower(org)+"/"+user] = password
+}
+
+// AddRefreshToken adds an API token with which a user of org logs in
+func (server *Server) AddRefreshToken(org string, refreshToken string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	server.refreshTokens[refreshToken] = org
+}
+
+// AddVDC adds a VDC named name to org and returns its id
+func (server *Server) AddVDC(org string, name string) string {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	uuid := server.newUUID()
+	vdc := &fakeVDC{
+		vdc: types.Vdc{
+			HREF: fmt.Sprintf("%s/api/vdc/%s", server.URL, uuid),
+			Type: "application/vnd.vmware.vcloud.vdc+xml",
+			ID:   fmt.Sprintf("urn:vcloud:vdc:%s", uuid),
+			Name: name,
+		},
+		orgName: org,
+	}
+	server.vdcs = append(server.vdcs, vdc)
+
+	return vdc.vdc.ID
+}
+
+// AddVM adds a powered on VM named name to the vApp vAppName of the VDC with vdcID, and returns the id of the VM.
+// The VM has ipAddress on its primary network, unless ipAddress is empty.
+func (server *Server) AddVM(vdcID string, vAppName string, name string, ipAddress string) string {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	vdc := server.findVDC(vdcID)
+	if vdc == nil {
+		panic(fmt.Sprintf("unable to add VM [%s] to unknown VDC [%s]", name, vdcID))
+	}
+	uuid := server.newUUID()
+	vm := &fakeVM{
+		vm: types.Vm{
+			HREF:   fmt.Sprintf("%s/api/vApp/vm-%s", server.URL, uuid),
+			Type:   "application/vnd.vmware.vcloud.vm+xml",
+			ID:     fmt.Sprintf("urn:vcloud:vm:%s", uuid),
+			Name:   name,
+			Status: vmStatusPoweredOn,
+			GuestCustomizationSection: &types.GuestCustomizationSection{
+				ComputerName: name,
+			},
+		},
+		vdcHREF:        vdc.vdc.HREF,
+		vAppName:       vAppName,
+		ipAddress:      ipAddress,
+		metadata:       make(map[string]string),
+		systemMetadata: make(map[string]string),
+	}
+	if ipAddress != "" {
+		vm.vm.NetworkConnectionSection = &types.NetworkConnectionSection{
+			PrimaryNetworkConnectionIndex: 0,
+			NetworkConnection: []*types.NetworkConnection{
+				{
+					Network:                 "primary",
+					NetworkConnectionIndex:  0,
+					IPAddress:               ipAddress,
+					IsConnected:             true,
+					IPAddressAllocationMode: types.IPAllocationModeManual,
+				},
+			},
+		}
+	}
+	server.vms = append(server.vms, vm)
+
+	return vm.vm.ID
+}
+
+// SetVMStatus sets the status of the VM with vmID to one of types.VAppStatuses, and its maintenance mode
+func (server *Server) SetVMStatus(vmID string, status int, inMaintenanceMode bool) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	for _, vm := range server.vms {
+		if vm.vm.ID == vmID {
+			vm.vm.Status = status
+			vm.inMaintenanceMode = inMaintenanceMode
+		}
+	}
+}
+
+// SetVMMetadata sets the string metadata key of the GENERAL domain of the VM with vmID to value
+func (server *Server) SetVMMetadata(vmID string, key string, value string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	for _, vm := range server.vms {
+		if vm.vm.ID == vmID {
+			vm.metadata[key] = value
+		}
+	}
+}
+
+// VMMetadata returns the string metadata of the VM with vmID in domain, GENERAL or SYSTEM, by key
+func (server *Server) VMMetadata(vmID string, domain string) map[string]string {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	metadata := make(map[string]string)
+	for _, vm := range server.vms {
+		if vm.vm.ID != vmID {
+			continue
+		}
+		domainMetadata := vm.metadata
+		if domain == metadataDomainSystem {
+			domainMetadata = vm.systemMetadata
+		}
+		for key, value := range domainMetadata {
+			metadata[key] = value
+		}
+	}
+
+	return metadata
+}
+
+// RemoveVM removes the VM with vmID, as if it had been deleted
+func (server *Server) RemoveVM(vmID string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	for idx, vm := range server.vms {
+		if vm.vm.ID == vmID {
+			server.vms = append(server.vms[:idx], server.vms[idx+1:]...)
+			return
+		}
+	}
+}
+
+func (server *Server) findOrg(name string) *types.Org {
+	for _, org := range server.orgs {
+		if strings.EqualFold(org.Name, name) {
+			return org
+		}
+	}
+
+	return nil
+}
+
+func (server *Server) findVDC(id string) *fakeVDC {
+	for _, vdc := range server.vdcs {
+		if vdc.vdc.ID == id {
+			return vdc
+		}
+	}
+
+	return nil
+}
+
+// canSee returns true if a user of org can see objects of objectOrg
+func canSee(org string, objectOrg string) bool {
+	return isSysAdmin(org) || strings.EqualFold(org, objectOrg)
+}
+
+func (server *Server) serveVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	versions := server.apiVersions
+	if versions == nil {
+		versions = defaultAPIVersions
+	}
+	response := &supportedVersions{}
+	for _, version := range versions {
+		response.VersionInfos = append(response.VersionInfos, versionInfo{
+			Version:  version,
+			LoginUrl: fmt.Sprintf("%s/api/sessions", server.URL),
+		})
+	}
+
+	writeXML(w, http.StatusOK, response)
+}
+
+// serveSession logs a user in with basic auth, as govcd does for a user and password
+func (server *Server) serveSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	username, password, ok := r.BasicAuth()
+	separator := strings.LastIndex(username, "@")
+	if !ok || separator < 0 {
+		writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "expected basic auth of user@org")
+		return
+	}
+	user, org := username[:separator], username[separator+1:]
+	if isSysAdmin(org) != strings.HasSuffix(r.URL.Path, "/provider") {
+		writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED",
+			fmt.Sprintf("org [%s] cannot log in at [%s]", org, r.URL.Path))
+		return
+	}
+	expectedPassword, ok := server.users[strings.ToLower(org)+"/"+user]
+	if !ok || expectedPassword != password {
+		writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", fmt.Sprintf("invalid credentials of [%s]", username))
+		return
+	}
+
+	w.Header().Set("X-VMWARE-VCLOUD-ACCESS-TOKEN", server.newToken(org))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"user": map[string]string{"name": user},
+		"org":  map[string]string{"name": org},
+	})
+}
+
+// serveOAuthToken exchanges an API token for an access token
+func (server *Server) serveOAuthToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	org := SystemOrg
+	if path := strings.TrimPrefix(r.URL.Path, "/oauth/tenant/"); path != r.URL.Path {
+		org = strings.TrimSuffix(path, "/token")
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "BAD_REQUEST", fmt.Sprintf("unable to read body: [%v]", err))
+		return
+	}
+	params, err := url.ParseQuery(string(body))
+	if err != nil || params.Get("grant_type") != "refresh_token" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+	tokenOrg, ok := server.refreshTokens[params.Get("refresh_token")]
+	if !ok || !strings.EqualFold(tokenOrg, org) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &types.ApiTokenRefresh{
+		AccessToken: server.newToken(tokenOrg),
+		TokenType:   "Bearer",
+		ExpiresIn:   int(tokenLifetime.Seconds()),
+	})
+}
+
+func (server *Server) serveLegacyAPI(w http.ResponseWriter, r *http.Request, org string) {
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/"), "/")
+	switch {
+	case len(segments) == 1 && segments[0] == "org":
+		server.serveOrgList(w, r, org)
+	case len(segments) == 2 && segments[0] == "org":
+		server.serveOrg(w, r, org, segments[1])
+	case len(segments) == 2 && segments[0] == "vdc":
+		server.serveVDC(w, r, org, segments[1])
+	case len(segments) == 1 && segments[0] == "query":
+		server.serveQuery(w, r, org)
+	case len(segments) == 2 && segments[0] == "vApp" && strings.HasPrefix(segments[1], "vm-"):
+		server.serveVM(w, r, org, strings.TrimPrefix(segments[1], "vm-"))
+	case len(segments) > 3 && segments[0] == "vApp" && strings.HasPrefix(segments[1], "vm-") &&
+		segments[2] == "metadata":
+		server.serveVMMetadata(w, r, org, strings.TrimPrefix(segments[1], "vm-"), segments[3:])
+	case len(segments) == 2 && segments[0] == "task":
+		server.serveTask(w, r, segments[1])
+	default:
+		writeError(w, r, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("no resource at [%s]", r.URL.Path))
+	}
+}
+
+func (server *Server) serveOrgList(w http.ResponseWriter, r *http.Request, org string) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	orgList := &types.OrgList{}
+	for _, candidate := range server.orgs {
+		if canSee(org, candidate.Name) {
+			orgList.Org = append(orgList.Org, &types.Org{
+				HREF: candidate.HREF,
+				Type: candidate.Type,
+				Name: candidate.Name,
+			})
+		}
+	}
+
+	writeXML(w, http.StatusOK, orgList)
+}
+
+func (server *Server) serveOrg(w http.ResponseWriter, r *http.Request, org string, uuid string) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	for _, candidate := range server.orgs {
+		if uuidOf(candidate.ID) == uuid && canSee(org, candidate.Name) {
+			writeXML(w, http.StatusOK, candidate)
+			return
+		}
+	}
+
+	writeError(w, r, http.StatusForbidden, "ACCESS_TO_RESOURCE_IS_FORBIDDEN", fmt.Sprintf("no access to org [%s]", uuid))
+}
+
+func (server *Server) serveVDC(w http.ResponseWriter, r *http.Request, org string, uuid string) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	for _, vdc := range server.vdcs {
+		if uuidOf(vdc.vdc.ID) == uuid && canSee(org, vdc.orgName) {
+			writeXML(w, http.StatusOK, &vdc.vdc)
+			return
+		}
+	}
+
+	writeError(w, r, http.StatusForbidden, "ACCESS_TO_RESOURCE_IS_FORBIDDEN", fmt.Sprintf("no access to vdc [%s]", uuid))
+}
+
+// findVM returns the VM with uuid if a user of org can see it
+func (server *Server) findVM(org string, uuid string) *fakeVM {
+	for _, vm := range server.vms {
+		if uuidOf(vm.vm.ID) == uuid && canSee(org, server.orgOfVDC(vm.vdcHREF)) {
+			return vm
+		}
+	}
+
+	return nil
+}
+
+// writeVMForbidden writes the error with which VCD forbids access to a VM that does not exist, rather than
+// reporting it as not found
+func writeVMForbidden(w http.ResponseWriter, r *http.Request, uuid string) {
+	writeError(w, r, http.StatusForbidden, "ACCESS_TO_RESOURCE_IS_FORBIDDEN", fmt.Sprintf("Either you need some "+
+		"or all of the following rights [Base] to perform operations [VAPP_VM_VIEW] for vm-%s or the target "+
+		"entity is invalid.", uuid))
+}
+
+// serveVM serves a VM
+func (server *Server) serveVM(w http.ResponseWriter, r *http.Request, org string, uuid string) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	vm := server.findVM(org, uuid)
+	if vm == nil {
+		writeVMForbidden(w, r, uuid)
+		return
+	}
+
+	writeXML(w, http.StatusOK, &vm.vm)
+}
+
+// serveVMMetadata serves the metadata of a VM. The entries of both domains are read from metadata/, and an entry
+// is set or deleted at metadata/<key>, or at metadata/SYSTEM/<key> in the SYSTEM domain, with a task. Like VCD,
+// only system administrators can change the SYSTEM domain.
+func (server *Server) serveVMMetadata(w http.ResponseWriter, r *http.Request, org string, uuid string,
+	segments []string) {
+	vm := server.findVM(org, uuid)
+	if vm == nil {
+		writeVMForbidden(w, r, uuid)
+		return
+	}
+
+	if len(segments) == 1 && segments[0] == "" {
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, r)
+			return
+		}
+		metadata := &types.Metadata{
+			Xmlns: types.XMLNamespaceVCloud,
+			HREF:  vm.vm.HREF + "/metadata",
+		}
+		for _, domain := range []string{metadataDomainGeneral, metadataDomainSystem} {
+			domainMetadata := vm.metadata
+			if domain == metadataDomainSystem {
+				domainMetadata = vm.systemMetadata
+			}
+			keys := make([]string, 0, len(domainMetadata))
+			for key := range domainMetadata {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				entry := &types.MetadataEntry{
+					Key: key,
+					TypedValue: &types.TypedValue{
+						XsiType: "MetadataStringValue",
+						Value:   domainMetadata[key],
+					},
+				}
+				if domain == metadataDomainSystem {
+					entry.Domain = metadataDomainSystem
+				}
+				metadata.MetadataEntry = append(metadata.MetadataEntry, entry)
+			}
+		}
+		writeXML(w, http.StatusOK, metadata)
+		return
+	}
+
+	domainMetadata, key := vm.metadata, segments[0]
+	switch {
+	case len(segments) == 2 && segments[0] == metadataDomainSystem:
+		if !isSysAdmin(org) {
+			writeError(w, r, http.StatusForbidden, "ACCESS_TO_RESOURCE_IS_FORBIDDEN",
+				fmt.Sprintf("only system administrators can change the system metadata of vm [%s]", uuid))
+			return
+		}
+		domainMetadata, key = vm.systemMetadata, segments[1]
+	case len(segments) != 1 || key == "":
+		writeError(w, r, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("no resource at [%s]", r.URL.Path))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "BAD_REQUEST", fmt.Sprintf("unable to read body: [%v]", err))
+			return
+		}
+		value := &types.MetadataValue{}
+		if err = xml.Unmarshal(body, value); err != nil || value.TypedValue == nil {
+			writeError(w, r, http.StatusBadRequest, "BAD_REQUEST",
+				fmt.Sprintf("expected a metadata value: [%v]", err))
+			return
+		}
+		server.startTask(w, r, "metadataUpdate", vm.vm.ID, []string{vm.vm.ID}, func() {
+			domainMetadata[key] = value.TypedValue.Value
+		}, nil)
+	case http.MethodDelete:
+		if _, ok := domainMetadata[key]; !ok {
+			writeError(w, r, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("vm [%s] has no metadata [%s]", uuid, key))
+			return
+		}
+		server.startTask(w, r, "metadataDelete", vm.vm.ID, []string{vm.vm.ID}, func() {
+			delete(domainMetadata, key)
+		}, nil)
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
+
+func (server *Server) orgOfVDC(vdcHREF string) string {
+	for _, vdc := range server.vdcs {
+		if vdc.vdc.HREF == vdcHREF {
+			return vdc.orgName
+		}
+	}
+
+	return ""
+}
+
+// rawQueryParams splits the query of a legacy API request. The filter of the legacy API is not escaped as a whole
+// but value by value, so that it contains ';', which url.ParseQuery rejects.
+func rawQueryParams(r *http.Request) map[string]string {
+	params := make(map[string]string)
+	for _, param := range strings.Split(r.URL.RawQuery, "&") {
+		nameValue := strings.SplitN(param, "=", 2)
+		if len(nameValue) != 2 {
+			continue
+		}
+		params[nameValue[0]] = nameValue[1]
+	}
+
+	return params
+}
+
+// serveQuery serves the typed queries of VDCs and VMs
+func (server *Server) serveQuery(w http.ResponseWriter, r *http.Request, org string) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	params := rawQueryParams(r)
+	expression := params["filter"]
+	unescape := params["filterEncoded"] == "true"
+	if !unescape {
+		var err error
+		if expression, err = url.QueryUnescape(expression); err != nil {
+			writeError(w, r, http.StatusBadRequest, "BAD_REQUEST", fmt.Sprintf("unable to unescape filter: [%v]", err))
+			return
+		}
+	}
+	f, ok := server.checkFilter(w, r, expression, unescape)
+	if !ok {
+		return
+	}
+	page, pageSize := pageParams(url.Values{"page": {params["page"]}, "pageSize": {params["pageSize"]}})
+
+	result := &types.QueryResultRecordsType{
+		Page:     page,
+		PageSize: pageSize,
+	}
+	switch queryType := params["type"]; queryType {
+	case "orgVdc", "adminOrgVdc":
+		records := make([]*types.QueryResultOrgVdcRecordType, 0)
+		for _, vdc := range server.vdcs {
+			orgOfVDC := server.findOrg(vdc.orgName)
+			if !canSee(org, vdc.orgName) || orgOfVDC == nil {
+				continue
+			}
+			if f.matches(map[string]string{"name": vdc.vdc.Name, "orgName": vdc.orgName, "org": orgOfVDC.HREF}) {
+				records = append(records, &types.QueryResultOrgVdcRecordType{
+					HREF:    vdc.vdc.HREF,
+					Name:    vdc.vdc.Name,
+					OrgName: vdc.orgName,
+				})
+			}
+		}
+		start, end := pageBounds(len(records), page, pageSize)
+		result.Total = float64(len(records))
+		if queryType == "orgVdc" {
+			result.OrgVdcRecord = records[start:end]
+		} else {
+			result.OrgVdcAdminRecord = records[start:end]
+		}
+	case "vm", "adminVM":
+		records := make([]*types.QueryResultVMRecordType, 0)
+		for _, vm := range server.vms {
+			if !canSee(org, server.orgOfVDC(vm.vdcHREF)) {
+				continue
+			}
+			record := &types.QueryResultVMRecordType{
+				HREF:            vm.vm.HREF,
+				ID:              vm.vm.ID,
+				Name:            vm.vm.Name,
+				ContainerName:   vm.vAppName,
+				VdcHREF:         vm.vdcHREF,
+				Status:          types.VAppStatuses[vm.vm.Status],
+				IpAddress:       vm.ipAddress,
+				MaintenanceMode: vm.inMaintenanceMode,
+			}
+			properties := map[string]string{
+				"name":           record.Name,
+				"containerName":  record.ContainerName,
+				"vdc":            record.VdcHREF,
+				"status":         record.Status,
+				"isVAppTemplate": "false",
+			}
+			for key, value := range vm.metadata {
+				properties["metadata:"+key] = "STRING:" + value
+			}
+			if f.matches(properties) {
+				records = append(records, record)
+			}
+		}
+		start, end := pageBounds(len(records), page, pageSize)
+		result.Total = float64(len(records))
+		if queryType == "vm" {
+			result.VMRecord = records[start:end]
+		} else {
+			result.AdminVMRecord = records[start:end]
+		}
+	default:
+		writeError(w, r, http.StatusBadRequest, "BAD_REQUEST", fmt.Sprintf("unsupported query type [%s]", queryType))
+		return
+	}
+
+	writeXML(w, http.StatusOK, result)
+}
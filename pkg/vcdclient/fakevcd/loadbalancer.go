@@ -0,0 +1,402 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package fakevcd
+
+import (
+	"fmt"
+	"net/http"
+
+	swaggerClient "github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdswaggerclient"
+)
+
+// LoadBalancerPools returns the load balancer pools of the gateway with gatewayID
+func (server *Server) LoadBalancerPools(gatewayID string) []swaggerClient.EdgeLoadBalancerPool {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	pools := make([]swaggerClient.EdgeLoadBalancerPool, 0)
+	for _, pool := range server.pools {
+		if pool.GatewayRef.Id == gatewayID {
+			pools = append(pools, *pool)
+		}
+	}
+
+	return pools
+}
+
+// VirtualServices returns the virtual services of the gateway with gatewayID
+func (server *Server) VirtualServices(gatewayID string) []swaggerClient.EdgeLoadBalancerVirtualService {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	virtualServices := make([]swaggerClient.EdgeLoadBalancerVirtualService, 0)
+	for _, virtualService := range server.virtualServices {
+		if virtualService.GatewayRef.Id == gatewayID {
+			virtualServices = append(virtualServices, *virtualService)
+		}
+	}
+
+	return virtualServices
+}
+
+func (server *Server) findPool(id string) (int, *swaggerClient.EdgeLoadBalancerPool) {
+	for idx, pool := range server.pools {
+		if pool.Id == id {
+			return idx, pool
+		}
+	}
+
+	return -1, nil
+}
+
+func (server *Server) findVirtualService(id string) (int, *swaggerClient.EdgeLoadBalancerVirtualService) {
+	for idx, virtualService := range server.virtualServices {
+		if virtualService.Id == id {
+			return idx, virtualService
+		}
+	}
+
+	return -1, nil
+}
+
+func (server *Server) serveLoadBalancer(w http.ResponseWriter, r *http.Request, segments []string) {
+	switch {
+	case len(segments) == 1 && segments[0] == "pools":
+		server.servePools(w, r)
+	case len(segments) == 2 && segments[0] == "pools":
+		server.servePool(w, r, segments[1])
+	case len(segments) == 1 && segments[0] == "virtualServices":
+		server.serveVirtualServices(w, r)
+	case len(segments) == 2 && segments[0] == "virtualServices":
+		server.serveVirtualService(w, r, segments[1])
+	case len(segments) == 2 && segments[0] == "serviceEngineGroups" && segments[1] == "assignments":
+		server.serveServiceEngineGroupAssignments(w, r)
+	default:
+		writeError(w, r, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("no resource at [%s]", r.URL.Path))
+	}
+}
+
+// checkPool writes a bad request and returns false if pool cannot be created or changed to as it is
+func (server *Server) checkPool(w http.ResponseWriter, r *http.Request, pool *swaggerClient.EdgeLoadBalancerPool) bool {
+	if pool.GatewayRef == nil || server.findGateway(pool.GatewayRef.Id) == nil {
+		writeError(w, r, http.StatusBadRequest, "BAD_REQUEST", fmt.Sprintf("pool [%s] has no valid gateway", pool.Name))
+		return false
+	}
+	for _, other := range server.pools {
+		if other.Id != pool.Id && other.Name == pool.Name && other.GatewayRef.Id == pool.GatewayRef.Id {
+			writeError(w, r, http.StatusBadRequest, "DUPLICATE_NAME",
+				fmt.Sprintf("a pool named [%s] already exists", pool.Name))
+			return false
+		}
+	}
+
+	return true
+}
+
+// servePools creates a pool. The pool is listed as CONFIGURING until its task completes.
+func (server *Server) servePools(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	pool := &swaggerClient.EdgeLoadBalancerPool{}
+	if !readJSON(w, r, pool) || !server.checkPool(w, r, pool) {
+		return
+	}
+	pool.Id = server.newURN("loadBalancerPool")
+	pool.MemberCount = int32(len(pool.Members))
+	server.pools = append(server.pools, pool)
+
+	server.startTask(w, r, "Creating load balancer pool", pool.Id, []string{pool.Id}, nil,
+		func() {
+			if idx, _ := server.findPool(pool.Id); idx >= 0 {
+				server.pools = append(server.pools[:idx], server.pools[idx+1:]...)
+			}
+		})
+}
+
+func (server *Server) servePool(w http.ResponseWriter, r *http.Request, id string) {
+	_, pool := server.findPool(id)
+	if pool == nil {
+		writeNotFound(w, r, "load balancer pool", id)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		response := *pool
+		response.Status = server.statusOf(id)
+		response.VirtualServiceRefs = server.virtualServiceRefsOf(id)
+		writeJSON(w, http.StatusOK, &response)
+	case http.MethodPut:
+		update := swaggerClient.EdgeLoadBalancerPool{}
+		if !readJSON(w, r, &update) {
+			return
+		}
+		update.Id = id
+		if server.isBusy(id) {
+			writeBusy(w, r, id)
+			return
+		}
+		if !server.checkPool(w, r, &update) {
+			return
+		}
+		update.Status = nil
+		update.MemberCount = int32(len(update.Members))
+		server.startTask(w, r, "Updating load balancer pool", id, []string{id},
+			func() {
+				*pool = update
+			}, nil)
+	case http.MethodDelete:
+		if server.isBusy(id) {
+			writeBusy(w, r, id)
+			return
+		}
+		if refs := server.virtualServiceRefsOf(id); len(refs) > 0 {
+			writeError(w, r, http.StatusBadRequest, "BAD_REQUEST",
+				fmt.Sprintf("pool [%s] is in use by virtual service [%s]", pool.Name, refs[0].Name))
+			return
+		}
+		server.startTask(w, r, "Deleting load balancer pool", id, []string{id},
+			func() {
+				if idx, _ := server.findPool(id); idx >= 0 {
+					server.pools = append(server.pools[:idx], server.pools[idx+1:]...)
+				}
+			}, nil)
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
+
+func (server *Server) virtualServiceRefsOf(poolID string) []swaggerClient.EntityReference {
+	refs := make([]swaggerClient.EntityReference, 0)
+	for _, virtualService := range server.virtualServices {
+		if virtualService.LoadBalancerPoolRef.Id == poolID {
+			refs = append(refs, swaggerClient.EntityReference{
+				Name: virtualService.Name,
+				Id:   virtualService.Id,
+			})
+		}
+	}
+
+	return refs
+}
+
+func (server *Server) servePoolSummaries(w http.ResponseWriter, r *http.Request, gateway *fakeGateway) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	f, ok := server.cloudAPIFilter(w, r)
+	if !ok {
+		return
+	}
+	summaries := make([]swaggerClient.EdgeLoadBalancerPoolSummary, 0)
+	for _, pool := range server.pools {
+		if pool.GatewayRef.Id != gateway.gateway.Id || !f.matches(map[string]string{
+			"id":   pool.Id,
+			"name": pool.Name,
+		}) {
+			continue
+		}
+		summaries = append(summaries, swaggerClient.EdgeLoadBalancerPoolSummary{
+			Status:             server.statusOf(pool.Id),
+			Id:                 pool.Id,
+			Name:               pool.Name,
+			Enabled:            pool.Enabled,
+			MemberCount:        pool.MemberCount,
+			VirtualServiceRefs: server.virtualServiceRefsOf(pool.Id),
+		})
+	}
+	page, pageSize := pageParams(r.URL.Query())
+	start, end := pageBounds(len(summaries), page, pageSize)
+
+	writeJSON(w, http.StatusOK, &swaggerClient.EdgeLoadBalancerPoolSummaries{
+		ResultTotal: int32(len(summaries)),
+		PageCount:   pageCount(len(summaries), pageSize),
+		Page:        int32(page),
+		PageSize:    int32(pageSize),
+		Values:      summaries[start:end],
+	})
+}
+
+// checkVirtualService writes a bad request and returns false if virtualService cannot be created or changed to as
+// it is
+func (server *Server) checkVirtualService(w http.ResponseWriter, r *http.Request,
+	virtualService *swaggerClient.EdgeLoadBalancerVirtualService) bool {
+	if virtualService.GatewayRef == nil || server.findGateway(virtualService.GatewayRef.Id) == nil {
+		writeError(w, r, http.StatusBadRequest, "BAD_REQUEST",
+			fmt.Sprintf("virtual service [%s] has no valid gateway", virtualService.Name))
+		return false
+	}
+	if virtualService.LoadBalancerPoolRef == nil {
+		writeError(w, r, http.StatusBadRequest, "BAD_REQUEST",
+			fmt.Sprintf("virtual service [%s] has no pool", virtualService.Name))
+		return false
+	}
+	if _, pool := server.findPool(virtualService.LoadBalancerPoolRef.Id); pool == nil {
+		writeError(w, r, http.StatusBadRequest, "BAD_REQUEST",
+			fmt.Sprintf("pool [%s] of virtual service [%s] does not exist", virtualService.LoadBalancerPoolRef.Id,
+				virtualService.Name))
+		return false
+	}
+	if virtualService.ServiceEngineGroupRef == nil {
+		writeError(w, r, http.StatusBadRequest, "BAD_REQUEST",
+			fmt.Sprintf("virtual service [%s] has no service engine group", virtualService.Name))
+		return false
+	}
+	for _, other := range server.virtualServices {
+		if other.Id != virtualService.Id && other.Name == virtualService.Name &&
+			other.GatewayRef.Id == virtualService.GatewayRef.Id {
+			writeError(w, r, http.StatusBadRequest, "DUPLICATE_NAME",
+				fmt.Sprintf("a virtual service named [%s] already exists", virtualService.Name))
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasCapacity returns true if the service engine group of virtualService can host another virtual service
+func (server *Server) hasCapacity(virtualService *swaggerClient.EdgeLoadBalancerVirtualService) bool {
+	for _, assignment := range server.segAssignments {
+		if assignment.GatewayRef.Id != virtualService.GatewayRef.Id ||
+			assignment.ServiceEngineGroupRef.Id != virtualService.ServiceEngineGroupRef.Id {
+			continue
+		}
+		deployed := int32(0)
+		for _, other := range server.virtualServices {
+			if other.GatewayRef.Id == assignment.GatewayRef.Id &&
+				other.ServiceEngineGroupRef.Id == assignment.ServiceEngineGroupRef.Id {
+				deployed++
+			}
+		}
+		return deployed < assignment.MaxVirtualServices
+	}
+
+	return false
+}
+
+// serveVirtualServices creates a virtual service. The virtual service is listed as CONFIGURING until its task
+// completes, after which it is healthy.
+func (server *Server) serveVirtualServices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	virtualService := &swaggerClient.EdgeLoadBalancerVirtualService{}
+	if !readJSON(w, r, virtualService) || !server.checkVirtualService(w, r, virtualService) {
+		return
+	}
+	if !server.hasCapacity(virtualService) {
+		writeError(w, r, http.StatusBadRequest, "BAD_REQUEST",
+			fmt.Sprintf("service engine group [%s] cannot host another virtual service",
+				virtualService.ServiceEngineGroupRef.Id))
+		return
+	}
+	virtualService.Id = server.newURN("loadBalancerVirtualService")
+	virtualService.HealthStatus = "UP"
+	server.virtualServices = append(server.virtualServices, virtualService)
+
+	server.startTask(w, r, "Creating load balancer virtual service", virtualService.Id,
+		[]string{virtualService.Id}, nil,
+		func() {
+			if idx, _ := server.findVirtualService(virtualService.Id); idx >= 0 {
+				server.virtualServices = append(server.virtualServices[:idx], server.virtualServices[idx+1:]...)
+			}
+		})
+}
+
+func (server *Server) serveVirtualService(w http.ResponseWriter, r *http.Request, id string) {
+	_, virtualService := server.findVirtualService(id)
+	if virtualService == nil {
+		writeNotFound(w, r, "load balancer virtual service", id)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		response := *virtualService
+		response.Status = server.statusOf(id)
+		writeJSON(w, http.StatusOK, &response)
+	case http.MethodPut:
+		update := swaggerClient.EdgeLoadBalancerVirtualService{}
+		if !readJSON(w, r, &update) {
+			return
+		}
+		update.Id = id
+		if server.isBusy(id) {
+			writeBusy(w, r, id)
+			return
+		}
+		if !server.checkVirtualService(w, r, &update) {
+			return
+		}
+		update.Status = nil
+		update.HealthStatus = "UP"
+		server.startTask(w, r, "Updating load balancer virtual service", id, []string{id},
+			func() {
+				*virtualService = update
+			}, nil)
+	case http.MethodDelete:
+		if server.isBusy(id) {
+			writeBusy(w, r, id)
+			return
+		}
+		server.startTask(w, r, "Deleting load balancer virtual service", id, []string{id},
+			func() {
+				if idx, _ := server.findVirtualService(id); idx >= 0 {
+					server.virtualServices = append(server.virtualServices[:idx], server.virtualServices[idx+1:]...)
+				}
+			}, nil)
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
+
+func (server *Server) serveVirtualServiceSummaries(w http.ResponseWriter, r *http.Request, gateway *fakeGateway) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	f, ok := server.cloudAPIFilter(w, r)
+	if !ok {
+		return
+	}
+	summaries := make([]swaggerClient.EdgeLoadBalancerVirtualServiceSummary, 0)
+	for _, virtualService := range server.virtualServices {
+		if virtualService.GatewayRef.Id != gateway.gateway.Id || !f.matches(map[string]string{
+			"id":               virtualService.Id,
+			"name":             virtualService.Name,
+			"virtualIpAddress": virtualService.VirtualIpAddress,
+		}) {
+			continue
+		}
+		summaries = append(summaries, swaggerClient.EdgeLoadBalancerVirtualServiceSummary{
+			Status:                server.statusOf(virtualService.Id),
+			Id:                    virtualService.Id,
+			Name:                  virtualService.Name,
+			Enabled:               virtualService.Enabled,
+			VirtualIpAddress:      virtualService.VirtualIpAddress,
+			LoadBalancerPoolRef:   virtualService.LoadBalancerPoolRef,
+			GatewayRef:            virtualService.GatewayRef,
+			ServiceEngineGroupRef: virtualService.ServiceEngineGroupRef,
+			CertificateRef:        virtualService.CertificateRef,
+			ServicePorts:          virtualService.ServicePorts,
+			HealthStatus:          virtualService.HealthStatus,
+		})
+	}
+	page, pageSize := pageParams(r.URL.Query())
+	start, end := pageBounds(len(summaries), page, pageSize)
+
+	writeJSON(w, http.StatusOK, &swaggerClient.EdgeLoadBalancerVirtualServiceSummaries{
+		ResultTotal: int32(len(summaries)),
+		PageCount:   pageCount(len(summaries), pageSize),
+		Page:        int32(page),
+		PageSize:    int32(pageSize),
+		Values:      summaries[start:end],
+	})
+}
@@ -0,0 +1,355 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package fakevcd is an in-process fake of the VCD endpoints that the cloud provider uses. It keeps the state of one
+// or more orgs in memory so that the vcdclient can be exercised end to end, without a VCD, in unit tests.
+//
+// Mutations return a task like VCD does. The task completes after the configured delay, and the object that it
+// changes reports CONFIGURING until then. Requests and tasks can be made to fail to exercise the error paths.
+package fakevcd
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	swaggerClient "github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdswaggerclient"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+const (
+	// SystemOrg is the org of the provider. Its users see the objects of every org.
+	SystemOrg = "System"
+
+	// defaultPageSize and maxPageSize are the page sizes that VCD uses when none or a larger one is requested
+	defaultPageSize = 25
+	maxPageSize     = 128
+
+	tokenLifetime = time.Hour
+)
+
+// requestFailure fails the next count requests that match method and pathPrefix
+type requestFailure struct {
+	method         string
+	pathPrefix     string
+	count          int
+	statusCode     int
+	minorErrorCode string
+}
+
+// taskFailure fails the tasks of the next count requests that match method and pathPrefix
+type taskFailure struct {
+	method     string
+	pathPrefix string
+	count      int
+	message    string
+}
+
+// Server is a fake VCD that serves over HTTP on a local port. All of its methods are safe for concurrent use.
+type Server struct {
+	// URL is the base URL of the server, to be used as the VCD host
+	URL string
+
+	server *httptest.Server
+
+	lock   sync.Mutex
+	nextID int
+
+	users         map[string]string // "org/user" to password
+	refreshTokens map[string]string // refresh token to org
+	tokens        map[string]string // access token to org
+
+	orgs            []*types.Org
+	vdcs            []*fakeVDC
+	networks        []*swaggerClient.VdcNetwork
+	gateways        []*fakeGateway
+	segAssignments  []*swaggerClient.LoadBalancerServiceEngineGroupAssignment
+	natRules        []*fakeNATRule
+	pools           []*swaggerClient.EdgeLoadBalancerPool
+	virtualServices []*swaggerClient.EdgeLoadBalancerVirtualService
+	appPortProfiles []*types.NsxtAppPortProfile
+	certificates    []*fakeCertificate
+	entities        []*fakeEntity
+	vms             []*fakeVM
+	tasks           []*fakeTask
+
+	apiVersions              []string
+	taskDelay                time.Duration
+	requestFailures          []*requestFailure
+	taskFailures             []*taskFailure
+	rejectedFilterProperties map[string]bool
+	requests                 []string
+}
+
+// NewServer starts a fake VCD with no orgs. Close must be called to stop it.
+func NewServer() *Server {
+	server := &Server{
+		users:                    make(map[string]string),
+		refreshTokens:            make(map[string]string),
+		tokens:                   make(map[string]string),
+		rejectedFilterProperties: make(map[string]bool),
+	}
+	server.server = httptest.NewServer(server)
+	server.URL = server.server.URL
+
+	return server
+}
+
+// Close stops the server
+func (server *Server) Close() {
+	server.server.Close()
+}
+
+// SetTaskDelay makes the tasks of later requests complete after delay rather than immediately
+func (server *Server) SetTaskDelay(delay time.Duration) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	server.taskDelay = delay
+}
+
+// FailRequests fails the next count requests whose method is method and whose path starts with pathPrefix, with
+// statusCode and a VCD error that has minorErrorCode. The failed requests change nothing.
+func (server *Server) FailRequests(method string, pathPrefix string, count int, statusCode int,
+	minorErrorCode string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	server.requestFailures = append(server.requestFailures, &requestFailure{
+		method:         method,
+		pathPrefix:     pathPrefix,
+		count:          count,
+		statusCode:     statusCode,
+		minorErrorCode: minorErrorCode,
+	})
+}
+
+// FailTasks makes the tasks of the next count requests whose method is method and whose path starts with
+// pathPrefix end in error with message. The change of a failed task is rolled back.
+func (server *Server) FailTasks(method string, pathPrefix string, count int, message string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	server.taskFailures = append(server.taskFailures, &taskFailure{
+		method:     method,
+		pathPrefix: pathPrefix,
+		count:      count,
+		message:    message,
+	})
+}
+
+// RejectFilterProperties makes the server reject filters on properties with a bad request, as older VCDs do for
+// properties that they cannot filter by
+func (server *Server) RejectFilterProperties(properties ...string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	for _, property := range properties {
+		server.rejectedFilterProperties[property] = true
+	}
+}
+
+// ExpireTokens invalidates every access token that has been handed out, so that clients have to log in again
+func (server *Server) ExpireTokens() {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	server.tokens = make(map[string]string)
+}
+
+// Requests returns the number of requests so far whose method is method and whose path starts with pathPrefix. An
+// empty method matches every method.
+func (server *Server) Requests(method string, pathPrefix string) int {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	count := 0
+	for _, request := range server.requests {
+		requestMethod, path := splitRequest(request)
+		if (method == "" || requestMethod == method) && strings.HasPrefix(path, pathPrefix) {
+			count++
+		}
+	}
+
+	return count
+}
+
+func splitRequest(request string) (string, string) {
+	parts := strings.SplitN(request, " ", 2)
+	return parts[0], parts[1]
+}
+
+// newUUID returns a new UUID. UUIDs are sequential so that failures are reproducible.
+func (server *Server) newUUID() string {
+	server.nextID++
+	return fmt.Sprintf("%08x-0000-4000-8000-%012x", server.nextID, server.nextID)
+}
+
+// newURN returns a new VCD id of kind, such as urn:vcloud:gateway:<uuid>
+func (server *Server) newURN(kind string) string {
+	return fmt.Sprintf("urn:vcloud:%s:%s", kind, server.newUUID())
+}
+
+// uuidOf returns the UUID at the end of a VCD id
+func uuidOf(id string) string {
+	return id[strings.LastIndex(id, ":")+1:]
+}
+
+// ServeHTTP serves a request to the fake VCD. Requests are served one at a time.
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	server.requests = append(server.requests, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+	server.completeTasks()
+
+	path := r.URL.Path
+	switch {
+	case path == "/api/versions":
+		server.serveVersions(w, r)
+		return
+	case strings.HasPrefix(path, "/cloudapi/1.0.0/sessions"):
+		server.serveSession(w, r)
+		return
+	case strings.HasPrefix(path, "/oauth/"):
+		server.serveOAuthToken(w, r)
+		return
+	}
+
+	org, ok := server.authenticate(r)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "the access token is missing or has expired")
+		return
+	}
+	if server.injectFailure(w, r) {
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(path, "/api/"):
+		server.serveLegacyAPI(w, r, org)
+	case strings.HasPrefix(path, "/cloudapi/1.0.0/"):
+		server.serveCloudAPI(w, r, org, strings.Split(strings.TrimPrefix(path, "/cloudapi/1.0.0/"), "/"))
+	default:
+		writeError(w, r, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("no resource at [%s]", path))
+	}
+}
+
+func (server *Server) serveCloudAPI(w http.ResponseWriter, r *http.Request, org string, segments []string) {
+	switch segments[0] {
+	case "orgVdcNetworks":
+		server.serveNetworks(w, r, segments[1:])
+	case "edgeGateways":
+		server.serveEdgeGateways(w, r, segments[1:])
+	case "loadBalancer":
+		server.serveLoadBalancer(w, r, segments[1:])
+	case "applicationPortProfiles":
+		server.serveAppPortProfiles(w, r, segments[1:])
+	case "ssl":
+		server.serveCertificates(w, r, org, segments[1:])
+	case "entities":
+		server.serveDefinedEntities(w, r, segments[1:])
+	default:
+		writeError(w, r, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("no resource at [%s]", r.URL.Path))
+	}
+}
+
+// authenticate returns the org of the access token of r. The token is sent as a bearer token by the token manager
+// of the client, and in a VCD header by govcd.
+func (server *Server) authenticate(r *http.Request) (string, bool) {
+	token := r.Header.Get("X-Vmware-Vcloud-Access-Token")
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) > len("bearer ") && strings.EqualFold(authorization[:len("bearer ")], "bearer ") {
+		token = authorization[len("bearer "):]
+	}
+	org, ok := server.tokens[token]
+
+	return org, ok
+}
+
+// newToken returns a new access token for org
+func (server *Server) newToken(org string) string {
+	token := fmt.Sprintf("fakevcd-access-token-%s", server.newUUID())
+	server.tokens[token] = org
+
+	return token
+}
+
+// injectFailure writes the error of the first request failure that matches r, if any
+func (server *Server) injectFailure(w http.ResponseWriter, r *http.Request) bool {
+	for idx, failure := range server.requestFailures {
+		if failure.method != r.Method || !strings.HasPrefix(r.URL.Path, failure.pathPrefix) {
+			continue
+		}
+		failure.count--
+		if failure.count <= 0 {
+			server.requestFailures = append(server.requestFailures[:idx], server.requestFailures[idx+1:]...)
+		}
+		writeError(w, r, failure.statusCode, failure.minorErrorCode,
+			fmt.Sprintf("injected failure of [%s %s]", r.Method, r.URL.Path))
+		return true
+	}
+
+	return false
+}
+
+// isSysAdmin returns true if org is the org of the provider
+func isSysAdmin(org string) bool {
+	return strings.EqualFold(org, SystemOrg)
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeXML(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/*+xml;version=36.0")
+	w.WriteHeader(statusCode)
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(body)
+}
+
+// writeError writes a VCD error in the format of the API of r: XML for the legacy API and JSON for the cloudapi
+func writeError(w http.ResponseWriter, r *http.Request, statusCode int, minorErrorCode string, message string) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		writeXML(w, statusCode, &types.Error{
+			Message:        message,
+			MajorErrorCode: statusCode,
+			MinorErrorCode: minorErrorCode,
+		})
+		return
+	}
+
+	writeJSON(w, statusCode, &types.OpenApiError{
+		MinorErrorCode: minorErrorCode,
+		Message:        message,
+	})
+}
+
+// readJSON decodes the body of r into body, and writes a bad request if it cannot be decoded
+func readJSON(w http.ResponseWriter, r *http.Request, body interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "BAD_REQUEST", fmt.Sprintf("unable to decode body: [%v]", err))
+		return false
+	}
+
+	return true
+}
+
+func writeNotFound(w http.ResponseWriter, r *http.Request, kind string, id string) {
+	writeError(w, r, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("[%s] with id [%s] not found", kind, id))
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED",
+		fmt.Sprintf("[%s] is not supported on [%s]", r.Method, r.URL.Path))
+}
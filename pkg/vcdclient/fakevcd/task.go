@@ -0,0 +1,151 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package fakevcd
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	swaggerClient "github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdswaggerclient"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+// fakeTask is a task that completes at completeAt. The ids of the objects that it changes are busy until then.
+type fakeTask struct {
+	task       types.Task
+	targetIDs  []string
+	completeAt time.Time
+	failure    string
+	done       bool
+
+	// apply is called when the task succeeds and rollback when it fails. Either may be nil.
+	apply    func()
+	rollback func()
+}
+
+// startTask starts a task for r that changes the objects of targetIDs, and writes it as the accepted response of r.
+// The task is owned by ownerID, which govcd reads back once the task completes.
+func (server *Server) startTask(w http.ResponseWriter, r *http.Request, operation string, ownerID string,
+	targetIDs []string, apply func(), rollback func()) {
+	uuid := server.newUUID()
+	task := &fakeTask{
+		task: types.Task{
+			HREF:      fmt.Sprintf("%s/api/task/%s", server.URL, uuid),
+			ID:        fmt.Sprintf("urn:vcloud:task:%s", uuid),
+			Name:      "task",
+			Status:    "running",
+			Operation: operation,
+			Owner: &types.Reference{
+				ID: ownerID,
+			},
+		},
+		targetIDs:  targetIDs,
+		completeAt: time.Now().Add(server.taskDelay),
+		failure:    server.takeTaskFailure(r),
+		apply:      apply,
+		rollback:   rollback,
+	}
+	server.tasks = append(server.tasks, task)
+	if server.taskDelay == 0 {
+		server.completeTasks()
+	}
+
+	w.Header().Set("Location", task.task.HREF)
+	writeXML(w, http.StatusAccepted, &task.task)
+}
+
+// takeTaskFailure returns the message with which the task of r has to fail, or an empty string if it succeeds
+func (server *Server) takeTaskFailure(r *http.Request) string {
+	for idx, failure := range server.taskFailures {
+		if failure.method != r.Method || !strings.HasPrefix(r.URL.Path, failure.pathPrefix) {
+			continue
+		}
+		failure.count--
+		if failure.count <= 0 {
+			server.taskFailures = append(server.taskFailures[:idx], server.taskFailures[idx+1:]...)
+		}
+		return failure.message
+	}
+
+	return ""
+}
+
+// completeTasks completes the tasks whose time has come, in the order in which they were started
+func (server *Server) completeTasks() {
+	now := time.Now()
+	for _, task := range server.tasks {
+		if task.done || now.Before(task.completeAt) {
+			continue
+		}
+		task.done = true
+		if task.failure != "" {
+			task.task.Status = "error"
+			task.task.Error = &types.Error{
+				Message:        task.failure,
+				MajorErrorCode: http.StatusInternalServerError,
+				MinorErrorCode: "INTERNAL_SERVER_ERROR",
+			}
+			if task.rollback != nil {
+				task.rollback()
+			}
+			continue
+		}
+		task.task.Status = "success"
+		if task.apply != nil {
+			task.apply()
+		}
+	}
+}
+
+// isBusy returns true if a running task changes the object with id
+func (server *Server) isBusy(id string) bool {
+	for _, task := range server.tasks {
+		if task.done {
+			continue
+		}
+		for _, targetID := range task.targetIDs {
+			if targetID == id {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// statusOf returns the status of the object with id: CONFIGURING while a task changes it, and REALIZED otherwise
+func (server *Server) statusOf(id string) *swaggerClient.NetworkingObjectStatusType {
+	status := swaggerClient.REALIZED_NetworkingObjectStatusType
+	if server.isBusy(id) {
+		status = swaggerClient.CONFIGURING_NetworkingObjectStatusType
+	}
+
+	return &status
+}
+
+// writeBusy writes the bad request with which VCD rejects a change to an object that a task is changing
+func writeBusy(w http.ResponseWriter, r *http.Request, id string) {
+	writeError(w, r, http.StatusBadRequest, "BUSY_ENTITY",
+		fmt.Sprintf("the entity [%s] is busy completing an operation", id))
+}
+
+func (server *Server) serveTask(w http.ResponseWriter, r *http.Request, uuid string) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	for _, task := range server.tasks {
+		if uuidOf(task.task.ID) == uuid {
+			writeXML(w, http.StatusOK, &task.task)
+			return
+		}
+	}
+
+	writeError(w, r, http.StatusForbidden, "ACCESS_TO_RESOURCE_IS_FORBIDDEN",
+		fmt.Sprintf("no access to task [%s]", uuid))
+}
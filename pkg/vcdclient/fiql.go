@@ -0,0 +1,46 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// fiqlReservedChars have a meaning in a FIQL filter. Values that contain any of them cannot be compared by VCD,
+// as the cloudapi has no way to escape them.
+const fiqlReservedChars = ";,()=!<>"
+
+// fiqlEquals returns the FIQL filter that matches property with value, or an empty filter if value cannot be
+// compared by VCD. Callers must still compare the items they get, as an empty filter matches everything.
+func fiqlEquals(property string, value string) string {
+	if value == "" || strings.ContainsAny(value, fiqlReservedChars) {
+		return ""
+	}
+
+	return fmt.Sprintf("%s==%s", property, value)
+}
+
+// fiqlOr returns the FIQL filter that matches any of the filters, or an empty filter if one of them is empty
+func fiqlOr(filters ...string) string {
+	for _, filter := range filters {
+		if filter == "" {
+			return ""
+		}
+	}
+
+	return strings.Join(filters, ",")
+}
+
+// isFilterRejected returns true if err is the bad request with which VCD rejects a filter on a property that it
+// cannot filter by
+func isFilterRejected(err error) bool {
+	var vcdError *VCDError
+	return errors.As(err, &vcdError) && vcdError.StatusCode == http.StatusBadRequest &&
+		vcdError.MinorErrorCode != minorErrorCodeBusyEntity
+}
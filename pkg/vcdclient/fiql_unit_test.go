@@ -0,0 +1,51 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFIQLFilters(t *testing.T) {
+
+	type TestCase struct {
+		Filter       string
+		Expected     string
+		ErrorComment string
+	}
+
+	testCaseList := []TestCase{
+		{fiqlEquals("name", "lb-1"), "name==lb-1", "Plain value should be compared"},
+		{fiqlEquals("name", "lb;1"), "", "Value with a separator cannot be compared"},
+		{fiqlEquals("name", "lb(1)"), "", "Value with parentheses cannot be compared"},
+		{fiqlEquals("name", ""), "", "Empty value cannot be compared"},
+		{fiqlOr("ip==1", "ip==2"), "ip==1,ip==2", "Filters should be joined in or"},
+		{fiqlOr("ip==1", ""), "", "An empty filter matches everything in or"},
+	}
+
+	for _, testCase := range testCaseList {
+		assert.Equal(t, testCase.Expected, testCase.Filter, testCase.ErrorComment)
+	}
+
+	return
+}
+
+func TestIsFilterRejected(t *testing.T) {
+	badRequest := &http.Response{StatusCode: http.StatusBadRequest}
+	assert.True(t, isFilterRejected(fmt.Errorf("unable to list: [%w]", NewVCDErrorFromResponse(badRequest,
+		[]byte(`{"minorErrorCode":"BAD_REQUEST","message":"invalid filter"}`)))), "Bad request rejects the filter")
+	assert.False(t, isFilterRejected(NewVCDErrorFromResponse(badRequest,
+		[]byte(`{"minorErrorCode":"BUSY_ENTITY","message":"busy"}`))), "Busy entity does not reject the filter")
+	assert.False(t, isFilterRejected(NewVCDErrorFromResponse(&http.Response{StatusCode: http.StatusNotFound},
+		nil)), "Not found does not reject the filter")
+	assert.False(t, isFilterRejected(fmt.Errorf("connection refused")), "Other errors do not reject the filter")
+
+	return
+}
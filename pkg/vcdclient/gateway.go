@@ -6,20 +6,26 @@
 package vcdclient
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/antihax/optional"
 	"github.com/apparentlymart/go-cidr/cidr"
-	"github.com/peterhellberg/link"
 	swaggerClient "github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdswaggerclient"
-	"github.com/vmware/go-vcloud-director/v2/govcd"
 	"github.com/vmware/go-vcloud-director/v2/types/v56"
 	"k8s.io/klog"
 	"net"
 	"net/http"
-	"net/url"
 	"strconv"
-	"strings"
+)
+
+const (
+	// internalIPProbeSize is the number of candidate IPs that are checked per request when probing for an unused
+	// one-arm IP
+	internalIPProbeSize = 25
+	// maxInternalIPProbes bounds the probing requests, after which the IPs of all virtual services are checked
+	maxInternalIPProbes = 8
 )
 
 func (client *Client) getOVDCNetwork(ctx context.Context, networkName string) (*swaggerClient.VdcNetwork, error) {
@@ -27,35 +33,38 @@ func (client *Client) getOVDCNetwork(ctx context.Context, networkName string) (*
 		return nil, fmt.Errorf("network name should not be empty")
 	}
 
+	// The name is filtered by VCD. The owner is checked here instead, as a network shared from a VDC group is
+	// owned by the group rather than by the VDC of the cluster.
 	ovdcNetworksAPI := client.APIClient.OrgVdcNetworksApi
-	pageNum := int32(1)
-	ovdcNetworkID := ""
-	for {
-		ovdcNetworks, resp, err := ovdcNetworksAPI.GetAllVdcNetworks(ctx, pageNum, 32, nil)
-		if err != nil {
-			// TODO: log resp in debug mode only
-			return nil, fmt.Errorf("unable to get all ovdc networks: [%+v]: [%v]", resp, err)
-		}
-
-		if len(ovdcNetworks.Values) == 0 {
-			break
-		}
-
-		for _, ovdcNetwork := range ovdcNetworks.Values {
-			if ovdcNetwork.Name == client.networkName {
-				ovdcNetworkID = ovdcNetwork.Id
-				break
+	matchingNetworks := make([]swaggerClient.VdcNetwork, 0)
+	err := newPager(32, fiqlEquals("name", networkName)).withScanFallback().forEachPage(ctx,
+		func(ctx context.Context, page int32, pageSize int32, filter optional.String) (int, int32, error) {
+			ovdcNetworks, resp, err := ovdcNetworksAPI.GetAllVdcNetworks(ctx, page, pageSize,
+				&swaggerClient.OrgVdcNetworksApiGetAllVdcNetworksOpts{
+					Filter: filter,
+				})
+			if err != nil {
+				return 0, 0, fmt.Errorf("unable to get page [%d] of ovdc networks: [%w]", page,
+					NewVCDErrorFromSwagger(resp, err))
+			}
+			for _, ovdcNetwork := range ovdcNetworks.Values {
+				if ovdcNetwork.Name == networkName {
+					matchingNetworks = append(matchingNetworks, ovdcNetwork)
+				}
 			}
-		}
 
-		if ovdcNetworkID != "" {
-			break
-		}
-		pageNum++
+			return len(ovdcNetworks.Values), ovdcNetworks.PageCount, nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get ovdc networks named [%s]: [%w]", networkName, err)
 	}
-	if ovdcNetworkID == "" {
-		return nil, fmt.Errorf("unable to obtain ID for ovdc network name [%s]",
-			client.networkName)
+	vdcID := ""
+	if client.VDC != nil && client.VDC.Vdc != nil {
+		vdcID = client.VDC.Vdc.ID
+	}
+	ovdcNetworkID, err := selectOVDCNetwork(networkName, vdcID, matchingNetworks)
+	if err != nil {
+		return nil, err
 	}
 
 	ovdcNetworkAPI := client.APIClient.OrgVdcNetworkApi
@@ -67,6 +76,32 @@ func (client *Client) getOVDCNetwork(ctx context.Context, networkName string) (*
 	return &ovdcNetwork, nil
 }
 
+// selectOVDCNetwork returns the ID of the network among the networks named networkName that is in the VDC vdcID.
+// A network of another VDC or of a VDC group is only used if it is the only network with the name.
+func selectOVDCNetwork(networkName string, vdcID string,
+	matchingNetworks []swaggerClient.VdcNetwork) (string, error) {
+	switch len(matchingNetworks) {
+	case 0:
+		return "", fmt.Errorf("unable to obtain ID for ovdc network name [%s]", networkName)
+	case 1:
+		return matchingNetworks[0].Id, nil
+	}
+
+	vdcNetworkIDs := make([]string, 0)
+	for _, ovdcNetwork := range matchingNetworks {
+		if (ovdcNetwork.OrgVdc != nil && ovdcNetwork.OrgVdc.Id == vdcID) ||
+			(ovdcNetwork.OwnerRef != nil && ovdcNetwork.OwnerRef.Id == vdcID) {
+			vdcNetworkIDs = append(vdcNetworkIDs, ovdcNetwork.Id)
+		}
+	}
+	if vdcID == "" || len(vdcNetworkIDs) != 1 {
+		return "", fmt.Errorf("found [%d] ovdc networks named [%s], of which [%d] are in VDC [%s]",
+			len(matchingNetworks), networkName, len(vdcNetworkIDs), vdcID)
+	}
+
+	return vdcNetworkIDs[0], nil
+}
+
 // CacheGatewayDetails : get gateway reference and cache some details in client object
 func (client *Client) CacheGatewayDetails(ctx context.Context) error {
 
@@ -74,31 +109,12 @@ func (client *Client) CacheGatewayDetails(ctx context.Context) error {
 		return fmt.Errorf("network name should not be empty")
 	}
 
-	ovdcNetwork, err := client.getOVDCNetwork(ctx, client.networkName)
+	gatewayRef, networkBackingType, err := client.getGatewayDetails(ctx, client.networkName)
 	if err != nil {
-		return fmt.Errorf("unable to get OVDC network [%s]: [%v]", client.networkName, err)
-	}
-
-	// Cache backing type
-	if ovdcNetwork.BackingNetworkType != nil {
-		client.networkBackingType = *ovdcNetwork.BackingNetworkType
-	}
-
-	// Cache gateway reference
-	if ovdcNetwork.Connection == nil ||
-		ovdcNetwork.Connection.RouterRef == nil {
-		klog.Infof("Gateway for Network Name [%s] is of type [%v]\n",
-			client.networkName, client.networkBackingType)
-		return nil
-	}
-
-	client.gatewayRef = &swaggerClient.EntityReference{
-		Name: ovdcNetwork.Connection.RouterRef.Name,
-		Id:   ovdcNetwork.Connection.RouterRef.Id,
+		return err
 	}
-
-	klog.Infof("Obtained Gateway [%s] for Network Name [%s] of type [%v]\n",
-		client.gatewayRef.Name, client.networkName, client.networkBackingType)
+	client.gatewayRef = gatewayRef
+	client.networkBackingType = networkBackingType
 
 	return nil
 }
@@ -125,32 +141,109 @@ func getUnusedIPAddressInRange(startIPAddress string, endIPAddress string,
 	return freeIP
 }
 
+// forEachVirtualServiceSummary calls visit for every virtual service summary of the gateway that p pages through,
+// until visit returns false
+func (client *Client) forEachVirtualServiceSummary(ctx context.Context, p *pager,
+	visit func(*swaggerClient.EdgeLoadBalancerVirtualServiceSummary) bool) error {
+	return p.forEachPage(ctx, func(ctx context.Context, page int32, pageSize int32,
+		filter optional.String) (int, int32, error) {
+		lbVSSummaries, resp, err := client.APIClient.EdgeGatewayLoadBalancerVirtualServicesApi.GetVirtualServiceSummariesForGateway(
+			ctx, page, pageSize, client.gatewayRef.Id,
+			&swaggerClient.EdgeGatewayLoadBalancerVirtualServicesApiGetVirtualServiceSummariesForGatewayOpts{
+				Filter: filter,
+			})
+		if err != nil {
+			return 0, 0, fmt.Errorf("unable to get page [%d] of virtual service summaries: [%w]", page,
+				NewVCDErrorFromSwagger(resp, err))
+		}
+		for idx := range lbVSSummaries.Values {
+			if !visit(&lbVSSummaries.Values[idx]) {
+				return 0, 0, errStopPaging
+			}
+		}
+
+		return len(lbVSSummaries.Values), lbVSSummaries.PageCount, nil
+	})
+}
+
+// probeUnusedInternalIPAddress looks for an unused one-arm IP by asking VCD which of a few candidate IPs are used
+// by virtual services, rather than listing every virtual service of the gateway. Returns an empty IP if none was
+// found within maxInternalIPProbes requests.
+func (client *Client) probeUnusedInternalIPAddress(ctx context.Context) (string, error) {
+	startIP := net.ParseIP(client.OneArm.StartIPAddress)
+	endIP := net.ParseIP(client.OneArm.EndIPAddress)
+	if startIP == nil || endIP == nil || bytes.Compare(startIP, endIP) > 0 {
+		return "", nil
+	}
+	reservedIPs := make(map[string]bool)
+	client.ipReservations.addReservedIPs(client.gatewayRef.Id, reservedIPs)
+
+	ip, exhausted := startIP, false
+	for probe := 0; probe < maxInternalIPProbes && !exhausted; probe++ {
+		candidates := make([]string, 0, internalIPProbeSize)
+		filters := make([]string, 0, internalIPProbeSize)
+		for len(candidates) < internalIPProbeSize && !exhausted {
+			if !reservedIPs[ip.String()] {
+				candidates = append(candidates, ip.String())
+				filters = append(filters, fiqlEquals("virtualIpAddress", ip.String()))
+			}
+			exhausted = ip.Equal(endIP)
+			ip = cidr.Inc(ip)
+		}
+		if len(candidates) == 0 {
+			break
+		}
+
+		usedIPs := make(map[string]bool)
+		err := client.forEachVirtualServiceSummary(ctx, newPager(internalIPProbeSize, fiqlOr(filters...)),
+			func(lbVSSummary *swaggerClient.EdgeLoadBalancerVirtualServiceSummary) bool {
+				usedIPs[lbVSSummary.VirtualIpAddress] = true
+				return true
+			})
+		if err != nil {
+			return "", err
+		}
+		for _, candidate := range candidates {
+			if !usedIPs[candidate] {
+				return candidate, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
 func (client *Client) getUnusedInternalIPAddress(ctx context.Context) (string, error) {
 
 	if client.gatewayRef == nil {
 		return "", fmt.Errorf("gateway reference should not be nil")
 	}
 
+	freeIP, err := client.probeUnusedInternalIPAddress(ctx)
+	if err != nil && !isFilterRejected(err) {
+		return "", fmt.Errorf("unable to probe for unused IP address of gateway [%s]: [%w]",
+			client.gatewayRef.Name, err)
+	}
+	if freeIP != "" {
+		klog.Infof("Obtained unused IP [%s] in range [%s-%s]\n", freeIP, client.OneArm.StartIPAddress,
+			client.OneArm.EndIPAddress)
+		return freeIP, nil
+	}
+
+	// Probing found no unused IP, so the IPs of all virtual services are checked
 	usedIPAddress := make(map[string]bool)
-	pageNum := int32(1)
-	for {
-		lbVSSummaries, resp, err := client.APIClient.EdgeGatewayLoadBalancerVirtualServicesApi.GetVirtualServiceSummariesForGateway(
-			ctx, pageNum, 25, client.gatewayRef.Id, nil)
-		if err != nil {
-			return "", fmt.Errorf("unable to get virtual service summaries for gateway [%s]: resp: [%v]: [%v]",
-				client.gatewayRef.Name, resp, err)
-		}
-		if len(lbVSSummaries.Values) == 0 {
-			break
-		}
-		for _, lbVSSummary := range lbVSSummaries.Values {
+	err = client.forEachVirtualServiceSummary(ctx, newPager(25, ""),
+		func(lbVSSummary *swaggerClient.EdgeLoadBalancerVirtualServiceSummary) bool {
 			usedIPAddress[lbVSSummary.VirtualIpAddress] = true
-		}
-
-		pageNum++
+			return true
+		})
+	if err != nil {
+		return "", fmt.Errorf("unable to get virtual service summaries for gateway [%s]: [%w]",
+			client.gatewayRef.Name, err)
 	}
+	client.ipReservations.addReservedIPs(client.gatewayRef.Id, usedIPAddress)
 
-	freeIP := getUnusedIPAddressInRange(client.OneArm.StartIPAddress,
+	freeIP = getUnusedIPAddressInRange(client.OneArm.StartIPAddress,
 		client.OneArm.EndIPAddress, usedIPAddress)
 	if freeIP == "" {
 		return "", fmt.Errorf("unable to find unused IP address in range [%s-%s]",
@@ -160,8 +253,8 @@ func (client *Client) getUnusedInternalIPAddress(ctx context.Context) (string, e
 	return freeIP, nil
 }
 
-// There are races here since there is no 'acquisition' of an IP. However, since k8s retries, it will
-// be correct.
+// There are races with other VCD clients here since there is no 'acquisition' of an IP. However, since k8s
+// retries, it will be correct. Races within this process are prevented by the IP reservations.
 func (client *Client) getUnusedExternalIPAddress(ctx context.Context, ipamSubnet string) (string, error) {
 	if client.gatewayRef == nil {
 		return "", fmt.Errorf("gateway reference should not be nil")
@@ -195,24 +288,27 @@ func (client *Client) getUnusedExternalIPAddress(ctx context.Context, ipamSubnet
 
 	// Next, get the list of used IP addresses for this gateway
 	usedIPs := make(map[string]bool)
-	pageNum := int32(1)
-	for {
-		gwUsedIPAddresses, resp, err := client.APIClient.EdgeGatewayApi.GetUsedIpAddresses(ctx, pageNum, 25,
-			client.gatewayRef.Id, nil)
+	err = newPager(25, "").forEachPage(ctx, func(ctx context.Context, page int32, pageSize int32,
+		filter optional.String) (int, int32, error) {
+		gwUsedIPAddresses, resp, err := client.APIClient.EdgeGatewayApi.GetUsedIpAddresses(ctx, page, pageSize,
+			client.gatewayRef.Id, &swaggerClient.EdgeGatewayApiGetUsedIpAddressesOpts{
+				Filter: filter,
+			})
 		if err != nil {
-			return "", fmt.Errorf("unable to get used IP addresses of gateway [%s]: [%+v]: [%v]",
-				client.gatewayRef.Name, resp, err)
-		}
-		if len(gwUsedIPAddresses.Values) == 0 {
-			break
+			return 0, 0, fmt.Errorf("unable to get page [%d] of used IP addresses: [%w]", page,
+				NewVCDErrorFromSwagger(resp, err))
 		}
-
 		for _, gwUsedIPAddress := range gwUsedIPAddresses.Values {
 			usedIPs[gwUsedIPAddress.IpAddress] = true
 		}
 
-		pageNum++
+		return len(gwUsedIPAddresses.Values), gwUsedIPAddresses.PageCount, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to get used IP addresses of gateway [%s]: [%w]",
+			client.gatewayRef.Name, err)
 	}
+	client.ipReservations.addReservedIPs(client.gatewayRef.Id, usedIPs)
 
 	// Now get a free IP that is not used.
 	freeIP := ""
@@ -234,43 +330,86 @@ func (client *Client) getUnusedExternalIPAddress(ctx context.Context, ipamSubnet
 	return freeIP, nil
 }
 
+// allocateInternalIPAddress picks an unused one-arm IP and reserves it for owner. The gateway lock is held only
+// while the IP is selected; the reservation keeps it from being handed out again until the owner releases it.
+func (client *Client) allocateInternalIPAddress(ctx context.Context, owner string) (string, error) {
+	unlock := client.gatewayLocks.Lock(client.gatewayRef.Id)
+	defer unlock()
+
+	freeIP, err := client.getUnusedInternalIPAddress(ctx)
+	if err != nil {
+		return "", err
+	}
+	client.ipReservations.reserve(client.gatewayRef.Id, freeIP, owner)
+
+	return freeIP, nil
+}
+
+// allocateExternalIPAddress picks an unused IP on the gateway from ipamSubnet and reserves it for owner.
+func (client *Client) allocateExternalIPAddress(ctx context.Context, ipamSubnet string,
+	owner string) (string, error) {
+
+	unlock := client.gatewayLocks.Lock(client.gatewayRef.Id)
+	defer unlock()
+
+	freeIP, err := client.getUnusedExternalIPAddress(ctx, ipamSubnet)
+	if err != nil {
+		return "", err
+	}
+	client.ipReservations.reserve(client.gatewayRef.Id, freeIP, owner)
+
+	return freeIP, nil
+}
+
 // TODO: There could be a race here as we don't book a slot. Retry repeatedly to get a LB Segment.
 func (client *Client) getLoadBalancerSEG(ctx context.Context) (*swaggerClient.EntityReference, error) {
 	if client.gatewayRef == nil {
 		return nil, fmt.Errorf("gateway reference should not be nil")
 	}
 
-	pageNum := int32(1)
 	var chosenSEGAssignment *swaggerClient.LoadBalancerServiceEngineGroupAssignment = nil
-	for {
-		segAssignments, resp, err := client.APIClient.LoadBalancerServiceEngineGroupAssignmentsApi.GetServiceEngineGroupAssignments(
-			ctx, pageNum, 25,
-			&swaggerClient.LoadBalancerServiceEngineGroupAssignmentsApiGetServiceEngineGroupAssignmentsOpts{
-				Filter: optional.NewString(fmt.Sprintf("gatewayRef.id==%s", client.gatewayRef.Id)),
-			},
-		)
-		if err != nil {
-			return nil, fmt.Errorf("unable to get service engine group for gateway [%s]: resp: [%v]: [%v]",
-				client.gatewayRef.Name, resp, err)
-		}
-		if len(segAssignments.Values) == 0 {
-			return nil, fmt.Errorf("obtained no service engine group assignment for gateway [%s]: [%v]", client.gatewayRef.Name, err)
-		}
-
-		for _, segAssignment := range segAssignments.Values {
-			if segAssignment.NumDeployedVirtualServices < segAssignment.MaxVirtualServices {
-				chosenSEGAssignment = &segAssignment
-				break
+	numMatchingAssignments := 0
+	err := newPager(25, fmt.Sprintf("gatewayRef.id==%s", client.gatewayRef.Id)).forEachPage(ctx,
+		func(ctx context.Context, page int32, pageSize int32, filter optional.String) (int, int32, error) {
+			segAssignments, resp, err := client.APIClient.LoadBalancerServiceEngineGroupAssignmentsApi.GetServiceEngineGroupAssignments(
+				ctx, page, pageSize,
+				&swaggerClient.LoadBalancerServiceEngineGroupAssignmentsApiGetServiceEngineGroupAssignmentsOpts{
+					Filter: filter,
+				},
+			)
+			if err != nil {
+				return 0, 0, fmt.Errorf("unable to get page [%d] of service engine group assignments: [%w]",
+					page, NewVCDErrorFromSwagger(resp, err))
+			}
+			for idx := range segAssignments.Values {
+				segAssignment := segAssignments.Values[idx]
+				if client.serviceEngineGroup != "" && (segAssignment.ServiceEngineGroupRef == nil ||
+					segAssignment.ServiceEngineGroupRef.Name != client.serviceEngineGroup) {
+					continue
+				}
+				numMatchingAssignments++
+				if segAssignment.NumDeployedVirtualServices < segAssignment.MaxVirtualServices {
+					chosenSEGAssignment = &segAssignment
+					return 0, 0, errStopPaging
+				}
 			}
-		}
-		if chosenSEGAssignment != nil {
-			break
-		}
 
-		pageNum++
+			return len(segAssignments.Values), segAssignments.PageCount, nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get service engine group for gateway [%s]: [%w]",
+			client.gatewayRef.Name, err)
 	}
 
 	if chosenSEGAssignment == nil {
+		if numMatchingAssignments == 0 {
+			if client.serviceEngineGroup != "" {
+				return nil, fmt.Errorf("service engine group [%s] with free instances is not assigned to gateway [%s]",
+					client.serviceEngineGroup, client.gatewayRef.Name)
+			}
+			return nil, fmt.Errorf("obtained no service engine group assignment for gateway [%s]",
+				client.gatewayRef.Name)
+		}
 		return nil, fmt.Errorf("unable to find service engine group with free instances")
 	}
 
@@ -279,41 +418,6 @@ func (client *Client) getLoadBalancerSEG(ctx context.Context) (*swaggerClient.En
 	return chosenSEGAssignment.ServiceEngineGroupRef, nil
 }
 
-func getCursor(resp *http.Response) (string, error) {
-	cursorURI := ""
-	for _, linklet := range resp.Header["Link"] {
-		for _, l := range link.Parse(linklet) {
-			if l.Rel == "nextPage" {
-				cursorURI = l.URI
-				break
-			}
-		}
-		if cursorURI != "" {
-			break
-		}
-	}
-	if cursorURI == "" {
-		return "", nil
-	}
-
-	u, err := url.Parse(cursorURI)
-	if err != nil {
-		return "", fmt.Errorf("unable to parse cursor URI [%s]: [%v]", cursorURI, err)
-	}
-
-	cursorStr := ""
-	keyMap, err := url.ParseQuery(u.RawQuery)
-	if err != nil {
-		return "", fmt.Errorf("unable to parse raw query [%s]: [%v]", u.RawQuery, err)
-	}
-
-	if cursorStrList, ok := keyMap["cursor"]; ok {
-		cursorStr = cursorStrList[0]
-	}
-
-	return cursorStr, nil
-}
-
 type NatRuleRef struct {
 	Name         string
 	ID           string
@@ -330,19 +434,17 @@ func (client *Client) getNATRuleRef(ctx context.Context, natRuleName string) (*N
 		return nil, fmt.Errorf("gateway reference should not be nil")
 	}
 
+	// NAT rules cannot be filtered by VCD, so the rules are paged through until the rule is found
 	var natRuleRef *NatRuleRef = nil
-	cursor := optional.EmptyString()
-	for {
+	err := newPager(128, "").forEachCursorPage(ctx, func(ctx context.Context, cursor optional.String,
+		pageSize int32, filter optional.String) (int, *http.Response, error) {
 		natRules, resp, err := client.APIClient.EdgeGatewayNatRulesApi.GetNatRules(
-			ctx, 128, client.gatewayRef.Id,
+			ctx, pageSize, client.gatewayRef.Id,
 			&swaggerClient.EdgeGatewayNatRulesApiGetNatRulesOpts{
 				Cursor: cursor,
 			})
 		if err != nil {
-			return nil, fmt.Errorf("unable to get nat rules: resp: [%+v]: [%v]", resp, err)
-		}
-		if len(natRules.Values) == 0 {
-			break
+			return 0, nil, fmt.Errorf("unable to get page of nat rules: [%w]", NewVCDErrorFromSwagger(resp, err))
 		}
 
 		for _, rule := range natRules.Values {
@@ -351,7 +453,7 @@ func (client *Client) getNATRuleRef(ctx context.Context, natRuleName string) (*N
 				if rule.DnatExternalPort != "" {
 					externalPort, err = strconv.Atoi(rule.DnatExternalPort)
 					if err != nil {
-						return nil, fmt.Errorf("unable to convert external port [%s] to int: [%v]",
+						return 0, nil, fmt.Errorf("unable to convert external port [%s] to int: [%v]",
 							rule.DnatExternalPort, err)
 					}
 				}
@@ -360,7 +462,7 @@ func (client *Client) getNATRuleRef(ctx context.Context, natRuleName string) (*N
 				if rule.InternalPort != "" {
 					internalPort, err = strconv.Atoi(rule.InternalPort)
 					if err != nil {
-						return nil, fmt.Errorf("unable to convert internal port [%s] to int: [%v]",
+						return 0, nil, fmt.Errorf("unable to convert internal port [%s] to int: [%v]",
 							rule.InternalPort, err)
 					}
 				}
@@ -373,21 +475,14 @@ func (client *Client) getNATRuleRef(ctx context.Context, natRuleName string) (*N
 					ExternalPort: externalPort,
 					InternalPort: internalPort,
 				}
-				break
+				return 0, nil, errStopPaging
 			}
 		}
-		if natRuleRef != nil {
-			break
-		}
 
-		cursorStr, err := getCursor(resp)
-		if err != nil {
-			return nil, fmt.Errorf("error while parsing response [%+v]: [%v]", resp, err)
-		}
-		if cursorStr == "" {
-			break
-		}
-		cursor = optional.NewString(cursorStr)
+		return len(natRules.Values), resp, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get nat rules: [%w]", err)
 	}
 
 	if natRuleRef == nil {
@@ -412,6 +507,9 @@ func (client *Client) createDNATRule(ctx context.Context, dnatRuleName string,
 		return fmt.Errorf("gateway reference should not be nil")
 	}
 
+	unlock := client.gatewayLocks.Lock(client.gatewayRef.Id)
+	defer unlock()
+
 	dnatRuleRef, err := client.getNATRuleRef(ctx, dnatRuleName)
 	if err != nil {
 		return fmt.Errorf("unexpected error while looking for nat rule [%s] in gateway [%s]: [%v]",
@@ -434,7 +532,7 @@ func (client *Client) createDNATRule(ctx context.Context, dnatRuleName string,
 	contextEntityID := client.VDC.Vdc.ID
 	scope := types.ApplicationPortProfileScopeTenant
 	appPortProfile, err := org.GetNsxtAppPortProfileByName(appPortProfileName, scope)
-	if err != nil && !strings.Contains(err.Error(), govcd.ErrorEntityNotFound.Error()) {
+	if err != nil && !errors.Is(NewVCDErrorFromGovcd(err), ErrNotFound) {
 		return fmt.Errorf("unable to search for Application Port Profile [%s]: [%v]",
 			appPortProfileName, err)
 	}
@@ -477,11 +575,9 @@ func (client *Client) createDNATRule(ctx context.Context, dnatRuleName string,
 			client.ClusterOrgName)
 	}
 
-	ruleType := swaggerClient.DNAT_NatRuleType
 	edgeNatRule := swaggerClient.EdgeNatRule{
 		Name:              dnatRuleName,
 		Enabled:           true,
-		RuleType:          &ruleType,
 		ExternalAddresses: externalIP,
 		InternalAddresses: internalIP,
 		DnatExternalPort:  fmt.Sprintf("%d", externalPort),
@@ -490,24 +586,35 @@ func (client *Client) createDNATRule(ctx context.Context, dnatRuleName string,
 			Id:   appPortProfile.NsxtAppPortProfile.ID,
 		},
 	}
-	resp, err := client.APIClient.EdgeGatewayNatRulesApi.CreateNatRule(ctx, edgeNatRule, client.gatewayRef.Id)
+	if client.SupportsFeature(FeatureNATRuleType) {
+		edgeNatRule.Type_ = string(swaggerClient.DNAT_NatRuleType)
+	} else {
+		ruleType := swaggerClient.DNAT_NatRuleType
+		edgeNatRule.RuleType = &ruleType
+	}
+	var resp *http.Response
+	err = client.retryCreate(ctx, fmt.Sprintf("create dnat rule [%s]", dnatRuleName), func() (*http.Response, error) {
+		resp, err = client.APIClient.EdgeGatewayNatRulesApi.CreateNatRule(ctx, edgeNatRule, client.gatewayRef.Id)
+		if err != nil {
+			return resp, NewVCDErrorFromSwagger(resp, err)
+		}
+		return resp, nil
+	})
 	if err != nil {
-		return fmt.Errorf("unable to create dnat rule [%s]: [%s:%d]=>[%s:%d]: [%v]", dnatRuleName,
+		return fmt.Errorf("unable to create dnat rule [%s]: [%s:%d]=>[%s:%d]: [%w]", dnatRuleName,
 			externalIP, externalPort, internalIP, internalPort, err)
 	}
-	if resp != nil && resp.StatusCode != http.StatusAccepted {
+	if resp == nil {
+		return fmt.Errorf("unable to create dnat rule [%s]: no response from VCD", dnatRuleName)
+	}
+	if resp.StatusCode != http.StatusAccepted {
 		return fmt.Errorf(
-			"unable to create dnat rule [%s]: [%s]=>[%s]; expected http response [%v], obtained [%v]: [%v]",
-			dnatRuleName, externalIP, internalIP, http.StatusAccepted, resp.StatusCode, err)
-	} else if err != nil {
-		return fmt.Errorf("unable to create dnat rule [%s]: [%s:%d]=>[%s:%d]: [%v]", dnatRuleName,
-			externalIP, externalPort, internalIP, internalPort, err)
+			"unable to create dnat rule [%s]: [%s]=>[%s]; expected http response [%v], obtained [%v]",
+			dnatRuleName, externalIP, internalIP, http.StatusAccepted, resp.StatusCode)
 	}
 
 	taskURL := resp.Header.Get("Location")
-	task := govcd.NewTask(&client.VCDClient.Client)
-	task.Task.HREF = taskURL
-	if err = task.WaitTaskCompletion(); err != nil {
+	if err = client.waitForTask(ctx, taskURL, taskOperationCreate); err != nil {
 		return fmt.Errorf("unable to create dnat rule [%s]: [%s]=>[%s]; creation task [%s] did not complete: [%v]",
 			dnatRuleName, externalIP, internalIP, taskURL, err)
 	}
@@ -540,7 +647,10 @@ func (client *Client) updateAppPortProfile(appPortProfileName string, externalPo
 }
 
 func (client *Client) updateDNATRule(ctx context.Context, dnatRuleName string, externalIP string, internalIP string, externalPort int32) error {
-	if err := client.checkIfGatewayIsReady(ctx); err != nil {
+	unlock := client.gatewayLocks.Lock(client.gatewayRef.Id)
+	defer unlock()
+
+	if err := client.waitForGatewayReady(ctx); err != nil {
 		klog.Errorf("failed to update DNAT rule; gateway [%s] is busy", client.gatewayRef.Name)
 		return err
 	}
@@ -554,13 +664,8 @@ func (client *Client) updateDNATRule(ctx context.Context, dnatRuleName string, e
 	}
 	dnatRule, resp, err := client.APIClient.EdgeGatewayNatRuleApi.GetNatRule(ctx, client.gatewayRef.Id, dnatRuleRef.ID)
 	if resp != nil && resp.StatusCode != http.StatusOK {
-		var responseMessageBytes []byte
-		if gsErr, ok := err.(swaggerClient.GenericSwaggerError); ok {
-			responseMessageBytes = gsErr.Body()
-		}
-		return fmt.Errorf(
-			"unable to get DNAT rule [%s]; expected http response [%v], obtained [%v]: resp: [%#v]: [%v]",
-			dnatRuleRef.Name, http.StatusOK, resp.StatusCode, string(responseMessageBytes), err)
+		return fmt.Errorf("unable to get DNAT rule [%s]; expected http response [%v], obtained [%v]: [%w]",
+			dnatRuleRef.Name, http.StatusOK, resp.StatusCode, NewVCDErrorFromSwagger(resp, err))
 	} else if err != nil {
 		return fmt.Errorf("error while getting DNAT rule [%s]: [%v]", dnatRuleRef.Name, err)
 	}
@@ -571,17 +676,28 @@ func (client *Client) updateDNATRule(ctx context.Context, dnatRuleName string, e
 	dnatRule.ExternalAddresses = externalIP
 	dnatRule.InternalAddresses = internalIP
 	dnatRule.DnatExternalPort = fmt.Sprintf("%d", externalPort)
-	resp, err = client.APIClient.EdgeGatewayNatRuleApi.UpdateNatRule(ctx, dnatRule, client.gatewayRef.Id, dnatRuleRef.ID)
-	if resp != nil && resp.StatusCode != http.StatusAccepted {
-		var responseMessageBytes []byte
-		if gsErr, ok := err.(swaggerClient.GenericSwaggerError); ok {
-			responseMessageBytes = gsErr.Body()
+	err = client.retry(ctx, fmt.Sprintf("update DNAT rule [%s]", dnatRuleRef.Name), func() (*http.Response, error) {
+		resp, err = client.APIClient.EdgeGatewayNatRuleApi.UpdateNatRule(ctx, dnatRule, client.gatewayRef.Id, dnatRuleRef.ID)
+		if err != nil {
+			return resp, NewVCDErrorFromSwagger(resp, err)
 		}
-		return fmt.Errorf(
-			"unable to update DNAT rule [%s]; expected http response [%v], obtained [%v]: resp: [%#v]: [%v]",
-			dnatRuleRef.Name, http.StatusAccepted, resp.StatusCode, string(responseMessageBytes), err)
-	} else if err != nil {
-		return fmt.Errorf("error while updating DNAT rule [%s]: [%v]", dnatRuleRef.Name, err)
+		return resp, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error while updating DNAT rule [%s]: [%w]", dnatRuleRef.Name, err)
+	}
+	if resp == nil {
+		return fmt.Errorf("unable to update DNAT rule [%s]: no response from VCD", dnatRuleRef.Name)
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("unable to update DNAT rule [%s]; expected http response [%v], obtained [%v]",
+			dnatRuleRef.Name, http.StatusAccepted, resp.StatusCode)
+	}
+
+	taskURL := resp.Header.Get("Location")
+	if err = client.waitForTask(ctx, taskURL, taskOperationUpdate); err != nil {
+		return fmt.Errorf("unable to update DNAT rule [%s]; update task [%s] did not complete: [%v]",
+			dnatRuleRef.Name, taskURL, err)
 	}
 	klog.Infof("successfully updated DNAT rule [%s]", dnatRuleRef.Name)
 	return nil
@@ -592,15 +708,18 @@ func (client *Client) updateDNATRule(ctx context.Context, dnatRuleName string, e
 func (client *Client) deleteDNATRule(ctx context.Context, dnatRuleName string,
 	failIfAbsent bool) error {
 
-	if err := client.checkIfGatewayIsReady(ctx); err != nil {
-		klog.Errorf("failed to update DNAT rule; gateway [%s] is busy", client.gatewayRef.Name)
-		return err
-	}
-
 	if client.gatewayRef == nil {
 		return fmt.Errorf("gateway reference should not be nil")
 	}
 
+	unlock := client.gatewayLocks.Lock(client.gatewayRef.Id)
+	defer unlock()
+
+	if err := client.waitForGatewayReady(ctx); err != nil {
+		klog.Errorf("failed to update DNAT rule; gateway [%s] is busy", client.gatewayRef.Name)
+		return err
+	}
+
 	dnatRuleRef, err := client.getNATRuleRef(ctx, dnatRuleName)
 	if err != nil {
 		return fmt.Errorf("unexpected error while finding dnat rule [%s]: [%v]", dnatRuleName, err)
@@ -612,21 +731,28 @@ func (client *Client) deleteDNATRule(ctx context.Context, dnatRuleName string,
 
 		klog.Infof("DNAT rule [%s] does not exist", dnatRuleName)
 	} else {
-		resp, err := client.APIClient.EdgeGatewayNatRuleApi.DeleteNatRule(ctx,
-			client.gatewayRef.Id, dnatRuleRef.ID)
-		if resp.StatusCode != http.StatusAccepted {
-			var responseMessageBytes []byte
-			if gsErr, ok := err.(swaggerClient.GenericSwaggerError); ok {
-				responseMessageBytes = gsErr.Body()
+		var resp *http.Response
+		err = client.retry(ctx, fmt.Sprintf("delete dnat rule [%s]", dnatRuleName), func() (*http.Response, error) {
+			resp, err = client.APIClient.EdgeGatewayNatRuleApi.DeleteNatRule(ctx,
+				client.gatewayRef.Id, dnatRuleRef.ID)
+			if err != nil {
+				return resp, NewVCDErrorFromSwagger(resp, err)
 			}
-			return fmt.Errorf("unable to delete dnat rule [%s]: expected http response [%v], obtained [%v], response: [%v]",
-				dnatRuleName, http.StatusAccepted, resp.StatusCode, string(responseMessageBytes))
+			return resp, nil
+		})
+		if err != nil {
+			return fmt.Errorf("unable to delete dnat rule [%s]: [%w]", dnatRuleName, err)
+		}
+		if resp == nil {
+			return fmt.Errorf("unable to delete dnat rule [%s]: no response from VCD", dnatRuleName)
+		}
+		if resp.StatusCode != http.StatusAccepted {
+			return fmt.Errorf("unable to delete dnat rule [%s]: expected http response [%v], obtained [%v]",
+				dnatRuleName, http.StatusAccepted, resp.StatusCode)
 		}
 
 		taskURL := resp.Header.Get("Location")
-		task := govcd.NewTask(&client.VCDClient.Client)
-		task.Task.HREF = taskURL
-		if err = task.WaitTaskCompletion(); err != nil {
+		if err = client.waitForTask(ctx, taskURL, taskOperationDelete); err != nil {
 			return fmt.Errorf("unable to delete dnat rule [%s]: deletion task [%s] did not complete: [%v]",
 				dnatRuleName, taskURL, err)
 		}
@@ -646,7 +772,7 @@ func (client *Client) deleteDNATRule(ctx context.Context, dnatRuleName string,
 	scope := types.ApplicationPortProfileScopeTenant
 	appPortProfile, err := org.GetNsxtAppPortProfileByName(appPortProfileName, scope)
 	if err != nil {
-		if strings.Contains(err.Error(), govcd.ErrorEntityNotFound.Error()) {
+		if errors.Is(NewVCDErrorFromGovcd(err), ErrNotFound) {
 			// things to delete are done
 			return nil
 		}
@@ -680,22 +806,34 @@ func (client *Client) getLoadBalancerPoolSummary(ctx context.Context,
 		return nil, fmt.Errorf("gateway reference should not be nil")
 	}
 
-	// This should return exactly one result, so no need to accumulate results
-	lbPoolSummaries, resp, err := client.APIClient.EdgeGatewayLoadBalancerPoolsApi.GetPoolSummariesForGateway(
-		ctx, 1, 25, client.gatewayRef.Id,
-		&swaggerClient.EdgeGatewayLoadBalancerPoolsApiGetPoolSummariesForGatewayOpts{
-			Filter: optional.NewString(fmt.Sprintf("name==%s", lbPoolName)),
-		},
-	)
+	// VCD filters by name, so this is a single request unless the name cannot be filtered
+	var lbPoolSummary *swaggerClient.EdgeLoadBalancerPoolSummary = nil
+	err := newPager(25, fiqlEquals("name", lbPoolName)).withScanFallback().forEachPage(ctx,
+		func(ctx context.Context, page int32, pageSize int32, filter optional.String) (int, int32, error) {
+			lbPoolSummaries, resp, err := client.APIClient.EdgeGatewayLoadBalancerPoolsApi.GetPoolSummariesForGateway(
+				ctx, page, pageSize, client.gatewayRef.Id,
+				&swaggerClient.EdgeGatewayLoadBalancerPoolsApiGetPoolSummariesForGatewayOpts{
+					Filter: filter,
+				},
+			)
+			if err != nil {
+				return 0, 0, fmt.Errorf("unable to get page [%d] of LB pool summaries: [%w]", page,
+					NewVCDErrorFromSwagger(resp, err))
+			}
+			for idx := range lbPoolSummaries.Values {
+				if lbPoolSummaries.Values[idx].Name == lbPoolName {
+					lbPoolSummary = &lbPoolSummaries.Values[idx]
+					return 0, 0, errStopPaging
+				}
+			}
+
+			return len(lbPoolSummaries.Values), lbPoolSummaries.PageCount, nil
+		})
 	if err != nil {
-		return nil, fmt.Errorf("unable to get reference for LB pool [%s]: [%+v]: [%v]",
-			lbPoolName, resp, err)
-	}
-	if len(lbPoolSummaries.Values) != 1 {
-		return nil, nil // this is not an error
+		return nil, fmt.Errorf("unable to get reference for LB pool [%s]: [%w]", lbPoolName, err)
 	}
 
-	return &lbPoolSummaries.Values[0], nil
+	return lbPoolSummary, nil // a nil summary is not an error
 }
 
 func (client *Client) getLoadBalancerPool(ctx context.Context,
@@ -754,20 +892,28 @@ func (client *Client) createLoadBalancerPool(ctx context.Context, lbPoolName str
 	}
 
 	lbPool, lbPoolMembers := client.formLoadBalancerPool(lbPoolName, ips, internalPort)
-	resp, err := client.APIClient.EdgeGatewayLoadBalancerPoolsApi.CreateLoadBalancerPool(ctx, lbPool)
+	var resp *http.Response
+	err = client.retryCreate(ctx, fmt.Sprintf("create loadbalancer pool [%s]", lbPoolName), func() (*http.Response, error) {
+		resp, err = client.APIClient.EdgeGatewayLoadBalancerPoolsApi.CreateLoadBalancerPool(ctx, lbPool)
+		if err != nil {
+			return resp, NewVCDErrorFromSwagger(resp, err)
+		}
+		return resp, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("unable to create loadbalancer pool with name [%s], members [%+v]: resp [%+v]: [%v]",
+		return nil, fmt.Errorf("unable to create loadbalancer pool with name [%s], members [%+v]: resp [%+v]: [%w]",
 			lbPoolName, lbPoolMembers, resp, err)
 	}
+	if resp == nil {
+		return nil, fmt.Errorf("unable to create loadbalancer pool [%s]: no response from VCD", lbPoolName)
+	}
 	if resp.StatusCode != http.StatusAccepted {
 		return nil, fmt.Errorf("unable to create loadbalancer pool; expected http response [%v], obtained [%v]",
 			http.StatusAccepted, resp.StatusCode)
 	}
 
 	taskURL := resp.Header.Get("Location")
-	task := govcd.NewTask(&client.VCDClient.Client)
-	task.Task.HREF = taskURL
-	if err = task.WaitTaskCompletion(); err != nil {
+	if err = client.waitForTask(ctx, taskURL, taskOperationCreate); err != nil {
 		return nil, fmt.Errorf("unable to create loadbalancer pool; creation task [%s] did not complete: [%v]",
 			taskURL, err)
 	}
@@ -807,20 +953,31 @@ func (client *Client) deleteLoadBalancerPool(ctx context.Context, lbPoolName str
 		return nil
 	}
 
-	if err = client.checkIfLBPoolIsReady(ctx, lbPoolName); err != nil {
+	if err = client.waitForLBPoolReady(ctx, lbPoolName); err != nil {
 		return err
 	}
 
-	resp, err := client.APIClient.EdgeGatewayLoadBalancerPoolApi.DeleteLoadBalancerPool(ctx, lbPoolRef.Id)
+	var resp *http.Response
+	err = client.retry(ctx, fmt.Sprintf("delete loadbalancer pool [%s]", lbPoolName), func() (*http.Response, error) {
+		resp, err = client.APIClient.EdgeGatewayLoadBalancerPoolApi.DeleteLoadBalancerPool(ctx, lbPoolRef.Id)
+		if err != nil {
+			return resp, NewVCDErrorFromSwagger(resp, err)
+		}
+		return resp, nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to delete lb pool [%s]: [%w]", lbPoolName, err)
+	}
+	if resp == nil {
+		return fmt.Errorf("unable to delete lb pool [%s]: no response from VCD", lbPoolName)
+	}
 	if resp.StatusCode != http.StatusAccepted {
 		return fmt.Errorf("unable to delete lb pool; expected http response [%v], obtained [%v]",
 			http.StatusAccepted, resp.StatusCode)
 	}
 
 	taskURL := resp.Header.Get("Location")
-	task := govcd.NewTask(&client.VCDClient.Client)
-	task.Task.HREF = taskURL
-	if err = task.WaitTaskCompletion(); err != nil {
+	if err = client.waitForTask(ctx, taskURL, taskOperationDelete); err != nil {
 		return fmt.Errorf("unable to delete lb pool; deletion task [%s] did not complete: [%v]",
 			taskURL, err)
 	}
@@ -867,8 +1024,8 @@ func (client *Client) updateLoadBalancerPool(ctx context.Context, lbPoolName str
 		klog.Infof("No updates needed for the loadbalancer pool [%s]", lbPool.Name)
 		return lbPoolRef, nil
 	}
-	if err = client.checkIfLBPoolIsReady(ctx, lbPoolName); err != nil {
-		return nil, fmt.Errorf("unable to update loadbalancer pool [%s]; loadbalancer pool is busy: [%v]",lbPoolName, err)
+	if err = client.waitForLBPoolReady(ctx, lbPoolName); err != nil {
+		return nil, fmt.Errorf("unable to update loadbalancer pool [%s]; loadbalancer pool is busy: [%w]",lbPoolName, err)
 	}
 	lbPool, resp, err = client.APIClient.EdgeGatewayLoadBalancerPoolApi.GetLoadBalancerPool(ctx, lbPoolRef.Id)
 	if err != nil {
@@ -878,20 +1035,27 @@ func (client *Client) updateLoadBalancerPool(ctx context.Context, lbPoolName str
 		return nil, fmt.Errorf("unable to get loadbalancer pool with id [%s], expected http response [%v], obtained [%v]", lbPoolRef.Id, http.StatusOK, resp.StatusCode)
 	}
 	updatedLBPool, lbPoolMembers := client.formLoadBalancerPool(lbPoolName, ips, internalPort)
-	resp, err = client.APIClient.EdgeGatewayLoadBalancerPoolApi.UpdateLoadBalancerPool(ctx, updatedLBPool, lbPoolRef.Id)
+	err = client.retry(ctx, fmt.Sprintf("update loadbalancer pool [%s]", lbPoolName), func() (*http.Response, error) {
+		resp, err = client.APIClient.EdgeGatewayLoadBalancerPoolApi.UpdateLoadBalancerPool(ctx, updatedLBPool, lbPoolRef.Id)
+		if err != nil {
+			return resp, NewVCDErrorFromSwagger(resp, err)
+		}
+		return resp, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("unable to update loadbalancer pool with name [%s], members [%+v]: resp [%+v]: [%v]",
+		return nil, fmt.Errorf("unable to update loadbalancer pool with name [%s], members [%+v]: resp [%+v]: [%w]",
 			lbPoolName, lbPoolMembers, resp, err)
 	}
+	if resp == nil {
+		return nil, fmt.Errorf("unable to update loadbalancer pool [%s]: no response from VCD", lbPoolName)
+	}
 	if resp.StatusCode != http.StatusAccepted {
 		return nil, fmt.Errorf("unable to update loadbalancer pool; expected http response [%v], obtained [%v]",
 			http.StatusAccepted, resp.StatusCode)
 	}
 
 	taskURL := resp.Header.Get("Location")
-	task := govcd.NewTask(&client.VCDClient.Client)
-	task.Task.HREF = taskURL
-	if err = task.WaitTaskCompletion(); err != nil {
+	if err = client.waitForTask(ctx, taskURL, taskOperationUpdate); err != nil {
 		return nil, fmt.Errorf("unable to update loadbalancer pool; update task [%s] did not complete: [%v]",
 			taskURL, err)
 	}
@@ -918,22 +1082,22 @@ func (client *Client) getVirtualService(ctx context.Context,
 		return nil, fmt.Errorf("gateway reference should not be nil")
 	}
 
-	// This should return exactly one result, so no need to accumulate results
-	lbVSSummaries, resp, err := client.APIClient.EdgeGatewayLoadBalancerVirtualServicesApi.GetVirtualServiceSummariesForGateway(
-		ctx, 1, 25, client.gatewayRef.Id,
-		&swaggerClient.EdgeGatewayLoadBalancerVirtualServicesApiGetVirtualServiceSummariesForGatewayOpts{
-			Filter: optional.NewString(fmt.Sprintf("name==%s", virtualServiceName)),
-		},
-	)
+	// VCD filters by name, so this is a single request unless the name cannot be filtered
+	var vsSummary *swaggerClient.EdgeLoadBalancerVirtualServiceSummary = nil
+	err := client.forEachVirtualServiceSummary(ctx,
+		newPager(25, fiqlEquals("name", virtualServiceName)).withScanFallback(),
+		func(lbVSSummary *swaggerClient.EdgeLoadBalancerVirtualServiceSummary) bool {
+			if lbVSSummary.Name == virtualServiceName {
+				vsSummary = lbVSSummary
+				return false
+			}
+			return true
+		})
 	if err != nil {
-		return nil, fmt.Errorf("unable to get reference for LB VS [%s]: resp: [%v]: [%v]",
-			virtualServiceName, resp, err)
-	}
-	if len(lbVSSummaries.Values) != 1 {
-		return nil, nil // this is not an error
+		return nil, fmt.Errorf("unable to get reference for LB VS [%s]: [%w]", virtualServiceName, err)
 	}
 
-	return &lbVSSummaries.Values[0], nil
+	return vsSummary, nil // a nil summary is not an error
 }
 
 func (client *Client) checkIfVirtualServiceIsPending(ctx context.Context, virtualServiceName string) error {
@@ -1008,13 +1172,8 @@ func (client *Client) checkIfLBPoolIsReady(ctx context.Context, lbPoolName strin
 func (client *Client) checkIfGatewayIsReady(ctx context.Context) error {
 	edgeGateway, resp, err := client.APIClient.EdgeGatewayApi.GetEdgeGateway(ctx, client.gatewayRef.Id)
 	if resp != nil && resp.StatusCode != http.StatusOK {
-		var responseMessageBytes []byte
-		if gsErr, ok := err.(swaggerClient.GenericSwaggerError); ok {
-			responseMessageBytes = gsErr.Body()
-		}
-		return fmt.Errorf(
-			"unable to get gateway details; expected http response [%v], obtained [%v]: resp: [%#v]: [%v]",
-			http.StatusOK, resp.StatusCode, string(responseMessageBytes), err)
+		return fmt.Errorf("unable to get gateway details; expected http response [%v], obtained [%v]: [%w]",
+			http.StatusOK, resp.StatusCode, NewVCDErrorFromSwagger(resp, err))
 	} else if err != nil {
 		return fmt.Errorf("error while checking gateway status for [%s]: [%v]", client.gatewayRef.Name, err)
 	}
@@ -1027,6 +1186,39 @@ func (client *Client) checkIfGatewayIsReady(ctx context.Context) error {
 	return NewGatewayBusyError(client.gatewayRef.Name)
 }
 
+// waitForGatewayReady retries checkIfGatewayIsReady with backoff while the gateway is busy
+func (client *Client) waitForGatewayReady(ctx context.Context) error {
+	return client.retry(ctx, fmt.Sprintf("wait for gateway [%s] to be ready", client.gatewayRef.Name),
+		func() (*http.Response, error) {
+			return nil, client.checkIfGatewayIsReady(ctx)
+		})
+}
+
+// waitForLBPoolReady retries checkIfLBPoolIsReady with backoff while the pool is busy
+func (client *Client) waitForLBPoolReady(ctx context.Context, lbPoolName string) error {
+	return client.retry(ctx, fmt.Sprintf("wait for loadbalancer pool [%s] to be ready", lbPoolName),
+		func() (*http.Response, error) {
+			return nil, client.checkIfLBPoolIsReady(ctx, lbPoolName)
+		})
+}
+
+// waitForVirtualServiceReady retries checkIfVirtualServiceIsReady with backoff while the virtual service is busy
+func (client *Client) waitForVirtualServiceReady(ctx context.Context, virtualServiceName string) error {
+	return client.retry(ctx, fmt.Sprintf("wait for virtual service [%s] to be ready", virtualServiceName),
+		func() (*http.Response, error) {
+			return nil, client.checkIfVirtualServiceIsReady(ctx, virtualServiceName)
+		})
+}
+
+// waitForVirtualServiceNotPending retries checkIfVirtualServiceIsPending with backoff while the health of the
+// virtual service is not yet known
+func (client *Client) waitForVirtualServiceNotPending(ctx context.Context, virtualServiceName string) error {
+	return client.retry(ctx, fmt.Sprintf("wait for virtual service [%s] to leave pending state", virtualServiceName),
+		func() (*http.Response, error) {
+			return nil, client.checkIfVirtualServiceIsPending(ctx, virtualServiceName)
+		})
+}
+
 func (client *Client) updateVirtualServicePort(ctx context.Context, virtualServiceName string, externalPort int32) error {
 	vsSummary, err := client.getVirtualService(ctx, virtualServiceName)
 	if err != nil {
@@ -1042,7 +1234,7 @@ func (client *Client) updateVirtualServicePort(ctx context.Context, virtualServi
 		klog.Infof("virtual service [%s] is already configured with port [%d]", virtualServiceName, externalPort)
 		return nil
 	}
-	if err = client.checkIfVirtualServiceIsReady(ctx, virtualServiceName); err != nil {
+	if err = client.waitForVirtualServiceReady(ctx, virtualServiceName); err != nil {
 		return err
 	}
 	vs, _, err := client.APIClient.EdgeGatewayLoadBalancerVirtualServiceApi.GetVirtualService(ctx, vsSummary.Id)
@@ -1054,17 +1246,29 @@ func (client *Client) updateVirtualServicePort(ctx context.Context, virtualServi
 		vs.ServicePorts[0].PortStart = externalPort
 		vs.ServicePorts[0].PortEnd = externalPort
 	}
-	resp, err := client.APIClient.EdgeGatewayLoadBalancerVirtualServiceApi.UpdateVirtualService(ctx, vs, vsSummary.Id)
-	if resp != nil && resp.StatusCode != http.StatusAccepted {
-		var responseMessageBytes []byte
-		if gsErr, ok := err.(swaggerClient.GenericSwaggerError); ok {
-			responseMessageBytes = gsErr.Body()
+	var resp *http.Response
+	err = client.retry(ctx, fmt.Sprintf("update virtual service [%s]", virtualServiceName), func() (*http.Response, error) {
+		resp, err = client.APIClient.EdgeGatewayLoadBalancerVirtualServiceApi.UpdateVirtualService(ctx, vs, vsSummary.Id)
+		if err != nil {
+			return resp, NewVCDErrorFromSwagger(resp, err)
 		}
-		return fmt.Errorf(
-			"unable to update virtual service; expected http response [%v], obtained [%v]: resp: [%#v]: [%v]",
-			http.StatusAccepted, resp.StatusCode, string(responseMessageBytes), err)
-	} else if err != nil {
-		return fmt.Errorf("error while updating virtual service [%s]: [%v]", virtualServiceName, err)
+		return resp, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error while updating virtual service [%s]: [%w]", virtualServiceName, err)
+	}
+	if resp == nil {
+		return fmt.Errorf("unable to update virtual service [%s]: no response from VCD", virtualServiceName)
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("unable to update virtual service; expected http response [%v], obtained [%v]",
+			http.StatusAccepted, resp.StatusCode)
+	}
+
+	taskURL := resp.Header.Get("Location")
+	if err = client.waitForTask(ctx, taskURL, taskOperationUpdate); err != nil {
+		return fmt.Errorf("unable to update virtual service [%s]; update task [%s] did not complete: [%v]",
+			virtualServiceName, taskURL, err)
 	}
 	return nil
 }
@@ -1085,7 +1289,7 @@ func (client *Client) createVirtualService(ctx context.Context, virtualServiceNa
 	}
 	if vsSummary != nil {
 		klog.V(3).Infof("LoadBalancer Virtual Service [%s] already exists", virtualServiceName)
-		if err = client.checkIfVirtualServiceIsPending(ctx, virtualServiceName); err != nil {
+		if err = client.waitForVirtualServiceNotPending(ctx, virtualServiceName); err != nil {
 			return nil, err
 		}
 
@@ -1173,19 +1377,28 @@ func (client *Client) createVirtualService(ctx context.Context, virtualServiceNa
 		}
 	}
 
-	resp, gsErr := client.APIClient.EdgeGatewayLoadBalancerVirtualServicesApi.CreateVirtualService(ctx, *virtualServiceConfig)
-	if resp != nil && resp.StatusCode != http.StatusAccepted {
-		return nil, fmt.Errorf(
-			"unable to create virtual service; expected http response [%v], obtained [%v]: resp: [%#v]: [%v]: [%v]",
-			http.StatusAccepted, resp.StatusCode, resp, gsErr, string(gsErr.Body()))
-	} else if gsErr != nil {
-		return nil, fmt.Errorf("error while creating virtual service [%s]: [%v]", virtualServiceName, gsErr)
+	var resp *http.Response
+	err = client.retryCreate(ctx, fmt.Sprintf("create virtual service [%s]", virtualServiceName), func() (*http.Response, error) {
+		var gsErr *swaggerClient.GenericSwaggerError
+		resp, gsErr = client.APIClient.EdgeGatewayLoadBalancerVirtualServicesApi.CreateVirtualService(ctx, *virtualServiceConfig)
+		if gsErr != nil {
+			return resp, NewVCDErrorFromSwagger(resp, gsErr)
+		}
+		return resp, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error while creating virtual service [%s]: [%w]", virtualServiceName, err)
+	}
+	if resp == nil {
+		return nil, fmt.Errorf("unable to create virtual service [%s]: no response from VCD", virtualServiceName)
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, fmt.Errorf("unable to create virtual service; expected http response [%v], obtained [%v]",
+			http.StatusAccepted, resp.StatusCode)
 	}
 
 	taskURL := resp.Header.Get("Location")
-	task := govcd.NewTask(&client.VCDClient.Client)
-	task.Task.HREF = taskURL
-	if err = task.WaitTaskCompletion(); err != nil {
+	if err = client.waitForTask(ctx, taskURL, taskOperationCreate); err != nil {
 		return nil, fmt.Errorf("unable to create virtual service; creation task [%s] did not complete: [%v]",
 			taskURL, err)
 	}
@@ -1206,7 +1419,7 @@ func (client *Client) createVirtualService(ctx context.Context, virtualServiceNa
 			virtualServiceName, err)
 	}
 
-	if err = client.checkIfVirtualServiceIsPending(ctx, virtualServiceName); err != nil {
+	if err = client.waitForVirtualServiceNotPending(ctx, virtualServiceName); err != nil {
 		return nil, err
 	}
 
@@ -1239,29 +1452,34 @@ func (client *Client) deleteVirtualService(ctx context.Context, virtualServiceNa
 		return nil
 	}
 
-	err = client.checkIfVirtualServiceIsReady(ctx, virtualServiceName)
+	err = client.waitForVirtualServiceReady(ctx, virtualServiceName)
 	if err != nil {
 			// virtual service is busy
 			return err
 	}
 
-	resp, err := client.APIClient.EdgeGatewayLoadBalancerVirtualServiceApi.DeleteVirtualService(
-		ctx, vsSummary.Id)
-	if resp != nil && resp.StatusCode != http.StatusAccepted {
-		var responseMessageBytes []byte
-		if gsErr, ok := err.(swaggerClient.GenericSwaggerError); ok {
-			responseMessageBytes = gsErr.Body()
+	var resp *http.Response
+	err = client.retry(ctx, fmt.Sprintf("delete virtual service [%s]", virtualServiceName), func() (*http.Response, error) {
+		resp, err = client.APIClient.EdgeGatewayLoadBalancerVirtualServiceApi.DeleteVirtualService(
+			ctx, vsSummary.Id)
+		if err != nil {
+			return resp, NewVCDErrorFromSwagger(resp, err)
 		}
-		return fmt.Errorf("unable to delete virtual service [%s]; expected http response [%v], obtained [%v] with response [%v]",
-			vsSummary.Name, http.StatusAccepted, resp.StatusCode, string(responseMessageBytes))
-	} else if err != nil {
-		return fmt.Errorf("failed to delete virtual service [%s]: [%v]", vsSummary.Name, err)
+		return resp, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete virtual service [%s]: [%w]", vsSummary.Name, err)
+	}
+	if resp == nil {
+		return fmt.Errorf("unable to delete virtual service [%s]: no response from VCD", vsSummary.Name)
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("unable to delete virtual service [%s]; expected http response [%v], obtained [%v]",
+			vsSummary.Name, http.StatusAccepted, resp.StatusCode)
 	}
 
 	taskURL := resp.Header.Get("Location")
-	task := govcd.NewTask(&client.VCDClient.Client)
-	task.Task.HREF = taskURL
-	if err = task.WaitTaskCompletion(); err != nil {
+	if err = client.waitForTask(ctx, taskURL, taskOperationDelete); err != nil {
 		return fmt.Errorf("unable to delete virtual service; deletion task [%s] did not complete: [%v]",
 			taskURL, err)
 	}
@@ -1289,9 +1507,6 @@ type PortDetails struct {
 func (client *Client) CreateLoadBalancer(ctx context.Context, virtualServiceNamePrefix string,
 	lbPoolNamePrefix string, ips []string, portDetailsList []PortDetails) (string, error) {
 
-	client.RWLock.Lock()
-	defer client.RWLock.Unlock()
-
 	if len(portDetailsList) == 0 {
 		// nothing to do here
 		klog.Infof("There is no port specified. Hence nothing to do.")
@@ -1302,6 +1517,10 @@ func (client *Client) CreateLoadBalancer(ctx context.Context, virtualServiceName
 		return "", fmt.Errorf("gateway reference should not be nil")
 	}
 
+	// IPs picked below are reserved for this Service until the objects claiming them exist in VCD. Once this
+	// function returns they are either visible as used on the gateway or no longer needed.
+	defer client.ipReservations.release(client.gatewayRef.Id, virtualServiceNamePrefix)
+
 	// Separately loop through all DNAT rules to see if any exist, so that we can reuse the external IP in case a
 	// partial creation of load-balancer is continued and an externalIP was claimed earlier by a dnat rule
 	externalIP := ""
@@ -1332,7 +1551,7 @@ func (client *Client) CreateLoadBalancer(ctx context.Context, virtualServiceName
 	}
 
 	if externalIP == "" {
-		externalIP, err = client.getUnusedExternalIPAddress(ctx, client.IPAMSubnet)
+		externalIP, err = client.allocateExternalIPAddress(ctx, client.IPAMSubnet, virtualServiceNamePrefix)
 		if err != nil {
 			return "", fmt.Errorf("unable to get unused IP address from subnet [%s]: [%v]",
 				client.IPAMSubnet, err)
@@ -1362,7 +1581,7 @@ func (client *Client) CreateLoadBalancer(ctx context.Context, virtualServiceName
 			}
 
 			klog.V(3).Infof("LoadBalancer Virtual Service [%s] already exists", virtualServiceName)
-			if err = client.checkIfVirtualServiceIsPending(ctx, virtualServiceName); err != nil {
+			if err = client.waitForVirtualServiceNotPending(ctx, virtualServiceName); err != nil {
 				return "", err
 			}
 
@@ -1371,7 +1590,7 @@ func (client *Client) CreateLoadBalancer(ctx context.Context, virtualServiceName
 
 		virtualServiceIP := externalIP
 		if client.OneArm != nil {
-			internalIP, err := client.getUnusedInternalIPAddress(ctx)
+			internalIP, err := client.allocateInternalIPAddress(ctx, virtualServiceNamePrefix)
 			if err != nil {
 				return "", fmt.Errorf("unable to get internal IP address for one-arm mode: [%v]", err)
 			}
@@ -1389,7 +1608,7 @@ func (client *Client) CreateLoadBalancer(ctx context.Context, virtualServiceName
 			// If the rule already existed, the old DNAT rule will remain unchanged. Hence we get the old externalIP
 			// from the old rule and use it. What happens to the new externalIP that we selected above? It just remains
 			// unused and hence does not get allocated and disappears. Since there is no IPAM based resource
-			// _acquisition_, the new externalIP can just be forgotten about.
+			// _acquisition_, the new externalIP can just be forgotten about; its reservation is dropped on return.
 			dnatRuleRef, err := client.getNATRuleRef(ctx, dnatRuleName)
 			if err != nil {
 				return "", fmt.Errorf("unable to retrieve created dnat rule [%s]: [%v]", dnatRuleName, err)
@@ -1428,11 +1647,10 @@ func (client *Client) CreateLoadBalancer(ctx context.Context, virtualServiceName
 func (client *Client) UpdateLoadBalancer(ctx context.Context, lbPoolName string, virtualServiceName string,
 	ips []string, internalPort int32, externalPort int32) error {
 
-	client.RWLock.Lock()
-	defer client.RWLock.Unlock()
 	_, err := client.updateLoadBalancerPool(ctx, lbPoolName, ips, internalPort)
 	if err != nil {
-		if lbPoolBusyErr, ok := err.(*LoadBalancerPoolBusyError); ok {
+		var lbPoolBusyErr *LoadBalancerPoolBusyError
+		if errors.As(err, &lbPoolBusyErr) {
 			klog.Errorf("update loadbalancer pool failed; loadbalancer pool [%s] is busy: [%v]", lbPoolName, err)
 			return lbPoolBusyErr
 		}
@@ -1440,7 +1658,8 @@ func (client *Client) UpdateLoadBalancer(ctx context.Context, lbPoolName string,
 	}
 	err = client.updateVirtualServicePort(ctx, virtualServiceName, externalPort)
 	if err != nil {
-		if vsBusyErr, ok := err.(*VirtualServiceBusyError); ok {
+		var vsBusyErr *VirtualServiceBusyError
+		if errors.As(err, &vsBusyErr) {
 			klog.Errorf("update virtual service failed; virtual service [%s] is busy: [%v]", virtualServiceName, err)
 			return vsBusyErr
 		}
@@ -1470,9 +1689,6 @@ func (client *Client) UpdateLoadBalancer(ctx context.Context, lbPoolName string,
 func (client *Client) DeleteLoadBalancer(ctx context.Context, virtualServiceNamePrefix string,
 	lbPoolNamePrefix string, portDetailsList []PortDetails) error {
 
-	client.RWLock.Lock()
-	defer client.RWLock.Unlock()
-
 	// TODO: try to continue in case of errors
 	var err error
 
@@ -1514,7 +1730,8 @@ func (client *Client) DeleteLoadBalancer(ctx context.Context, virtualServiceName
 
 		err = client.deleteVirtualService(ctx, virtualServiceName, false, rdeVIP)
 		if err != nil {
-			if vsBusyErr, ok := err.(*VirtualServiceBusyError); ok {
+			var vsBusyErr *VirtualServiceBusyError
+			if errors.As(err, &vsBusyErr) {
 				klog.Errorf("delete virtual service failed; virtual service [%s] is busy: [%v]", virtualServiceName, err)
 				return vsBusyErr
 			}
@@ -1523,7 +1740,8 @@ func (client *Client) DeleteLoadBalancer(ctx context.Context, virtualServiceName
 
 		err = client.deleteLoadBalancerPool(ctx, lbPoolName, false)
 		if err != nil {
-			if lbPoolBusyErr, ok := err.(*LoadBalancerPoolBusyError); ok {
+			var lbPoolBusyErr *LoadBalancerPoolBusyError
+			if errors.As(err, &lbPoolBusyErr) {
 				klog.Errorf("delete loadbalancer pool failed; loadbalancer pool [%s] is busy: [%v]", lbPoolName, err)
 				return lbPoolBusyErr
 			}
@@ -6,11 +6,15 @@
 package vcdclient
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
 )
 
 func TestGetUnusedIPAddressInRange(t *testing.T) {
@@ -162,3 +166,160 @@ func TestGetCursor(t *testing.T) {
 
 	return
 }
+
+func TestIPReservations(t *testing.T) {
+
+	reservations := ipReservations{}
+	reservations.reserve("gateway-1", "1.2.3.4", "service-a")
+	reservations.reserve("gateway-1", "1.2.3.5", "service-b")
+	reservations.reserve("gateway-2", "1.2.3.6", "service-a")
+
+	usedIPs := map[string]bool{
+		"1.2.3.7": true,
+	}
+	reservations.addReservedIPs("gateway-1", usedIPs)
+	assert.Equal(t, map[string]bool{"1.2.3.4": true, "1.2.3.5": true, "1.2.3.7": true}, usedIPs,
+		"Reserved IPs of the gateway should be marked as used")
+
+	freeIP := getUnusedIPAddressInRange("1.2.3.4", "1.2.3.10", usedIPs)
+	assert.Equal(t, "1.2.3.6", freeIP, "Reserved IPs should not be handed out again")
+
+	reservations.release("gateway-1", "service-a")
+	usedIPs = make(map[string]bool)
+	reservations.addReservedIPs("gateway-1", usedIPs)
+	assert.Equal(t, map[string]bool{"1.2.3.5": true}, usedIPs,
+		"Only the reservations of the released owner should be dropped")
+
+	usedIPs = make(map[string]bool)
+	reservations.addReservedIPs("gateway-2", usedIPs)
+	assert.Equal(t, map[string]bool{"1.2.3.6": true}, usedIPs,
+		"Reservations on other gateways should be untouched")
+
+	return
+}
+
+func TestGetOVDCNetwork(t *testing.T) {
+
+	type TestCase struct {
+		NetworkNames  []string
+		NetworkOwners []string
+		RejectFilters bool
+		NetworkID     string
+		NumRequests   int
+		ExpectError   bool
+		ErrorComment  string
+	}
+
+	manyNetworkNames := make([]string, 0)
+	for idx := 0; idx < 100; idx++ {
+		manyNetworkNames = append(manyNetworkNames, fmt.Sprintf("net-%d", idx))
+	}
+	manyNetworkNames[40] = "net"
+
+	testCaseList := []TestCase{
+		{manyNetworkNames, nil, false, "network-40", 1, false, "Filtered network should take one request"},
+		{manyNetworkNames, nil, true, "network-40", 5, false, "Rejected filter should page through all networks"},
+		{[]string{"net", "net"}, []string{"vdc-2", "vdc-1"}, false, "network-1", 1, false,
+			"Network of the VDC should be chosen among networks with the same name"},
+		{[]string{"net", "net"}, []string{"vdc-2", "vdc-3"}, false, "", 1, true,
+			"Networks of other VDCs with the same name should be ambiguous"},
+		{[]string{"other"}, nil, false, "", 1, true, "Missing network should be an error"},
+	}
+
+	for _, testCase := range testCaseList {
+		fakeServer := &pagerTestServer{
+			networkNames:    testCase.NetworkNames,
+			networkOwners:   testCase.NetworkOwners,
+			rejectFilters:   testCase.RejectFilters,
+			reportPageCount: true,
+		}
+		server := httptest.NewServer(fakeServer)
+		client := newPagerTestClient(server.URL)
+		client.VDC = &govcd.Vdc{Vdc: &types.Vdc{ID: "vdc-1"}}
+
+		network, err := client.getOVDCNetwork(context.Background(), "net")
+		server.Close()
+
+		if testCase.ExpectError {
+			assert.Error(t, err, testCase.ErrorComment)
+		} else if assert.NoError(t, err, testCase.ErrorComment) {
+			assert.Equal(t, testCase.NetworkID, network.Id, testCase.ErrorComment)
+		}
+		assert.Equal(t, testCase.NumRequests, fakeServer.requests, testCase.ErrorComment)
+	}
+
+	return
+}
+
+func TestGetVirtualService(t *testing.T) {
+	fakeServer := &pagerTestServer{}
+	for idx := 0; idx < 60; idx++ {
+		fakeServer.vsIPs = append(fakeServer.vsIPs, fmt.Sprintf("10.0.0.%d", idx))
+	}
+	server := httptest.NewServer(fakeServer)
+	defer server.Close()
+	client := newPagerTestClient(server.URL)
+
+	vsSummary, err := client.getVirtualService(context.Background(), "vs-50")
+	assert.NoError(t, err, "Filtered virtual service should be found")
+	if assert.NotNil(t, vsSummary, "Virtual service should be returned") {
+		assert.Equal(t, "vs-id-50", vsSummary.Id, "Unexpected virtual service found")
+	}
+	assert.Equal(t, []string{"name==vs-50"}, fakeServer.filters, "Name should be filtered by VCD")
+
+	fakeServer.rejectFilters, fakeServer.requests = true, 0
+	vsSummary, err = client.getVirtualService(context.Background(), "vs-50")
+	assert.NoError(t, err, "Virtual service should be found when the filter is rejected")
+	if assert.NotNil(t, vsSummary, "Virtual service should be returned") {
+		assert.Equal(t, "vs-id-50", vsSummary.Id, "Unexpected virtual service found")
+	}
+	assert.Equal(t, 4, fakeServer.requests, "Rejected filter should page until the virtual service")
+
+	vsSummary, err = client.getVirtualService(context.Background(), "absent")
+	assert.NoError(t, err, "Missing virtual service is not an error")
+	assert.Nil(t, vsSummary, "Missing virtual service should not be found")
+
+	return
+}
+
+func TestGetUnusedInternalIPAddress(t *testing.T) {
+
+	type TestCase struct {
+		NumUsedIPs    int
+		ReservedIPs   []string
+		RejectFilters bool
+		FreeIP        string
+		NumRequests   int
+		ErrorComment  string
+	}
+
+	testCaseList := []TestCase{
+		{0, nil, false, "10.0.0.0", 1, "First IP of an empty range should be probed"},
+		{30, nil, false, "10.0.0.30", 2, "Second probe should find the IP after the used ones"},
+		{3, []string{"10.0.0.3"}, false, "10.0.0.4", 1, "Reserved IPs should be skipped"},
+		{30, nil, true, "10.0.0.30", 3, "Rejected filter should list all virtual services"},
+		{240, nil, false, "10.0.0.240", 8 + 10, "Failed probes should list all virtual services"},
+	}
+
+	for _, testCase := range testCaseList {
+		fakeServer := &pagerTestServer{rejectFilters: testCase.RejectFilters}
+		for idx := 0; idx < testCase.NumUsedIPs; idx++ {
+			fakeServer.vsIPs = append(fakeServer.vsIPs, fmt.Sprintf("10.0.0.%d", idx))
+		}
+		server := httptest.NewServer(fakeServer)
+		client := newPagerTestClient(server.URL)
+		client.OneArm = &OneArm{StartIPAddress: "10.0.0.0", EndIPAddress: "10.0.0.250"}
+		for _, ip := range testCase.ReservedIPs {
+			client.ipReservations.reserve("gateway-1", ip, "service")
+		}
+
+		freeIP, err := client.getUnusedInternalIPAddress(context.Background())
+		server.Close()
+
+		assert.NoError(t, err, testCase.ErrorComment)
+		assert.Equal(t, testCase.FreeIP, freeIP, testCase.ErrorComment)
+		assert.Equal(t, testCase.NumRequests, fakeServer.requests, testCase.ErrorComment)
+	}
+
+	return
+}
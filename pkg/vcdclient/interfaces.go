@@ -0,0 +1,84 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"context"
+)
+
+// VM is a VM of the cluster, independent of how it was read from the inventory
+type VM struct {
+	// ID is the id of the VM, such as urn:vcloud:vm:<uuid>
+	ID   string
+	HREF string
+	Name string
+	// Status is the name of the status of the VM, such as POWERED_ON
+	Status string
+	// MaintenanceMode is only known for VMs returned by ListVMs
+	MaintenanceMode bool
+	// IPAddresses are the IPs of the network connections of the VM. VMs returned by ListVMs only have the IP of
+	// their primary network connection.
+	IPAddresses []string
+}
+
+// LoadBalancerBackend creates, updates, deletes and gets the load balancers of Services on a load balancer target.
+// Each port of a Service has a pool named lbPoolNamePrefix-<port> and a virtual service named
+// virtualServiceNamePrefix-<port>.
+type LoadBalancerBackend interface {
+	// CreateLoadBalancer creates the pools and virtual services of portDetailsList with ips as pool members and
+	// returns the external IP of the load balancer. Parts that already exist are kept.
+	CreateLoadBalancer(ctx context.Context, virtualServiceNamePrefix string, lbPoolNamePrefix string,
+		ips []string, portDetailsList []PortDetails) (string, error)
+	// UpdateLoadBalancer sets the members of a pool to ips and the ports of the pool and its virtual service
+	UpdateLoadBalancer(ctx context.Context, lbPoolName string, virtualServiceName string, ips []string,
+		internalPort int32, externalPort int32) error
+	// DeleteLoadBalancer deletes the pools and virtual services of portDetailsList that exist
+	DeleteLoadBalancer(ctx context.Context, virtualServiceNamePrefix string, lbPoolNamePrefix string,
+		portDetailsList []PortDetails) error
+	// GetLoadBalancer returns the external IP of a virtual service, or an empty string if it does not exist yet
+	GetLoadBalancer(ctx context.Context, virtualServiceName string) (string, error)
+}
+
+// LoadBalancerBackends returns the load balancer backends of the load balancer targets
+type LoadBalancerBackends interface {
+	// LoadBalancerBackend returns the backend of the named target, or of the default target if name is empty
+	LoadBalancerBackend(ctx context.Context, name string) (LoadBalancerBackend, error)
+	// LBTargetNames returns the names of all load balancer targets, sorted
+	LBTargetNames() []string
+}
+
+// VMInventory finds the VMs of the cluster. VMs that are not found yield an error for which
+// errors.Is(err, ErrNotFound) holds, and names used by several VMs a DuplicateVMNameError.
+type VMInventory interface {
+	FindVMByName(name string) (*VM, error)
+	// FindVMByUUID finds a VM by its uuid, with or without the VCDVMIDPrefix
+	FindVMByUUID(uuid string) (*VM, error)
+	FindVMByComputerName(computerName string) (*VM, error)
+	// FindVMByMetadata finds the VM whose metadata key has the string value
+	FindVMByMetadata(key string, value string) (*VM, error)
+	// ListVMs lists all VMs of the cluster with their status
+	ListVMs() ([]*VM, error)
+}
+
+// VMMetadata reads and writes the metadata of VMs
+type VMMetadata interface {
+	// GetVMMetadata returns the metadata entries of the VM at vmHREF by key
+	GetVMMetadata(vmHREF string) (map[string]string, error)
+	// SetVMMetadata makes the entries of the VM at vmHREF in domain, GENERAL or SYSTEM, whose keys start with
+	// prefix the entries, and returns true if the metadata of the VM was changed
+	SetVMMetadata(ctx context.Context, vmHREF string, domain string, prefix string,
+		entries map[string]string) (bool, error)
+}
+
+// RDEStore keeps the virtual IPs of the load balancers of the cluster in its RDE. Clusters without an RDE have no
+// virtual IPs, and adding or removing them does nothing.
+type RDEStore interface {
+	GetVirtualIPs(ctx context.Context) ([]string, error)
+	// AddVirtualIP adds ip unless the RDE already has it
+	AddVirtualIP(ctx context.Context, ip string) error
+	// RemoveVirtualIP removes ip if the RDE has it
+	RemoveVirtualIP(ctx context.Context, ip string) error
+}
@@ -0,0 +1,64 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"sync"
+)
+
+// ipReservations tracks IP addresses that have been handed out by this process but may not yet be
+// visible as used on the gateway, because the VCD object claiming them is still being created. This
+// prevents two Services that are reconciled in parallel from picking the same free IP.
+type ipReservations struct {
+	rwLock sync.RWMutex
+	// gateway ID => IP address => owner
+	reserved map[string]map[string]string
+}
+
+// reserve marks ip on the gateway as taken by owner.
+func (r *ipReservations) reserve(gatewayID string, ip string, owner string) {
+	r.rwLock.Lock()
+	defer r.rwLock.Unlock()
+
+	if r.reserved == nil {
+		r.reserved = make(map[string]map[string]string)
+	}
+	gatewayIPs, ok := r.reserved[gatewayID]
+	if !ok {
+		gatewayIPs = make(map[string]string)
+		r.reserved[gatewayID] = gatewayIPs
+	}
+	gatewayIPs[ip] = owner
+}
+
+// release drops every reservation held by owner on the gateway.
+func (r *ipReservations) release(gatewayID string, owner string) {
+	r.rwLock.Lock()
+	defer r.rwLock.Unlock()
+
+	gatewayIPs, ok := r.reserved[gatewayID]
+	if !ok {
+		return
+	}
+	for ip, currOwner := range gatewayIPs {
+		if currOwner == owner {
+			delete(gatewayIPs, ip)
+		}
+	}
+	if len(gatewayIPs) == 0 {
+		delete(r.reserved, gatewayID)
+	}
+}
+
+// addReservedIPs adds the IPs reserved on the gateway to usedIPs.
+func (r *ipReservations) addReservedIPs(gatewayID string, usedIPs map[string]bool) {
+	r.rwLock.RLock()
+	defer r.rwLock.RUnlock()
+
+	for ip := range r.reserved[gatewayID] {
+		usedIPs[ip] = true
+	}
+}
@@ -0,0 +1,209 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	swaggerClient "github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdswaggerclient"
+	"k8s.io/klog"
+)
+
+const (
+	// DefaultLBTargetName : name of the target formed by the network, vip subnet and one-arm range of the cluster
+	DefaultLBTargetName = "default"
+
+	// lbTargetRefreshInterval is how long cached gateway details of a target are used before they are refreshed
+	lbTargetRefreshInterval = 10 * time.Minute
+)
+
+// LBTarget : an Org VDC network whose edge gateway hosts the load balancers of the Services that select it
+type LBTarget struct {
+	Name        string
+	NetworkName string
+	IPAMSubnet  string
+	OneArm      *OneArm
+	// ServiceEngineGroup is the name of the service engine group used for virtual services. If it is empty,
+	// any group assigned to the gateway that has capacity is used.
+	ServiceEngineGroup string
+}
+
+// lbTargetState : gateway details of a target, which are cached and refreshed independently of other targets
+type lbTargetState struct {
+	target LBTarget
+
+	rwLock             sync.RWMutex
+	gatewayRef         *swaggerClient.EntityReference
+	networkBackingType swaggerClient.BackingNetworkType
+	refreshedAt        time.Time
+}
+
+// lbTargets : targets of a client, shared with the copies of the client scoped to a target
+type lbTargets struct {
+	defaultName string
+	states      map[string]*lbTargetState
+}
+
+func newLBTargets(targets []LBTarget, defaultName string) (*lbTargets, error) {
+	if defaultName == "" {
+		defaultName = DefaultLBTargetName
+	}
+	lbTargetMap := &lbTargets{
+		defaultName: defaultName,
+		states:      make(map[string]*lbTargetState),
+	}
+	for _, target := range targets {
+		if _, ok := lbTargetMap.states[target.Name]; ok {
+			return nil, fmt.Errorf("load balancer target [%s] is defined more than once", target.Name)
+		}
+		lbTargetMap.states[target.Name] = &lbTargetState{
+			target: target,
+		}
+	}
+	if _, ok := lbTargetMap.states[defaultName]; !ok {
+		return nil, fmt.Errorf("default load balancer target [%s] is not defined", defaultName)
+	}
+
+	return lbTargetMap, nil
+}
+
+func (lbTargetMap *lbTargets) get(name string) (*lbTargetState, error) {
+	if name == "" {
+		name = lbTargetMap.defaultName
+	}
+	state, ok := lbTargetMap.states[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown load balancer target [%s]", name)
+	}
+
+	return state, nil
+}
+
+// getGatewayDetails returns the gateway and backing type of the gateway of networkName
+func (client *Client) getGatewayDetails(ctx context.Context, networkName string) (*swaggerClient.EntityReference,
+	swaggerClient.BackingNetworkType, error) {
+
+	var networkBackingType swaggerClient.BackingNetworkType
+	ovdcNetwork, err := client.getOVDCNetwork(ctx, networkName)
+	if err != nil {
+		return nil, networkBackingType, fmt.Errorf("unable to get OVDC network [%s]: [%v]", networkName, err)
+	}
+
+	if ovdcNetwork.BackingNetworkType != nil {
+		networkBackingType = *ovdcNetwork.BackingNetworkType
+	}
+	if ovdcNetwork.Connection == nil || ovdcNetwork.Connection.RouterRef == nil {
+		klog.Infof("Gateway for Network Name [%s] is of type [%v]\n", networkName, networkBackingType)
+		return nil, networkBackingType, nil
+	}
+
+	gatewayRef := &swaggerClient.EntityReference{
+		Name: ovdcNetwork.Connection.RouterRef.Name,
+		Id:   ovdcNetwork.Connection.RouterRef.Id,
+	}
+	klog.Infof("Obtained Gateway [%s] for Network Name [%s] of type [%v]\n",
+		gatewayRef.Name, networkName, networkBackingType)
+
+	return gatewayRef, networkBackingType, nil
+}
+
+// refreshLBTarget fetches the gateway details of the target. If that fails, details cached earlier are kept.
+func (client *Client) refreshLBTarget(ctx context.Context, state *lbTargetState) error {
+	gatewayRef, networkBackingType, err := client.getGatewayDetails(ctx, state.target.NetworkName)
+	if err != nil {
+		return fmt.Errorf("unable to get gateway of load balancer target [%s]: [%v]", state.target.Name, err)
+	}
+
+	state.rwLock.Lock()
+	defer state.rwLock.Unlock()
+	state.gatewayRef = gatewayRef
+	state.networkBackingType = networkBackingType
+	state.refreshedAt = time.Now()
+
+	return nil
+}
+
+// RefreshLBTargets : refreshes the gateway details of every load balancer target. A target that cannot be
+// refreshed does not affect the others; all failures are returned together.
+func (client *Client) RefreshLBTargets(ctx context.Context) error {
+	if client.lbTargets == nil {
+		return fmt.Errorf("client has no load balancer targets")
+	}
+
+	failedTargets := make([]string, 0)
+	for name, state := range client.lbTargets.states {
+		if err := client.refreshLBTarget(ctx, state); err != nil {
+			klog.Errorf("%v", err)
+			failedTargets = append(failedTargets, name)
+		}
+	}
+	if len(failedTargets) > 0 {
+		sort.Strings(failedTargets)
+		return fmt.Errorf("unable to refresh load balancer targets [%v]", failedTargets)
+	}
+
+	return nil
+}
+
+// LBTargetNames : returns the names of the load balancer targets of the client
+func (client *Client) LBTargetNames() []string {
+	names := make([]string, 0)
+	if client.lbTargets == nil {
+		return names
+	}
+	for name := range client.lbTargets.states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ForLBTarget : returns a copy of the client that creates load balancers on the network and gateway of the named
+// target, or of the default target if name is empty. Gateway details older than the refresh interval are
+// refreshed first.
+func (client *Client) ForLBTarget(ctx context.Context, name string) (*Client, error) {
+	if client.lbTargets == nil {
+		return nil, fmt.Errorf("client has no load balancer targets")
+	}
+	state, err := client.lbTargets.get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	state.rwLock.RLock()
+	stale := time.Since(state.refreshedAt) > lbTargetRefreshInterval
+	state.rwLock.RUnlock()
+	if stale {
+		if err = client.refreshLBTarget(ctx, state); err != nil {
+			state.rwLock.RLock()
+			cached := !state.refreshedAt.IsZero()
+			state.rwLock.RUnlock()
+			if !cached {
+				return nil, err
+			}
+			klog.Warningf("Using cached gateway details: [%v]", err)
+		}
+	}
+
+	scopedClient := *client
+	scopedClient.lbTargetName = state.target.Name
+	scopedClient.networkName = state.target.NetworkName
+	scopedClient.IPAMSubnet = state.target.IPAMSubnet
+	scopedClient.OneArm = state.target.OneArm
+	scopedClient.serviceEngineGroup = state.target.ServiceEngineGroup
+
+	state.rwLock.RLock()
+	scopedClient.gatewayRef = state.gatewayRef
+	scopedClient.networkBackingType = state.networkBackingType
+	state.rwLock.RUnlock()
+
+	return &scopedClient, nil
+}
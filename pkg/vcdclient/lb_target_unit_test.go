@@ -0,0 +1,87 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	swaggerClient "github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdswaggerclient"
+)
+
+func TestNewLBTargets(t *testing.T) {
+
+	type TestCase struct {
+		Targets     []LBTarget
+		DefaultName string
+		ExpectError bool
+	}
+
+	testCaseList := []TestCase{
+		{[]LBTarget{{Name: DefaultLBTargetName}}, "", false},
+		{[]LBTarget{{Name: DefaultLBTargetName}, {Name: "dmz"}}, "dmz", false},
+		{[]LBTarget{{Name: "dmz"}}, "", true},
+		{[]LBTarget{{Name: DefaultLBTargetName}}, "dmz", true},
+		{[]LBTarget{{Name: DefaultLBTargetName}, {Name: "dmz"}, {Name: "dmz"}}, "", true},
+	}
+
+	for _, tc := range testCaseList {
+		_, err := newLBTargets(tc.Targets, tc.DefaultName)
+		if tc.ExpectError {
+			assert.Error(t, err, "Expected error for targets [%v] with default [%s]", tc.Targets, tc.DefaultName)
+		} else {
+			assert.NoError(t, err, "Unexpected error for targets [%v] with default [%s]", tc.Targets, tc.DefaultName)
+		}
+	}
+
+	return
+}
+
+func TestForLBTarget(t *testing.T) {
+	dmzOneArm := &OneArm{StartIPAddress: "192.168.9.2", EndIPAddress: "192.168.9.100"}
+	lbTargetMap, err := newLBTargets([]LBTarget{
+		{Name: DefaultLBTargetName, NetworkName: "internal-network", IPAMSubnet: "10.1.0.0/24"},
+		{Name: "dmz", NetworkName: "dmz-network", IPAMSubnet: "10.2.0.0/24", OneArm: dmzOneArm,
+			ServiceEngineGroup: "dmz-seg"},
+	}, "")
+	assert.NoError(t, err, "Unable to create load balancer targets")
+
+	// the gateways are cached already, so that no VCD is needed
+	for name, gatewayID := range map[string]string{DefaultLBTargetName: "gateway-internal", "dmz": "gateway-dmz"} {
+		lbTargetMap.states[name].gatewayRef = &swaggerClient.EntityReference{Id: gatewayID, Name: gatewayID}
+		lbTargetMap.states[name].networkBackingType = swaggerClient.NSXT_FLEXIBLE_SEGMENT_BackingNetworkType
+		lbTargetMap.states[name].refreshedAt = time.Now()
+	}
+
+	client := &Client{
+		networkName: "internal-network",
+		lbTargets:   lbTargetMap,
+	}
+	assert.Equal(t, []string{DefaultLBTargetName, "dmz"}, client.LBTargetNames(), "Unexpected target names")
+
+	ctx := context.Background()
+	dmzClient, err := client.ForLBTarget(ctx, "dmz")
+	assert.NoError(t, err, "Unable to scope client to target [dmz]")
+	assert.Equal(t, "dmz-network", dmzClient.networkName, "Unexpected network of scoped client")
+	assert.Equal(t, "10.2.0.0/24", dmzClient.IPAMSubnet, "Unexpected vip subnet of scoped client")
+	assert.Equal(t, dmzOneArm, dmzClient.OneArm, "Unexpected one arm of scoped client")
+	assert.Equal(t, "dmz-seg", dmzClient.serviceEngineGroup, "Unexpected service engine group of scoped client")
+	assert.Equal(t, "gateway-dmz", dmzClient.gatewayRef.Id, "Unexpected gateway of scoped client")
+	assert.True(t, dmzClient.IsNSXTBackedGateway(), "Scoped client should use the backing type of its target")
+	assert.Equal(t, "internal-network", client.networkName, "Scoping should not modify the client")
+
+	defaultClient, err := client.ForLBTarget(ctx, "")
+	assert.NoError(t, err, "Unable to scope client to default target")
+	assert.Equal(t, "gateway-internal", defaultClient.gatewayRef.Id, "Empty name should select the default target")
+	assert.Nil(t, defaultClient.OneArm, "Default target has no one arm")
+
+	_, err = client.ForLBTarget(ctx, "unknown")
+	assert.Error(t, err, "Unknown target should be rejected")
+
+	return
+}
@@ -0,0 +1,167 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/antihax/optional"
+	"github.com/peterhellberg/link"
+	"k8s.io/klog"
+)
+
+// errStopPaging is returned by a page function to end the iteration early, typically because the item looked for
+// has been found. It is not returned by the pager.
+var errStopPaging = errors.New("stop paging")
+
+// pageFunc fetches and visits page number page, of pageSize items matching the FIQL filter, of a page based list
+// API. The filter is unset if there is none. It returns the number of items on the page and the number of pages
+// reported by VCD, or 0 if VCD did not report it.
+type pageFunc func(ctx context.Context, page int32, pageSize int32, filter optional.String) (int, int32, error)
+
+// cursorPageFunc fetches and visits the page at cursor, of pageSize items matching the FIQL filter, of a cursor
+// based list API. The cursor is unset for the first page. It returns the number of items on the page and the
+// response, whose Link header has the cursor of the next page.
+type cursorPageFunc func(ctx context.Context, cursor optional.String, pageSize int32,
+	filter optional.String) (int, *http.Response, error)
+
+// pager iterates over the pages of a VCD list API, either by page number or by the cursors that VCD returns in
+// the Link header. Iteration ends after the last page, when a page function returns errStopPaging, or when ctx is
+// done.
+type pager struct {
+	pageSize int32
+	filter   optional.String
+
+	// scanOnRejectedFilter makes the pager page through all items if VCD rejects the filter
+	scanOnRejectedFilter bool
+}
+
+// newPager creates a pager that fetches pageSize items per page, matching the FIQL filter unless it is empty
+func newPager(pageSize int32, filter string) *pager {
+	p := &pager{
+		pageSize: pageSize,
+		filter:   optional.EmptyString(),
+	}
+	if filter != "" {
+		p.filter = optional.NewString(filter)
+	}
+
+	return p
+}
+
+// withScanFallback makes p page through all items if VCD rejects its filter, which may be on a property that
+// older VCD versions cannot filter by. The page function must then check every item itself.
+func (p *pager) withScanFallback() *pager {
+	p.scanOnRejectedFilter = true
+	return p
+}
+
+// forEachPage calls fn for every page of a page based list API, from the first page up to the last page reported
+// by VCD, or up to the first empty page if VCD reports no page count.
+func (p *pager) forEachPage(ctx context.Context, fn pageFunc) error {
+	err := p.forEachPageWithFilter(ctx, fn, p.filter)
+	if p.scanOnRejectedFilter && p.filter.IsSet() && isFilterRejected(err) {
+		klog.Infof("VCD rejected filter [%s], paging through all items instead: [%v]", p.filter.Value(), err)
+		err = p.forEachPageWithFilter(ctx, fn, optional.EmptyString())
+	}
+
+	return err
+}
+
+func (p *pager) forEachPageWithFilter(ctx context.Context, fn pageFunc, filter optional.String) error {
+	for page := int32(1); ; page++ {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("stopped paging before page [%d]: [%w]", page, err)
+		}
+
+		count, pageCount, err := fn(ctx, page, p.pageSize, filter)
+		if errors.Is(err, errStopPaging) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if count == 0 || (pageCount > 0 && page >= pageCount) {
+			return nil
+		}
+	}
+}
+
+// forEachCursorPage calls fn for every page of a cursor based list API, until a page is empty or has no cursor
+// to a next page
+func (p *pager) forEachCursorPage(ctx context.Context, fn cursorPageFunc) error {
+	cursor := optional.EmptyString()
+	for page := 1; ; page++ {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("stopped paging before page [%d]: [%w]", page, err)
+		}
+
+		count, resp, err := fn(ctx, cursor, p.pageSize, p.filter)
+		if errors.Is(err, errStopPaging) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return nil
+		}
+
+		cursorStr, err := getCursor(resp)
+		if err != nil {
+			return fmt.Errorf("unable to get cursor of page [%d]: [%v]", page+1, err)
+		}
+		if cursorStr == "" {
+			return nil
+		}
+		cursor = optional.NewString(cursorStr)
+	}
+}
+
+// getCursor returns the cursor of the next page from the nextPage link in the Link header of resp, or an empty
+// string if there is no next page
+func getCursor(resp *http.Response) (string, error) {
+	if resp == nil {
+		return "", nil
+	}
+
+	cursorURI := ""
+	for _, linklet := range resp.Header["Link"] {
+		for _, l := range link.Parse(linklet) {
+			if l.Rel == "nextPage" {
+				cursorURI = l.URI
+				break
+			}
+		}
+		if cursorURI != "" {
+			break
+		}
+	}
+	if cursorURI == "" {
+		return "", nil
+	}
+
+	u, err := url.Parse(cursorURI)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse cursor URI [%s]: [%v]", cursorURI, err)
+	}
+
+	cursorStr := ""
+	keyMap, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse raw query [%s]: [%v]", u.RawQuery, err)
+	}
+
+	if cursorStrList, ok := keyMap["cursor"]; ok {
+		cursorStr = cursorStrList[0]
+	}
+
+	return cursorStr, nil
+}
@@ -0,0 +1,271 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/antihax/optional"
+	"github.com/stretchr/testify/assert"
+	swaggerClient "github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdswaggerclient"
+)
+
+// pagerTestServer is a fake VCD that lists networks and virtual services by page number and NAT rules by cursor.
+// It supports FIQL filters of == comparisons joined by , or ; unless it rejects all filters.
+type pagerTestServer struct {
+	networkNames    []string
+	networkOwners   []string
+	natRuleNames    []string
+	vsIPs           []string
+	reportPageCount bool
+	rejectFilters   bool
+
+	// requests counts the list requests, and filters records the FIQL filters sent with them
+	requests int
+	filters  []string
+}
+
+func (server *pagerTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	query := r.URL.Query()
+	pageSize, _ := strconv.Atoi(query.Get("pageSize"))
+
+	page, _ := strconv.Atoi(query.Get("page"))
+	filter := query.Get("filter")
+	if r.URL.Path == "/cloudapi/1.0.0/orgVdcNetworks" || strings.HasSuffix(r.URL.Path, "/virtualServiceSummaries") ||
+		strings.HasSuffix(r.URL.Path, "/nat/rules") {
+		server.requests++
+		server.filters = append(server.filters, filter)
+	}
+	if filter != "" && server.rejectFilters {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprint(w, `{"minorErrorCode":"BAD_REQUEST","message":"invalid filter"}`)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/cloudapi/1.0.0/orgVdcNetworks":
+		if filter == "name==missing" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, `{"minorErrorCode":"NOT_FOUND","message":"no such network"}`)
+			return
+		}
+		matching := make([]swaggerClient.VdcNetwork, 0)
+		for idx, name := range server.networkNames {
+			network := swaggerClient.VdcNetwork{Id: fmt.Sprintf("network-%d", idx), Name: name}
+			if idx < len(server.networkOwners) {
+				network.OwnerRef = &swaggerClient.EntityReference{Id: server.networkOwners[idx]}
+			}
+			if matchesTestFilter(filter, map[string]string{"name": name}) {
+				matching = append(matching, network)
+			}
+		}
+		networks := swaggerClient.VdcNetworks{Page: int32(page), PageSize: int32(pageSize)}
+		for idx := (page - 1) * pageSize; idx < page*pageSize && idx < len(matching); idx++ {
+			networks.Values = append(networks.Values, matching[idx])
+		}
+		if server.reportPageCount {
+			networks.PageCount = int32((len(matching) + pageSize - 1) / pageSize)
+		}
+		_ = json.NewEncoder(w).Encode(networks)
+
+	case r.URL.Path == "/cloudapi/1.0.0/edgeGateways/gateway-1/loadBalancer/virtualServiceSummaries":
+		matching := make([]swaggerClient.EdgeLoadBalancerVirtualServiceSummary, 0)
+		for idx, ip := range server.vsIPs {
+			name := fmt.Sprintf("vs-%d", idx)
+			if matchesTestFilter(filter, map[string]string{"name": name, "virtualIpAddress": ip}) {
+				matching = append(matching, swaggerClient.EdgeLoadBalancerVirtualServiceSummary{
+					Id:               fmt.Sprintf("vs-id-%d", idx),
+					Name:             name,
+					VirtualIpAddress: ip,
+				})
+			}
+		}
+		summaries := swaggerClient.EdgeLoadBalancerVirtualServiceSummaries{}
+		for idx := (page - 1) * pageSize; idx < page*pageSize && idx < len(matching); idx++ {
+			summaries.Values = append(summaries.Values, matching[idx])
+		}
+		summaries.PageCount = int32((len(matching) + pageSize - 1) / pageSize)
+		_ = json.NewEncoder(w).Encode(summaries)
+
+	case strings.HasPrefix(r.URL.Path, "/cloudapi/1.0.0/orgVdcNetworks/"):
+		id := strings.TrimPrefix(r.URL.Path, "/cloudapi/1.0.0/orgVdcNetworks/")
+		_ = json.NewEncoder(w).Encode(swaggerClient.VdcNetwork{Id: id})
+
+	case r.URL.Path == "/cloudapi/1.0.0/edgeGateways/gateway-1/nat/rules":
+		offset, _ := strconv.Atoi(query.Get("cursor"))
+		rules := swaggerClient.EdgeNatRules{}
+		for idx := offset; idx < offset+pageSize && idx < len(server.natRuleNames); idx++ {
+			rules.Values = append(rules.Values, swaggerClient.EdgeNatRule{
+				Id:   fmt.Sprintf("rule-%d", idx),
+				Name: server.natRuleNames[idx],
+			})
+		}
+		if offset+pageSize < len(server.natRuleNames) {
+			w.Header().Add("Link", fmt.Sprintf(`<%s?cursor=%d>;rel="nextPage";type="application/json"`,
+				r.URL.Path, offset+pageSize))
+		}
+		_ = json.NewEncoder(w).Encode(rules)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// matchesTestFilter returns true if the item with properties matches the FIQL filter, which may only have ==
+// comparisons joined by either , or ;
+func matchesTestFilter(filter string, properties map[string]string) bool {
+	if filter == "" {
+		return true
+	}
+	separator, matchAll := ",", false
+	if strings.Contains(filter, ";") {
+		separator, matchAll = ";", true
+	}
+	for _, comparison := range strings.Split(filter, separator) {
+		parts := strings.SplitN(comparison, "==", 2)
+		matches := len(parts) == 2 && properties[parts[0]] == parts[1]
+		if matches != matchAll {
+			return matches
+		}
+	}
+
+	return matchAll
+}
+
+func newPagerTestClient(serverURL string) *Client {
+	swaggerConfig := swaggerClient.NewConfiguration()
+	swaggerConfig.BasePath = fmt.Sprintf("%s/cloudapi", serverURL)
+
+	return &Client{
+		APIClient:      swaggerClient.NewAPIClient(swaggerConfig),
+		gatewayRef:     &swaggerClient.EntityReference{Name: "gateway", Id: "gateway-1"},
+		ipReservations: &ipReservations{},
+	}
+}
+
+// listNetworkNames lists the names of the networks of client with p, stopping after stopAt if it is set
+func listNetworkNames(ctx context.Context, client *Client, p *pager, stopAt string) ([]string, error) {
+	names := make([]string, 0)
+	err := p.forEachPage(ctx, func(ctx context.Context, page int32, pageSize int32,
+		filter optional.String) (int, int32, error) {
+		networks, resp, err := client.APIClient.OrgVdcNetworksApi.GetAllVdcNetworks(ctx, page, pageSize,
+			&swaggerClient.OrgVdcNetworksApiGetAllVdcNetworksOpts{
+				Filter: filter,
+			})
+		if err != nil {
+			return 0, 0, NewVCDErrorFromSwagger(resp, err)
+		}
+		for _, network := range networks.Values {
+			names = append(names, network.Name)
+			if network.Name == stopAt {
+				return 0, 0, errStopPaging
+			}
+		}
+
+		return len(networks.Values), networks.PageCount, nil
+	})
+
+	return names, err
+}
+
+func TestPagerPages(t *testing.T) {
+
+	type TestCase struct {
+		NumNetworks     int
+		PageSize        int32
+		ReportPageCount bool
+		StopAt          string
+		NumNames        int
+		NumRequests     int
+		ErrorComment    string
+	}
+
+	testCaseList := []TestCase{
+		{5, 2, true, "", 5, 3, "Pages up to the reported page count"},
+		{4, 2, true, "", 4, 2, "Full last page should end paging with a page count"},
+		{4, 2, false, "", 4, 3, "Pages up to an empty page without a page count"},
+		{0, 2, true, "", 0, 1, "No networks should take one request"},
+		{7, 2, true, "net-2", 3, 2, "Stopping should not fetch further pages"},
+		{7, 2, false, "net-0", 1, 1, "Stopping on the first page should take one request"},
+	}
+
+	for _, testCase := range testCaseList {
+		fakeServer := &pagerTestServer{reportPageCount: testCase.ReportPageCount}
+		for idx := 0; idx < testCase.NumNetworks; idx++ {
+			fakeServer.networkNames = append(fakeServer.networkNames, fmt.Sprintf("net-%d", idx))
+		}
+		server := httptest.NewServer(fakeServer)
+
+		names, err := listNetworkNames(context.Background(), newPagerTestClient(server.URL),
+			newPager(testCase.PageSize, ""), testCase.StopAt)
+		server.Close()
+
+		assert.NoError(t, err, testCase.ErrorComment)
+		assert.Equal(t, testCase.NumNames, len(names), testCase.ErrorComment)
+		assert.Equal(t, testCase.NumRequests, fakeServer.requests, testCase.ErrorComment)
+	}
+
+	return
+}
+
+func TestPagerFilterAndErrors(t *testing.T) {
+	fakeServer := &pagerTestServer{networkNames: []string{"net-0"}, reportPageCount: true}
+	server := httptest.NewServer(fakeServer)
+	defer server.Close()
+	client := newPagerTestClient(server.URL)
+
+	_, err := listNetworkNames(context.Background(), client, newPager(2, "name==net-0"), "")
+	assert.NoError(t, err, "Filtered listing should succeed")
+	_, err = listNetworkNames(context.Background(), client, newPager(2, ""), "")
+	assert.NoError(t, err, "Unfiltered listing should succeed")
+	assert.Equal(t, []string{"name==net-0", ""}, fakeServer.filters, "Filter should only be sent when set")
+
+	_, err = listNetworkNames(context.Background(), client, newPager(2, "name==missing"), "")
+	assert.True(t, errors.Is(err, ErrNotFound), "Error of a page should keep its kind: [%v]", err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fakeServer.requests = 0
+	_, err = listNetworkNames(ctx, client, newPager(2, ""), "")
+	assert.True(t, errors.Is(err, context.Canceled), "Cancelled context should stop paging: [%v]", err)
+	assert.Equal(t, 0, fakeServer.requests, "Cancelled context should not fetch pages")
+
+	return
+}
+
+func TestPagerCursorPages(t *testing.T) {
+	fakeServer := &pagerTestServer{}
+	for idx := 0; idx < 300; idx++ {
+		fakeServer.natRuleNames = append(fakeServer.natRuleNames, fmt.Sprintf("rule-%d", idx))
+	}
+	server := httptest.NewServer(fakeServer)
+	defer server.Close()
+	client := newPagerTestClient(server.URL)
+
+	natRuleRef, err := client.getNATRuleRef(context.Background(), "rule-200")
+	assert.NoError(t, err, "Listing nat rules should succeed")
+	if assert.NotNil(t, natRuleRef, "Rule on the second page should be found") {
+		assert.Equal(t, "rule-200", natRuleRef.ID, "Unexpected rule found")
+	}
+	assert.Equal(t, 2, fakeServer.requests, "Paging should stop at the page with the rule")
+
+	fakeServer.requests = 0
+	natRuleRef, err = client.getNATRuleRef(context.Background(), "absent")
+	assert.NoError(t, err, "Missing rule is not an error")
+	assert.Nil(t, natRuleRef, "Missing rule should not be found")
+	assert.Equal(t, 3, fakeServer.requests, "Paging should follow the cursors to the last page")
+
+	return
+}
@@ -0,0 +1,66 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"context"
+	"fmt"
+
+	swaggerClient "github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdswaggerclient"
+	"k8s.io/klog"
+)
+
+// CheckAccess : reads the VCD objects that the CCM works with, so that missing objects and rights are found before
+// a rollout. Authentication, the org, the VDC and the gateway are already checked when the client is created. All
+// problems found are returned.
+func (client *Client) CheckAccess(ctx context.Context) []error {
+	errs := make([]error, 0)
+
+	if vmRecords, err := client.ListClusterVMs(); err != nil {
+		errs = append(errs, fmt.Errorf("unable to list vms of vApps [%s] in VDC [%s]: [%v]",
+			client.ClusterVAppName, client.ClusterOVDCName, err))
+	} else if len(vmRecords) == 0 {
+		errs = append(errs, fmt.Errorf("no vms are selected by vApps [%s] in VDC [%s]",
+			client.ClusterVAppName, client.ClusterOVDCName))
+	}
+
+	if _, _, _, err := client.GetRDEVirtualIps(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("unable to read RDE [%s]: [%v]", client.ClusterID, err))
+	}
+
+	for _, targetName := range client.LBTargetNames() {
+		targetClient, err := client.ForLBTarget(ctx, targetName)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		errs = append(errs, targetClient.checkLBTargetAccess(ctx)...)
+	}
+
+	return errs
+}
+
+// checkLBTargetAccess reads the gateway objects used to create load balancers on the target of the client
+func (client *Client) checkLBTargetAccess(ctx context.Context) []error {
+	errs := make([]error, 0)
+	if !client.IsNSXTBackedGateway() {
+		klog.Infof("Gateway of network [%s] of load balancer target [%s] is not backed by NSX-T; skipping checks",
+			client.networkName, client.lbTargetName)
+		return errs
+	}
+
+	if _, resp, err := client.APIClient.EdgeGatewayNatRulesApi.GetNatRules(ctx, 1, client.gatewayRef.Id,
+		&swaggerClient.EdgeGatewayNatRulesApiGetNatRulesOpts{}); err != nil {
+		errs = append(errs, fmt.Errorf("unable to list NAT rules of gateway [%s] of load balancer target [%s]: resp: [%v]: [%v]",
+			client.gatewayRef.Name, client.lbTargetName, resp, err))
+	}
+	if _, err := client.getLoadBalancerSEG(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("unable to get a service engine group for gateway [%s] of load balancer target [%s]: [%v]",
+			client.gatewayRef.Name, client.lbTargetName, err))
+	}
+
+	return errs
+}
@@ -0,0 +1,94 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ProxyConfig : HTTP proxy through which VCD is reached. If URL is empty, the HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY environment variables are used instead.
+type ProxyConfig struct {
+	URL string `json:"url"`
+
+	// NoProxy is a comma separated list of hosts, domains, IP addresses and CIDRs that are reached directly.
+	// A domain matches itself and all of its subdomains; "*" disables the proxy.
+	NoProxy string `json:"noProxy"`
+
+	// Username and Password authenticate to the proxy. They can also be set as user info in URL.
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// bypassesProxy returns true if host, without a port, matches an entry of noProxy
+func bypassesProxy(host string, noProxy string) bool {
+	hostIP := net.ParseIP(host)
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if hostIP != nil && cidr.Contains(hostIP) {
+				return true
+			}
+			continue
+		}
+		if entryHost, _, err := net.SplitHostPort(entry); err == nil {
+			entry = entryHost
+		}
+		if entryIP := net.ParseIP(entry); entryIP != nil {
+			if hostIP != nil && entryIP.Equal(hostIP) {
+				return true
+			}
+			continue
+		}
+		entry = strings.TrimPrefix(entry, ".")
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// proxyFunc returns the function used by http.Transport to pick the proxy for each request
+func (proxyConfig *ProxyConfig) proxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	if proxyConfig.URL == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	rawURL := proxyConfig.URL
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse proxy url [%s]: [%v]", proxyConfig.URL, err)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("proxy url [%s] has no host", proxyConfig.URL)
+	}
+	if proxyConfig.Username != "" {
+		// the transport sends these as Proxy-Authorization for plain requests as well as CONNECT tunnels
+		proxyURL.User = url.UserPassword(proxyConfig.Username, proxyConfig.Password)
+	}
+
+	noProxy := proxyConfig.NoProxy
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassesProxy(strings.ToLower(req.URL.Hostname()), noProxy) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}, nil
+}
@@ -0,0 +1,89 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBypassesProxy(t *testing.T) {
+
+	type TestCase struct {
+		Host    string
+		NoProxy string
+		Bypass  bool
+	}
+
+	testCaseList := []TestCase{
+		{"vcd.example.com", "", false},
+		{"vcd.example.com", "*", true},
+		{"vcd.example.com", "vcd.example.com", true},
+		{"vcd.example.com", "example.com", true},
+		{"vcd.example.com", ".example.com", true},
+		{"vcd.example.com", "other.com, example.com", true},
+		{"vcd.example.com", "vcd.example.com:443", true},
+		{"myexample.com", "example.com", false},
+		{"10.1.2.3", "10.0.0.0/8", true},
+		{"192.168.1.1", "10.0.0.0/8", false},
+		{"10.1.2.3", "10.1.2.3", true},
+		{"vcd.example.com", "10.0.0.0/8", false},
+	}
+
+	for _, tc := range testCaseList {
+		assert.Equal(t, tc.Bypass, bypassesProxy(tc.Host, tc.NoProxy),
+			"Unexpected result for host [%s] and no proxy list [%s]", tc.Host, tc.NoProxy)
+	}
+
+	return
+}
+
+func TestProxyConfig(t *testing.T) {
+	proxiedHosts := make([]string, 0)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expectedAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte("proxy-user:proxy-password"))
+		if r.Header.Get("Proxy-Authorization") != expectedAuth {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		proxiedHosts = append(proxiedHosts, r.URL.Host)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	proxyConfig := &ProxyConfig{
+		URL:      proxy.URL,
+		NoProxy:  "direct.example.com",
+		Username: "proxy-user",
+		Password: "proxy-password",
+	}
+	proxyFunc, err := proxyConfig.proxyFunc()
+	assert.NoError(t, err, "Unable to create proxy function")
+
+	httpClient := &http.Client{
+		Transport: &http.Transport{Proxy: proxyFunc},
+	}
+	resp, err := httpClient.Get("http://vcd.example.com/api/versions")
+	assert.NoError(t, err, "Request should be sent through the proxy")
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "Proxy should accept the proxy credentials")
+	_ = resp.Body.Close()
+	assert.Equal(t, []string{"vcd.example.com"}, proxiedHosts, "Request should reach the proxy")
+
+	directReq, err := http.NewRequest(http.MethodGet, "http://direct.example.com/api", nil)
+	assert.NoError(t, err, "Unable to create request")
+	proxyURL, err := proxyFunc(directReq)
+	assert.NoError(t, err, "Proxy should be selected without error")
+	assert.Nil(t, proxyURL, "Host in no proxy list should be reached directly")
+
+	_, err = (&ProxyConfig{URL: "http://"}).proxyFunc()
+	assert.Error(t, err, "Proxy url without host should be rejected")
+
+	return
+}
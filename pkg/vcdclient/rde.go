@@ -59,39 +59,36 @@ func (client *Client) addVirtualIpToRDE(ctx context.Context, addIp string) error
 		return nil
 	}
 
-	numRetries := 10
-	for i := 0; i < numRetries; i++ {
-		currIps, etag, defEnt, err := client.GetRDEVirtualIps(ctx)
-		if err != nil {
-			return fmt.Errorf("error getting current vips: [%v]", err)
-		}
-
-		// check if need to update RDE
-		foundAddIp := false
-		for _, ip := range currIps {
-			if ip == addIp {
-				foundAddIp = true
-				break
+	return client.retry(ctx, fmt.Sprintf("add virtual IP [%s] to RDE [%s]", addIp, client.ClusterID),
+		func() (*http.Response, error) {
+			currIps, etag, defEnt, err := client.GetRDEVirtualIps(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("error getting current vips: [%v]", err)
 			}
-		}
-		if foundAddIp {
-			return nil // no need to update RDE
-		}
 
-		updatedIps := append(currIps, addIp)
-		httpResponse, err := client.updateRDEVirtualIps(ctx, updatedIps, etag, defEnt)
-		if err != nil {
-			if httpResponse.StatusCode == http.StatusPreconditionFailed {
-				klog.Infof("Wrong ETag while adding virtual IP [%s]", addIp)
-				continue
+			// check if need to update RDE
+			foundAddIp := false
+			for _, ip := range currIps {
+				if ip == addIp {
+					foundAddIp = true
+					break
+				}
+			}
+			if foundAddIp {
+				return nil, nil // no need to update RDE
 			}
-			return fmt.Errorf("error when adding virtual ip [%s] to RDE: [%v]", addIp, err)
-		}
-		klog.Infof("Successfully updated RDE [%s] with virtual IP [%s]", client.ClusterID, addIp)
-		return nil
-	}
 
-	return fmt.Errorf("unable to update rde due to incorrect etag after [%d]] tries", numRetries)
+			updatedIps := append(currIps, addIp)
+			httpResponse, err := client.updateRDEVirtualIps(ctx, updatedIps, etag, defEnt)
+			if err != nil {
+				if httpResponse != nil && httpResponse.StatusCode == http.StatusPreconditionFailed {
+					klog.Infof("Wrong ETag while adding virtual IP [%s]", addIp)
+				}
+				return httpResponse, fmt.Errorf("error when adding virtual ip [%s] to RDE: [%v]", addIp, err)
+			}
+			klog.Infof("Successfully updated RDE [%s] with virtual IP [%s]", client.ClusterID, addIp)
+			return httpResponse, nil
+		})
 }
 
 func (client *Client) removeVirtualIpFromRDE(ctx context.Context, removeIp string) error {
@@ -105,42 +102,39 @@ func (client *Client) removeVirtualIpFromRDE(ctx context.Context, removeIp strin
 		return nil
 	}
 
-	numRetries := 10
-	for i := 0; i < numRetries; i++ {
-		currIps, etag, defEnt, err := client.GetRDEVirtualIps(ctx)
-		if err != nil {
-			return fmt.Errorf("error getting current vips: [%v]", err)
-		}
-		// currIps is guaranteed not to be nil by GetRDEVirtualIps
-		if len(currIps) == 0 {
-			// valid case since this could be a retry operation
-			return nil
-		}
-
-		// form updated virtual ip list
-		foundIdx := -1
-		for idx, ip := range currIps {
-			if ip == removeIp {
-				foundIdx = idx
-				break // for inner loop
+	return client.retry(ctx, fmt.Sprintf("remove virtual IP [%s] from RDE [%s]", removeIp, client.ClusterID),
+		func() (*http.Response, error) {
+			currIps, etag, defEnt, err := client.GetRDEVirtualIps(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("error getting current vips: [%v]", err)
 			}
-		}
-		if foundIdx == -1 {
-			return nil // no need to update RDE
-		}
-		updatedIps := append(currIps[:foundIdx], currIps[foundIdx+1:]...)
-
-		httpResponse, err := client.updateRDEVirtualIps(ctx, updatedIps, etag, defEnt)
-		if err != nil {
-			if httpResponse.StatusCode == http.StatusPreconditionFailed {
-				klog.Infof("Wrong ETag while removing virtual IP [%s]", removeIp)
-				continue
+			// currIps is guaranteed not to be nil by GetRDEVirtualIps
+			if len(currIps) == 0 {
+				// valid case since this could be a retry operation
+				return nil, nil
 			}
-			return fmt.Errorf("error when removing virtual ip [%s] from RDE: [%v]",
-				removeIp, err)
-		}
-		return nil
-	}
 
-	return fmt.Errorf("unable to update rde due to incorrect etag after [%d] tries", numRetries)
+			// form updated virtual ip list
+			foundIdx := -1
+			for idx, ip := range currIps {
+				if ip == removeIp {
+					foundIdx = idx
+					break // for inner loop
+				}
+			}
+			if foundIdx == -1 {
+				return nil, nil // no need to update RDE
+			}
+			updatedIps := append(currIps[:foundIdx], currIps[foundIdx+1:]...)
+
+			httpResponse, err := client.updateRDEVirtualIps(ctx, updatedIps, etag, defEnt)
+			if err != nil {
+				if httpResponse != nil && httpResponse.StatusCode == http.StatusPreconditionFailed {
+					klog.Infof("Wrong ETag while removing virtual IP [%s]", removeIp)
+				}
+				return httpResponse, fmt.Errorf("error when removing virtual ip [%s] from RDE: [%v]",
+					removeIp, err)
+			}
+			return httpResponse, nil
+		})
 }
@@ -0,0 +1,132 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog"
+)
+
+const (
+	DefaultRetryMaxAttempts    = 6
+	DefaultRetryInitialBackoff = 2 * time.Second
+	DefaultRetryMaxBackoff     = 30 * time.Second
+
+	// each backoff is stretched by a random factor in [1, 1+retryJitterFactor)
+	retryJitterFactor = 0.5
+)
+
+// RetryConfig : budget for retrying transient VCD failures within a single request. Zero values fall back
+// to the defaults.
+type RetryConfig struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+func (retryConfig *RetryConfig) withDefaults() RetryConfig {
+	effectiveConfig := *retryConfig
+	if effectiveConfig.MaxAttempts <= 0 {
+		effectiveConfig.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if effectiveConfig.InitialBackoff <= 0 {
+		effectiveConfig.InitialBackoff = DefaultRetryInitialBackoff
+	}
+	if effectiveConfig.MaxBackoff <= 0 {
+		effectiveConfig.MaxBackoff = DefaultRetryMaxBackoff
+	}
+
+	return effectiveConfig
+}
+
+// isRetryableError returns true if the failure is expected to clear up on its own: an object that is still
+// being configured, a conflicting concurrent change (including ETag mismatches), throttling or a server error.
+func isRetryableError(resp *http.Response, err error) bool {
+	var vsPendingErr *VirtualServicePendingError
+	if errors.Is(err, ErrBusy) || errors.As(err, &vsPendingErr) {
+		return true
+	}
+
+	if resp == nil {
+		return false
+	}
+	switch {
+	case resp.StatusCode == http.StatusConflict,
+		resp.StatusCode == http.StatusPreconditionFailed,
+		resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode >= http.StatusInternalServerError:
+		return true
+	}
+
+	return false
+}
+
+// isRetryableCreateError returns true if VCD turned the create down before accepting it, as it does for a busy
+// parent object or throttling. Other failures, such as server errors and conflicts, may come after VCD created the
+// object, so that another attempt could create a duplicate.
+func isRetryableCreateError(resp *http.Response, err error) bool {
+	if errors.Is(err, ErrBusy) {
+		return true
+	}
+
+	return resp != nil && resp.StatusCode == http.StatusTooManyRequests
+}
+
+// retry calls fn until it succeeds, fails with an error that is not retryable, the retry budget is exhausted
+// or ctx is done. Between attempts it sleeps with jittered exponential backoff. fn returns the http response
+// of the call it makes, if any, so that the status code can be used to classify the failure.
+func (client *Client) retry(ctx context.Context, operation string, fn func() (*http.Response, error)) error {
+	return client.retryIf(ctx, operation, isRetryableError, fn)
+}
+
+// retryCreate is retry for calls that create an object, which are only retried if VCD turned them down before
+// creating anything.
+func (client *Client) retryCreate(ctx context.Context, operation string, fn func() (*http.Response, error)) error {
+	return client.retryIf(ctx, operation, isRetryableCreateError, fn)
+}
+
+func (client *Client) retryIf(ctx context.Context, operation string,
+	isRetryable func(resp *http.Response, err error) bool, fn func() (*http.Response, error)) error {
+	retryConfig := client.RetryConfig.withDefaults()
+
+	backoff := retryConfig.InitialBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		var resp *http.Response
+		resp, err = fn()
+		if err == nil {
+			return nil
+		}
+		if !isRetryable(resp, err) {
+			return err
+		}
+		if attempt >= retryConfig.MaxAttempts {
+			break
+		}
+
+		sleepDuration := wait.Jitter(backoff, retryJitterFactor)
+		klog.Infof("Attempt [%d/%d] to %s failed with a transient error; retrying in [%v]: [%v]",
+			attempt, retryConfig.MaxAttempts, operation, sleepDuration, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up retrying %s: [%v]: last error: [%w]", operation, ctx.Err(), err)
+		case <-time.After(sleepDuration):
+		}
+
+		backoff *= 2
+		if backoff > retryConfig.MaxBackoff {
+			backoff = retryConfig.MaxBackoff
+		}
+	}
+
+	return fmt.Errorf("unable to %s after [%d] attempts: [%w]", operation, retryConfig.MaxAttempts, err)
+}
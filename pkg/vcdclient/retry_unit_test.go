@@ -0,0 +1,126 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryableError(t *testing.T) {
+
+	type TestCase struct {
+		StatusCode int
+		Err        error
+		Retryable  bool
+	}
+
+	testCaseList := []TestCase{
+		{0, NewVirtualServiceBusyError("vs"), true},
+		{0, fmt.Errorf("wrapped: [%w]", NewLBPoolBusyError("pool")), true},
+		{0, NewGatewayBusyError("gateway"), true},
+		{0, NewVirtualServicePendingError("vs"), true},
+		{0, fmt.Errorf("unknown failure"), false},
+		{http.StatusConflict, fmt.Errorf("conflict"), true},
+		{http.StatusPreconditionFailed, fmt.Errorf("wrong etag"), true},
+		{http.StatusTooManyRequests, fmt.Errorf("throttled"), true},
+		{http.StatusServiceUnavailable, fmt.Errorf("unavailable"), true},
+		{http.StatusBadRequest, fmt.Errorf("bad request"), false},
+		{http.StatusNotFound, fmt.Errorf("not found"), false},
+	}
+
+	for _, tc := range testCaseList {
+		var resp *http.Response
+		if tc.StatusCode != 0 {
+			resp = &http.Response{StatusCode: tc.StatusCode}
+		}
+		assert.Equal(t, tc.Retryable, isRetryableError(resp, tc.Err),
+			"Unexpected classification of status [%d] and error [%v]", tc.StatusCode, tc.Err)
+	}
+
+	return
+}
+
+func TestIsRetryableCreateError(t *testing.T) {
+
+	type TestCase struct {
+		StatusCode int
+		Err        error
+		Retryable  bool
+	}
+
+	testCaseList := []TestCase{
+		{http.StatusBadRequest, &VCDError{StatusCode: http.StatusBadRequest, MinorErrorCode: "BUSY_ENTITY"}, true},
+		{0, fmt.Errorf("wrapped: [%w]", NewGatewayBusyError("gateway")), true},
+		{http.StatusTooManyRequests, fmt.Errorf("throttled"), true},
+		{http.StatusConflict, fmt.Errorf("conflict"), false},
+		{http.StatusServiceUnavailable, fmt.Errorf("unavailable"), false},
+		{http.StatusGatewayTimeout, fmt.Errorf("timeout"), false},
+		{0, fmt.Errorf("connection reset"), false},
+	}
+
+	for _, tc := range testCaseList {
+		var resp *http.Response
+		if tc.StatusCode != 0 {
+			resp = &http.Response{StatusCode: tc.StatusCode}
+		}
+		assert.Equal(t, tc.Retryable, isRetryableCreateError(resp, tc.Err),
+			"Unexpected classification of creation with status [%d] and error [%v]", tc.StatusCode, tc.Err)
+	}
+
+	return
+}
+
+func TestRetry(t *testing.T) {
+	client := &Client{
+		RetryConfig: RetryConfig{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     2 * time.Millisecond,
+		},
+	}
+	ctx := context.Background()
+
+	// transient failure followed by success
+	attempts := 0
+	err := client.retry(ctx, "test operation", func() (*http.Response, error) {
+		attempts++
+		if attempts < 2 {
+			return &http.Response{StatusCode: http.StatusConflict}, fmt.Errorf("conflict")
+		}
+		return nil, nil
+	})
+	assert.NoError(t, err, "Operation should succeed after a transient failure")
+	assert.Equal(t, 2, attempts, "Operation should be attempted until it succeeds")
+
+	// non-retryable failure is returned immediately
+	attempts = 0
+	err = client.retry(ctx, "test operation", func() (*http.Response, error) {
+		attempts++
+		return &http.Response{StatusCode: http.StatusBadRequest}, fmt.Errorf("bad request")
+	})
+	assert.Error(t, err, "Non-retryable failure should be returned")
+	assert.Equal(t, 1, attempts, "Non-retryable failure should not be retried")
+
+	// retry budget is exhausted and the last error remains inspectable
+	attempts = 0
+	err = client.retry(ctx, "test operation", func() (*http.Response, error) {
+		attempts++
+		return nil, NewVirtualServiceBusyError("vs")
+	})
+	assert.Error(t, err, "Persistent transient failure should be returned")
+	assert.Equal(t, 3, attempts, "Operation should be attempted MaxAttempts times")
+	var vsBusyErr *VirtualServiceBusyError
+	assert.True(t, errors.As(err, &vsBusyErr), "Last error should be wrapped in the returned error")
+
+	return
+}
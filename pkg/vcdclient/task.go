@@ -0,0 +1,147 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/vmware/cloud-provider-for-cloud-director/pkg/util"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+	"k8s.io/klog"
+)
+
+const (
+	DefaultTaskCreateTimeout = 10 * time.Minute
+	DefaultTaskUpdateTimeout = 10 * time.Minute
+	DefaultTaskDeleteTimeout = 10 * time.Minute
+
+	taskPollInitialInterval = time.Second
+	taskPollMaxInterval     = 10 * time.Second
+
+	// terminal states of a VCD task
+	taskStatusSuccess  = "success"
+	taskStatusError    = "error"
+	taskStatusAborted  = "aborted"
+	taskStatusCanceled = "canceled"
+)
+
+// TaskTimeouts : maximum time to wait for a VCD task to complete, per type of operation. Zero values
+// fall back to the defaults.
+type TaskTimeouts struct {
+	Create time.Duration
+	Update time.Duration
+	Delete time.Duration
+}
+
+type taskOperation string
+
+const (
+	taskOperationCreate = taskOperation("create")
+	taskOperationUpdate = taskOperation("update")
+	taskOperationDelete = taskOperation("delete")
+)
+
+func (timeouts *TaskTimeouts) forOperation(operation taskOperation) time.Duration {
+	timeout := time.Duration(0)
+	defaultTimeout := time.Duration(0)
+	switch operation {
+	case taskOperationCreate:
+		timeout, defaultTimeout = timeouts.Create, DefaultTaskCreateTimeout
+	case taskOperationUpdate:
+		timeout, defaultTimeout = timeouts.Update, DefaultTaskUpdateTimeout
+	case taskOperationDelete:
+		timeout, defaultTimeout = timeouts.Delete, DefaultTaskDeleteTimeout
+	}
+	if timeout <= 0 {
+		return defaultTimeout
+	}
+
+	return timeout
+}
+
+// getTask fetches the current state of the task at taskURL. Unlike govcd.Task.Refresh, the request is bound to ctx.
+func (client *Client) getTask(ctx context.Context, taskURL *url.URL) (*types.Task, error) {
+	req := client.VCDClient.Client.NewRequest(map[string]string{}, http.MethodGet, *taskURL, nil)
+	resp, err := client.VCDClient.Client.Http.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("unable to get task [%s]: [%v]", taskURL.String(), err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			klog.Errorf("unable to close response body of task [%s]: [%v]", taskURL.String(), err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		responseMessageBytes, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unable to get task [%s]; expected http response [%v], obtained [%v]: [%w]",
+			taskURL.String(), http.StatusOK, resp.StatusCode, NewVCDErrorFromResponse(resp, responseMessageBytes))
+	}
+
+	task := &types.Task{}
+	if err = util.DecodeXMLBody(types.BodyTypeXML, resp, task); err != nil {
+		return nil, fmt.Errorf("unable to decode task [%s]: [%v]", taskURL.String(), err)
+	}
+
+	return task, nil
+}
+
+// waitForTask polls the task at taskURL with exponential backoff until it completes. It gives up when ctx is
+// done or when the timeout configured for the operation elapses, whichever is earlier. A task that ends in
+// an error state is returned as a *TaskFailedError carrying the VCD error details.
+func (client *Client) waitForTask(ctx context.Context, taskURL string, operation taskOperation) error {
+	if taskURL == "" {
+		return fmt.Errorf("task URL should not be empty")
+	}
+	u, err := url.ParseRequestURI(taskURL)
+	if err != nil {
+		return fmt.Errorf("unable to parse task URL [%s]: [%v]", taskURL, err)
+	}
+
+	timeout := client.TaskTimeouts.forOperation(operation)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	interval := taskPollInitialInterval
+	lastStatus := ""
+	for {
+		task, err := client.getTask(ctx, u)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("gave up waiting for %s task [%s] after [%v]: [%v]",
+					operation, taskURL, timeout, ctx.Err())
+			}
+			return err
+		}
+		lastStatus = task.Status
+
+		switch task.Status {
+		case taskStatusSuccess:
+			return nil
+		case taskStatusError, taskStatusAborted, taskStatusCanceled:
+			return NewTaskFailedError(taskURL, task)
+		}
+		klog.V(3).Infof("Task [%s] for %s operation is in status [%s]; polling again in [%v]",
+			taskURL, operation, task.Status, interval)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up waiting for %s task [%s] in status [%s] after [%v]: [%v]",
+				operation, taskURL, lastStatus, timeout, ctx.Err())
+		case <-time.After(interval):
+		}
+
+		interval *= 2
+		if interval > taskPollMaxInterval {
+			interval = taskPollMaxInterval
+		}
+	}
+}
@@ -0,0 +1,110 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+)
+
+func newTaskTestClient(t *testing.T, serverURL string, timeouts TaskTimeouts) *Client {
+	u, err := url.Parse(serverURL + "/api")
+	assert.NoError(t, err, "Unable to parse test server URL")
+
+	return &Client{
+		VCDClient:    govcd.NewVCDClient(*u, true),
+		TaskTimeouts: timeouts,
+	}
+}
+
+func TestWaitForTask(t *testing.T) {
+
+	type TestCase struct {
+		Statuses     []string
+		ErrorMessage string
+		ExpectError  bool
+		ErrorComment string
+	}
+
+	testCaseList := []TestCase{
+		{
+			Statuses:     []string{"running", "success"},
+			ExpectError:  false,
+			ErrorComment: "Task that eventually succeeds should not return an error",
+		},
+		{
+			Statuses:     []string{"error"},
+			ErrorMessage: "gateway is busy",
+			ExpectError:  true,
+			ErrorComment: "Task that fails should return a TaskFailedError",
+		},
+	}
+
+	for _, testCase := range testCaseList {
+		numCalls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			status := testCase.Statuses[numCalls]
+			if numCalls < len(testCase.Statuses)-1 {
+				numCalls++
+			}
+			errorElement := ""
+			if status == taskStatusError {
+				errorElement = fmt.Sprintf(
+					`<Error majorErrorCode="400" minorErrorCode="BAD_REQUEST" message="%s"/>`,
+					testCase.ErrorMessage)
+			}
+			w.Header().Set("Content-Type", "application/vnd.vmware.vcloud.task+xml")
+			_, _ = fmt.Fprintf(w, `<Task status="%s" operation="test">%s</Task>`, status, errorElement)
+		}))
+
+		client := newTaskTestClient(t, server.URL, TaskTimeouts{})
+		err := client.waitForTask(context.Background(), server.URL+"/api/task/1", taskOperationCreate)
+		server.Close()
+
+		if !testCase.ExpectError {
+			assert.NoError(t, err, testCase.ErrorComment)
+			continue
+		}
+
+		var taskErr *TaskFailedError
+		assert.True(t, errors.As(err, &taskErr), testCase.ErrorComment)
+		if taskErr != nil {
+			assert.Equal(t, testCase.ErrorMessage, taskErr.Message, testCase.ErrorComment)
+			assert.Equal(t, 400, taskErr.MajorErrorCode, testCase.ErrorComment)
+		}
+	}
+
+	return
+}
+
+func TestWaitForTaskTimeout(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `<Task status="running" operation="test"/>`)
+	}))
+	defer server.Close()
+
+	client := newTaskTestClient(t, server.URL, TaskTimeouts{Delete: 100 * time.Millisecond})
+	err := client.waitForTask(context.Background(), server.URL+"/api/task/1", taskOperationDelete)
+	assert.Error(t, err, "Task that never completes should time out")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client = newTaskTestClient(t, server.URL, TaskTimeouts{})
+	err = client.waitForTask(ctx, server.URL+"/api/task/1", taskOperationDelete)
+	assert.Error(t, err, "Waiting on a cancelled context should fail")
+
+	return
+}
@@ -0,0 +1,91 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// TLSConfig : how the certificate presented by the VCD endpoint is verified
+type TLSConfig struct {
+	// Insecure skips verification of the certificate chain and host name. Pinned certificates are still
+	// enforced, which allows trusting exactly one self-signed certificate.
+	Insecure bool `json:"insecure"`
+
+	// CACertFile and CACert are PEM encoded CA certificates trusted in addition to the system roots
+	CACertFile string `json:"caCertFile"`
+	CACert     string `json:"caCert"`
+
+	// PinnedCertificates are SHA-256 fingerprints in hex, optionally separated by colons, as printed by
+	// `openssl x509 -noout -fingerprint -sha256`. If set, one of the certificates presented by VCD must match.
+	PinnedCertificates []string `json:"pinnedCertificates"`
+}
+
+func normalizeFingerprint(fingerprint string) (string, error) {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fingerprint), ":", ""))
+	decoded, err := hex.DecodeString(normalized)
+	if err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("[%s] is not a SHA-256 fingerprint in hex", fingerprint)
+	}
+
+	return normalized, nil
+}
+
+func (tlsConfig *TLSConfig) clientConfig() (*tls.Config, error) {
+	tlsClientConfig := &tls.Config{
+		InsecureSkipVerify: tlsConfig.Insecure,
+	}
+
+	caCerts := []byte(tlsConfig.CACert)
+	if tlsConfig.CACertFile != "" {
+		caCertFileContent, err := ioutil.ReadFile(tlsConfig.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA certificate file [%s]: [%v]", tlsConfig.CACertFile, err)
+		}
+		caCerts = append(caCerts, '\n')
+		caCerts = append(caCerts, caCertFileContent...)
+	}
+	if len(strings.TrimSpace(string(caCerts))) > 0 {
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil || rootCAs == nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(caCerts) {
+			return nil, fmt.Errorf("no PEM encoded certificates found in the configured CA certificates")
+		}
+		tlsClientConfig.RootCAs = rootCAs
+	}
+
+	if len(tlsConfig.PinnedCertificates) > 0 {
+		pinnedFingerprints := make(map[string]bool)
+		for _, pinnedCertificate := range tlsConfig.PinnedCertificates {
+			fingerprint, err := normalizeFingerprint(pinnedCertificate)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pinned certificate: [%v]", err)
+			}
+			pinnedFingerprints[fingerprint] = true
+		}
+
+		// this runs after the regular chain verification, or instead of it if Insecure is set
+		tlsClientConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			for _, rawCert := range rawCerts {
+				fingerprint := sha256.Sum256(rawCert)
+				if pinnedFingerprints[hex.EncodeToString(fingerprint[:])] {
+					return nil
+				}
+			}
+			return fmt.Errorf("none of the certificates presented by VCD match a pinned certificate")
+		}
+	}
+
+	return tlsClientConfig, nil
+}
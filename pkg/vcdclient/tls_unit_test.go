@@ -0,0 +1,76 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	serverCert := server.Certificate()
+	serverCertPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverCert.Raw}))
+	fingerprint := sha256.Sum256(serverCert.Raw)
+	serverFingerprint := strings.ToUpper(hex.EncodeToString(fingerprint[:]))
+
+	type TestCase struct {
+		Name         string
+		TLSConfig    TLSConfig
+		ExpectError  bool
+		ErrorComment string
+	}
+
+	testCaseList := []TestCase{
+		{"untrusted certificate", TLSConfig{}, true,
+			"Certificate not signed by a trusted CA should be rejected"},
+		{"custom CA", TLSConfig{CACert: serverCertPEM}, false,
+			"Certificate signed by the configured CA should be accepted"},
+		{"insecure", TLSConfig{Insecure: true}, false,
+			"Certificate should not be verified if insecure"},
+		{"insecure with mismatched pin", TLSConfig{Insecure: true, PinnedCertificates: []string{strings.Repeat("0", 64)}},
+			true, "Certificate not matching the pin should be rejected even if insecure"},
+		{"insecure with pin", TLSConfig{Insecure: true, PinnedCertificates: []string{serverFingerprint}}, false,
+			"Certificate matching the pin should be accepted"},
+		{"custom CA with pin", TLSConfig{CACert: serverCertPEM, PinnedCertificates: []string{serverFingerprint}}, false,
+			"Trusted certificate matching the pin should be accepted"},
+	}
+
+	for _, tc := range testCaseList {
+		tlsClientConfig, err := tc.TLSConfig.clientConfig()
+		assert.NoError(t, err, "Unable to create TLS config for test case [%s]", tc.Name)
+
+		httpClient := &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsClientConfig},
+		}
+		resp, err := httpClient.Get(server.URL)
+		if tc.ExpectError {
+			assert.Error(t, err, "Test case [%s]: %s", tc.Name, tc.ErrorComment)
+			continue
+		}
+		assert.NoError(t, err, "Test case [%s]: %s", tc.Name, tc.ErrorComment)
+		_ = resp.Body.Close()
+	}
+
+	_, err := (&TLSConfig{PinnedCertificates: []string{"not-a-fingerprint"}}).clientConfig()
+	assert.Error(t, err, "Invalid fingerprint should be rejected")
+
+	_, err = (&TLSConfig{CACert: "not a certificate"}).clientConfig()
+	assert.Error(t, err, "CA certificate that is not PEM encoded should be rejected")
+
+	return
+}
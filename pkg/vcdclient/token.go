@@ -0,0 +1,260 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+	"k8s.io/klog"
+)
+
+const (
+	// DefaultBearerTokenLifetime is assumed when VCD does not report when a token expires, which is the case
+	// for sessions created with a username and password.
+	DefaultBearerTokenLifetime = 30 * time.Minute
+
+	// tokens are refreshed this long before they expire so that requests in flight do not race the expiry
+	bearerTokenRefreshMargin = 2 * time.Minute
+)
+
+type bearerToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+func (token *bearerToken) needsRefresh(now time.Time) bool {
+	return !now.Before(token.expiresAt.Add(-bearerTokenRefreshMargin))
+}
+
+// tokenManager owns the bearer token used for every request to VCD, whether made through govcd or the
+// swagger client. The token is swapped atomically so that concurrent callers always see a complete token,
+// and refreshes are serialized so that a burst of callers with an expired token authenticates only once.
+type tokenManager struct {
+	lifetime      time.Duration
+	baseTransport http.RoundTripper
+	httpTimeout   time.Duration
+	apiVersion    string
+
+	// authConfig holds the credentials of every refresh. It is only replaced once the new credentials have been
+	// used to authenticate, and is shared with the copies of the client that are scoped to a load balancer target.
+	authConfig  atomic.Value // *VCDAuthConfig
+	token       atomic.Value // *bearerToken
+	refreshLock sync.Mutex
+	// credentialsLock serializes switches to new credentials, which span more than the token refresh
+	credentialsLock sync.Mutex
+
+	// fetchToken authenticates against VCD; it can be replaced in tests
+	fetchToken func(authConfig *VCDAuthConfig) (*bearerToken, error)
+}
+
+// newTokenManager takes over the token that vcdClient has already obtained and installs a transport on its
+// http client that stamps the current token on each request. The swagger client must share the same http
+// client for its requests to be covered as well.
+func newTokenManager(authConfig *VCDAuthConfig, vcdClient *govcd.VCDClient, lifetime time.Duration) *tokenManager {
+	if lifetime <= 0 {
+		lifetime = DefaultBearerTokenLifetime
+	}
+	baseTransport := vcdClient.Client.Http.Transport
+	if baseTransport == nil {
+		baseTransport = http.DefaultTransport
+	}
+
+	tokens := &tokenManager{
+		lifetime:      lifetime,
+		baseTransport: baseTransport,
+		httpTimeout:   vcdClient.Client.Http.Timeout,
+		apiVersion:    vcdClient.Client.APIVersion,
+	}
+	tokens.fetchToken = tokens.authenticate
+	tokens.authConfig.Store(authConfig)
+	tokens.token.Store(&bearerToken{
+		value:     vcdClient.Client.VCDToken,
+		expiresAt: time.Now().Add(lifetime),
+	})
+	vcdClient.Client.Http.Transport = &bearerTokenTransport{
+		tokens: tokens,
+		base:   baseTransport,
+	}
+
+	return tokens
+}
+
+func (tokens *tokenManager) current() *bearerToken {
+	return tokens.token.Load().(*bearerToken)
+}
+
+// getAuthConfig returns the credentials that the current token was obtained with
+func (tokens *tokenManager) getAuthConfig() *VCDAuthConfig {
+	return tokens.authConfig.Load().(*VCDAuthConfig)
+}
+
+// authenticate obtains a new token with a separate govcd client so that the session of the shared client
+// is never modified while other requests are using it.
+func (tokens *tokenManager) authenticate(config *VCDAuthConfig) (*bearerToken, error) {
+	href := fmt.Sprintf("%s/api", config.Host)
+	u, err := url.ParseRequestURI(href)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse url [%s]: [%v]", href, err)
+	}
+
+	authClient := govcd.NewVCDClient(*u, config.Insecure)
+	authClient.Client.APIVersion = tokens.apiVersion
+	authClient.Client.Http = http.Client{
+		Transport: tokens.baseTransport,
+		Timeout:   tokens.httpTimeout,
+	}
+
+	lifetime := tokens.lifetime
+	if config.RefreshToken != "" {
+		tokenRefresh, err := authClient.SetApiToken(config.UserOrg, config.RefreshToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get bearer token using the refresh token: [%v]", err)
+		}
+		if expiresIn := time.Duration(tokenRefresh.ExpiresIn) * time.Second; expiresIn > 0 && expiresIn < lifetime {
+			lifetime = expiresIn
+		}
+	} else if config.User != "" && config.Password != "" {
+		resp, err := authClient.GetAuthResponse(config.User, config.Password, config.UserOrg)
+		if err != nil {
+			return nil, fmt.Errorf("unable to authenticate [%s/%s] for url [%s]: [%+v] : [%v]",
+				config.UserOrg, config.User, href, resp, err)
+		}
+	} else {
+		return nil, fmt.Errorf(
+			"unable to find refresh token or secret to refresh vcd client for user [%s/%s] and url [%s]",
+			config.UserOrg, config.User, href)
+	}
+	if authClient.Client.VCDToken == "" {
+		return nil, fmt.Errorf("no bearer token obtained for user [%s/%s] and url [%s]",
+			config.UserOrg, config.User, href)
+	}
+
+	return &bearerToken{
+		value:     authClient.Client.VCDToken,
+		expiresAt: time.Now().Add(lifetime),
+	}, nil
+}
+
+// setCredentials authenticates with authConfig and, if that succeeds, uses it for this and all future
+// refreshes. On failure the current credentials and token remain in use.
+func (tokens *tokenManager) setCredentials(authConfig *VCDAuthConfig) error {
+	tokens.refreshLock.Lock()
+	defer tokens.refreshLock.Unlock()
+
+	newToken, err := tokens.fetchToken(authConfig)
+	if err != nil {
+		return fmt.Errorf("unable to authenticate with new credentials: [%v]", err)
+	}
+	tokens.authConfig.Store(authConfig)
+	tokens.token.Store(newToken)
+	klog.Infof("Switched to new credentials for user [%s/%s]; bearer token valid until [%v]",
+		authConfig.UserOrg, authConfig.User, newToken.expiresAt)
+
+	return nil
+}
+
+// refresh replaces staleToken with a new one. If another caller has already replaced it, that token is
+// returned without authenticating again.
+func (tokens *tokenManager) refresh(staleToken *bearerToken) (*bearerToken, error) {
+	tokens.refreshLock.Lock()
+	defer tokens.refreshLock.Unlock()
+
+	if currentToken := tokens.current(); currentToken != staleToken {
+		return currentToken, nil
+	}
+
+	authConfig := tokens.getAuthConfig()
+	klog.Infof("Refreshing VCD bearer token for user [%s/%s]", authConfig.UserOrg, authConfig.User)
+	newToken, err := tokens.fetchToken(authConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to refresh bearer token: [%v]", err)
+	}
+	tokens.token.Store(newToken)
+	klog.Infof("Refreshed VCD bearer token; valid until [%v]", newToken.expiresAt)
+
+	return newToken, nil
+}
+
+// get returns a token that is not about to expire, refreshing it first if needed. If the refresh fails but
+// the current token has not expired yet, the current token is used.
+func (tokens *tokenManager) get() (*bearerToken, error) {
+	currentToken := tokens.current()
+	now := time.Now()
+	if !currentToken.needsRefresh(now) {
+		return currentToken, nil
+	}
+
+	newToken, err := tokens.refresh(currentToken)
+	if err != nil {
+		if now.Before(currentToken.expiresAt) {
+			klog.Errorf("Continuing with current bearer token valid until [%v]: [%v]", currentToken.expiresAt, err)
+			return currentToken, nil
+		}
+		return nil, err
+	}
+
+	return newToken, nil
+}
+
+// bearerTokenTransport sets the current bearer token on each request, and retries a request once with a new
+// token if VCD rejects it with 401 Unauthorized.
+type bearerTokenTransport struct {
+	tokens *tokenManager
+	base   http.RoundTripper
+}
+
+func withBearerToken(req *http.Request, token *bearerToken) *http.Request {
+	authorizedReq := req.Clone(req.Context())
+	authorizedReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.value))
+	if authorizedReq.Header.Get(govcd.BearerTokenHeader) != "" {
+		authorizedReq.Header.Set(govcd.BearerTokenHeader, token.value)
+	}
+
+	return authorizedReq
+}
+
+func (transport *bearerTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := transport.tokens.get()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get bearer token for request [%s %s]: [%v]", req.Method, req.URL, err)
+	}
+
+	resp, err := transport.base.RoundTrip(withBearerToken(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		// the body has been consumed and cannot be sent again
+		return resp, nil
+	}
+
+	newToken, refreshErr := transport.tokens.refresh(token)
+	if refreshErr != nil {
+		klog.Errorf("Request [%s %s] was unauthorized and the bearer token could not be refreshed: [%v]",
+			req.Method, req.URL, refreshErr)
+		return resp, nil
+	}
+
+	retryReq := withBearerToken(req, newToken)
+	if req.GetBody != nil {
+		if retryReq.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	klog.Infof("Retrying unauthorized request [%s %s] with a refreshed bearer token", req.Method, req.URL)
+	return transport.base.RoundTrip(retryReq)
+}
@@ -0,0 +1,133 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTokenManager(initialToken *bearerToken, fetchedValue string, fetchCount *int) *tokenManager {
+	tokens := &tokenManager{
+		lifetime:      time.Hour,
+		baseTransport: http.DefaultTransport,
+	}
+	tokens.authConfig.Store(&VCDAuthConfig{})
+	tokens.token.Store(initialToken)
+	tokens.fetchToken = func(authConfig *VCDAuthConfig) (*bearerToken, error) {
+		*fetchCount++
+		return &bearerToken{
+			value:     fetchedValue,
+			expiresAt: time.Now().Add(time.Hour),
+		}, nil
+	}
+
+	return tokens
+}
+
+func TestBearerTokenTransportRetriesUnauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer new-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+
+	fetchCount := 0
+	tokens := newTestTokenManager(&bearerToken{
+		value:     "revoked-token",
+		expiresAt: time.Now().Add(time.Hour),
+	}, "new-token", &fetchCount)
+	httpClient := &http.Client{
+		Transport: &bearerTokenTransport{tokens: tokens, base: http.DefaultTransport},
+	}
+
+	resp, err := httpClient.Post(server.URL, "text/plain", strings.NewReader("payload"))
+	assert.NoError(t, err, "Request should succeed after refreshing the token")
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "Request should be retried with the new token")
+	body, _ := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.Equal(t, "payload", string(body), "Request body should be sent again on retry")
+	assert.Equal(t, 1, fetchCount, "Token should be refreshed once")
+
+	// the new token is reused for subsequent requests
+	resp, err = httpClient.Get(server.URL)
+	assert.NoError(t, err, "Request with the refreshed token should succeed")
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "Refreshed token should be used")
+	_ = resp.Body.Close()
+	assert.Equal(t, 1, fetchCount, "Valid token should not be refreshed")
+
+	return
+}
+
+func TestTokenManagerRefresh(t *testing.T) {
+	fetchCount := 0
+	expiringToken := &bearerToken{
+		value:     "expiring-token",
+		expiresAt: time.Now().Add(bearerTokenRefreshMargin / 2),
+	}
+	tokens := newTestTokenManager(expiringToken, "new-token", &fetchCount)
+
+	token, err := tokens.get()
+	assert.NoError(t, err, "Token about to expire should be refreshed")
+	assert.Equal(t, "new-token", token.value, "Token about to expire should be replaced")
+	assert.Equal(t, 1, fetchCount, "Token should be refreshed once")
+
+	// callers that observed the same stale token share a single refresh
+	staleToken := tokens.current()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := tokens.refresh(staleToken)
+			assert.NoError(t, err, "Refresh should succeed")
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 2, fetchCount, "Concurrent refreshes of the same token should authenticate once")
+
+	return
+}
+
+func TestTokenManagerSetCredentials(t *testing.T) {
+	fetchCount := 0
+	currentToken := &bearerToken{
+		value:     "current-token",
+		expiresAt: time.Now().Add(time.Hour),
+	}
+	tokens := newTestTokenManager(currentToken, "rotated-token", &fetchCount)
+	currentAuthConfig := tokens.getAuthConfig()
+
+	fetchToken := tokens.fetchToken
+	tokens.fetchToken = func(authConfig *VCDAuthConfig) (*bearerToken, error) {
+		return nil, fmt.Errorf("invalid credentials")
+	}
+	err := tokens.setCredentials(&VCDAuthConfig{User: "invalid-user"})
+	assert.Error(t, err, "Invalid credentials should be rejected")
+	assert.Equal(t, currentAuthConfig, tokens.getAuthConfig(), "Current credentials should be kept on failure")
+	assert.Equal(t, currentToken, tokens.current(), "Current token should be kept on failure")
+
+	tokens.fetchToken = fetchToken
+	rotatedAuthConfig := &VCDAuthConfig{User: "rotated-user"}
+	err = tokens.setCredentials(rotatedAuthConfig)
+	assert.NoError(t, err, "Valid credentials should be accepted")
+	assert.Equal(t, rotatedAuthConfig, tokens.getAuthConfig(), "Rotated credentials should be used")
+	assert.Equal(t, "rotated-token", tokens.current().value, "Token of the rotated credentials should be used")
+
+	return
+}
@@ -0,0 +1,225 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	swaggerClient "github.com/vmware/cloud-provider-for-cloud-director/pkg/vcdswaggerclient"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+// The kinds of VCD errors, to be checked with errors.Is. ErrNotFound is the govcd not-found error, so that
+// errors.Is(err, ErrNotFound) also holds for the not-found errors returned by govcd. ErrInvalidTarget is the
+// forbidden error with which VCD answers requests for entities that are gone, so that it is also ErrForbidden.
+var (
+	ErrNotFound      = govcd.ErrorEntityNotFound
+	ErrForbidden     = errors.New("access to entity is forbidden")
+	ErrInvalidTarget = fmt.Errorf("target entity is invalid: [%w]", ErrForbidden)
+	ErrBusy          = errors.New("entity is busy")
+	ErrConflict      = errors.New("entity is in conflict")
+	ErrQuotaExceeded = errors.New("quota is exceeded")
+)
+
+// VCD minor error codes that identify the kind of an error regardless of its status code
+const (
+	minorErrorCodeBusyEntity    = "BUSY_ENTITY"
+	minorErrorCodeForbidden     = "ACCESS_TO_RESOURCE_IS_FORBIDDEN"
+	minorErrorCodeNotFound      = "NOT_FOUND"
+	minorErrorCodeDuplicateName = "DUPLICATE_NAME"
+	minorErrorCodeQuotaExceeded = "QUOTA_EXCEEDED"
+)
+
+// invalidTargetRegexp matches the message of the forbidden errors for entities that are gone. VCD uses the same
+// minor error code for them as for missing rights, so that only the message tells them apart.
+var invalidTargetRegexp = regexp.MustCompile(`or the target entity is invalid`)
+
+// govcdAPIErrorRegexp matches the text of a types.Error that govcd has formatted into another error, which only
+// keeps the major error code and the message
+var govcdAPIErrorRegexp = regexp.MustCompile(`API Error: (\d+): (.*)$`)
+
+// VCDError is an error response of VCD. Its kind, one of ErrNotFound, ErrForbidden, ErrInvalidTarget, ErrBusy,
+// ErrConflict or ErrQuotaExceeded, is derived from the minor error code, or else from the status code. Errors of
+// other kinds match none of them.
+type VCDError struct {
+	StatusCode     int
+	MajorErrorCode int
+	MinorErrorCode string
+	Message        string
+}
+
+func (vcdError *VCDError) Error() string {
+	return fmt.Sprintf("VCD error [%d:%s]: [%s]", vcdError.MajorErrorCode, vcdError.MinorErrorCode,
+		vcdError.Message)
+}
+
+// Unwrap returns the kind of the error, so that errors.Is works with the kinds
+func (vcdError *VCDError) Unwrap() error {
+	return vcdErrorKind(vcdError.StatusCode, vcdError.MinorErrorCode, vcdError.Message)
+}
+
+// forbiddenErrorKind returns the kind of a forbidden VCD error with message
+func forbiddenErrorKind(message string) error {
+	if invalidTargetRegexp.MatchString(message) {
+		return ErrInvalidTarget
+	}
+
+	return ErrForbidden
+}
+
+// vcdErrorKind returns the kind of a VCD error with statusCode, minorErrorCode and message, or nil if it is of
+// no kind
+func vcdErrorKind(statusCode int, minorErrorCode string, message string) error {
+	switch minorErrorCode {
+	case minorErrorCodeBusyEntity:
+		return ErrBusy
+	case minorErrorCodeForbidden:
+		return forbiddenErrorKind(message)
+	case minorErrorCodeNotFound:
+		return ErrNotFound
+	case minorErrorCodeDuplicateName:
+		return ErrConflict
+	case minorErrorCodeQuotaExceeded:
+		return ErrQuotaExceeded
+	}
+
+	switch statusCode {
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusForbidden:
+		return forbiddenErrorKind(message)
+	case http.StatusConflict:
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// newVCDErrorFromBody decodes the error body of a response with statusCode, which is JSON for the OpenAPI and
+// XML for the legacy API. Returns nil if body is not a VCD error.
+func newVCDErrorFromBody(statusCode int, body []byte) *VCDError {
+	jsonError := struct {
+		MajorErrorCode int    `json:"majorErrorCode"`
+		MinorErrorCode string `json:"minorErrorCode"`
+		Message        string `json:"message"`
+	}{}
+	if err := json.Unmarshal(body, &jsonError); err == nil &&
+		(jsonError.MinorErrorCode != "" || jsonError.Message != "") {
+		return &VCDError{
+			StatusCode:     statusCode,
+			MajorErrorCode: jsonError.MajorErrorCode,
+			MinorErrorCode: jsonError.MinorErrorCode,
+			Message:        jsonError.Message,
+		}
+	}
+
+	xmlError := types.Error{}
+	if err := xml.Unmarshal(body, &xmlError); err == nil &&
+		(xmlError.MinorErrorCode != "" || xmlError.Message != "") {
+		return &VCDError{
+			StatusCode:     statusCode,
+			MajorErrorCode: xmlError.MajorErrorCode,
+			MinorErrorCode: xmlError.MinorErrorCode,
+			Message:        xmlError.Message,
+		}
+	}
+
+	return nil
+}
+
+// NewVCDErrorFromResponse returns the VCD error in body, the body of the error response resp. If body is not a VCD
+// error, the error only has the status code and the body as message.
+func NewVCDErrorFromResponse(resp *http.Response, body []byte) *VCDError {
+	if vcdError := newVCDErrorFromBody(resp.StatusCode, body); vcdError != nil {
+		return vcdError
+	}
+
+	return &VCDError{
+		StatusCode:     resp.StatusCode,
+		MajorErrorCode: resp.StatusCode,
+		Message:        string(body),
+	}
+}
+
+// NewVCDErrorFromSwagger returns the VCD error in err, an error of the swagger client for the response resp,
+// which may be nil. If the swagger error has no VCD error body, the error only has the status code of resp.
+// Errors that are not swagger errors are returned as they are.
+func NewVCDErrorFromSwagger(resp *http.Response, err error) error {
+	var body []byte
+	switch gsErr := err.(type) {
+	case swaggerClient.GenericSwaggerError:
+		body = gsErr.Body()
+	case *swaggerClient.GenericSwaggerError:
+		if gsErr != nil {
+			body = gsErr.Body()
+		}
+	case nil:
+	default:
+		return err
+	}
+	if resp == nil {
+		return err
+	}
+
+	if vcdError := newVCDErrorFromBody(resp.StatusCode, body); vcdError != nil {
+		return vcdError
+	}
+
+	return &VCDError{
+		StatusCode:     resp.StatusCode,
+		MajorErrorCode: resp.StatusCode,
+		Message:        http.StatusText(resp.StatusCode),
+	}
+}
+
+// NewVCDErrorFromGovcd returns the VCD error in err, an error returned by govcd. govcd returns the VCD errors of
+// the legacy API as a *types.Error, or formats them into its own errors, which keep only the major error code and
+// the message. It reports missing entities with its own not-found error. Other errors are returned as they are.
+func NewVCDErrorFromGovcd(err error) error {
+	if err == nil || errors.Is(err, ErrNotFound) {
+		return err
+	}
+	var apiError *types.Error
+	if errors.As(err, &apiError) {
+		// the major error code of VCD is the status code of the response
+		return &VCDError{
+			StatusCode:     apiError.MajorErrorCode,
+			MajorErrorCode: apiError.MajorErrorCode,
+			MinorErrorCode: apiError.MinorErrorCode,
+			Message:        apiError.Message,
+		}
+	}
+	if govcd.ContainsNotFound(err) {
+		return &VCDError{
+			StatusCode:     http.StatusNotFound,
+			MajorErrorCode: http.StatusNotFound,
+			Message:        err.Error(),
+		}
+	}
+
+	matches := govcdAPIErrorRegexp.FindStringSubmatch(err.Error())
+	if matches == nil {
+		return err
+	}
+	majorErrorCode, convErr := strconv.Atoi(matches[1])
+	if convErr != nil {
+		return err
+	}
+
+	// the major error code of VCD is the status code of the response
+	return &VCDError{
+		StatusCode:     majorErrorCode,
+		MajorErrorCode: majorErrorCode,
+		Message:        matches[2],
+	}
+}
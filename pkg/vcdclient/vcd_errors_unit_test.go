@@ -0,0 +1,209 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+func TestVCDErrorFromBody(t *testing.T) {
+
+	type TestCase struct {
+		StatusCode     int
+		Body           string
+		MinorErrorCode string
+		Message        string
+		Kind           error
+	}
+
+	testCaseList := []TestCase{
+		{
+			http.StatusBadRequest,
+			`{"minorErrorCode":"BUSY_ENTITY","message":"[ a1b2 ] The entity gw is busy completing an operation."}`,
+			"BUSY_ENTITY",
+			"[ a1b2 ] The entity gw is busy completing an operation.",
+			ErrBusy,
+		},
+		{
+			http.StatusForbidden,
+			`<Error xmlns="http://www.vmware.com/vcloud/v1.5" majorErrorCode="403" ` +
+				`minorErrorCode="ACCESS_TO_RESOURCE_IS_FORBIDDEN" message="target entity is invalid"/>`,
+			"ACCESS_TO_RESOURCE_IS_FORBIDDEN",
+			"target entity is invalid",
+			ErrForbidden,
+		},
+		{
+			http.StatusNotFound,
+			`{"minorErrorCode":"BAD_REQUEST","message":"no such pool"}`,
+			"BAD_REQUEST",
+			"no such pool",
+			ErrNotFound,
+		},
+		{
+			http.StatusBadRequest,
+			`{"minorErrorCode":"DUPLICATE_NAME","message":"name is in use"}`,
+			"DUPLICATE_NAME",
+			"name is in use",
+			ErrConflict,
+		},
+		{
+			http.StatusBadRequest,
+			`{"minorErrorCode":"QUOTA_EXCEEDED","message":"vm quota exceeded"}`,
+			"QUOTA_EXCEEDED",
+			"vm quota exceeded",
+			ErrQuotaExceeded,
+		},
+		{
+			http.StatusBadRequest,
+			`{"minorErrorCode":"BAD_REQUEST","message":"invalid port"}`,
+			"BAD_REQUEST",
+			"invalid port",
+			nil,
+		},
+	}
+
+	kinds := []error{ErrNotFound, ErrForbidden, ErrBusy, ErrConflict, ErrQuotaExceeded}
+	for _, tc := range testCaseList {
+		resp := &http.Response{StatusCode: tc.StatusCode}
+		err := fmt.Errorf("unable to update gateway: [%w]", NewVCDErrorFromResponse(resp, []byte(tc.Body)))
+
+		var vcdError *VCDError
+		if assert.True(t, errors.As(err, &vcdError), "Error of body [%s] should be a VCDError", tc.Body) {
+			assert.Equal(t, tc.MinorErrorCode, vcdError.MinorErrorCode, "Unexpected minor code for [%s]", tc.Body)
+			assert.Equal(t, tc.Message, vcdError.Message, "Unexpected message for [%s]", tc.Body)
+		}
+		for _, kind := range kinds {
+			assert.Equal(t, kind == tc.Kind, errors.Is(err, kind), "Unexpected kind [%v] for [%s]", kind, tc.Body)
+		}
+	}
+
+	// a body that is not a VCD error only keeps the status code
+	vcdError := NewVCDErrorFromResponse(&http.Response{StatusCode: http.StatusConflict}, []byte("conflict"))
+	assert.Equal(t, http.StatusConflict, vcdError.MajorErrorCode, "Status code should be the major code")
+	assert.True(t, errors.Is(vcdError, ErrConflict), "409 should be a conflict")
+
+	return
+}
+
+func TestVCDErrorFromGovcd(t *testing.T) {
+
+	type TestCase struct {
+		Err  error
+		Kind error
+	}
+
+	testCaseList := []TestCase{
+		{govcd.ErrorEntityNotFound, ErrNotFound},
+		{fmt.Errorf("error retrieving metadata: %s", govcd.ErrorEntityNotFound), ErrNotFound},
+		{fmt.Errorf("error retrieving vm: API Error: 403: Either you need some or all of the following " +
+			"rights [Base] to perform operations [VAPP_VM_VIEW] for vm-1 or the target entity is invalid"),
+			ErrInvalidTarget},
+		{fmt.Errorf("error retrieving vm: API Error: 403: Either you need some or all of the following " +
+			"rights [Base] to perform operations [VAPP_VM_VIEW] for vm-1"), ErrForbidden},
+		{fmt.Errorf("error retrieving vm: API Error: 409: vm is being changed"), ErrConflict},
+		{&types.Error{MajorErrorCode: http.StatusBadRequest, MinorErrorCode: "BUSY_ENTITY",
+			Message: "vm is busy"}, ErrBusy},
+		{fmt.Errorf("error setting metadata: [%w]", &types.Error{MajorErrorCode: http.StatusForbidden,
+			MinorErrorCode: "ACCESS_TO_RESOURCE_IS_FORBIDDEN", Message: "Either you need some or all of the " +
+				"following rights [Base] to perform operations [VAPP_VM_VIEW] for vm-1 or the target entity is " +
+				"invalid."}), ErrInvalidTarget},
+		{fmt.Errorf("error retrieving vm: API Error: 400: bad request"), nil},
+		{fmt.Errorf("connection refused"), nil},
+	}
+
+	// an invalid target is also forbidden
+	kinds := []error{ErrNotFound, ErrForbidden, ErrInvalidTarget, ErrBusy, ErrConflict, ErrQuotaExceeded}
+	for _, tc := range testCaseList {
+		err := NewVCDErrorFromGovcd(tc.Err)
+		for _, kind := range kinds {
+			assert.Equal(t, errors.Is(tc.Kind, kind), errors.Is(err, kind), "Unexpected kind [%v] for [%v]",
+				kind, tc.Err)
+		}
+	}
+	assert.Nil(t, NewVCDErrorFromGovcd(nil), "nil error should stay nil")
+
+	return
+}
+
+func TestIsVmNotAvailable(t *testing.T) {
+
+	type TestCase struct {
+		Err          error
+		NotAvailable bool
+		ErrorComment string
+	}
+
+	testCaseList := []TestCase{
+		{
+			Err:          fmt.Errorf("unable to get vm: [%w]", govcd.ErrorEntityNotFound),
+			NotAvailable: true,
+			ErrorComment: "VM that is not found should not be available",
+		},
+		{
+			Err: fmt.Errorf("unable to get vm: [%w]", NewVCDErrorFromGovcd(fmt.Errorf("error retrieving vm: "+
+				"API Error: 403: Either you need some or all of the following rights [Base] to perform operations "+
+				"[VAPP_VM_VIEW] for vm-1 or the target entity is invalid"))),
+			NotAvailable: true,
+			ErrorComment: "VM whose target entity is invalid should not be available",
+		},
+		{
+			Err: fmt.Errorf("unable to get vm: [%w]", NewVCDErrorFromGovcd(fmt.Errorf("error retrieving vm: "+
+				"API Error: 403: Either you need some or all of the following rights [Base] to perform operations "+
+				"[VAPP_VM_VIEW] for vm-1"))),
+			NotAvailable: false,
+			ErrorComment: "VM that the user may not view should be available",
+		},
+		{
+			Err: fmt.Errorf("unable to get vm: [%w]", NewVCDErrorFromGovcd(&types.Error{
+				MajorErrorCode: http.StatusForbidden,
+				MinorErrorCode: "ACCESS_TO_RESOURCE_IS_FORBIDDEN",
+				Message: "Either you need some or all of the following rights [Base] to perform operations " +
+					"[VAPP_VM_VIEW] for vm-1 or the target entity is invalid.",
+			})),
+			NotAvailable: true,
+			ErrorComment: "VM whose target entity is invalid should not be available when govcd keeps the VCD error",
+		},
+		{
+			Err:          fmt.Errorf("unable to get vm: [%w]", ErrForbidden),
+			NotAvailable: false,
+			ErrorComment: "Plain forbidden error should not make the VM unavailable",
+		},
+		{
+			Err:          fmt.Errorf("connection refused"),
+			NotAvailable: false,
+			ErrorComment: "Other errors should not make the VM unavailable",
+		},
+	}
+
+	client := &Client{}
+	for _, testCase := range testCaseList {
+		assert.Equal(t, testCase.NotAvailable, client.IsVmNotAvailable(testCase.Err), testCase.ErrorComment)
+	}
+
+	return
+}
+
+func TestBusyErrorKinds(t *testing.T) {
+	busyErrors := []error{
+		NewVirtualServiceBusyError("vs"),
+		NewLBPoolBusyError("pool"),
+		NewGatewayBusyError("gateway"),
+		&TaskFailedError{MajorErrorCode: http.StatusBadRequest, MinorErrorCode: "BUSY_ENTITY"},
+	}
+	for _, err := range busyErrors {
+		assert.True(t, errors.Is(fmt.Errorf("wrapped: [%w]", err), ErrBusy), "[%v] should be busy", err)
+		assert.False(t, errors.Is(err, ErrNotFound), "[%v] should not be not-found", err)
+	}
+
+	return
+}
@@ -0,0 +1,251 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+	"k8s.io/klog"
+)
+
+const (
+	// MinSupportedAPIVersion is the first version with NSX-T Advanced Load Balancer support
+	MinSupportedAPIVersion = "35.0"
+	// MaxSupportedAPIVersion is the version the swagger models are generated for. Requests of the swagger client
+	// ask for the negotiated version, so that newer versions may only be negotiated once the models cover them.
+	MaxSupportedAPIVersion = VCloudApiVersion
+)
+
+// APIVersionConfig : window of VCD API versions that may be negotiated. Unset bounds default to the range
+// supported by the provider, and bounds outside that range are narrowed to it.
+type APIVersionConfig struct {
+	Min string `json:"min"`
+	Max string `json:"max"`
+}
+
+// Feature : a capability of VCD that is available from a certain API version on. Multi-port virtual services
+// (37.0) and IP Spaces (37.1) are not features yet, since the swagger models predate them.
+type Feature string
+
+const (
+	// FeatureNATRuleType : the kind of NAT rule is set through type; ruleType is deprecated
+	FeatureNATRuleType = Feature("NATRuleType")
+)
+
+var featureMinAPIVersions = map[Feature]string{
+	FeatureNATRuleType: "36.0",
+}
+
+// apiVersion : VCD API version of the form major.minor
+type apiVersion struct {
+	major int
+	minor int
+}
+
+func parseAPIVersion(version string) (apiVersion, error) {
+	parts := strings.Split(strings.TrimSpace(version), ".")
+	if len(parts) != 2 {
+		return apiVersion{}, fmt.Errorf("api version [%s] is not of the form major.minor", version)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return apiVersion{}, fmt.Errorf("invalid major version in api version [%s]: [%v]", version, err)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return apiVersion{}, fmt.Errorf("invalid minor version in api version [%s]: [%v]", version, err)
+	}
+
+	return apiVersion{major: major, minor: minor}, nil
+}
+
+func (version apiVersion) less(other apiVersion) bool {
+	if version.major != other.major {
+		return version.major < other.major
+	}
+	return version.minor < other.minor
+}
+
+func (version apiVersion) String() string {
+	return fmt.Sprintf("%d.%d", version.major, version.minor)
+}
+
+// window returns the range of versions that may be negotiated
+func (apiVersionConfig *APIVersionConfig) window() (apiVersion, apiVersion, error) {
+	minVersion, _ := parseAPIVersion(MinSupportedAPIVersion)
+	maxVersion, _ := parseAPIVersion(MaxSupportedAPIVersion)
+	if apiVersionConfig.Min != "" {
+		configuredMin, err := parseAPIVersion(apiVersionConfig.Min)
+		if err != nil {
+			return apiVersion{}, apiVersion{}, fmt.Errorf("invalid minimum api version: [%v]", err)
+		}
+		if minVersion.less(configuredMin) {
+			minVersion = configuredMin
+		}
+	}
+	if apiVersionConfig.Max != "" {
+		configuredMax, err := parseAPIVersion(apiVersionConfig.Max)
+		if err != nil {
+			return apiVersion{}, apiVersion{}, fmt.Errorf("invalid maximum api version: [%v]", err)
+		}
+		if configuredMax.less(maxVersion) {
+			maxVersion = configuredMax
+		}
+	}
+	if maxVersion.less(minVersion) {
+		return apiVersion{}, apiVersion{}, fmt.Errorf("no api version in range [%s, %s] is supported by the provider",
+			apiVersionConfig.Min, apiVersionConfig.Max)
+	}
+
+	return minVersion, maxVersion, nil
+}
+
+// pickAPIVersion picks the highest of the versions offered by VCD that lies in the configured window
+func pickAPIVersion(offeredVersions []string, apiVersionConfig APIVersionConfig) (string, error) {
+	minVersion, maxVersion, err := apiVersionConfig.window()
+	if err != nil {
+		return "", err
+	}
+
+	var negotiated *apiVersion
+	for _, offeredVersion := range offeredVersions {
+		version, err := parseAPIVersion(offeredVersion)
+		if err != nil {
+			klog.V(3).Infof("Ignoring api version [%s] offered by VCD: [%v]", offeredVersion, err)
+			continue
+		}
+		if version.less(minVersion) || maxVersion.less(version) {
+			continue
+		}
+		if negotiated == nil || negotiated.less(version) {
+			negotiated = &version
+		}
+	}
+	if negotiated == nil {
+		return "", fmt.Errorf("VCD offers api versions [%s], none of which is in range [%s, %s]",
+			strings.Join(offeredVersions, ","), minVersion, maxVersion)
+	}
+
+	return negotiated.String(), nil
+}
+
+// fetchSupportedAPIVersions lists the api versions offered by VCD. The endpoint does not need authentication.
+func fetchSupportedAPIVersions(vcdClient *govcd.VCDClient) ([]string, error) {
+	versionsURL := vcdClient.Client.VCDHREF
+	versionsURL.Path += "/versions"
+	resp, err := vcdClient.Client.Http.Get(versionsURL.String())
+	if err != nil {
+		return nil, fmt.Errorf("unable to get api versions from [%s]: [%v]", versionsURL.String(), err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			klog.Errorf("unable to close response body of [%s]: [%v]", versionsURL.String(), err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		responseMessageBytes, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unable to get api versions from [%s]; expected http response [%v], obtained [%v]: [%w]",
+			versionsURL.String(), http.StatusOK, resp.StatusCode, NewVCDErrorFromResponse(resp, responseMessageBytes))
+	}
+
+	supportedVersions := govcd.SupportedVersions{}
+	if err = xml.NewDecoder(resp.Body).Decode(&supportedVersions); err != nil {
+		return nil, fmt.Errorf("unable to decode api versions from [%s]: [%v]", versionsURL.String(), err)
+	}
+	offeredVersions := make([]string, 0, len(supportedVersions.VersionInfos))
+	for _, versionInfo := range supportedVersions.VersionInfos {
+		offeredVersions = append(offeredVersions, versionInfo.Version)
+	}
+
+	return offeredVersions, nil
+}
+
+// negotiateAPIVersion sets the api version of vcdClient to the highest version that both VCD and the
+// provider support within the configured window.
+func (config *VCDAuthConfig) negotiateAPIVersion(vcdClient *govcd.VCDClient) error {
+	offeredVersions, err := fetchSupportedAPIVersions(vcdClient)
+	if err != nil {
+		return fmt.Errorf("unable to get api versions supported by VCD: [%v]", err)
+	}
+	negotiatedVersion, err := pickAPIVersion(offeredVersions, config.APIVersion)
+	if err != nil {
+		return fmt.Errorf("unable to negotiate api version: [%v]", err)
+	}
+	vcdClient.Client.APIVersion = negotiatedVersion
+	klog.Infof("Negotiated VCD api version [%s]", negotiatedVersion)
+
+	return nil
+}
+
+// APIVersion : returns the VCD api version negotiated by the client
+func (client *Client) APIVersion() string {
+	return client.VCDClient.Client.APIVersion
+}
+
+// SupportsFeature : returns true if the negotiated api version provides feature
+func (client *Client) SupportsFeature(feature Feature) bool {
+	minVersionString, ok := featureMinAPIVersions[feature]
+	if !ok {
+		return false
+	}
+	minVersion, _ := parseAPIVersion(minVersionString)
+	negotiatedVersion, err := parseAPIVersion(client.APIVersion())
+	if err != nil {
+		return false
+	}
+
+	return !negotiatedVersion.less(minVersion)
+}
+
+// logFeatures logs which of the known features are available with the negotiated api version
+func (client *Client) logFeatures() {
+	features := make([]string, 0, len(featureMinAPIVersions))
+	for feature := range featureMinAPIVersions {
+		features = append(features, fmt.Sprintf("%s=%v", feature, client.SupportsFeature(feature)))
+	}
+	klog.Infof("Features available with VCD api version [%s]: [%s]", client.APIVersion(), strings.Join(features, ","))
+}
+
+var acceptVersionRegexp = regexp.MustCompile(`version=[0-9]+\.[0-9]+`)
+
+// cloudAPIVersionTransport makes requests of the swagger client, which is generated for a fixed api version,
+// ask for the negotiated api version instead.
+type cloudAPIVersionTransport struct {
+	apiVersion string
+	base       http.RoundTripper
+}
+
+func (transport *cloudAPIVersionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	accept := req.Header.Get("Accept")
+	if accept == "" {
+		return transport.base.RoundTrip(req)
+	}
+
+	versionedReq := req.Clone(req.Context())
+	versionedReq.Header.Set("Accept",
+		acceptVersionRegexp.ReplaceAllString(accept, fmt.Sprintf("version=%s", transport.apiVersion)))
+	return transport.base.RoundTrip(versionedReq)
+}
+
+// newSwaggerHTTPClient returns the http client for the swagger client. It uses the transport of vcdClient, so
+// that TLS, proxy and bearer token handling are shared, and the api version negotiated by vcdClient.
+func newSwaggerHTTPClient(vcdClient *govcd.VCDClient) *http.Client {
+	return &http.Client{
+		Transport: &cloudAPIVersionTransport{
+			apiVersion: vcdClient.Client.APIVersion,
+			base:       vcdClient.Client.Http.Transport,
+		},
+		Timeout: vcdClient.Client.Http.Timeout,
+	}
+}
@@ -0,0 +1,125 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+)
+
+func TestPickAPIVersion(t *testing.T) {
+
+	type TestCase struct {
+		OfferedVersions  []string
+		APIVersionConfig APIVersionConfig
+		Version          string
+		ExpectError      bool
+	}
+
+	testCaseList := []TestCase{
+		{[]string{"33.0", "34.0", "35.0", "36.0"}, APIVersionConfig{}, "36.0", false},
+		{[]string{"35.0", "36.0", "36.1"}, APIVersionConfig{Max: "35.0"}, "35.0", false},
+		{[]string{"36.0", "37.0", "37.1", "38.0"}, APIVersionConfig{}, MaxSupportedAPIVersion, false},
+		{[]string{"36.0", "37.0"}, APIVersionConfig{Max: "37.0"}, MaxSupportedAPIVersion, false},
+		{[]string{"35.10", "35.9"}, APIVersionConfig{Max: "35.10"}, "35.10", false},
+		{[]string{"35.0", "36.0"}, APIVersionConfig{Min: "36.1"}, "", true},
+		{[]string{"32.0", "33.0", "34.0"}, APIVersionConfig{}, "", true},
+		{[]string{"36.0", "invalid"}, APIVersionConfig{}, "36.0", false},
+		{[]string{"36.0"}, APIVersionConfig{Min: "37.0", Max: "36.0"}, "", true},
+		{[]string{"36.0"}, APIVersionConfig{Min: "thirty-six"}, "", true},
+	}
+
+	for _, tc := range testCaseList {
+		version, err := pickAPIVersion(tc.OfferedVersions, tc.APIVersionConfig)
+		if tc.ExpectError {
+			assert.Error(t, err, "Expected error for offered versions [%v] and config [%v]",
+				tc.OfferedVersions, tc.APIVersionConfig)
+			continue
+		}
+		assert.NoError(t, err, "Unexpected error for offered versions [%v] and config [%v]",
+			tc.OfferedVersions, tc.APIVersionConfig)
+		assert.Equal(t, tc.Version, version, "Unexpected version picked from [%v] with config [%v]",
+			tc.OfferedVersions, tc.APIVersionConfig)
+	}
+
+	return
+}
+
+func TestSupportsFeature(t *testing.T) {
+	client := &Client{
+		VCDClient: &govcd.VCDClient{},
+	}
+
+	client.VCDClient.Client.APIVersion = "35.0"
+	assert.False(t, client.SupportsFeature(FeatureNATRuleType), "NAT rule type should not be supported in 35.0")
+
+	client.VCDClient.Client.APIVersion = "36.0"
+	assert.True(t, client.SupportsFeature(FeatureNATRuleType), "NAT rule type should be supported in 36.0")
+
+	client.VCDClient.Client.APIVersion = "37.1"
+	assert.True(t, client.SupportsFeature(FeatureNATRuleType), "NAT rule type should be supported in 37.1")
+	assert.False(t, client.SupportsFeature(Feature("Unknown")), "Unknown features should not be supported")
+
+	return
+}
+
+func TestNegotiateAPIVersion(t *testing.T) {
+	acceptHeaders := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/versions" {
+			w.Header().Set("Content-Type", "application/xml")
+			_, _ = fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<SupportedVersions xmlns="http://www.vmware.com/vcloud/versions">
+    <VersionInfo deprecated="true"><Version>34.0</Version></VersionInfo>
+    <VersionInfo deprecated="false"><Version>35.0</Version></VersionInfo>
+    <VersionInfo deprecated="false"><Version>36.0</Version></VersionInfo>
+    <VersionInfo deprecated="false"><Version>36.1</Version></VersionInfo>
+</SupportedVersions>`)
+			return
+		}
+		acceptHeaders = append(acceptHeaders, r.Header.Get("Accept"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL + "/api")
+	assert.NoError(t, err, "Unable to parse test server URL")
+	vcdClient := govcd.NewVCDClient(*u, true)
+
+	config := &VCDAuthConfig{}
+	err = config.negotiateAPIVersion(vcdClient)
+	assert.NoError(t, err, "Api version should be negotiated")
+	assert.Equal(t, MaxSupportedAPIVersion, vcdClient.Client.APIVersion,
+		"Highest offered version that the swagger models cover should be negotiated")
+
+	config.APIVersion = APIVersionConfig{Max: "35.0"}
+	err = config.negotiateAPIVersion(vcdClient)
+	assert.NoError(t, err, "Api version should be negotiated")
+	assert.Equal(t, "35.0", vcdClient.Client.APIVersion, "Highest version in the window should be negotiated")
+
+	// requests of the swagger client ask for the negotiated version
+	httpClient := newSwaggerHTTPClient(vcdClient)
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/cloudapi/1.0.0/edgeGateways", nil)
+	assert.NoError(t, err, "Unable to create request")
+	req.Header.Set("Accept", fmt.Sprintf("application/json;version=%s", VCloudApiVersion))
+	resp, err := httpClient.Do(req)
+	assert.NoError(t, err, "Request should succeed")
+	_ = resp.Body.Close()
+	assert.Equal(t, []string{"application/json;version=35.0"}, acceptHeaders,
+		"Accept header should carry the negotiated version")
+
+	config.APIVersion = APIVersionConfig{Min: "37.0"}
+	err = config.negotiateAPIVersion(vcdClient)
+	assert.Error(t, err, "Negotiation should fail if VCD offers no version in the window")
+
+	return
+}
@@ -0,0 +1,106 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// VMSelector : selects the VMs of the cluster in the VDC. VMs in vApps that match any of VAppNames, VAppGlobs or
+// VAppRegexps are selected. If MetadataKey is set, the VMs whose metadata MetadataKey has the string value
+// MetadataValue are selected instead, in any vApp of the VDC.
+type VMSelector struct {
+	VAppNames     []string
+	VAppGlobs     []string
+	VAppRegexps   []*regexp.Regexp
+	MetadataKey   string
+	MetadataValue string
+}
+
+// String : describes the selector for logs
+func (selector *VMSelector) String() string {
+	if selector.MetadataKey != "" {
+		return fmt.Sprintf("metadata:%s=%s", selector.MetadataKey, selector.MetadataValue)
+	}
+	entries := append([]string{}, selector.VAppNames...)
+	entries = append(entries, selector.VAppGlobs...)
+	for _, vAppRegexp := range selector.VAppRegexps {
+		entries = append(entries, "/"+vAppRegexp.String()+"/")
+	}
+
+	return strings.Join(entries, ",")
+}
+
+// MarshalJSON : writes the regular expressions as strings, so that the keys of ClientCache tell selectors apart
+func (selector VMSelector) MarshalJSON() ([]byte, error) {
+	vAppRegexps := make([]string, len(selector.VAppRegexps))
+	for idx, vAppRegexp := range selector.VAppRegexps {
+		vAppRegexps[idx] = vAppRegexp.String()
+	}
+
+	return json.Marshal(struct {
+		VAppNames     []string
+		VAppGlobs     []string
+		VAppRegexps   []string
+		MetadataKey   string
+		MetadataValue string
+	}{selector.VAppNames, selector.VAppGlobs, vAppRegexps, selector.MetadataKey, selector.MetadataValue})
+}
+
+func (selector *VMSelector) isEmpty() bool {
+	return selector.MetadataKey == "" && len(selector.VAppNames) == 0 && len(selector.VAppGlobs) == 0 &&
+		len(selector.VAppRegexps) == 0
+}
+
+// matchesVApp returns true if VMs in the vApp vAppName are selected
+func (selector *VMSelector) matchesVApp(vAppName string) bool {
+	if selector.MetadataKey != "" {
+		return true
+	}
+	for _, name := range selector.VAppNames {
+		if name == vAppName {
+			return true
+		}
+	}
+	for _, glob := range selector.VAppGlobs {
+		if matched, _ := path.Match(glob, vAppName); matched {
+			return true
+		}
+	}
+	for _, vAppRegexp := range selector.VAppRegexps {
+		if vAppRegexp.MatchString(vAppName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// queryFilter returns the encoded filter of a VM query in the VDC at vdcHREF for the selected VMs. Globs and
+// regular expressions cannot be expressed in a filter, so with those the filter selects all VMs of the VDC and
+// the records have to be matched with matchesVApp.
+func (selector *VMSelector) queryFilter(vdcHREF string) string {
+	filter := fmt.Sprintf("vdc==%s", url.QueryEscape(vdcHREF))
+	if selector.MetadataKey != "" {
+		return fmt.Sprintf("%s;metadata:%s==STRING:%s", filter, url.QueryEscape(selector.MetadataKey),
+			url.QueryEscape(selector.MetadataValue))
+	}
+	if len(selector.VAppGlobs) > 0 || len(selector.VAppRegexps) > 0 {
+		return filter
+	}
+
+	containerFilters := make([]string, len(selector.VAppNames))
+	for idx, name := range selector.VAppNames {
+		containerFilters[idx] = fmt.Sprintf("containerName==%s", url.QueryEscape(name))
+	}
+
+	return fmt.Sprintf("%s;(%s)", filter, strings.Join(containerFilters, ","))
+}
@@ -0,0 +1,80 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVMSelector(t *testing.T) {
+	vdcHREF := "https://vcd.example.com/api/vdc/1"
+
+	type TestCase struct {
+		Selector       VMSelector
+		Filter         string
+		MatchingVApps  []string
+		UnmatchedVApps []string
+	}
+
+	testCaseList := []TestCase{
+		{
+			VMSelector{VAppNames: []string{"cluster"}},
+			"vdc==https%3A%2F%2Fvcd.example.com%2Fapi%2Fvdc%2F1;(containerName==cluster)",
+			[]string{"cluster"},
+			[]string{"cluster-gpu"},
+		},
+		{
+			VMSelector{VAppNames: []string{"cluster", "cluster gpu"}},
+			"vdc==https%3A%2F%2Fvcd.example.com%2Fapi%2Fvdc%2F1;(containerName==cluster,containerName==cluster+gpu)",
+			[]string{"cluster", "cluster gpu"},
+			[]string{"infra"},
+		},
+		{
+			VMSelector{VAppNames: []string{"cluster"}, VAppGlobs: []string{"cluster-*"},
+				VAppRegexps: []*regexp.Regexp{regexp.MustCompile(`^infra-[0-9]+$`)}},
+			"vdc==https%3A%2F%2Fvcd.example.com%2Fapi%2Fvdc%2F1",
+			[]string{"cluster", "cluster-gpu", "infra-2"},
+			[]string{"other-cluster", "infra-x"},
+		},
+		{
+			VMSelector{MetadataKey: "cluster-id", MetadataValue: "urn:vcloud:entity:1"},
+			"vdc==https%3A%2F%2Fvcd.example.com%2Fapi%2Fvdc%2F1;metadata:cluster-id==STRING:urn%3Avcloud%3Aentity%3A1",
+			[]string{"cluster", "any"},
+			[]string{},
+		},
+	}
+
+	for _, tc := range testCaseList {
+		assert.Equal(t, tc.Filter, tc.Selector.queryFilter(vdcHREF), "Unexpected filter for [%s]", tc.Selector.String())
+		for _, vAppName := range tc.MatchingVApps {
+			assert.True(t, tc.Selector.matchesVApp(vAppName), "vApp [%s] should match [%s]", vAppName,
+				tc.Selector.String())
+		}
+		for _, vAppName := range tc.UnmatchedVApps {
+			assert.False(t, tc.Selector.matchesVApp(vAppName), "vApp [%s] should not match [%s]", vAppName,
+				tc.Selector.String())
+		}
+	}
+
+	return
+}
+
+func TestVMSelectorClientCacheKey(t *testing.T) {
+	gpuKey, err := clientCacheKey(&ClientOptions{VMSelector: VMSelector{
+		VAppRegexps: []*regexp.Regexp{regexp.MustCompile(`^gpu-`)},
+	}})
+	assert.NoError(t, err, "Unable to get cache key")
+	infraKey, err := clientCacheKey(&ClientOptions{VMSelector: VMSelector{
+		VAppRegexps: []*regexp.Regexp{regexp.MustCompile(`^infra-`)},
+	}})
+	assert.NoError(t, err, "Unable to get cache key")
+	assert.NotEqual(t, gpuKey, infraKey, "Selectors with different regular expressions should not share a client")
+
+	return
+}
@@ -6,78 +6,403 @@
 package vcdclient
 
 import (
+	"context"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"k8s.io/klog"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
 	"strings"
 
+	"github.com/antihax/optional"
 	"github.com/vmware/go-vcloud-director/v2/govcd"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
 )
 
 const (
 	// VCDVMIDPrefix is a prefix added to VM objects by VCD. This needs
 	// to be removed for query operations.
 	VCDVMIDPrefix = "urn:vcloud:vm:"
+
+	// vmHREFPrefix is the prefix of the uuid in the last segment of the href of a VM
+	vmHREFPrefix = "vm-"
+
+	// vmQueryPageSize is the number of VMs fetched per request when listing the VMs of the vApp
+	vmQueryPageSize = 128
+
+	// MetadataDomainGeneral holds the metadata that users of the org can read and write. MetadataDomainSystem
+	// holds the metadata that only system administrators can write; it is shown read-only to users of the org.
+	MetadataDomainGeneral = "GENERAL"
+	MetadataDomainSystem  = "SYSTEM"
 )
 
-// FindVMByName finds a VM in a vApp using the name. The client is expected to have a valid
-// bearer token when this function is called.
+// metadataValue is a types.MetadataValue with the domain of the entry, which govcd cannot set
+type metadataValue struct {
+	XMLName    xml.Name          `xml:"MetadataValue"`
+	Xsi        string            `xml:"xmlns:xsi,attr"`
+	Xmlns      string            `xml:"xmlns,attr"`
+	Domain     *metadataDomain   `xml:"Domain,omitempty"`
+	TypedValue *types.TypedValue `xml:"TypedValue"`
+}
+
+type metadataDomain struct {
+	Visibility string `xml:"visibility,attr"`
+	Domain     string `xml:",chardata"`
+}
+
+// FindVMByName finds a VM among the VMs selected by the VM selector of the client using the name. A name used
+// by several selected VMs yields a DuplicateVMNameError. The client is expected to have a valid bearer token
+// when this function is called.
 func (client *Client) FindVMByName(vmName string) (*govcd.VM, error) {
 	if vmName == "" {
 		return nil, fmt.Errorf("vmName mandatory for FindVMByName")
 	}
 
-	klog.Infof("Trying to find vm [%s] in vApp [%s] by name", vmName, client.ClusterVAppName)
-	vApp, err := client.VDC.GetVAppByName(client.ClusterVAppName, true)
-	if err != nil {
-		return nil, fmt.Errorf("unable to find vApp [%s] by name: [%v]", client.ClusterVAppName, err)
-	}
-
-	vm, err := vApp.GetVMByName(vmName, true)
+	klog.Infof("Trying to find vm [%s] in vApps [%s] by name", vmName, client.ClusterVAppName)
+	vmRecords, err := client.queryClusterVMs(fmt.Sprintf("name==%s", url.QueryEscape(vmName)))
 	if err != nil {
-		return nil, fmt.Errorf("unable to find vm [%s] in vApp [%s]: [%v]", vmName, client.ClusterVAppName, err)
+		return nil, fmt.Errorf("unable to find vm [%s] in vApps [%s]: [%v]", vmName, client.ClusterVAppName, err)
 	}
 
-	return vm, nil
+	return client.getSingleVM(vmName, vmRecords)
 }
 
-// FindVMByUUID finds a VM in a vApp using the UUID. The client is expected to have a valid
-// bearer token when this function is called.
+// FindVMByUUID finds a VM among the VMs selected by the VM selector of the client using the UUID. The client
+// is expected to have a valid bearer token when this function is called.
 func (client *Client) FindVMByUUID(vcdVmUUID string) (*govcd.VM, error) {
 	if vcdVmUUID == "" {
 		return nil, fmt.Errorf("vmUUID mandatory for FindVMByUUID")
 	}
 
-	klog.Infof("Trying to find vm [%s] in vApp [%s] by UUID", vcdVmUUID, client.ClusterVAppName)
-	vmUUID := strings.TrimPrefix(vcdVmUUID, VCDVMIDPrefix)
+	klog.Infof("Trying to find vm [%s] in vApps [%s] by UUID", vcdVmUUID, client.ClusterVAppName)
+	vmID := VCDVMIDPrefix + strings.ToLower(strings.TrimPrefix(vcdVmUUID, VCDVMIDPrefix))
+
+	// VM queries cannot be filtered by id, so the selected VMs are listed
+	vmRecords, err := client.ListClusterVMs()
+	if err != nil {
+		return nil, fmt.Errorf("unable to find vm UUID [%s] in vApps [%s]: [%v]",
+			vcdVmUUID, client.ClusterVAppName, err)
+	}
+	for _, vmRecord := range vmRecords {
+		if vmRecord.ID != vmID {
+			continue
+		}
+		vm, err := client.VCDClient.Client.GetVMByHref(vmRecord.HREF)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get vm UUID [%s] in vApp [%s]: [%w]",
+				vcdVmUUID, vmRecord.ContainerName, NewVCDErrorFromGovcd(err))
+		}
+		return vm, nil
+	}
+
+	return nil, govcd.ErrorEntityNotFound
+}
+
+// FindVMByMetadata finds the VM among the VMs selected by the VM selector of the client whose metadata key has
+// the string value. A value used by several selected VMs yields a DuplicateVMNameError. The client is expected to
+// have a valid bearer token when this function is called.
+func (client *Client) FindVMByMetadata(key string, value string) (*govcd.VM, error) {
+	if key == "" || value == "" {
+		return nil, fmt.Errorf("key and value mandatory for FindVMByMetadata")
+	}
+
+	klog.Infof("Trying to find vm with metadata [%s=%s] in vApps [%s]", key, value, client.ClusterVAppName)
+	vmRecords, err := client.queryClusterVMs(fmt.Sprintf("metadata:%s==STRING:%s", url.QueryEscape(key),
+		url.QueryEscape(value)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to find vm with metadata [%s=%s] in vApps [%s]: [%v]",
+			key, value, client.ClusterVAppName, err)
+	}
+
+	return client.getSingleVM(value, vmRecords)
+}
+
+// FindVMByComputerName finds the VM among the VMs selected by the VM selector of the client whose guest
+// customization sets computerName. The computer name cannot be queried, so every selected VM is fetched. A
+// computer name used by several selected VMs yields a DuplicateVMNameError. The client is expected to have a
+// valid bearer token when this function is called.
+func (client *Client) FindVMByComputerName(computerName string) (*govcd.VM, error) {
+	if computerName == "" {
+		return nil, fmt.Errorf("computerName mandatory for FindVMByComputerName")
+	}
 
-	vApp, err := client.VDC.GetVAppByName(client.ClusterVAppName, true)
+	klog.Infof("Trying to find vm with computer name [%s] in vApps [%s]", computerName, client.ClusterVAppName)
+	vmRecords, err := client.ListClusterVMs()
 	if err != nil {
-		return nil, fmt.Errorf("unable to find vApp [%s] by name: [%v]", client.ClusterVAppName, err)
+		return nil, fmt.Errorf("unable to find vm with computer name [%s] in vApps [%s]: [%v]",
+			computerName, client.ClusterVAppName, err)
 	}
 
+	var matchingVM *govcd.VM = nil
+	matchingVAppNames := make([]string, 0)
+	for _, vmRecord := range vmRecords {
+		vm, err := client.VCDClient.Client.GetVMByHref(vmRecord.HREF)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get vm [%s] in vApp [%s]: [%w]", vmRecord.Name,
+				vmRecord.ContainerName, NewVCDErrorFromGovcd(err))
+		}
+		if vm.VM.GuestCustomizationSection == nil ||
+			!strings.EqualFold(vm.VM.GuestCustomizationSection.ComputerName, computerName) {
+			continue
+		}
+		matchingVM = vm
+		matchingVAppNames = append(matchingVAppNames, vmRecord.ContainerName)
+	}
+	if len(matchingVAppNames) > 1 {
+		return nil, NewDuplicateVMNameError(computerName, matchingVAppNames)
+	}
+	if matchingVM == nil {
+		return nil, govcd.ErrorEntityNotFound
+	}
+
+	return matchingVM, nil
+}
+
+// getSingleVM fetches the VM of the only record in vmRecords, which were found by name
+func (client *Client) getSingleVM(name string, vmRecords []*types.QueryResultVMRecordType) (*govcd.VM, error) {
+	if len(vmRecords) == 0 {
+		return nil, govcd.ErrorEntityNotFound
+	}
+	if len(vmRecords) > 1 {
+		vAppNames := make([]string, len(vmRecords))
+		for idx, vmRecord := range vmRecords {
+			vAppNames[idx] = vmRecord.ContainerName
+		}
+		return nil, NewDuplicateVMNameError(name, vAppNames)
+	}
 
-	vm, err := vApp.GetVMById(vmUUID, true)
+	vm, err := client.VCDClient.Client.GetVMByHref(vmRecords[0].HREF)
 	if err != nil {
-		return nil, fmt.Errorf("unable to find vm UUID [%s] in vApp [%s]: [%v]",
-			vmUUID, client.ClusterVAppName, err)
+		return nil, fmt.Errorf("unable to get vm [%s] in vApp [%s]: [%w]", vmRecords[0].Name,
+			vmRecords[0].ContainerName, NewVCDErrorFromGovcd(err))
 	}
 
 	return vm, nil
 }
 
 // IsVmNotAvailable : In VCD, if the VM is not available, it can be an access error or the VM may not be present.
-// Hence we sometimes get an error different from govcd.ErrorEntityNotFound
+// VCD answers requests for VMs that are gone with ErrInvalidTarget. Other forbidden errors mean that the user lacks
+// rights to a VM that may well exist, so they are not taken for VMs that are gone.
 func (client *Client) IsVmNotAvailable(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, ErrInvalidTarget)
+}
 
-	if strings.Contains(err.Error(), "Either you need some or all of the following rights [Base]") &&
-		strings.Contains(err.Error(), "to perform operations [VAPP_VM_VIEW]") &&
-		strings.Contains(err.Error(), "target entity is invalid") {
-		return true
+// GetVMMetadata returns the metadata entries of the VM at vmHREF by key. The client is expected to have a valid
+// bearer token when this function is called.
+func (client *Client) GetVMMetadata(vmHREF string) (map[string]string, error) {
+	if vmHREF == "" {
+		return nil, fmt.Errorf("vmHREF mandatory for GetVMMetadata")
 	}
 
-	if strings.Contains(err.Error(), "error refreshing VM: cannot refresh VM, Object is empty") {
-		return true
+	vm, err := client.VCDClient.Client.GetVMByHref(vmHREF)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get vm [%s]: [%w]", vmHREF, NewVCDErrorFromGovcd(err))
+	}
+	metadata, err := vm.GetMetadata()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get metadata of vm [%s]: [%w]", vm.VM.Name,
+			NewVCDErrorFromGovcd(err))
+	}
+
+	entries := make(map[string]string)
+	for _, entry := range metadata.MetadataEntry {
+		if entry == nil || entry.TypedValue == nil {
+			continue
+		}
+		entries[entry.Key] = entry.TypedValue.Value
+	}
+
+	return entries, nil
+}
+
+// metadataEntryDomain returns the domain of entry. Entries of the GENERAL domain have none.
+func metadataEntryDomain(entry *types.MetadataEntry) string {
+	if entry.Domain == "" {
+		return MetadataDomainGeneral
+	}
+
+	return entry.Domain
+}
+
+// vmMetadataURL returns the url of the metadata entry key of the VM at vmHREF in domain
+func vmMetadataURL(vmHREF string, domain string, key string) string {
+	if domain == MetadataDomainSystem {
+		return fmt.Sprintf("%s/metadata/%s/%s", strings.TrimSuffix(vmHREF, "/"), domain, url.PathEscape(key))
+	}
+
+	return fmt.Sprintf("%s/metadata/%s", strings.TrimSuffix(vmHREF, "/"), url.PathEscape(key))
+}
+
+// SetVMMetadata makes the metadata entries of the VM at vmHREF in domain whose keys start with prefix the
+// entries, which must all have keys with that prefix. The domain is GENERAL or SYSTEM, and an empty domain is
+// GENERAL. Entries that already have their value are not written again, and entries with the prefix that are not
+// in entries are deleted. Entries of the other domain are left alone. Returns true if the metadata of the VM was
+// changed. The client is expected to have a valid bearer token when this function is called.
+func (client *Client) SetVMMetadata(ctx context.Context, vmHREF string, domain string, prefix string,
+	entries map[string]string) (bool, error) {
+	if vmHREF == "" || prefix == "" {
+		return false, fmt.Errorf("vmHREF and prefix mandatory for SetVMMetadata")
+	}
+	switch domain {
+	case "":
+		domain = MetadataDomainGeneral
+	case MetadataDomainGeneral, MetadataDomainSystem:
+	default:
+		return false, fmt.Errorf("unknown metadata domain [%s]", domain)
+	}
+	for key := range entries {
+		if !strings.HasPrefix(key, prefix) {
+			return false, fmt.Errorf("metadata key [%s] does not have prefix [%s]", key, prefix)
+		}
+	}
+
+	vm, err := client.VCDClient.Client.GetVMByHref(vmHREF)
+	if err != nil {
+		return false, fmt.Errorf("unable to get vm [%s]: [%w]", vmHREF, NewVCDErrorFromGovcd(err))
+	}
+	metadata, err := vm.GetMetadata()
+	if err != nil {
+		return false, fmt.Errorf("unable to get metadata of vm [%s]: [%w]", vm.VM.Name,
+			NewVCDErrorFromGovcd(err))
+	}
+	currentEntries := make(map[string]string)
+	for _, entry := range metadata.MetadataEntry {
+		if entry == nil || entry.TypedValue == nil || metadataEntryDomain(entry) != domain ||
+			!strings.HasPrefix(entry.Key, prefix) {
+			continue
+		}
+		currentEntries[entry.Key] = entry.TypedValue.Value
+	}
+
+	// SYSTEM entries are shown read-only to the users of the org, as they are written by the cluster
+	var entryDomain *metadataDomain = nil
+	if domain == MetadataDomainSystem {
+		entryDomain = &metadataDomain{
+			Visibility: "READONLY",
+			Domain:     MetadataDomainSystem,
+		}
+	}
+	changed := false
+	for key, value := range entries {
+		if currentValue, ok := currentEntries[key]; ok && currentValue == value {
+			continue
+		}
+		task, err := client.VCDClient.Client.ExecuteTaskRequest(vmMetadataURL(vm.VM.HREF, domain, key),
+			http.MethodPut, types.MimeMetaDataValue, "error adding metadata: %s", &metadataValue{
+				Xmlns:  types.XMLNamespaceVCloud,
+				Xsi:    types.XMLNamespaceXSI,
+				Domain: entryDomain,
+				TypedValue: &types.TypedValue{
+					XsiType: "MetadataStringValue",
+					Value:   value,
+				},
+			})
+		if err != nil {
+			return changed, fmt.Errorf("unable to set metadata [%s] of vm [%s]: [%w]", key, vm.VM.Name,
+				NewVCDErrorFromGovcd(err))
+		}
+		if err = client.waitForTask(ctx, task.Task.HREF, taskOperationUpdate); err != nil {
+			return changed, fmt.Errorf("unable to wait for metadata [%s] of vm [%s] to be set: [%w]",
+				key, vm.VM.Name, err)
+		}
+		changed = true
+	}
+	for key := range currentEntries {
+		if _, ok := entries[key]; ok {
+			continue
+		}
+		task, err := client.VCDClient.Client.ExecuteTaskRequest(vmMetadataURL(vm.VM.HREF, domain, key),
+			http.MethodDelete, "", "error deleting metadata: %s", nil)
+		if err != nil {
+			return changed, fmt.Errorf("unable to delete metadata [%s] of vm [%s]: [%w]", key, vm.VM.Name,
+				NewVCDErrorFromGovcd(err))
+		}
+		if err = client.waitForTask(ctx, task.Task.HREF, taskOperationDelete); err != nil {
+			return changed, fmt.Errorf("unable to wait for metadata [%s] of vm [%s] to be deleted: [%w]",
+				key, vm.VM.Name, err)
+		}
+		changed = true
+	}
+
+	return changed, nil
+}
+
+// vmUUIDFromHREF returns the ID of a VM, such as urn:vcloud:vm:<uuid>, from its href, which ends in vm-<uuid>
+func vmUUIDFromHREF(href string) (string, error) {
+	lastSegment := path.Base(strings.TrimSuffix(href, "/"))
+	if !strings.HasPrefix(lastSegment, vmHREFPrefix) || len(lastSegment) == len(vmHREFPrefix) {
+		return "", fmt.Errorf("href [%s] is not the href of a vm", href)
+	}
+
+	return VCDVMIDPrefix + strings.ToLower(strings.TrimPrefix(lastSegment, vmHREFPrefix)), nil
+}
+
+// ListClusterVMs lists all VMs selected by the VM selector of the client with the query API, which needs a
+// request per page of vmQueryPageSize VMs rather than per VM. The ID of each record is set from its href. The
+// client is expected to have a valid bearer token when this function is called.
+func (client *Client) ListClusterVMs() ([]*types.QueryResultVMRecordType, error) {
+	vmRecords, err := client.queryClusterVMs("")
+	if err != nil {
+		return nil, err
+	}
+	klog.Infof("Listed [%d] vms of vApps [%s]", len(vmRecords), client.ClusterVAppName)
+
+	return vmRecords, nil
+}
+
+// queryClusterVMs returns the VMs selected by the VM selector of the client that also match the encoded
+// extraFilter, if it is set
+func (client *Client) queryClusterVMs(extraFilter string) ([]*types.QueryResultVMRecordType, error) {
+	if client.VDC == nil || client.VDC.Vdc == nil {
+		return nil, fmt.Errorf("VDC [%s] has not been loaded by the client", client.ClusterOVDCName)
+	}
+	if client.vmSelector.isEmpty() {
+		return nil, fmt.Errorf("client has no vm selector")
+	}
+
+	queryType := client.VCDClient.Client.GetQueryType(types.QtVm)
+	filter := client.vmSelector.queryFilter(client.VDC.Vdc.HREF)
+	if extraFilter != "" {
+		filter = fmt.Sprintf("%s;%s", filter, extraFilter)
+	}
+	vmRecords := make([]*types.QueryResultVMRecordType, 0)
+	err := newPager(vmQueryPageSize, filter).forEachPage(context.Background(), func(ctx context.Context, page int32,
+		pageSize int32, filter optional.String) (int, int32, error) {
+		results, err := client.VCDClient.Client.QueryWithNotEncodedParams(nil, map[string]string{
+			"type":          queryType,
+			"filter":        filter.Value(),
+			"filterEncoded": "true",
+			"page":          strconv.Itoa(int(page)),
+			"pageSize":      strconv.Itoa(int(pageSize)),
+		})
+		if err != nil {
+			return 0, 0, fmt.Errorf("unable to query page [%d] of vms: [%w]", page, NewVCDErrorFromGovcd(err))
+		}
+
+		pageRecords := results.Results.VMRecord
+		if client.VCDClient.Client.IsSysAdmin {
+			pageRecords = results.Results.AdminVMRecord
+		}
+		for _, vmRecord := range pageRecords {
+			if vmRecord.VAppTemplate || !client.vmSelector.matchesVApp(vmRecord.ContainerName) {
+				continue
+			}
+			if vmRecord.ID, err = vmUUIDFromHREF(vmRecord.HREF); err != nil {
+				return 0, 0, fmt.Errorf("unable to get id of vm [%s]: [%v]", vmRecord.Name, err)
+			}
+			vmRecords = append(vmRecords, vmRecord)
+		}
+
+		// the query reports the total number of records rather than the number of pages
+		pageCount := (int32(results.Results.Total) + pageSize - 1) / pageSize
+		return len(pageRecords), pageCount, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to query vms of vApps [%s]: [%w]", client.ClusterVAppName, err)
 	}
 
-	return false
+	return vmRecords, nil
 }
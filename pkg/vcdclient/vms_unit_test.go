@@ -0,0 +1,43 @@
+/*
+   Copyright 2021 VMware, Inc.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package vcdclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVMUUIDFromHREF(t *testing.T) {
+
+	type TestCase struct {
+		HREF        string
+		UUID        string
+		ExpectError bool
+	}
+
+	testCaseList := []TestCase{
+		{"https://vcd.example.com/api/vApp/vm-1b2c3d4e-0000-4000-8000-000000000001",
+			"urn:vcloud:vm:1b2c3d4e-0000-4000-8000-000000000001", false},
+		{"https://vcd.example.com/api/vApp/vm-1B2C3D4E-0000-4000-8000-000000000001/",
+			"urn:vcloud:vm:1b2c3d4e-0000-4000-8000-000000000001", false},
+		{"https://vcd.example.com/api/vApp/vapp-1b2c3d4e-0000-4000-8000-000000000001", "", true},
+		{"https://vcd.example.com/api/vApp/vm-", "", true},
+		{"", "", true},
+	}
+
+	for _, tc := range testCaseList {
+		uuid, err := vmUUIDFromHREF(tc.HREF)
+		if tc.ExpectError {
+			assert.Error(t, err, "Expected error for href [%s]", tc.HREF)
+			continue
+		}
+		assert.NoError(t, err, "Unexpected error for href [%s]", tc.HREF)
+		assert.Equal(t, tc.UUID, uuid, "Unexpected uuid for href [%s]", tc.HREF)
+	}
+
+	return
+}